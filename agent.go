@@ -0,0 +1,526 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"filippo.io/age"
+)
+
+const (
+	agentSocketEnvVar = "AGE_EDIT_AGENT_SOCKET"
+	agentSocketName   = "agent.sock"
+	agentDialTimeout  = time.Second
+	agentTimeout      = 30 * time.Second
+
+	// recipientsDir is the directory under the state directory
+	// with the recipients of the identities files age-edit has read.
+	recipientsDir = "recipients"
+
+	agentOpInfo   = "info"
+	agentOpUnwrap = "unwrap"
+)
+
+// errAgentNoMatch is how the agent reports that none of its identities matched.
+const errAgentNoMatch = "no identity matched"
+
+// agentRequest is a request from age-edit to the identity agent.
+// Every connection carries one request and one response encoded as JSON.
+type agentRequest struct {
+	Op      string        `json:"op"`
+	Stanzas []*age.Stanza `json:"stanzas,omitempty"`
+}
+
+// agentResponse is the response of the identity agent.
+type agentResponse struct {
+	Error      string   `json:"error,omitempty"`
+	FileKey    []byte   `json:"file_key,omitempty"`
+	Identities string   `json:"identities,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// agentIdentity is an age identity that forwards unwrapping to the identity agent.
+type agentIdentity struct {
+	socket string
+}
+
+var _ age.Identity = &agentIdentity{}
+
+// defaultAgentSocket returns the path of the agent socket.
+func defaultAgentSocket() (string, error) {
+	if socket := os.Getenv(agentSocketEnvVar); socket != "" {
+		return socket, nil
+	}
+
+	dir, err := userRuntimeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, agentSocketName), nil
+}
+
+// checkAgentSocket checks that only the current user can have created the socket:
+// the socket and its directory must belong to the user, and other users must not have access to them.
+func checkAgentSocket(socket string) error {
+	if err := checkPrivate(filepath.Dir(socket)); err != nil {
+		return fmt.Errorf("unsafe agent socket directory: %w", err)
+	}
+
+	if err := checkPrivate(socket); err != nil {
+		return fmt.Errorf("unsafe agent socket: %w", err)
+	}
+
+	return nil
+}
+
+// agentCall sends a request to the agent and returns its response.
+func agentCall(socket string, req agentRequest) (agentResponse, error) {
+	var resp agentResponse
+
+	if err := checkAgentSocket(socket); err != nil {
+		return resp, err
+	}
+
+	conn, err := net.DialTimeout("unix", socket, agentDialTimeout)
+	if err != nil {
+		return resp, fmt.Errorf("failed to connect to agent: %w", err)
+	}
+	defer conn.Close()
+
+	if err := checkPeer(conn); err != nil {
+		return resp, fmt.Errorf("refusing to use agent: %w", err)
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, fmt.Errorf("failed to send request to agent: %w", err)
+	}
+
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, fmt.Errorf("failed to read response from agent: %w", err)
+	}
+
+	return resp, nil
+}
+
+// Unwrap asks the agent to unwrap the file key.
+func (i *agentIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	resp, err := agentCall(i.socket, agentRequest{Op: agentOpUnwrap, Stanzas: stanzas})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Error == errAgentNoMatch {
+		return nil, age.ErrIncorrectIdentity
+	}
+
+	if resp.Error != "" {
+		return nil, fmt.Errorf("agent: %s", resp.Error)
+	}
+
+	return resp.FileKey, nil
+}
+
+// agentInfo returns the identities file and recipients of the running agent.
+// It returns an error if no agent is running.
+func agentInfo(socket string) (agentResponse, error) {
+	resp, err := agentCall(socket, agentRequest{Op: agentOpInfo, Stanzas: nil})
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.Error != "" {
+		return resp, fmt.Errorf("agent: %s", resp.Error)
+	}
+
+	return resp, nil
+}
+
+// agentIdentities returns an identity backed by the agent
+// if an agent is running and holds the identities from the given file.
+// An empty path means the identities file of the agent.
+// The agent only unwraps file keys.
+// The recipients are those age-edit recorded when it last read the file itself,
+// so an agent can't make age-edit encrypt to other keys,
+// and a file that has changed since, like one with a new key, isn't used through the agent.
+// The second return value is false if the agent can't be used.
+func agentIdentities(path string) ([]age.Identity, []age.Recipient, bool) {
+	socket, err := defaultAgentSocket()
+	if err != nil {
+		return nil, nil, false
+	}
+
+	info, err := agentInfo(socket)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	if path == "" {
+		path = info.Identities
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil || absPath != info.Identities {
+		return nil, nil, false
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	sum := sha256.Sum256(data)
+	clear(data)
+
+	recipients, err := rememberedRecipients(sum[:])
+	if err != nil {
+		return nil, nil, false
+	}
+
+	return []age.Identity{newNamedIdentity(&agentIdentity{socket: socket}, "agent", socket)}, recipients, true
+}
+
+// recipientsPath returns where the recipients of a version of an identities file are recorded.
+func recipientsPath(sum []byte) (string, error) {
+	stateDir, err := userStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(stateDir, recipientsDir, hex.EncodeToString(sum)), nil
+}
+
+// rememberRecipients records the recipients of a version of an identities file
+// for the sessions that use the agent.
+// Only native X25519 recipients can be recorded, like the agent only supports native X25519 identities.
+func rememberRecipients(sum []byte, recipients []age.Recipient) error {
+	lines := []string{}
+
+	for _, recipient := range recipients {
+		x25519Recipient, ok := recipient.(*age.X25519Recipient)
+		if !ok {
+			return nil
+		}
+
+		lines = append(lines, x25519Recipient.String())
+	}
+
+	path, err := recipientsPath(sum)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), tempDirPerm); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, filePerm, false, func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+
+		return err
+	})
+}
+
+// rememberedRecipients returns the recipients recorded for a version of an identities file.
+func rememberedRecipients(sum []byte) ([]age.Recipient, error) {
+	path, err := recipientsPath(sum)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := []age.Recipient{}
+
+	for _, line := range strings.Fields(string(data)) {
+		recipient, err := age.ParseX25519Recipient(line)
+		if err != nil {
+			return nil, fmt.Errorf("malformed recipient in %q: %w", path, err)
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients in %q", path)
+	}
+
+	return recipients, nil
+}
+
+// openIdentities returns the identities from the agent if it holds the identities file
+// and loads the identities file otherwise.
+func openIdentities(path string, lockKeys bool) ([]age.Identity, []age.Recipient, error) {
+	if identities, recipients, ok := agentIdentities(path); ok {
+		return identities, recipients, nil
+	}
+
+	if path == "" {
+		return nil, nil, errors.New("no identities file given and no agent running")
+	}
+
+	return loadIdentities(path, lockKeys)
+}
+
+// agentAvailable reports whether an agent is running.
+func agentAvailable() bool {
+	_, _, ok := agentIdentities("")
+
+	return ok
+}
+
+// handleAgentConn answers a single request.
+// Processes of other users get no answer.
+func handleAgentConn(conn net.Conn, idsPath string, identities []*age.X25519Identity) {
+	defer conn.Close()
+
+	if err := checkPeer(conn); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: refused a connection:", err)
+
+		return
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	var req agentRequest
+
+	resp := agentResponse{}
+
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("malformed request: %v", err)
+		_ = json.NewEncoder(conn).Encode(resp)
+
+		return
+	}
+
+	switch req.Op {
+	case agentOpInfo:
+		resp.Identities = idsPath
+
+		for _, identity := range identities {
+			resp.Recipients = append(resp.Recipients, identity.Recipient().String())
+		}
+
+	case agentOpUnwrap:
+		resp.Error = errAgentNoMatch
+
+		for _, identity := range identities {
+			fileKey, err := identity.Unwrap(req.Stanzas)
+			if errors.Is(err, age.ErrIncorrectIdentity) {
+				continue
+			}
+
+			if err != nil {
+				resp.Error = err.Error()
+
+				break
+			}
+
+			resp.Error = ""
+			resp.FileKey = fileKey
+
+			break
+		}
+
+	default:
+		resp.Error = fmt.Sprintf("unknown operation %q", req.Op)
+	}
+
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// listenAgent creates the agent socket.
+// It refuses to replace the socket of a running agent and removes stale sockets.
+// The directory of the socket must be private to the user,
+// since MkdirAll keeps the owner and the mode of a directory that exists.
+func listenAgent(socket string) (net.Listener, error) {
+	dir := filepath.Dir(socket)
+
+	if err := os.MkdirAll(dir, tempDirPerm); err != nil {
+		return nil, err
+	}
+
+	if err := checkPrivate(dir); err != nil {
+		return nil, fmt.Errorf("unsafe agent socket directory: %w", err)
+	}
+
+	if _, err := agentInfo(socket); err == nil {
+		return nil, fmt.Errorf("an agent is already running on %q", socket)
+	}
+
+	_ = os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(socket, filePerm); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// agentCommand implements the "agent" subcommand.
+func agentCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultSocket, err := defaultAgentSocket()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	flag := sub.flagSet(
+		"Run an agent that holds the identities in locked memory and decrypts file keys for other age-edit processes. While the agent is running, age-edit uses it instead of reading the same identities file, so a passphrase-protected identities file only needs to be unlocked once. Only native X25519 identities are supported. The agent runs in the foreground until it is interrupted or its lifetime expires.",
+		fmt.Sprintf("  identities              identities file path (%s%s)\n", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+
+	lifetime := flag.Duration(
+		"lifetime",
+		0,
+		"exit after this much time (0 to run until interrupted)",
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	socket := flag.StringP(
+		"socket",
+		"s",
+		defaultSocket,
+		fmt.Sprintf("socket path (%v)", agentSocketEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	idsPath := identitiesFileDefault
+	if flag.NArg() == 1 {
+		idsPath = flag.Arg(0)
+	}
+
+	if idsPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file")
+
+		return exitBadUsage
+	}
+
+	absIdsPath, err := filepath.Abs(idsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	lockKeys := false
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			lockKeys = true
+		}
+	}
+
+	loaded, _, err := loadIdentities(idsPath, lockKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	identities := make([]*age.X25519Identity, 0, len(loaded))
+
+	for _, identity := range loaded {
+		x25519Identity, ok := unwrapIdentity(identity).(*age.X25519Identity)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Error: the agent only supports native X25519 identities")
+
+			return exitError
+		}
+
+		identities = append(identities, x25519Identity)
+	}
+
+	listener, err := listenAgent(*socket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+	defer os.Remove(*socket)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		if *lifetime > 0 {
+			select {
+			case <-stop:
+			case <-time.After(*lifetime):
+			}
+		} else {
+			<-stop
+		}
+
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "age-edit agent listening on %q\n", *socket)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return exitOK
+			}
+
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		go handleAgentConn(conn, absIdsPath, identities)
+	}
+}
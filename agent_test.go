@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// privateSocket returns a socket path in a directory only the user has access to,
+// like the agent requires.
+func privateSocket(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, agentSocketName)
+}
+
+func TestAgent(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := privateSocket(t)
+
+	listener, err := listenAgent(socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			if err != nil {
+				continue
+			}
+
+			go handleAgentConn(conn, "/ids", []*age.X25519Identity{identity})
+		}
+	}()
+
+	info, err := agentInfo(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Identities != "/ids" || len(info.Recipients) != 1 || info.Recipients[0] != identity.Recipient().String() {
+		t.Errorf("unexpected agent info: %+v", info)
+	}
+
+	// A second agent can't take over the socket.
+	if _, err := listenAgent(socket); err == nil {
+		t.Error("expected listening on the socket of a running agent to fail")
+	}
+
+	for _, tt := range []struct {
+		recipient age.Recipient
+		expectOk  bool
+	}{
+		{identity.Recipient(), true},
+		{otherIdentity.Recipient(), false},
+	} {
+		var encrypted bytes.Buffer
+
+		w, err := age.Encrypt(&encrypted, tt.recipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _ = io.WriteString(w, "agent test")
+		w.Close()
+
+		r, err := age.Decrypt(&encrypted, &agentIdentity{socket: socket})
+		if (err == nil) != tt.expectOk {
+			t.Fatalf("Decrypt() with agent error = %v, expected success %v", err, tt.expectOk)
+		}
+
+		if err != nil {
+			var noMatch *age.NoIdentityMatchError
+			if !errors.As(err, &noMatch) {
+				t.Errorf("expected NoIdentityMatchError, got %v", err)
+			}
+
+			continue
+		}
+
+		content, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != "agent test" {
+			t.Errorf("decrypted content is %q", content)
+		}
+	}
+}
+
+func TestAgentRecipients(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent answers with the recipient of a key that isn't in the identities file.
+	rogueIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(t.TempDir(), "ids.txt")
+	if err := os.WriteFile(idsPath, []byte(identity.String()+"\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := privateSocket(t)
+	t.Setenv(agentSocketEnvVar, socket)
+
+	listener, err := listenAgent(socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			if err != nil {
+				continue
+			}
+
+			go handleAgentConn(conn, idsPath, []*age.X25519Identity{rogueIdentity})
+		}
+	}()
+
+	// age-edit hasn't read the file itself yet.
+	if _, _, ok := agentIdentities(idsPath); ok {
+		t.Fatal("expected the agent not to be used without recorded recipients")
+	}
+
+	if _, _, err := loadIdentities(idsPath, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{idsPath, ""} {
+		_, recipients, ok := agentIdentities(path)
+		if !ok {
+			t.Fatalf("%q: expected the agent to be used", path)
+		}
+
+		if len(recipients) != 1 || recipientName(recipients[0]) != identity.Recipient().String() {
+			t.Errorf("%q: expected the recipient of the identities file, got %v", path, recipients)
+		}
+	}
+
+	// A new key in the file isn't known to the agent.
+	newIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(idsPath, []byte(identity.String()+"\n"+newIdentity.String()+"\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, ok := agentIdentities(idsPath); ok {
+		t.Error("expected the agent not to be used for a changed identities file")
+	}
+}
+
+func TestAgentSocketPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no POSIX permissions")
+	}
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	socket := filepath.Join(dir, agentSocketName)
+
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := listenAgent(socket); err == nil {
+		t.Error("expected an error for a directory other users can access")
+	}
+
+	if _, err := agentCall(socket, agentRequest{Op: agentOpInfo, Stanzas: nil}); err == nil || !strings.Contains(err.Error(), "unsafe") {
+		t.Errorf("expected an unsafe socket directory, got %v", err)
+	}
+
+	if err := os.Chmod(dir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := listenAgent(socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket: %v", err)
+	}
+	defer listener.Close()
+
+	if err := os.Chmod(socket, 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := agentCall(socket, agentRequest{Op: agentOpInfo, Stanzas: nil}); err == nil || !strings.Contains(err.Error(), "unsafe agent socket:") {
+		t.Errorf("expected an unsafe socket, got %v", err)
+	}
+}
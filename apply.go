@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+const defaultSedCommand = "sed"
+
+// applyOptions configures how a filter is applied to encrypted files.
+type applyOptions struct {
+	identities []age.Identity
+	recipients []age.Recipient
+
+	filterCmd  string
+	filterArgs []string
+
+	decodeCmd  string
+	decodeArgs []string
+	encodeCmd  string
+	encodeArgs []string
+
+	history historyOptions
+	dryRun  bool
+
+	lock    bool
+	locking lockOptions
+}
+
+// applyFile runs the plaintext of an encrypted file through a filter
+// and encrypts the output over the file if it differs.
+// The file is locked for the whole operation, replaced atomically,
+// and keeps its format and permissions.
+// The plaintext is kept in memory and never written to disk.
+// It returns whether the filter changed the plaintext.
+func applyFile(encPath string, opts applyOptions) (bool, error) {
+	if opts.lock && !opts.dryRun {
+		fileLock := newFileLock(encPath, opts.locking)
+
+		locked, err := fileLock.TryLock()
+		if err != nil {
+			return false, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if !locked {
+			return false, errors.New("encrypted file is locked")
+		}
+
+		defer func() {
+			_ = fileLock.Unlock()
+		}()
+	}
+
+	info, err := os.Stat(encPath)
+	if err != nil {
+		return false, err
+	}
+
+	armored, err := isArmored(encPath)
+	if err != nil {
+		return false, err
+	}
+
+	var before bytes.Buffer
+
+	if err := decryptToWriter(encPath, &before, opts.decodeCmd, opts.decodeArgs, opts.identities...); err != nil {
+		return false, err
+	}
+
+	var after bytes.Buffer
+
+	if err := runFilter(opts.filterCmd, opts.filterArgs, bytes.NewReader(before.Bytes()), &after); err != nil {
+		return false, fmt.Errorf("filter failed: %w", err)
+	}
+
+	if bytes.Equal(before.Bytes(), after.Bytes()) {
+		return false, nil
+	}
+
+	if opts.dryRun {
+		return true, nil
+	}
+
+	if opts.history.keep > 0 {
+		if _, err := archiveVersion(encPath, opts.history); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: failed to keep the previous version: %v\n", encPath, err)
+		}
+	}
+
+	return true, writeFileAtomic(encPath, info.Mode().Perm(), true, func(w io.Writer) error {
+		return encryptStream(&after, w, armored, opts.encodeCmd, opts.encodeArgs, opts.recipients...)
+	})
+}
+
+// applyCommand implements the "apply" subcommand.
+func applyCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	history, err := envHistoryOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Transform the plaintext of encrypted files without an editor: with sed(1) expressions or with a filter command that reads the plaintext from standard input and writes the result to standard output. Files whose plaintext changes are encrypted again under lock and replaced atomically; they keep their format. Directories are searched recursively for files that match the pattern, and the versions in the history are skipped. A failure in one file doesn't stop the others.",
+		"  path                    encrypted file or directory\n",
+	)
+
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	dryRun := flag.BoolP(
+		"dry-run",
+		"n",
+		false,
+		"report the files that would change without changing them",
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	filter := flag.StringP(
+		"exec",
+		"x",
+		"",
+		"filter command to run on the plaintext",
+	)
+	expressions := flag.StringArrayP(
+		"expression",
+		"e",
+		[]string{},
+		"sed expression to run on the plaintext (repeatable)",
+	)
+	keep := flag.Int(
+		"history",
+		history.keep,
+		fmt.Sprintf("keep a number of previous encrypted versions of each file next to it (0 to disable, %v)", historyEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted files (negated %v)", lockEnvVar),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	pattern := flag.StringP(
+		"pattern",
+		"p",
+		defaultPathPattern,
+		"file name pattern to match in directories",
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if (len(*expressions) > 0) == (*filter != "") {
+		fmt.Fprintln(os.Stderr, "Error: need either sed expressions or a filter command")
+
+		return exitBadUsage
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one encrypted file or directory")
+
+		return exitBadUsage
+	}
+
+	if *keep < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --history must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *idsPath == "" && !agentAvailable() {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file")
+
+		return exitBadUsage
+	}
+
+	opts := applyOptions{
+		identities: []age.Identity{},
+		recipients: []age.Recipient{},
+
+		filterCmd:  defaultSedCommand,
+		filterArgs: []string{},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+
+		history: history,
+		dryRun:  *dryRun,
+
+		lock:    !*noLock,
+		locking: locking,
+	}
+
+	opts.history.keep = *keep
+
+	for _, expression := range *expressions {
+		opts.filterArgs = append(opts.filterArgs, "-e", expression)
+	}
+
+	commands := []struct {
+		value string
+		name  string
+		cmd   *string
+		args  *[]string
+	}{
+		{*filter, "filter", &opts.filterCmd, &opts.filterArgs},
+		{*decode, "decode", &opts.decodeCmd, &opts.decodeArgs},
+		{*encode, "encode", &opts.encodeCmd, &opts.encodeArgs},
+	}
+
+	for _, command := range commands {
+		if command.value == "" {
+			continue
+		}
+
+		args, err := shlex.Split(command.value, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: failed to split %s command\n", command.name)
+
+			return exitBadUsage
+		}
+
+		*command.cmd = args[0]
+		*command.args = args[1:]
+	}
+
+	deps := []dependency{
+		{
+			role:    "filter",
+			command: opts.filterCmd,
+			hint:    "install it or fix --exec",
+		},
+		decodeDependency(opts.decodeCmd),
+		encodeDependency(opts.encodeCmd),
+	}
+
+	if err := checkDependencies(deps...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	paths, err := collectPaths(flag.Args(), *pattern)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	lockKeys := false
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			lockKeys = true
+		}
+	}
+
+	identities, identityRecipients, err := openIdentities(*idsPath, lockKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	opts.identities = orderIdentities(identities, *prefer)
+	opts.recipients = identityRecipients
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		opts.recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+	}
+
+	code := exitOK
+	verb := "changed"
+
+	if *dryRun {
+		verb = "would change"
+	}
+
+	for _, path := range paths {
+		if inHistory(path) {
+			continue
+		}
+
+		resetMatches(opts.identities)
+
+		changed, err := applyFile(path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+
+			code = exitError
+
+			continue
+		}
+
+		if changed {
+			fmt.Printf("%s %s\n", verb, path)
+		}
+	}
+
+	return code
+}
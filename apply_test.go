@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestApplyFile(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath(defaultSedCommand); err != nil {
+		t.Skip("sed not found")
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(t.TempDir(), "config.age")
+
+	if err := encryptNewFile(strings.NewReader("host: old\n"), encPath, false, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := applyOptions{
+		identities: []age.Identity{identity},
+		recipients: []age.Recipient{identity.Recipient()},
+
+		filterCmd:  defaultSedCommand,
+		filterArgs: []string{"-e", "s/old/new/"},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+
+		history: historyOptions{keep: 0, maxAge: 0, store: historyStoreFile},
+		dryRun:  true,
+
+		lock:    true,
+		locking: lockOptions{strategy: lockStrategyFlock, expiry: defaultLockExpiry},
+	}
+
+	tests := []struct {
+		dryRun      bool
+		wantChanged bool
+		want        string
+	}{
+		{true, true, "host: old\n"},
+		{false, true, "host: new\n"},
+		{false, false, "host: new\n"},
+	}
+
+	for _, test := range tests {
+		opts.dryRun = test.dryRun
+
+		changed, err := applyFile(encPath, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+
+		if err := decryptToWriter(encPath, &out, "", []string{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		if changed != test.wantChanged || out.String() != test.want {
+			t.Errorf("dry run %v: got changed %v, contents %q", test.dryRun, changed, out.String())
+		}
+	}
+
+	armored, err := isArmored(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !armored {
+		t.Error("expected the file to stay armored")
+	}
+
+	opts.filterArgs = []string{"-e", "s/unterminated"}
+
+	if _, err := applyFile(encPath, opts); err == nil {
+		t.Error("expected an error from a failing filter")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveSuffix marks encrypted files that hold a directory, like "certs.tar.age".
+const archiveSuffix = ".tar"
+
+// archiveDirTime is the modification time of every directory in an archive.
+var archiveDirTime = time.Unix(0, 0)
+
+// isArchive reports whether an encrypted file holds a directory as a tar archive.
+func isArchive(encPath string) bool {
+	return strings.HasSuffix(getRoot(encPath), archiveSuffix)
+}
+
+// packArchive writes a directory tree to w as a tar archive.
+// The archive depends only on the names, contents, permissions, and modification times of the files in the tree,
+// so packing an unchanged tree gives the same bytes, and changes can be detected by a checksum.
+// Owners and access times are left out.
+// Directories get the same time, archiveDirTime,
+// since an editor that creates and removes a swap file in a directory changes its time but not the contents.
+func packArchive(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		header := &tar.Header{ //nolint:exhaustruct
+			Name:    filepath.ToSlash(rel),
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: info.ModTime().Truncate(time.Second),
+		}
+
+		switch {
+		case info.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+			header.ModTime = archiveDirTime
+
+		case info.Mode().IsRegular():
+			header.Typeflag = tar.TypeReg
+			header.Size = info.Size()
+
+		case info.Mode()&fs.ModeSymlink != 0:
+			header.Typeflag = tar.TypeSymlink
+
+			if header.Linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("can't archive %q: not a file, a directory, or a symlink", rel)
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// unpackArchive extracts a tar archive into a new directory.
+// It accepts files, directories, and symlinks,
+// and refuses entries that would be written outside the directory or through a symlink.
+func unpackArchive(r io.Reader, dir string) error {
+	if err := os.Mkdir(dir, tempDirPerm); err != nil {
+		return err
+	}
+
+	// Directories get their times after their contents are written.
+	dirTimes := map[string]time.Time{}
+
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		name := filepath.FromSlash(strings.TrimSuffix(header.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q is outside the directory", header.Name)
+		}
+
+		path := filepath.Join(dir, name)
+
+		if err := checkNoSymlinks(dir, filepath.Dir(name)); err != nil {
+			return err
+		}
+
+		// Archives don't always have entries for the directories of their files.
+		if err := os.MkdirAll(filepath.Dir(path), tempDirPerm); err != nil {
+			return err
+		}
+
+		perm := os.FileMode(header.Mode).Perm() //nolint:gosec
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			// The owner keeps full access, so the editor can add files and the directory can be removed.
+			if err := os.Mkdir(path, perm|0o700); err != nil && !errors.Is(err, os.ErrExist) { //nolint:mnd
+				return err
+			}
+
+			// Archives from before archiveDirTime have the times of their directories.
+			if !header.ModTime.Equal(archiveDirTime) {
+				dirTimes[path] = header.ModTime
+			}
+
+			continue
+
+		case tar.TypeReg:
+			if err := writeArchiveFile(path, perm, tr); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+
+			continue
+
+		default:
+			return fmt.Errorf("archive entry %q has an unsupported type", header.Name)
+		}
+
+		if err := os.Chtimes(path, header.ModTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+
+	for path, modTime := range dirTimes {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkNoSymlinks confirms that no directory between dir and dir/rel is a symlink,
+// so an archive can't create a symlink and then write through it.
+func checkNoSymlinks(dir, rel string) error {
+	path := dir
+
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." || part == "" {
+			continue
+		}
+
+		path = filepath.Join(path, part)
+
+		info, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("archive writes through the symlink %q", path)
+		}
+	}
+
+	return nil
+}
+
+// writeArchiveFile writes a file from an archive.
+// It refuses to replace an existing file, so duplicate entries can't overwrite each other.
+func writeArchiveFile(path string, perm os.FileMode, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil { //nolint:gosec
+		f.Close()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// The umask may have removed permissions.
+	return os.Chmod(path, perm)
+}
+
+// makeTreeReadOnly removes write permissions from the files in a tree for read-only mode.
+// Directories stay writable, so the tree can be removed afterward.
+func makeTreeReadOnly(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		return os.Chmod(path, fileReadOnlyPerm)
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+
+	if err := os.MkdirAll(filepath.Join(src, "sub", "empty"), tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("a\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "sub", "run.sh"), []byte("#! /bin/sh\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink("../a.txt", filepath.Join(src, "sub", "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first bytes.Buffer
+
+	if err := packArchive(src, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(tempDir, "dst")
+
+	if err := unpackArchive(bytes.NewReader(first.Bytes()), dst); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "sub", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "#! /bin/sh\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "sub", "empty")); err != nil {
+		t.Error("empty directory wasn't unpacked:", err)
+	}
+
+	// Packing the unpacked tree must give the same archive, or every session would look like a change.
+	var second bytes.Buffer
+
+	if err := packArchive(dst, &second); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("packing the unpacked tree gave a different archive")
+	}
+
+	// An editor creates and removes a swap file in a directory, which changes its time.
+	swapPath := filepath.Join(dst, "sub", ".run.sh.swp")
+	if err := os.WriteFile(swapPath, []byte{}, filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(swapPath); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dst, "sub"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	var third bytes.Buffer
+
+	if err := packArchive(dst, &third); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first.Bytes(), third.Bytes()) {
+		t.Error("a new time of a directory gave a different archive")
+	}
+}
+
+func TestUnpackArchiveUnsafe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{
+			"parent",
+			[]*tar.Header{
+				{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o600},
+			},
+		},
+		{
+			"absolute",
+			[]*tar.Header{
+				{Name: "/tmp/evil", Typeflag: tar.TypeReg, Mode: 0o600},
+			},
+		},
+		{
+			"through symlink",
+			[]*tar.Header{
+				{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0o777},
+				{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0o600},
+			},
+		},
+		{
+			"duplicate",
+			[]*tar.Header{
+				{Name: "file", Typeflag: tar.TypeReg, Mode: 0o600},
+				{Name: "file", Typeflag: tar.TypeReg, Mode: 0o600},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var archive bytes.Buffer
+
+			tw := tar.NewWriter(&archive)
+
+			for _, header := range test.headers {
+				header.ModTime = time.Unix(0, 0)
+
+				if err := tw.WriteHeader(header); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			tempDir := t.TempDir()
+
+			if err := unpackArchive(&archive, filepath.Join(tempDir, "dst")); err == nil {
+				t.Error("expected an error")
+			}
+
+			if _, err := os.Lstat(filepath.Join(tempDir, "evil")); err == nil {
+				t.Error("archive wrote outside the directory")
+			}
+		})
+	}
+}
+
+func TestEditArchive(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	editorPath := filepath.Join(tempDir, "test-editor")
+	if runtime.GOOS == "windows" {
+		editorPath += ".exe"
+	}
+
+	if err := exec.Command("go", "build", "-o", editorPath, "./test/edit").Run(); err != nil {
+		t.Fatalf("failed to build test/edit binary: %v", err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idFilePath := filepath.Join(tempDir, "id")
+	if err := os.WriteFile(idFilePath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(tempDir, "dir.tar.age")
+
+	for range 2 {
+		editTempDir, err := edit(config{
+			idsPath:       idFilePath,
+			encPath:       encPath,
+			tempDirPrefix: t.TempDir(),
+
+			command: editorPath,
+			args:    []string{},
+		})
+		if editTempDir != "" {
+			defer os.RemoveAll(editTempDir)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+
+	if err := decryptToWriter(encPath, &archive, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(tempDir, "dst")
+
+	if err := unpackArchive(&archive, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dst, "edit.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "edit\nedit\n" {
+		t.Errorf("expected %q, got %q", "edit\nedit\n", content)
+	}
+}
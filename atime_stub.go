@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime can't tell the access time of a file on this platform.
+func accessTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
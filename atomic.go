@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// syncDir flushes a directory to disk, so a file renamed into it survives a power loss.
+// Windows can't sync directories, and NTFS journals renames, so it does nothing there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// writeFileAtomic replaces a file with the output of write.
+// It writes to a temporary file in the same directory
+// and renames it over the destination,
+// so the destination is never left partially written.
+// With fsync, it flushes the new file and then the directory to disk,
+// so a power loss right after it returns can't leave an empty or torn file.
+// The new file gets perm and the owner, group, and extended attributes of the file it replaces.
+// A symlink keeps pointing to the replaced file.
+// A file in a directory where the user can't create files is rewritten in place instead.
+func writeFileAtomic(path string, perm os.FileMode, fsync bool, write func(w io.Writer) error) error {
+	// Renaming over a symlink would replace the link, so the file it points to is replaced instead.
+	path, err := resolveSymlink(path)
+	if err != nil {
+		return err
+	}
+
+	return writeTempAndRename(path, perm, fsync, true, write)
+}
+
+// writeNewFileAtomic writes a new file like writeFileAtomic.
+// It fails with an error that matches os.ErrExist if a file or a symlink exists at the path
+// when the new file is moved into place, so it never replaces a file created in the meantime.
+func writeNewFileAtomic(path string, perm os.FileMode, fsync bool, write func(w io.Writer) error) error {
+	return writeTempAndRename(path, perm, fsync, false, write)
+}
+
+// writeTempAndRename writes a temporary file next to path and renames it to path.
+// If replace is false, the rename fails if path exists.
+func writeTempAndRename(path string, perm os.FileMode, fsync, replace bool, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if errors.Is(err, os.ErrPermission) && replace {
+		if _, statErr := os.Stat(path); statErr == nil {
+			return writeOutsideAndRewrite(path, fsync, write)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tempPath := f.Name()
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	if err := write(f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// A replaced file keeps its owner and extended attributes,
+	// so files managed by other tools don't change after an edit.
+	// When the new file can't get the owner, the old file is rewritten in place instead,
+	// which keeps the owner at the cost of atomicity.
+	if info, err := os.Stat(path); err == nil && replace {
+		err := copyOwner(tempPath, info)
+		if errors.Is(err, errOwnerNotCopied) {
+			return rewriteInPlace(path, tempPath, fsync)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := copyXattrs(path, tempPath); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
+
+	rename := os.Rename
+	if !replace {
+		rename = renameNoReplace
+	}
+
+	if err := rename(tempPath, path); err != nil {
+		return err
+	}
+
+	renamed = true
+
+	if fsync {
+		return syncDir(dir)
+	}
+
+	return nil
+}
+
+// errOwnerNotCopied means that a new file can't get the owner or the group of the file it replaces.
+var errOwnerNotCopied = errors.New("can't give the file the owner and the group of the old one")
+
+// rewriteInPlace copies a complete temporary file over the contents of a file
+// whose owner a replacement can't keep.
+// A crash during the copy can leave the file partially written,
+// but a failing filter can't, since the temporary file is complete before the copy starts.
+func rewriteInPlace(path, tempPath string, fsync bool) error {
+	in, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+
+	if err == nil && fsync {
+		err = out.Sync()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// writeOutsideAndRewrite saves a writable file in a directory where the user can't create files.
+// The new contents go to a temporary file in the system temporary directory,
+// which is then copied over the file like in rewriteInPlace.
+func writeOutsideAndRewrite(path string, fsync bool, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp("", "age-edit-"+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return rewriteInPlace(path, f.Name(), fsync)
+}
+
+// linkNoReplace moves a file to a path that must not exist with a hard link,
+// which fails if the path exists, unlike a rename.
+// The file is in place once it is linked, so failing to remove the old name isn't an error.
+func linkNoReplace(oldPath, newPath string) error {
+	if err := os.Link(oldPath, newPath); err != nil {
+		return err
+	}
+
+	_ = os.Remove(oldPath)
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	for _, fsync := range []bool{true, false} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "secret.age")
+
+		err := writeFileAtomic(path, 0o600, fsync, func(w io.Writer) error {
+			_, err := io.WriteString(w, "data")
+
+			return err
+		})
+		if err != nil {
+			t.Fatalf("fsync %v: %v", fsync, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != "data" {
+			t.Errorf("fsync %v: expected %q, got %q", fsync, "data", data)
+		}
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	t.Parallel()
+
+	if err := syncDir(t.TempDir()); err != nil {
+		t.Errorf("syncDir() failed: %v", err)
+	}
+}
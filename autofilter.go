@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// sniffLength is how much of the plaintext age-edit reads to recognize its format.
+	sniffLength = 512
+	// tarMagicOffset is where a POSIX tar archive has its magic bytes.
+	tarMagicOffset = 257
+)
+
+// tarMagic marks a POSIX tar archive.
+var tarMagic = []byte("ustar")
+
+// autoFilter is a compression format that age-edit recognizes by the magic bytes of the plaintext
+// and the filters that decompress it for editing and compress it again when saving.
+type autoFilter struct {
+	name       string
+	magic      []byte
+	decodeCmd  string
+	decodeArgs []string
+	encodeCmd  string
+	encodeArgs []string
+}
+
+// autoFilters are the formats age-edit recognizes.
+// They all have a built-in filter, so they don't need external commands.
+var autoFilters = []autoFilter{
+	{
+		name:       "gzip",
+		magic:      []byte{0x1f, 0x8b},
+		decodeCmd:  builtinFilterPrefix + "gzip",
+		decodeArgs: []string{"-d"},
+		encodeCmd:  builtinFilterPrefix + "gzip",
+		encodeArgs: []string{},
+	},
+	{
+		name:       "xz",
+		magic:      []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		decodeCmd:  builtinFilterPrefix + "xz",
+		decodeArgs: []string{"-d"},
+		encodeCmd:  builtinFilterPrefix + "xz",
+		encodeArgs: []string{},
+	},
+	{
+		name:       "Zstandard",
+		magic:      []byte{0x28, 0xb5, 0x2f, 0xfd},
+		decodeCmd:  builtinFilterPrefix + "zstd",
+		decodeArgs: []string{"-d"},
+		encodeCmd:  builtinFilterPrefix + "zstd",
+		encodeArgs: []string{},
+	},
+}
+
+// sniffFile reads the start of a file to recognize its format.
+func sniffFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, sniffLength)
+
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+
+	return header[:n], nil
+}
+
+// detectAutoFilter returns the compression format of data that starts with header.
+func detectAutoFilter(header []byte) (autoFilter, bool) {
+	for _, filter := range autoFilters {
+		if bytes.HasPrefix(header, filter.magic) {
+			return filter, true
+		}
+	}
+
+	return autoFilter{}, false //nolint:exhaustruct
+}
+
+// isTar reports whether data that starts with header is a tar archive.
+func isTar(header []byte) bool {
+	return len(header) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic)
+}
+
+// archiveDir names the tree of a tar archive that age-edit has recognized by its content,
+// like "backup" for "backup.tar.gz" and "backup.d" for "backup".
+func archiveDir(tempFile string) string {
+	name := filepath.Base(tempFile)
+	trimmed := name
+
+	for _, ext := range []string{".gz", ".xz", ".zst", archiveSuffix} {
+		trimmed = strings.TrimSuffix(trimmed, ext)
+	}
+
+	if trimmed == name || trimmed == "" {
+		return tempFile + ".d"
+	}
+
+	return filepath.Join(filepath.Dir(tempFile), trimmed)
+}
+
+// decodeInPlace runs a decode filter on a file and replaces the file with the output.
+// The input is shredded like the rest of the plaintext.
+func decodeInPlace(path, command string, args []string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(path), ".age-edit-decoded-*")
+	if err != nil {
+		in.Close()
+
+		return err
+	}
+
+	err = runFilter(command, args, in, out)
+	in.Close()
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = shredTree(path)
+	}
+
+	if err == nil {
+		err = os.Rename(out.Name(), path)
+	}
+
+	if err != nil {
+		_ = shredTree(out.Name())
+
+		return err
+	}
+
+	return nil
+}
+
+// applyAutoFilter recognizes a compressed plaintext by its magic bytes and decompresses it,
+// so saves compress it again with the same format.
+// A tar archive, compressed or not, opens as a directory like a ".tar.age" file.
+func (f *editFile) applyAutoFilter() error {
+	header, err := sniffFile(f.tempFile)
+	if err != nil {
+		return err
+	}
+
+	if filter, ok := detectAutoFilter(header); ok {
+		encodeArgs := f.cfg.compression.filterArgs(filter.encodeCmd, filter.encodeArgs)
+		if err := checkFilterArgs(filter.encodeCmd, encodeArgs); err != nil {
+			return fmt.Errorf("can't compress %q again with %s: %w", f.cfg.encPath, filter.name, err)
+		}
+
+		if err := decodeInPlace(f.tempFile, filter.decodeCmd, filter.decodeArgs); err != nil {
+			return fmt.Errorf("failed to decompress %q with %s: %w", f.cfg.encPath, filter.name, err)
+		}
+
+		f.cfg.decodeCmd, f.cfg.decodeArgs = filter.decodeCmd, filter.decodeArgs
+		f.cfg.encodeCmd, f.cfg.encodeArgs = filter.encodeCmd, encodeArgs
+
+		if f.cfg.verbose {
+			fmt.Fprintf(os.Stderr, "Decompressed %q with %s; saving compresses it again\n", f.cfg.encPath, filter.name)
+		}
+
+		header, err = sniffFile(f.tempFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.dir != "" || !isTar(header) {
+		return nil
+	}
+
+	if f.cfg.confirmSave || f.cfg.watch {
+		fmt.Fprintf(os.Stderr, "Warning: %q is a tar archive, but --confirm-save and --watch don't work with archives, so it opens as a file\n", f.cfg.encPath)
+
+		return nil
+	}
+
+	f.dir = archiveDir(f.tempFile)
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestArchiveDir(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"backup.tar.gz":  "backup",
+		"backup.tar.zst": "backup",
+		"backup.tar.xz":  "backup",
+		"backup.tar":     "backup",
+		"backup":         "backup.d",
+		".tar":           ".tar.d",
+	}
+
+	for name, expected := range tests {
+		dir := filepath.Join("tmp", "session")
+		if got := archiveDir(filepath.Join(dir, name)); got != filepath.Join(dir, expected) {
+			t.Errorf("archiveDir(%q): expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func TestAutoFilter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.Bytes()
+	}
+
+	compressed := func(command string, data []byte) []byte {
+		var buf bytes.Buffer
+
+		if err := runBuiltinFilter(command, []string{}, bytes.NewReader(data), &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.Bytes()
+	}
+
+	var archive bytes.Buffer
+
+	tw := tar.NewWriter(&archive)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: filePerm, Size: 2}); err != nil { //nolint:exhaustruct
+		t.Fatal(err)
+	}
+
+	if _, err := tw.Write([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The editor appends a line to the file or to a.txt in the directory.
+	script := `if [ -d "$1" ]; then echo b >> "$1/a.txt"; else echo b >> "$1"; fi`
+
+	for name, plaintext := range map[string][]byte{
+		"notes.md.gz.age":    gzipped([]byte("a\n")),
+		"backup.tar.gz.age":  gzipped(archive.Bytes()),
+		"backup-tar.gz.age":  gzipped(archive.Bytes()),
+		"notes.md.xz.age":    compressed("builtin:xz", []byte("a\n")),
+		"backup.tar.zst.age": compressed("builtin:zstd", archive.Bytes()),
+		"uncompressed.age":   []byte("a\n"),
+		"uncompressed-2.age": archive.Bytes(),
+	} {
+		plainPath := filepath.Join(tempDir, name+".plain")
+		encPath := filepath.Join(tempDir, name)
+
+		if err := os.WriteFile(plainPath, plaintext, filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encryptToFile(plainPath, encPath, false, false, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+
+		editTempDir, err := edit(config{
+			idsPath:       idsPath,
+			encPath:       encPath,
+			tempDirPrefix: t.TempDir(),
+			autoFilter:    true,
+
+			command: "sh",
+			args:    []string{"-c", script, "sh"},
+		})
+		if editTempDir != "" {
+			defer os.RemoveAll(editTempDir)
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var saved bytes.Buffer
+
+		if err := decryptToWriter(encPath, &saved, "", []string{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		data := saved.Bytes()
+
+		if filter, ok := detectAutoFilter(plaintext); ok {
+			if !bytes.HasPrefix(data, filter.magic) {
+				t.Errorf("%s: expected the saved file to be compressed again", name)
+
+				continue
+			}
+
+			var decompressed bytes.Buffer
+
+			if err := runBuiltinFilter(filter.decodeCmd, filter.decodeArgs, bytes.NewReader(data), &decompressed); err != nil {
+				t.Fatal(err)
+			}
+
+			data = decompressed.Bytes()
+		}
+
+		if isTar(data) {
+			tr := tar.NewReader(bytes.NewReader(data))
+			if _, err := tr.Next(); err != nil {
+				t.Fatal(err)
+			}
+
+			var content bytes.Buffer
+			if _, err := content.ReadFrom(tr); err != nil {
+				t.Fatal(err)
+			}
+
+			data = content.Bytes()
+		}
+
+		if string(data) != "a\nb\n" {
+			t.Errorf("%s: expected the edited text, got %q", name, data)
+		}
+	}
+}
+
+func TestAutoFilterUnsupportedArchive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// age-edit doesn't unpack hard links.
+	var archive bytes.Buffer
+
+	tw := tar.NewWriter(&archive)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: filePerm, Size: 2}); err != nil { //nolint:exhaustruct
+		t.Fatal(err)
+	}
+
+	if _, err := tw.Write([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tw.WriteHeader(&tar.Header{Name: "b.txt", Typeflag: tar.TypeLink, Linkname: "a.txt", Mode: filePerm}); err != nil { //nolint:exhaustruct
+		t.Fatal(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "backup.plain")
+	encPath := filepath.Join(tempDir, "backup.age")
+
+	if err := os.WriteFile(plainPath, archive.Bytes(), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, false, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive opens as a file, so the editor sees its bytes.
+	editTempDir, err := edit(config{
+		idsPath:       idsPath,
+		encPath:       encPath,
+		tempDirPrefix: t.TempDir(),
+		autoFilter:    true,
+
+		command: "sh",
+		args:    []string{"-c", `[ -f "$1" ] && printf x >> "$1"`, "sh"},
+	})
+	if editTempDir != "" {
+		defer os.RemoveAll(editTempDir)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var saved bytes.Buffer
+
+	if err := decryptToWriter(encPath, &saved, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(saved.Bytes(), append(archive.Bytes(), 'x')) {
+		t.Error("expected the archive to be saved as the edited bytes")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// autosave calls the save function at an interval until the returned function is called.
+// The save function should only write when the file has changed.
+// A failure is reported once, and so is the next successful save.
+func autosave(interval time.Duration, save func() error) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	var failing atomic.Bool
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+			}
+
+			err := save()
+
+			switch {
+			case err != nil && !failing.Swap(true):
+				fmt.Fprintf(os.Stderr, "\r\007age-edit: autosave failed: %v\n", err)
+
+			case err == nil && failing.Swap(false):
+				fmt.Fprintln(os.Stderr, "\r\007age-edit: autosave works again")
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAutosave(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	stop := autosave(10*time.Millisecond, func() error {
+		calls.Add(1)
+
+		return nil
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stop()
+
+	stopped := calls.Load()
+	if stopped < 3 {
+		t.Fatalf("expected at least 3 saves, got %d", stopped)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if calls.Load() > stopped+1 {
+		t.Errorf("saves continued after stop: %d then %d", stopped, calls.Load())
+	}
+}
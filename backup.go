@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+const backupSuffix = ".bak"
+
+// backupPath returns the path of a backup of an encrypted file.
+// With a single backup, it is "file.age.bak".
+// With more, backups are numbered from the newest, like "file.age.~1~".
+func backupPath(encPath string, n, keep int) string {
+	if keep == 1 {
+		return encPath + backupSuffix
+	}
+
+	return fmt.Sprintf("%s.~%d~", encPath, n)
+}
+
+// backupFile copies an encrypted file to its newest backup before it is replaced.
+// It shifts the numbered backups, so at most keep backups remain.
+// Only the ciphertext is copied, and the backup keeps the modification time of the file.
+// It returns the path of the backup or an empty string if the file doesn't exist yet.
+func backupFile(encPath string, keep int, fsync bool) (string, error) {
+	in, err := os.Open(encPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if keep > 1 {
+		err := os.Remove(backupPath(encPath, keep, keep))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		for n := keep - 1; n >= 1; n-- {
+			err := os.Rename(backupPath(encPath, n, keep), backupPath(encPath, n+1, keep))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+
+	path := backupPath(encPath, 1, keep)
+
+	err = writeFileAtomic(path, info.Mode().Perm(), fsync, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+
+		return err
+	})
+	if err == nil {
+		err = os.Chtimes(path, info.ModTime(), info.ModTime())
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to back up %q: %w", encPath, err)
+	}
+
+	return path, nil
+}
+
+// backupFiles returns the existing backups of an encrypted file:
+// the single backup followed by the numbered backups from the newest.
+func backupFiles(encPath string) ([]string, error) {
+	dir, name := filepath.Split(encPath)
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	numbered := regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `\.~([1-9]\d*)~$`)
+
+	single := []string{}
+	numbers := []int{}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		if entry.Name() == name+backupSuffix {
+			single = append(single, backupPath(encPath, 1, 1))
+
+			continue
+		}
+
+		match := numbered.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		n, err := strconv.Atoi(match[1])
+		if err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+
+	slices.Sort(numbers)
+
+	backups := single
+	for _, n := range numbers {
+		backups = append(backups, backupPath(encPath, n, 0))
+	}
+
+	return backups, nil
+}
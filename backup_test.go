@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBackupFile(t *testing.T) {
+	t.Parallel()
+
+	encPath := filepath.Join(t.TempDir(), "secret.txt.age")
+
+	path, err := backupFile(encPath, 3, true)
+	if err != nil || path != "" {
+		t.Fatalf("backupFile() of a missing file returned %q, %v", path, err)
+	}
+
+	for _, content := range []string{"v1", "v2", "v3", "v4"} {
+		if err := os.WriteFile(encPath, []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := backupFile(encPath, 3, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := backupFiles(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{encPath + ".~1~", encPath + ".~2~", encPath + ".~3~"}
+	if !slices.Equal(backups, expected) {
+		t.Fatalf("backupFiles() returned %v, expected %v", backups, expected)
+	}
+
+	for i, content := range []string{"v4", "v3", "v2"} {
+		data, err := os.ReadFile(backups[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != content {
+			t.Errorf("expected %q in %s, got %q", content, backups[i], data)
+		}
+	}
+}
+
+func TestBackupFileSingle(t *testing.T) {
+	t.Parallel()
+
+	encPath := filepath.Join(t.TempDir(), "secret.txt.age")
+
+	for _, content := range []string{"v1", "v2"} {
+		if err := os.WriteFile(encPath, []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		path, err := backupFile(encPath, 1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if path != encPath+backupSuffix {
+			t.Errorf("expected the backup %s, got %s", encPath+backupSuffix, path)
+		}
+	}
+
+	data, err := os.ReadFile(encPath + backupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "v2" {
+		t.Errorf("expected %q, got %q", "v2", data)
+	}
+}
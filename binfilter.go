@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const (
+	// base64LineLength is the length of the lines of base64 that builtin:base64 decodes for the editor,
+	// like in MIME and the output of the base64 command.
+	base64LineLength = 76
+	// hexLineBytes is the number of bytes on a line of builtin:hex.
+	hexLineBytes = 32
+)
+
+// base64View shows binary plaintext as base64 in the editor.
+// Its decode filter encodes to base64, and its encode filter decodes the base64 from the editor,
+// since the binary data is what age-edit encrypts.
+var base64View = builtinFilter{
+	encode: func(in io.Reader, out io.Writer) error {
+		text, err := readViewText(in)
+		if err != nil {
+			return err
+		}
+
+		// Accept the URL-safe alphabet and missing padding, like in tokens.
+		text = strings.NewReplacer("-", "+", "_", "/").Replace(strings.TrimRight(text, "="))
+
+		data, err := base64.RawStdEncoding.DecodeString(text)
+		if err != nil {
+			return fmt.Errorf("invalid base64: %w", err)
+		}
+
+		_, err = out.Write(data)
+
+		return err
+	},
+	decode: func(in io.Reader, out io.Writer) error {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+
+		return writeViewLines(out, base64.StdEncoding.EncodeToString(data), base64LineLength)
+	},
+	compressor: nil,
+}
+
+// hexView shows binary plaintext as hexadecimal in the editor.
+// Like base64View, it decodes to hexadecimal and encodes from it.
+var hexView = builtinFilter{
+	encode: func(in io.Reader, out io.Writer) error {
+		text, err := readViewText(in)
+		if err != nil {
+			return err
+		}
+
+		data, err := hex.DecodeString(text)
+		if err != nil {
+			return fmt.Errorf("invalid hexadecimal: %w", err)
+		}
+
+		_, err = out.Write(data)
+
+		return err
+	},
+	decode: func(in io.Reader, out io.Writer) error {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+
+		return writeViewLines(out, hex.EncodeToString(data), 2*hexLineBytes) //nolint:mnd
+	},
+	compressor: nil,
+}
+
+// readViewText reads the text from the editor without whitespace,
+// so the user can break and indent the lines.
+func readViewText(in io.Reader) (string, error) {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+
+		return r
+	}, string(data)), nil
+}
+
+// writeViewLines writes text in lines of a given length.
+// Empty text, like a new file, stays empty.
+func writeViewLines(out io.Writer, text string, length int) error {
+	var buf bytes.Buffer
+
+	for len(text) > 0 {
+		n := min(length, len(text))
+
+		buf.WriteString(text[:n])
+		buf.WriteByte('\n')
+
+		text = text[n:]
+	}
+
+	_, err := out.Write(buf.Bytes())
+
+	return err
+}
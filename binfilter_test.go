@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBinaryViewFilters(t *testing.T) {
+	t.Parallel()
+
+	data := []byte{}
+	for i := range 100 {
+		data = append(data, byte(i*7))
+	}
+
+	for _, name := range []string{"builtin:base64", "builtin:hex"} {
+		var text, binary bytes.Buffer
+
+		if err := runFilter(name, []string{"-d"}, bytes.NewReader(data), &text); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(text.String(), "\n"), "\n") {
+			if len(line) > base64LineLength {
+				t.Errorf("%s: expected short lines, got %q", name, line)
+			}
+		}
+
+		// The user indents the text.
+		edited := strings.ReplaceAll(text.String(), "\n", "\n\t ")
+
+		if err := runFilter(name, []string{}, strings.NewReader(edited), &binary); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(binary.Bytes(), data) {
+			t.Errorf("%s: expected the data after a round trip, got %v", name, binary.Bytes())
+		}
+
+		text.Reset()
+
+		if err := runFilter(name, []string{"-d"}, strings.NewReader(""), &text); err != nil || text.Len() != 0 {
+			t.Errorf("%s: expected empty input to stay empty, got %q: %v", name, text.String(), err)
+		}
+
+		if err := runFilter(name, []string{}, strings.NewReader("not valid!"), &binary); err == nil {
+			t.Errorf("%s: expected an error for invalid text", name)
+		}
+	}
+
+	// URL-safe base64 without padding, like in tokens.
+	var binary bytes.Buffer
+
+	if err := runFilter("builtin:base64", []string{}, strings.NewReader("-_8"), &binary); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(binary.Bytes(), []byte{0xfb, 0xff}) {
+		t.Errorf("expected URL-safe base64 to decode, got %v", binary.Bytes())
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// blockWriter compresses blocks of its input in parallel and writes them in order.
+// Each block is a separate compressed stream,
+// which formats like xz decompress as the concatenation of their data.
+// It holds up to threads + 1 blocks of input in memory.
+type blockWriter struct {
+	out       io.Writer
+	threads   int
+	blockSize int
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+	buf       []byte
+	pending   []chan compressedBlock
+	started   bool
+	err       error
+}
+
+// compressedBlock is the result of compressing a block.
+type compressedBlock struct {
+	data []byte
+	err  error
+}
+
+// newBlockWriter returns a writer that compresses blocks of blockSize with up to threads at a time.
+func newBlockWriter(out io.Writer, threads, blockSize int, newWriter func(w io.Writer) (io.WriteCloser, error)) *blockWriter {
+	return &blockWriter{
+		out:       out,
+		threads:   threads,
+		blockSize: blockSize,
+		newWriter: newWriter,
+		buf:       []byte{},
+		pending:   []chan compressedBlock{},
+		started:   false,
+		err:       nil,
+	}
+}
+
+func (w *blockWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n := len(p)
+
+	for len(p) > 0 {
+		take := min(w.blockSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:take]...)
+		p = p[take:]
+
+		if len(w.buf) == w.blockSize {
+			if err := w.startBlock(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close compresses the rest of the input and writes the blocks that are left.
+// Empty input becomes one empty stream.
+func (w *blockWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if len(w.buf) > 0 || !w.started {
+		if err := w.startBlock(); err != nil {
+			return err
+		}
+	}
+
+	for len(w.pending) > 0 {
+		if err := w.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startBlock compresses the buffered input in a goroutine.
+// It waits for the oldest block to be written when every thread is busy.
+func (w *blockWriter) startBlock() error {
+	if len(w.pending) == w.threads {
+		if err := w.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	block := w.buf
+	w.buf = []byte{}
+	w.started = true
+
+	done := make(chan compressedBlock, 1)
+	w.pending = append(w.pending, done)
+
+	go func() {
+		var compressed bytes.Buffer
+
+		cw, err := w.newWriter(&compressed)
+		if err == nil {
+			_, err = cw.Write(block)
+			if closeErr := cw.Close(); err == nil {
+				err = closeErr
+			}
+		}
+
+		done <- compressedBlock{data: compressed.Bytes(), err: err}
+	}()
+
+	return nil
+}
+
+// writeBlock waits for the oldest block and writes it.
+// The blocks that are still compressing finish in the background after an error.
+func (w *blockWriter) writeBlock() error {
+	result := <-w.pending[0]
+	w.pending = w.pending[1:]
+
+	err := result.err
+	if err == nil {
+		_, err = w.out.Write(result.data)
+	}
+
+	if err != nil {
+		w.err = err
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+)
+
+func TestBlockWriter(t *testing.T) {
+	t.Parallel()
+
+	const blockSize = 4096
+
+	var sb strings.Builder
+	for i := range 3000 {
+		fmt.Fprintf(&sb, "line %d: %d\n", i, i*i%7919)
+	}
+
+	text := sb.String()
+	cfg := xz.WriterConfig{DictCap: blockSize} //nolint:exhaustruct
+	newWriter := func(w io.Writer) (io.WriteCloser, error) {
+		return cfg.NewWriter(w)
+	}
+
+	for _, size := range []int{0, 1, blockSize - 1, blockSize, blockSize + 1, 5*blockSize + 7, len(text)} {
+		for _, threads := range []int{1, 2, 4} {
+			var compressed bytes.Buffer
+
+			bw := newBlockWriter(&compressed, threads, blockSize, newWriter)
+
+			// Write in pieces that don't line up with the blocks.
+			for rest := text[:size]; rest != ""; {
+				n := min(1000, len(rest))
+				if _, err := io.WriteString(bw, rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+
+				rest = rest[n:]
+			}
+
+			if err := bw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := xz.NewReader(&compressed)
+			if err != nil {
+				t.Fatalf("size %d, %d threads: %v", size, threads, err)
+			}
+
+			decompressed, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("size %d, %d threads: %v", size, threads, err)
+			}
+
+			if string(decompressed) != text[:size] {
+				t.Errorf("size %d, %d threads: got %d bytes back", size, threads, len(decompressed))
+			}
+		}
+	}
+}
+
+func TestBlockWriterError(t *testing.T) {
+	t.Parallel()
+
+	errBlock := errors.New("block failed")
+	bw := newBlockWriter(io.Discard, 2, 16, func(io.Writer) (io.WriteCloser, error) {
+		return nil, errBlock
+	})
+
+	// The error shows up once the writer waits for a block.
+	var err error
+	for range 4 {
+		if _, err = bw.Write(bytes.Repeat([]byte("x"), 16)); err != nil {
+			break
+		}
+	}
+
+	if !errors.Is(err, errBlock) {
+		t.Errorf("expected the block error from Write, got %v", err)
+	}
+
+	if err := bw.Close(); !errors.Is(err, errBlock) {
+		t.Errorf("expected the block error from Close, got %v", err)
+	}
+
+	var out shortWriter
+
+	bw = newBlockWriter(&out, 2, 16, func(w io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(w)
+	})
+
+	_, writeErr := bw.Write(bytes.Repeat([]byte("x"), 100))
+	if err := bw.Close(); err == nil || (writeErr != nil && !errors.Is(err, writeErr)) {
+		t.Errorf("expected the output error, got %v and %v", writeErr, err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+// decryptToWriter decrypts inputPath to w,
+// optionally applying a decode filter command like decryptToFile.
+// The plaintext is streamed and never written to disk.
+func decryptToWriter(inputPath string, w io.Writer, decodeCmd string, decodeArgs []string, identities ...age.Identity) error {
+	if err := checkIdentitiesFit(inputPath, identities); err != nil {
+		return err
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	d, err := wrapDecrypt(in, identities...)
+	if err != nil {
+		return explainDecryptError(err, inputPath, identities)
+	}
+
+	return explainTrailingData(runFilter(decodeCmd, decodeArgs, d, w), inputPath)
+}
+
+// catCommand implements the "cat" subcommand.
+func catCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultVerboseVal, err := defaultVerbose()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Decrypt files to standard output without writing the plaintext to disk. Age files are authenticated in chunks, so the output of a damaged file may be cut short; the exit status is nonzero in that case.",
+		"  encrypted               encrypted file path\n",
+	)
+
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	verbose := flag.BoolP(
+		"verbose",
+		"v",
+		defaultVerboseVal,
+		fmt.Sprintf("report which identity decrypted each file (%v)", verboseEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one encrypted file")
+
+		return exitBadUsage
+	}
+
+	if *idsPath == "" && !agentAvailable() {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file")
+
+		return exitBadUsage
+	}
+
+	lockKeys := false
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			lockKeys = true
+		}
+	}
+
+	decodeCmd := ""
+	decodeArgs := []string{}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		decodeCmd = args[0]
+		decodeArgs = args[1:]
+	}
+
+	if err := checkDependencies(decodeDependency(decodeCmd)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	identities, _, err := openIdentities(*idsPath, lockKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	identities = orderIdentities(identities, *prefer)
+
+	for _, encPath := range flag.Args() {
+		resetMatches(identities)
+
+		if err := decryptToWriter(encPath, os.Stdout, decodeCmd, decodeArgs, identities...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", encPath, err)
+
+			return exitError
+		}
+
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Decrypted %s with identity %s\n", encPath, matchedIdentity(identities))
+		}
+	}
+
+	return exitOK
+}
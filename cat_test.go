@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestDecryptToWriter(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "plain.age")
+
+	if err := os.WriteFile(plainPath, []byte("streamed\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	if err := decryptToWriter(encPath, &out, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "streamed\n" {
+		t.Errorf("decryptToWriter() wrote %q", out.String())
+	}
+
+	out.Reset()
+
+	if err := decryptToWriter(encPath, &out, "", []string{}, other); err == nil || out.Len() != 0 {
+		t.Errorf("decryptToWriter() with the wrong identity returned %v and wrote %q", err, out.String())
+	}
+}
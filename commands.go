@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// subcommand is a mode of operation other than editing
+// selected by the first command-line argument.
+type subcommand struct {
+	name    string
+	args    string
+	summary string
+	run     func(sub subcommand, args []string) int
+}
+
+// subcommands returns the available subcommands in the order they appear in the usage message.
+func subcommands() []subcommand {
+	return []subcommand{
+		{
+			name:    "agent",
+			args:    "[identities]",
+			summary: "hold identities in memory for other age-edit processes",
+			run:     agentCommand,
+		},
+		{
+			name:    "apply",
+			args:    "path...",
+			summary: "transform the plaintext of files with sed or a filter",
+			run:     applyCommand,
+		},
+		{
+			name:    "cat",
+			args:    "encrypted...",
+			summary: "decrypt files to standard output",
+			run:     catCommand,
+		},
+		{
+			name:    "diff",
+			args:    "[[identities] encrypted]",
+			summary: "show the changes since another version of a file",
+			run:     diffCommand,
+		},
+		{
+			name:    "doctor",
+			args:    "[[identities] encrypted]",
+			summary: "check the environment and suggest fixes",
+			run:     doctorCommand,
+		},
+		{
+			name:    "encrypt",
+			args:    "plain encrypted",
+			summary: "encrypt a new file",
+			run:     encryptCommand,
+		},
+		{
+			name:    "exercise",
+			args:    "",
+			summary: "check that editing works on this machine",
+			run:     exerciseCommand,
+		},
+		{
+			name:    "git-textconv",
+			args:    "[encrypted]",
+			summary: "print plaintext for git diff or set up a repository",
+			run:     textconvCommand,
+		},
+		{
+			name:    "head",
+			args:    "encrypted...",
+			summary: "decrypt the first lines of files to standard output",
+			run:     headCommand,
+		},
+		{
+			name:    "history",
+			args:    "[[identities] encrypted]",
+			summary: "list, compare, and restore previous versions of a file",
+			run:     historyCommand,
+		},
+		{
+			name:    "identities",
+			args:    "[identities]",
+			summary: "list usable identities and age plugins",
+			run:     identitiesCommand,
+		},
+		{
+			name:    "info",
+			args:    "encrypted...",
+			summary: "show the format and recipients of files without decrypting them",
+			run:     infoCommand,
+		},
+		{
+			name:    "list",
+			args:    "[path...]",
+			summary: "list encrypted files and whether the identities open them",
+			run:     listCommand,
+		},
+		{
+			name:    "merge",
+			args:    "base ours theirs",
+			summary: "merge two versions of a file that diverged",
+			run:     mergeCommand,
+		},
+		{
+			name:    "pipe",
+			args:    "[command...]",
+			summary: "transform encrypted standard input to encrypted standard output",
+			run:     pipeCommand,
+		},
+		{
+			name:    "reformat",
+			args:    "encrypted...",
+			summary: "convert files between the armored and the binary format",
+			run:     reformatCommand,
+		},
+		{
+			name:    "rekey",
+			args:    "path...",
+			summary: "re-encrypt files to new recipients",
+			run:     rekeyCommand,
+		},
+		{
+			name:    "replace",
+			args:    "encrypted",
+			summary: "replace the contents of a file with standard input",
+			run:     replaceCommand,
+		},
+		{
+			name:    "rm",
+			args:    "encrypted...",
+			summary: "delete encrypted files and their copies in the history and the trash",
+			run:     rmCommand,
+		},
+		{
+			name:    "run",
+			args:    "[[identities] encrypted] -- command [args]",
+			summary: "run a command on the plaintext and save its changes",
+			run:     runCommand,
+		},
+		{
+			name:    "sessions",
+			args:    "",
+			summary: "list running edits and their temporary files",
+			run:     sessionsCommand,
+		},
+		{
+			name:    "touch",
+			args:    "encrypted...",
+			summary: "create empty encrypted files without opening the editor",
+			run:     touchCommand,
+		},
+		{
+			name:    "tui",
+			args:    "[dir]",
+			summary: "browse, edit, and manage encrypted files in a terminal UI",
+			run:     tuiCommand,
+		},
+		{
+			name:    "verify",
+			args:    "[[identities] encrypted]",
+			summary: "check that a file decrypts without writing the plaintext",
+			run:     verifyCommand,
+		},
+		{
+			name:    "view",
+			args:    "[[identities] encrypted]",
+			summary: "show a file in a pager without saving anything",
+			run:     viewCommand,
+		},
+	}
+}
+
+// findSubcommand looks up a subcommand by name.
+func findSubcommand(name string) (subcommand, bool) {
+	for _, sub := range subcommands() {
+		if sub.name == name {
+			return sub, true
+		}
+	}
+
+	return subcommand{}, false //nolint:exhaustruct
+}
+
+// commandForArg looks up the subcommand named by the first command-line argument.
+// Like with external subcommands, a file with the name of a subcommand is edited instead,
+// so "age-edit list" edits a file called "list".
+// Directories don't count, since only files are edited.
+func commandForArg(arg string) (subcommand, bool) {
+	if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+		return subcommand{}, false //nolint:exhaustruct
+	}
+
+	return findSubcommand(arg)
+}
+
+// subcommandUsages formats the list of subcommands for the usage message.
+func subcommandUsages() string {
+	subs := subcommands()
+
+	// Align the summaries with the argument descriptions.
+	// The arguments of each subcommand are shown in its own help.
+	width := 22
+	for _, sub := range subs {
+		width = max(width, len(sub.name))
+	}
+
+	var sb strings.Builder
+	for _, sub := range subs {
+		fmt.Fprintf(&sb, "  %-*s  %s\n", width, sub.name, sub.summary)
+	}
+
+	return sb.String()
+}
+
+// flagSet creates a flag set for the subcommand.
+// Its usage message includes the description and the help for positional arguments.
+func (sub subcommand) flagSet(description, arguments string) *pflag.FlagSet {
+	flag := pflag.NewFlagSet(sub.name, pflag.ContinueOnError)
+
+	flag.Usage = func() {
+		var sb strings.Builder
+
+		fmt.Fprintf(&sb, "Usage: %s %s [options] %s\n\n%s\n", filepath.Base(os.Args[0]), sub.name, sub.args, description)
+
+		if arguments != "" {
+			fmt.Fprintf(&sb, "\nArguments:\n%s", arguments)
+		}
+
+		if flag.HasFlags() {
+			// Merge "(default ...)" with our own parentheticals.
+			fmt.Fprintf(&sb, "\nOptions:\n%s", strings.ReplaceAll(flag.FlagUsages(), ") (", ", "))
+		}
+
+		fmt.Fprint(os.Stderr, sb.String())
+	}
+
+	return flag
+}
+
+// parseSubcommandFlags parses the arguments of a subcommand.
+// It returns false and an exit code when the subcommand should exit right away:
+// after printing help or on a usage error.
+func parseSubcommandFlags(flag *pflag.FlagSet, args []string) (int, bool) {
+	if err := flag.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return exitOK, false
+		}
+
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage, false
+	}
+
+	return exitOK, true
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCommandForArg(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	if sub, ok := commandForArg("list"); !ok || sub.name != "list" {
+		t.Errorf("expected the list command, got %q", sub.name)
+	}
+
+	if _, ok := commandForArg("secrets.age"); ok {
+		t.Error("expected no command for a file name")
+	}
+
+	// A file with the name of a command is edited instead, but a directory isn't.
+	if err := os.WriteFile("list", []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir("history", 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := commandForArg("list"); ok {
+		t.Error("expected an existing file to take precedence")
+	}
+
+	if sub, ok := commandForArg("history"); !ok || sub.name != "history" {
+		t.Errorf("expected the history command despite the directory, got %q", sub.name)
+	}
+}
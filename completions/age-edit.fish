@@ -1,15 +1,99 @@
-complete -c age-edit -s a -l armor -d 'Write armored age file'
+complete -c age-edit -l allow-empty -d 'Save an empty file over an encrypted file with content'
+complete -c age-edit -l allow-shrink -d 'Save with a warning when the file shrinks past the limits'
+complete -c age-edit -l also-save -d 'Also write the encrypted file to a path or directory' -r
+complete -c age-edit -s a -l armor -d 'Write armored age file instead of keeping the format'
+complete -c age-edit -l autosave -d 'Save changes every N seconds while the editor is open' -x
+complete -c age-edit -l backups -d 'Keep a number of backups of the encrypted file' -x
+complete -c age-edit -s b -l binary -d 'Write binary age file instead of keeping the format'
+complete -c age-edit -l chdir -d 'Run the editor in the temporary directory'
 complete -c age-edit -s c -l command -d 'Editor command' -r
+complete -c age-edit -l compression-level -d 'Level of the built-in compressors' -x -a '1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19'
+complete -c age-edit -l compression-threads -d 'Threads of builtin:xz and builtin:zstd' -x
+complete -c age-edit -l compression-window -d 'Window of builtin:xz and builtin:zstd as a power of 2' -x
+complete -c age-edit -l confirm-save -d 'Show the changes and ask before saving'
 complete -c age-edit -l decode -d 'Filter command after decryption' -r
+complete -c age-edit -l decode-shell -d 'Shell command line after decryption' -x
+complete -c age-edit -l diff -d 'Diff command for --confirm-save' -r
 complete -c age-edit -s e -l editor -d 'Editor executable' -r
 complete -c age-edit -l encode -d 'Filter command before encryption' -r
+complete -c age-edit -l encode-shell -d 'Shell command line before encryption' -x
+complete -c age-edit -l filter-dir -d 'Working directory of the filters' -r
+complete -c age-edit -l filter-env -d 'Set or pass through variables for the filters' -x
+complete -c age-edit -l filter-timeout -d 'Kill a filter that runs longer than a duration' -x
 complete -c age-edit -s f -l force -d 'Force re-encryption'
+complete -c age-edit -l gc -d 'Remove the temporary directories of crashed sessions and exit'
+complete -c age-edit -l git-commit -d 'Commit the encrypted file to its Git repository after every save'
+complete -c age-edit -l git-message -d 'Commit message for --git-commit' -x
+complete -c age-edit -l history -d 'Keep a number of previous encrypted versions of the file' -x
+complete -c age-edit -l history-max-age -d 'Remove previous versions older than a duration' -x
+complete -c age-edit -l history-store -d 'Where to keep previous versions' -x -a 'file state'
+complete -c age-edit -l hook -d 'Run a command on an event, like post-encrypt=COMMAND' -x -a 'pre-decrypt= post-decrypt= pre-encrypt= post-encrypt= post-cleanup='
+complete -c age-edit -s i -l identities -d 'Identities file; all arguments are encrypted files' -r
+complete -c age-edit -l idle-timeout -d 'Save and close the session after a time without activity' -x
+complete -c age-edit -l inhibit-sleep -d 'Keep the computer from sleeping while the plaintext is on disk'
+complete -c age-edit -l keep-temp -d 'Keep the temporary directory with the plaintext after exit'
+complete -c age-edit -l lock-expiry -d 'Time after which a dotlock can be broken' -r
+complete -c age-edit -l lock-strategy -d 'How to lock the encrypted file' -x -a 'flock dotlock'
+complete -c age-edit -l max-shrink -d 'Refuse to save when the file shrinks by more than a percentage' -x
+complete -c age-edit -l min-size -d 'Refuse to save when the file shrinks below a size in bytes' -x
+complete -c age-edit -l no-auto-filter -d 'Do not recognize compressed plaintext and tar archives'
+complete -c age-edit -l no-fsync -d 'Do not flush the saved file to disk'
 complete -c age-edit -s L -l no-lock -d 'Do not lock encrypted file'
 complete -c age-edit -s M -l no-memlock -d 'Disable mlockall(2) that prevents swapping'
+complete -c age-edit -l no-supervisor -d 'Do not start a process that removes the plaintext if age-edit is killed'
+complete -c age-edit -l no-tty -d 'Do not give the editor a terminal when there is none'
+complete -c age-edit -l notify -d 'Show a desktop notification when saving in the background'
+complete -c age-edit -l open-binary -d 'Open a binary file in the default application of the desktop'
+complete -c age-edit -l park -d 'Take the plaintext off the disk while suspended'
+complete -c age-edit -l plain-name -d 'File name of the decrypted temporary file' -x
+complete -c age-edit -l prefer -d 'Try identities with these labels or recipients first' -r
+complete -c age-edit -l preserve-mtime -d 'Give the encrypted file the modification time of the plaintext'
+complete -c age-edit -l print-config -d 'Print the resolved configuration and exit'
 complete -c age-edit -s r -l read-only -d 'Make the temporary file read-only and discard all changes'
+complete -c age-edit -l revert-signal -d 'Signal that replaces the plaintext with the encrypted file on disk' -x
+complete -c age-edit -l save-signals -d 'Signals that save the changes without closing the editor' -x
+complete -c age-edit -l stay -d 'Keep the session open after the editor exits'
 complete -c age-edit -s t -l temp-dir -d 'Temporary directory prefix' -r
+complete -c age-edit -l template -d 'Plaintext file to start a new file from' -r
+complete -c age-edit -l template-text -d 'Text to start a new file from' -x
+complete -c age-edit -l trash -d 'Directory for encrypted copies of discarded changes' -r
+complete -c age-edit -l trash-ttl -d 'How long to keep discarded changes in the trash' -r
+complete -c age-edit -l validate -d 'Command that checks the plaintext before saving' -r
+complete -c age-edit -s v -l verbose -d 'Report which identity decrypted the file'
 complete -c age-edit -s V -l version -d 'Report the program version and exit'
 complete -c age-edit -s w -l warn -d 'Warn if editor exits after less than N seconds' -r
+complete -c age-edit -l wait -d 'How to wait for GUI editors that return at once' -x -a 'flags enter open none'
+complete -c age-edit -l warn-droppings -d 'Warn about swap, backup, and undo files the editor leaves'
+complete -c age-edit -l watch -d 'Save the encrypted file whenever the editor saves'
+complete -c age-edit -l wrap -d 'Act as $EDITOR: edit files without the .age suffix directly'
+complete -c age-edit -s y -l yes -d 'Create a missing encrypted file without asking'
+
+# Commands.
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a agent -d 'Hold identities in memory for other age-edit processes'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a apply -d 'Transform the plaintext of files with sed or a filter'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a cat -d 'Decrypt files to standard output'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a diff -d 'Show the changes since another version of a file'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a doctor -d 'Check the environment and suggest fixes'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a encrypt -d 'Encrypt a new file'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a exercise -d 'Check that editing works on this machine'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a git-textconv -d 'Print plaintext for git diff or set up a repository'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a head -d 'Decrypt the first lines of files to standard output'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a history -d 'List, compare, and restore previous versions of a file'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a identities -d 'List usable identities and age plugins'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a info -d 'Show the format and recipients of files without decrypting them'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a list -d 'List encrypted files and whether the identities open them'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a merge -d 'Merge two versions of a file that diverged'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a pipe -d 'Transform encrypted standard input to encrypted standard output'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a reformat -d 'Convert files between the armored and the binary format'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a rekey -d 'Re-encrypt files to new recipients'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a replace -d 'Replace the contents of a file with standard input'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a rm -d 'Delete encrypted files and their copies in the history and the trash'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a run -d 'Run a command on the plaintext and save its changes'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a sessions -d 'List running edits and their temporary files'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a touch -d 'Create empty encrypted files without opening the editor'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a tui -d 'Browse, edit, and manage encrypted files in a terminal UI'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a verify -d 'Check that a file decrypts without writing the plaintext'
+complete -c age-edit -n "__fish_is_nth_token 1" -f -a view -d 'Show a file in a pager without saving anything'
 
 # Complete files for both arguments.
 complete -c age-edit -n "__fish_is_nth_token 1" -F
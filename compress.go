@@ -0,0 +1,393 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// builtinFilterPrefix marks a filter that age-edit runs itself instead of an external command.
+const builtinFilterPrefix = "builtin:"
+
+// builtinFilter is a filter that age-edit runs in the process.
+// Like the gzip command, it encodes by default and decodes with the argument "-d".
+type builtinFilter struct {
+	encode func(in io.Reader, out io.Writer) error
+	decode func(in io.Reader, out io.Writer) error
+	// compressor is the format of a compression filter, which takes a compression level.
+	compressor *compressor
+}
+
+// builtinFilters are the filters age-edit has built in.
+// They run in the process, so the plaintext doesn't pass through the pipes of another program,
+// and they work where the commands aren't installed, like on Windows.
+var builtinFilters = map[string]builtinFilter{
+	"base64": base64View,
+	"gzip": compressor{
+		compress: func(w io.Writer, opts compressionOptions) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, opts.level)
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		minLevel:     gzip.BestSpeed,
+		maxLevel:     gzip.BestCompression,
+		defaultLevel: gzip.BestCompression,
+		threads:      false,
+		minWindow:    0,
+		maxWindow:    0,
+	}.filter(),
+	"hex":  hexView,
+	"json": {encode: compactJSON, decode: indentJSON, compressor: nil},
+	"xz": compressor{
+		compress: func(w io.Writer, opts compressionOptions) (io.WriteCloser, error) {
+			cfg := xz.WriterConfig{DictCap: xzDictCaps[opts.level-1]} //nolint:exhaustruct
+			if opts.window != 0 {
+				cfg.DictCap = 1 << opts.window
+			}
+
+			if opts.threads <= 1 {
+				return cfg.NewWriter(w)
+			}
+
+			// Like the xz command, compress blocks three times the size of the dictionary in parallel,
+			// but keep the plaintext held by the blocks under xzMaxBuffered.
+			// A block never uses a dictionary larger than itself.
+			blockSize := min(xzBlockFactor*cfg.DictCap, xzMaxBlockSize)
+			cfg.DictCap = min(cfg.DictCap, blockSize)
+			threads := max(min(opts.threads, xzMaxBuffered/blockSize-1), 1)
+
+			return newBlockWriter(w, threads, blockSize, func(w io.Writer) (io.WriteCloser, error) {
+				return cfg.NewWriter(w)
+			}), nil
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return io.NopCloser(xr), nil
+		},
+		minLevel:     1,
+		maxLevel:     len(xzDictCaps),
+		defaultLevel: 6,
+		threads:      true,
+		minWindow:    12,
+		maxWindow:    30,
+	}.filter(),
+	"zstd": compressor{
+		compress: func(w io.Writer, opts compressionOptions) (io.WriteCloser, error) {
+			zopts := []zstd.EOption{
+				zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.level)),
+				zstd.WithEncoderConcurrency(max(opts.threads, 1)),
+			}
+			if opts.window != 0 {
+				zopts = append(zopts, zstd.WithWindowSize(1<<opts.window))
+			}
+
+			return zstd.NewWriter(w, zopts...)
+		},
+		decompress: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+
+			return zr.IOReadCloser(), nil
+		},
+		minLevel:     1,
+		maxLevel:     19,
+		defaultLevel: 3,
+		threads:      true,
+		minWindow:    10,
+		maxWindow:    29,
+	}.filter(),
+}
+
+// xzDictCaps are the dictionary sizes of the xz levels 1 to 9, like the presets of the xz command.
+// The xz package has no other setting that depends on the level.
+var xzDictCaps = []int{
+	1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+// xzBlockFactor is the size of the blocks xz compresses in parallel relative to its dictionary.
+const xzBlockFactor = 3
+
+// xzMaxBlockSize and xzMaxBuffered limit the memory of parallel xz compression.
+// A blockWriter holds a block for each thread and the one it is filling,
+// so fewer threads run when their blocks would exceed xzMaxBuffered.
+const (
+	xzMaxBlockSize = 32 << 20
+	xzMaxBuffered  = 256 << 20
+)
+
+// compressionOptions are the settings of a built-in compressor.
+// Zero is the default of each format.
+type compressionOptions struct {
+	level   int
+	threads int
+	// window is the base-2 logarithm of the window size, like 27 for 128 MiB.
+	window int
+}
+
+// checkCompressionOptions checks the options before age-edit knows the compressor of a file.
+// The level and window depend on the compressor, so checkFilterArgs checks them when it is chosen.
+func checkCompressionOptions(opts compressionOptions) error {
+	if opts.level < 0 {
+		return fmt.Errorf("invalid compression level: %d", opts.level)
+	}
+
+	if opts.threads < 0 {
+		return fmt.Errorf("invalid number of compression threads: %d", opts.threads)
+	}
+
+	if opts.window < 0 {
+		return fmt.Errorf("invalid compression window: %d", opts.window)
+	}
+
+	return nil
+}
+
+// checkFilterArgs checks the arguments of a built-in filter before it runs,
+// so an option the compressor lacks is an error before the editor starts and not when saving.
+// Other filters aren't checked.
+func checkFilterArgs(command string, args []string) error {
+	if !strings.HasPrefix(command, builtinFilterPrefix) {
+		return nil
+	}
+
+	_, _, _, err := parseBuiltinArgs(command, args)
+
+	return err
+}
+
+// filterArgs adds the options to the arguments of a built-in compressor,
+// so they apply unless the arguments set them.
+// The arguments of other filters and the options a compressor doesn't have are left out.
+func (opts compressionOptions) filterArgs(command string, args []string) []string {
+	if !strings.HasPrefix(command, builtinFilterPrefix) {
+		return args
+	}
+
+	f, ok := builtinFilters[strings.TrimPrefix(command, builtinFilterPrefix)]
+	if !ok || f.compressor == nil {
+		return args
+	}
+
+	optArgs := []string{}
+
+	if opts.level != 0 {
+		optArgs = append(optArgs, "-"+strconv.Itoa(opts.level))
+	}
+
+	if opts.threads != 0 && f.compressor.threads {
+		optArgs = append(optArgs, "--threads="+strconv.Itoa(opts.threads))
+	}
+
+	if opts.window != 0 && f.compressor.maxWindow != 0 {
+		optArgs = append(optArgs, "--window="+strconv.Itoa(opts.window))
+	}
+
+	return append(optArgs, args...)
+}
+
+// compressor is a built-in compression format.
+// Zstandard maps its levels 1 to 19 to the four speeds of its encoder.
+type compressor struct {
+	compress     func(w io.Writer, opts compressionOptions) (io.WriteCloser, error)
+	decompress   func(r io.Reader) (io.ReadCloser, error)
+	minLevel     int
+	maxLevel     int
+	defaultLevel int
+	// threads is whether the format compresses in parallel.
+	threads bool
+	// minWindow and maxWindow are the window sizes of the format like in compressionOptions.
+	// They are zero for a format with a fixed window.
+	minWindow int
+	maxWindow int
+}
+
+// filter returns the built-in filter that compresses and decompresses with c.
+func (c compressor) filter() builtinFilter {
+	return builtinFilter{
+		encode: func(in io.Reader, out io.Writer) error {
+			return c.encode(in, out, compressionOptions{level: c.defaultLevel, threads: 0, window: 0})
+		},
+		decode: func(in io.Reader, out io.Writer) error {
+			r, err := c.decompress(in)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			_, err = io.Copy(out, r) //nolint:gosec
+
+			return err
+		},
+		compressor: &c,
+	}
+}
+
+// encode compresses in to out with the options.
+func (c compressor) encode(in io.Reader, out io.Writer, opts compressionOptions) error {
+	w, err := c.compress(out, opts)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, in); err != nil {
+		w.Close()
+
+		return err
+	}
+
+	return w.Close()
+}
+
+// builtinFilterNames returns the names of the built-in filters in order.
+func builtinFilterNames() []string {
+	names := []string{}
+	for name := range builtinFilters {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// findBuiltinFilter looks up a built-in filter like "builtin:gzip".
+func findBuiltinFilter(command string) (builtinFilter, error) {
+	name := strings.TrimPrefix(command, builtinFilterPrefix)
+
+	f, ok := builtinFilters[name]
+	if !ok {
+		return builtinFilter{}, fmt.Errorf( //nolint:exhaustruct
+			"no built-in filter %q; the built-in filters are %s%s, and other formats need a command, like \"bzip2\"",
+			name,
+			builtinFilterPrefix,
+			strings.Join(builtinFilterNames(), ", "+builtinFilterPrefix),
+		)
+	}
+
+	return f, nil
+}
+
+// runBuiltinFilter runs a built-in filter from in to out.
+// A compressor takes a level like the gzip command, like "-1", "--fast", or "--best",
+// and the formats that have them take "--threads=N" and "--window=N".
+// The last argument for a setting wins.
+func runBuiltinFilter(command string, args []string, in io.Reader, out io.Writer) error {
+	f, decode, opts, err := parseBuiltinArgs(command, args)
+	if err != nil {
+		return err
+	}
+
+	c := f.compressor
+	run := f.encode
+
+	switch {
+	case decode:
+		run = f.decode
+
+	case c != nil:
+		if opts.level == 0 {
+			opts.level = c.defaultLevel
+		}
+
+		run = func(in io.Reader, out io.Writer) error {
+			return c.encode(in, out, opts)
+		}
+	}
+
+	if err := run(in, out); err != nil {
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+
+	return nil
+}
+
+// parseBuiltinArgs parses the arguments of a built-in filter.
+// The level and the window are checked after the last argument sets them.
+func parseBuiltinArgs(command string, args []string) (builtinFilter, bool, compressionOptions, error) {
+	opts := compressionOptions{level: 0, threads: 0, window: 0}
+
+	f, err := findBuiltinFilter(command)
+	if err != nil {
+		return f, false, opts, err
+	}
+
+	decode := false
+	levelSet, windowSet := false, false
+	c := f.compressor
+
+	for _, arg := range args {
+		switch {
+		case arg == "-d" || arg == "--decode" || arg == "--decompress":
+			decode = true
+
+		case c != nil && arg == "--fast":
+			opts.level = c.minLevel
+
+		case c != nil && arg == "--best":
+			opts.level = c.maxLevel
+
+		case c != nil && isLevelArg(arg):
+			opts.level, _ = strconv.Atoi(arg[1:])
+			levelSet = true
+
+		case c != nil && c.threads && strings.HasPrefix(arg, "--threads="):
+			opts.threads, err = strconv.Atoi(strings.TrimPrefix(arg, "--threads="))
+			if err != nil || opts.threads < 1 {
+				return f, decode, opts, fmt.Errorf("invalid number of threads for %s: %q", command, arg)
+			}
+
+		case c != nil && c.maxWindow != 0 && strings.HasPrefix(arg, "--window="):
+			opts.window, err = strconv.Atoi(strings.TrimPrefix(arg, "--window="))
+			if err != nil {
+				return f, decode, opts, fmt.Errorf("invalid window for %s: %q", command, arg)
+			}
+
+			windowSet = true
+
+		default:
+			return f, decode, opts, fmt.Errorf("unknown argument for %s: %q", command, arg)
+		}
+	}
+
+	if c == nil {
+		return f, decode, opts, nil
+	}
+
+	if levelSet && (opts.level < c.minLevel || opts.level > c.maxLevel) {
+		return f, decode, opts, fmt.Errorf("no compression level %d for %s; the levels are %d to %d", opts.level, command, c.minLevel, c.maxLevel)
+	}
+
+	if windowSet && (opts.window < c.minWindow || opts.window > c.maxWindow) {
+		return f, decode, opts, fmt.Errorf("no compression window %d for %s; the windows are %d to %d", opts.window, command, c.minWindow, c.maxWindow)
+	}
+
+	return f, decode, opts, nil
+}
+
+// isLevelArg reports whether arg is a compression level like "-9".
+func isLevelArg(arg string) bool {
+	if len(arg) < 2 || len(arg) > 3 || arg[0] != '-' {
+		return false
+	}
+
+	for _, c := range arg[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
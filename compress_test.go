@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestBuiltinFilter(t *testing.T) {
+	t.Parallel()
+
+	plaintext := strings.Repeat("secret\n", 100)
+
+	var compressed, decompressed bytes.Buffer
+
+	if err := runFilter("builtin:gzip", []string{}, strings.NewReader(plaintext), &compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	if compressed.Len() >= len(plaintext) {
+		t.Errorf("expected the plaintext to be compressed, got %d bytes", compressed.Len())
+	}
+
+	if err := runFilter("builtin:gzip", []string{"-d"}, &compressed, &decompressed); err != nil {
+		t.Fatal(err)
+	}
+
+	if decompressed.String() != plaintext {
+		t.Errorf("expected the plaintext after decompressing, got %q", decompressed.String())
+	}
+
+	if err := runFilter("builtin:gzip", []string{"-d"}, strings.NewReader("not gzip"), &decompressed); err == nil {
+		t.Error("expected an error for data that isn't compressed")
+	}
+
+	if err := runFilter("builtin:gzip", []string{"-x"}, strings.NewReader(plaintext), &decompressed); err == nil {
+		t.Error("expected an error for an unknown argument")
+	}
+
+	if err := checkDependencies(encodeDependency("builtin:gzip")); err != nil {
+		t.Errorf("expected the built-in filter to be found: %v", err)
+	}
+
+	if err := checkDependencies(encodeDependency("builtin:bzip2")); err == nil {
+		t.Error("expected an error for a filter that isn't built in")
+	}
+}
+
+func TestBuiltinCompressors(t *testing.T) {
+	t.Parallel()
+
+	plaintext := strings.Repeat("secret\n", 1000)
+
+	for name, magic := range map[string][]byte{
+		"gzip": {0x1f, 0x8b},
+		"xz":   {0xfd, '7', 'z', 'X', 'Z', 0x00},
+		"zstd": {0x28, 0xb5, 0x2f, 0xfd},
+	} {
+		command := builtinFilterPrefix + name
+		c := builtinFilters[name].compressor
+
+		for _, args := range [][]string{{}, {"--fast"}, {"--best"}} {
+			var compressed, decompressed bytes.Buffer
+
+			if err := runFilter(command, args, strings.NewReader(plaintext), &compressed); err != nil {
+				t.Fatalf("%s %v: %v", command, args, err)
+			}
+
+			if !bytes.HasPrefix(compressed.Bytes(), magic) || compressed.Len() >= len(plaintext) {
+				t.Errorf("%s %v: expected compressed data in the format, got % x", command, args, compressed.Bytes())
+			}
+
+			if err := runFilter(command, []string{"-d"}, &compressed, &decompressed); err != nil {
+				t.Fatalf("%s %v: %v", command, args, err)
+			}
+
+			if decompressed.String() != plaintext {
+				t.Errorf("%s %v: expected the plaintext after decompressing", command, args)
+			}
+		}
+
+		for _, level := range []int{0, c.maxLevel + 1} {
+			if err := runFilter(command, []string{fmt.Sprintf("-%d", level)}, strings.NewReader(plaintext), io.Discard); err == nil {
+				t.Errorf("%s: expected an error for level %d", command, level)
+			}
+		}
+
+		if err := runFilter(command, []string{"-d"}, strings.NewReader(plaintext), io.Discard); err == nil {
+			t.Errorf("%s: expected an error for data that isn't compressed", command)
+		}
+	}
+
+	var compressed bytes.Buffer
+
+	if err := runFilter("builtin:zstd", []string{"-19"}, strings.NewReader(plaintext), &compressed); err != nil {
+		t.Errorf("expected level 19 for Zstandard: %v", err)
+	}
+}
+
+func TestBuiltinFilterRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "secret.txt")
+	encPath := filepath.Join(tempDir, "secret.txt.gz.age")
+
+	if err := os.WriteFile(plainPath, []byte("secret\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, false, false, "builtin:gzip", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := decryptToWriter(encPath, &plaintext, "builtin:gzip", []string{"-d"}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext.String() != "secret\n" {
+		t.Errorf("expected the plaintext, got %q", plaintext.String())
+	}
+}
+
+func TestBuiltinFilterLevel(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	for i := range 5000 {
+		fmt.Fprintf(&sb, "line %d: %d\n", i, i*i%7919)
+	}
+
+	plaintext := sb.String()
+
+	compress := func(args ...string) []byte {
+		var compressed bytes.Buffer
+
+		if err := runFilter("builtin:gzip", args, strings.NewReader(plaintext), &compressed); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+
+		return compressed.Bytes()
+	}
+
+	fast, best := compress("-1"), compress("-9")
+
+	if len(fast) <= len(best) {
+		t.Errorf("expected level 1 to compress less than level 9, got %d and %d bytes", len(fast), len(best))
+	}
+
+	if !bytes.Equal(compress("--fast"), fast) || !bytes.Equal(compress("--best"), best) || !bytes.Equal(compress(), best) {
+		t.Error("expected --fast and --best to be levels 1 and 9 and 9 to be the default")
+	}
+
+	var decompressed bytes.Buffer
+
+	if err := runFilter("builtin:gzip", []string{"-d"}, bytes.NewReader(fast), &decompressed); err != nil || decompressed.String() != plaintext {
+		t.Errorf("expected the plaintext after decompressing: %v", err)
+	}
+
+	for _, test := range []struct {
+		command string
+		arg     string
+	}{
+		{"builtin:gzip", "-0"},
+		{"builtin:gzip", "-10"},
+		{"builtin:json", "-1"},
+		{"builtin:json", "--best"},
+	} {
+		if err := runFilter(test.command, []string{test.arg}, strings.NewReader("{}"), io.Discard); err == nil {
+			t.Errorf("%s %s: expected an error", test.command, test.arg)
+		}
+	}
+}
+
+func TestCompressionOptions(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		opts  compressionOptions
+		valid bool
+	}{
+		{compressionOptions{level: 0, threads: 0, window: 0}, true},
+		{compressionOptions{level: 9, threads: 4, window: 27}, true},
+		{compressionOptions{level: 19, threads: 0, window: 10}, true},
+		{compressionOptions{level: -1, threads: 0, window: 0}, false},
+		{compressionOptions{level: 0, threads: -1, window: 0}, false},
+		{compressionOptions{level: 0, threads: 0, window: -1}, false},
+	} {
+		if err := checkCompressionOptions(test.opts); (err == nil) != test.valid {
+			t.Errorf("%+v: expected valid %v, got %v", test.opts, test.valid, err)
+		}
+	}
+
+	// The level and the window are checked against the compressor that uses them.
+	for _, test := range []struct {
+		command string
+		opts    compressionOptions
+		args    []string
+		valid   bool
+	}{
+		{"builtin:zstd", compressionOptions{level: 19, threads: 0, window: 10}, []string{}, true},
+		{"builtin:gzip", compressionOptions{level: 19, threads: 0, window: 10}, []string{}, false},
+		{"builtin:gzip", compressionOptions{level: 19, threads: 0, window: 10}, []string{"-5"}, true},
+		{"builtin:gzip", compressionOptions{level: 0, threads: 8, window: 10}, []string{}, true},
+		{"builtin:xz", compressionOptions{level: 0, threads: 0, window: 11}, []string{}, false},
+		{"builtin:xz", compressionOptions{level: 0, threads: 0, window: 11}, []string{"--window=30"}, true},
+		{"builtin:xz", compressionOptions{level: 0, threads: 0, window: 0}, []string{"-0"}, false},
+		{"builtin:zstd", compressionOptions{level: 0, threads: 0, window: 0}, []string{"--window=0"}, false},
+		{"zstd", compressionOptions{level: 19, threads: 0, window: 10}, []string{"-22"}, true},
+	} {
+		args := test.opts.filterArgs(test.command, test.args)
+		if err := checkFilterArgs(test.command, args); (err == nil) != test.valid {
+			t.Errorf("%s %q: expected valid %v, got %v", test.command, args, test.valid, err)
+		}
+	}
+
+	opts := compressionOptions{level: 1, threads: 4, window: 20}
+
+	for _, test := range []struct {
+		command  string
+		args     []string
+		expected []string
+	}{
+		{"builtin:zstd", []string{"-9"}, []string{"-1", "--threads=4", "--window=20", "-9"}},
+		{"builtin:xz", []string{}, []string{"-1", "--threads=4", "--window=20"}},
+		{"builtin:gzip", []string{}, []string{"-1"}},
+		{"builtin:json", []string{}, []string{}},
+		{"zstd", []string{"-9"}, []string{"-9"}},
+	} {
+		if got := opts.filterArgs(test.command, test.args); !slices.Equal(got, test.expected) {
+			t.Errorf("%s %q: expected %q, got %q", test.command, test.args, test.expected, got)
+		}
+	}
+}
+
+func TestCompressionOptionsOutput(t *testing.T) {
+	t.Parallel()
+
+	var sb strings.Builder
+	for i := range 20000 {
+		fmt.Fprintf(&sb, "line %d: %d\n", i, i*i%7919)
+	}
+
+	plaintext := sb.String()
+
+	compress := func(command string, opts compressionOptions, args ...string) []byte {
+		var compressed, decompressed bytes.Buffer
+
+		args = opts.filterArgs(command, args)
+		if err := runFilter(command, args, strings.NewReader(plaintext), &compressed); err != nil {
+			t.Fatalf("%s %q: %v", command, args, err)
+		}
+
+		if err := runFilter(command, []string{"-d"}, bytes.NewReader(compressed.Bytes()), &decompressed); err != nil {
+			t.Fatalf("%s %q: %v", command, args, err)
+		}
+
+		if decompressed.String() != plaintext {
+			t.Errorf("%s %q: expected the plaintext after decompressing", command, args)
+		}
+
+		return compressed.Bytes()
+	}
+
+	none := compressionOptions{level: 0, threads: 0, window: 0}
+
+	for _, test := range []struct {
+		command string
+		opts    compressionOptions
+	}{
+		{"builtin:gzip", compressionOptions{level: 1, threads: 0, window: 0}},
+		{"builtin:xz", compressionOptions{level: 1, threads: 0, window: 0}},
+		{"builtin:xz", compressionOptions{level: 0, threads: 0, window: 12}},
+		{"builtin:zstd", compressionOptions{level: 19, threads: 0, window: 0}},
+		{"builtin:zstd", compressionOptions{level: 0, threads: 0, window: 10}},
+	} {
+		if bytes.Equal(compress(test.command, test.opts), compress(test.command, none)) {
+			t.Errorf("%s %+v: expected the options to change the output", test.command, test.opts)
+		}
+	}
+
+	// xz compresses blocks of three times the window in parallel.
+	small := compressionOptions{level: 0, threads: 1, window: 12}
+	parallel := compressionOptions{level: 0, threads: 4, window: 12}
+
+	if bytes.Equal(compress("builtin:xz", parallel), compress("builtin:xz", small)) {
+		t.Error("expected threads to change the output of xz")
+	}
+
+	// The Zstandard encoder writes the same output in any number of threads.
+	if !bytes.Equal(compress("builtin:zstd", compressionOptions{level: 0, threads: 4, window: 0}), compress("builtin:zstd", none)) {
+		t.Error("expected threads not to change the output of Zstandard")
+	}
+
+	// The arguments of the filter win.
+	if !bytes.Equal(compress("builtin:zstd", compressionOptions{level: 19, threads: 0, window: 10}, "-3", "--window=22"), compress("builtin:zstd", none, "--window=22")) {
+		t.Error("expected the arguments of the filter to override the options")
+	}
+
+	var empty, decompressed bytes.Buffer
+
+	if err := runFilter("builtin:xz", parallel.filterArgs("builtin:xz", []string{}), strings.NewReader(""), &empty); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runFilter("builtin:xz", []string{"-d"}, &empty, &decompressed); err != nil || decompressed.Len() != 0 {
+		t.Errorf("expected empty input to make an empty stream: %v", err)
+	}
+
+	for _, test := range []struct {
+		command string
+		arg     string
+	}{
+		{"builtin:gzip", "--threads=2"},
+		{"builtin:gzip", "--window=20"},
+		{"builtin:xz", "--threads=0"},
+		{"builtin:xz", "--window=31"},
+		{"builtin:zstd", "--window=9"},
+		{"builtin:zstd", "--window=x"},
+	} {
+		if err := runFilter(test.command, []string{test.arg}, strings.NewReader(plaintext), io.Discard); err == nil {
+			t.Errorf("%s %s: expected an error", test.command, test.arg)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	sourceArgument = "argument"
+	sourceDefault  = "default"
+	sourceFlag     = "flag"
+)
+
+// flagEnvVars maps the options of age-edit to the environment variables that set their defaults.
+// For the editor, the first variable that is set wins.
+var flagEnvVars = map[string][]string{
+	"allow-empty":         {allowEmptyEnvVar},
+	"allow-shrink":        {allowShrinkEnvVar},
+	"also-save":           {alsoSaveEnvVar},
+	"armor":               {armorEnvVar},
+	"autosave":            {autosaveEnvVar},
+	"backups":             {backupsEnvVar},
+	"chdir":               {chdirEnvVar},
+	"command":             {commandEnvVar},
+	"compression-level":   {compressionLevelEnvVar},
+	"compression-threads": {compressionThreadsEnvVar},
+	"compression-window":  {compressionWindowEnvVar},
+	"confirm-save":        {confirmSaveEnvVar},
+	"decode":              {decodeEnvVar},
+	"decode-shell":        {decodeShellEnvVar},
+	"diff":                {diffEnvVar},
+	"editor":              editorEnvVars,
+	"encode":              {encodeEnvVar},
+	"encode-shell":        {encodeShellEnvVar},
+	"filter-dir":          {filterDirEnvVar},
+	"filter-env":          {filterEnvEnvVar},
+	"filter-timeout":      {filterTimeoutEnvVar},
+	"force":               {forceEnvVar},
+	"git-commit":          {gitCommitEnvVar},
+	"git-message":         {gitMessageEnvVar},
+	"history":             {historyEnvVar},
+	"history-max-age":     {historyMaxAgeEnvVar},
+	"history-store":       {historyStoreEnvVar},
+	"hook":                {hooksEnvVar},
+	"idle-timeout":        {idleTimeoutEnvVar},
+	"inhibit-sleep":       {inhibitSleepEnvVar},
+	"lock-expiry":         {lockExpiryEnvVar},
+	"lock-strategy":       {lockStrategyEnvVar},
+	"max-shrink":          {maxShrinkEnvVar},
+	"min-size":            {minSizeEnvVar},
+	"no-auto-filter":      {autoFilterEnvVar},
+	"no-fsync":            {fsyncEnvVar},
+	"no-lock":             {lockEnvVar},
+	"no-memlock":          {memlockEnvVar},
+	"no-supervisor":       {supervisorEnvVar},
+	"no-tty":              {ttyEnvVar},
+	"notify":              {notifyEnvVar},
+	"open-binary":         {openBinaryEnvVar},
+	"park":                {parkEnvVar},
+	"plain-name":          {plainNameEnvVar},
+	"prefer":              {preferEnvVar},
+	"preserve-mtime":      {preserveMtimeEnvVar},
+	"read-only":           {readOnlyEnvVar},
+	"revert-signal":       {revertSignalEnvVar},
+	"save-signals":        {saveSignalsEnvVar},
+	"stay":                {stayEnvVar},
+	"temp-dir":            {tempDirPrefixEnvVar},
+	"template":            {templateEnvVar},
+	"template-text":       {templateTextEnvVar},
+	"trash":               {trashEnvVar},
+	"trash-ttl":           {trashTTLEnvVar},
+	"validate":            {validateEnvVar},
+	"verbose":             {verboseEnvVar},
+	"wait":                {waitEnvVar},
+	"warn":                {warnEnvVar},
+	"warn-droppings":      {warnDroppingsEnvVar},
+	"watch":               {watchEnvVar},
+	"wrap":                {wrapEnvVar},
+	"yes":                 {yesEnvVar},
+}
+
+// envSource returns the source of a setting read from the first set environment variable.
+func envSource(envVars []string) (string, bool) {
+	for _, envVar := range envVars {
+		if os.Getenv(envVar) != "" {
+			return "env " + envVar, true
+		}
+	}
+
+	return "", false
+}
+
+// writeConfig writes the resolved configuration with the source of every value:
+// an argument, an option, an environment variable, or the built-in default.
+// Each line has a setting, its value, and its source, so the output is easy to compare and grep.
+func writeConfig(w io.Writer, flag *pflag.FlagSet, idsPath, encPath string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd
+
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+
+	identitiesFlag := flag.Changed("identities")
+
+	positional := []struct {
+		name   string
+		value  string
+		envVar string
+		flag   bool
+		arg    bool
+	}{
+		{"identities", idsPath, identitiesFileEnvVar, identitiesFlag, !identitiesFlag && flag.NArg() >= 2}, //nolint:mnd
+		{"encrypted", encPath, encryptedFileEnvVar, false, flag.NArg() >= 1},
+	}
+
+	for _, p := range positional {
+		source := sourceDefault
+
+		if p.flag {
+			source = sourceFlag
+		} else if p.arg {
+			source = sourceArgument
+		} else if env, ok := envSource([]string{p.envVar}); ok {
+			source = env
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.name, strconv.Quote(p.value), source)
+	}
+
+	flag.VisitAll(func(f *pflag.Flag) {
+		envVars, ok := flagEnvVars[f.Name]
+		if !ok {
+			return
+		}
+
+		source := sourceDefault
+
+		if f.Changed {
+			source = sourceFlag
+		} else if env, ok := envSource(envVars); ok {
+			source = env
+		}
+
+		value := f.Value.String()
+		if f.Value.Type() == "string" {
+			value = strconv.Quote(value)
+		}
+
+		fmt.Fprintf(tw, "--%s\t%s\t%s\n", f.Name, value, source)
+	})
+
+	for _, envVar := range []string{editorsEnvVar, pluginDirEnvVar, pluginsEnvVar, suffixesEnvVar} {
+		source := sourceDefault
+		if env, ok := envSource([]string{envVar}); ok {
+			source = env
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", envVar, strconv.Quote(os.Getenv(envVar)), source)
+	}
+
+	return tw.Flush()
+}
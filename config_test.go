@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestWriteConfig(t *testing.T) {
+	t.Setenv(editorEnvVars[0], "")
+	t.Setenv(editorEnvVars[1], "nano")
+	t.Setenv(lockEnvVar, "no")
+	t.Setenv(identitiesFileEnvVar, "ids.txt")
+
+	flag := pflag.NewFlagSet("age-edit", pflag.ContinueOnError)
+	flag.BoolP("armor", "a", false, "")
+	flag.String("editor", "nano", "")
+	flag.Bool("no-lock", true, "")
+	flag.Int("warn", 0, "")
+	flag.BoolP("version", "V", false, "")
+
+	if err := flag.Parse([]string{"-a", "secret.age"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeConfig(&buf, flag, "ids.txt", "secret.age"); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := strings.Fields(line)
+		lines[fields[0]] = fields[1:]
+	}
+
+	tests := map[string]string{
+		"identities": `"ids.txt" env ` + identitiesFileEnvVar,
+		"encrypted":  `"secret.age" argument`,
+		"--armor":    "true flag",
+		"--editor":   `"nano" env ` + editorEnvVars[1],
+		"--no-lock":  "true env " + lockEnvVar,
+		"--warn":     "0 default",
+	}
+
+	for name, want := range tests {
+		if got := strings.Join(lines[name], " "); got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	if _, ok := lines["--version"]; ok {
+		t.Error("expected no line for --version")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// confirmSavedDir is the subdirectory of the temporary directory
+// with a copy of the plaintext as it was last saved, which --confirm-save compares against.
+const confirmSavedDir = "saved"
+
+// snapshotFile copies the plaintext in the temporary directory for a later comparison.
+// A missing file is copied as an empty one, like a new file before the first save.
+func snapshotFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), tempDirPerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, data, filePerm)
+}
+
+// confirmSave shows the changes to the plaintext since the last save with a diff command
+// and asks whether to save them.
+// The paths are relative to dir, so the diff doesn't show the temporary directory.
+// It returns true without asking when the diff command finds no changes.
+// If the diff command fails, it still asks, so the changes aren't lost.
+// The end of input declines.
+func confirmSave(r *bufio.Reader, w io.Writer, diffCmd string, diffArgs []string, dir, savedPath, editedPath string) bool {
+	fullArgs := append([]string{}, diffArgs...)
+	fullArgs = append(fullArgs, savedPath, editedPath)
+
+	cmd := exec.CommandContext(context.Background(), diffCmd, fullArgs...)
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil:
+		return true
+
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == diffExitDifferent:
+
+	default:
+		fmt.Fprintf(w, "Warning: diff command failed: %v\n", err)
+	}
+
+	for {
+		fmt.Fprint(w, "Save these changes? [y/n] ")
+
+		line, err := r.ReadString('\n')
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+
+		case "n", "no":
+			return false
+		}
+
+		if err != nil {
+			fmt.Fprintln(w)
+
+			return false
+		}
+	}
+}
+
+// confirmCreate asks whether to create an encrypted file that doesn't exist,
+// so a typo in the path doesn't start a new file instead of opening the intended one.
+// Only "y" or "yes" accepts; an empty answer and the end of input decline.
+func confirmCreate(r io.Reader, w io.Writer, path string) bool {
+	fmt.Fprintf(w, "Create new encrypted file %q? [y/N] ", path)
+
+	line, err := readLine(r)
+	if err != nil && line == "" {
+		fmt.Fprintln(w)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
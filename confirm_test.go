@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfirmSave(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	savedPath := filepath.Join(confirmSavedDir, "secret.txt")
+
+	if err := snapshotFile(filepath.Join(dir, "missing"), filepath.Join(dir, savedPath)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("edited\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"y\n", true},
+		{"yes\n", true},
+		{"maybe\nn\n", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+
+		r := bufio.NewReader(strings.NewReader(test.input))
+
+		if got := confirmSave(r, &output, "diff", []string{"-u"}, dir, savedPath, "secret.txt"); got != test.expected {
+			t.Errorf("input %q: expected %v, got %v", test.input, test.expected, got)
+		}
+
+		if !strings.Contains(output.String(), "+edited") {
+			t.Errorf("input %q: expected the diff in the output, got %q", test.input, output.String())
+		}
+	}
+
+	// Without changes, there is nothing to confirm.
+	if err := snapshotFile(filepath.Join(dir, "secret.txt"), filepath.Join(dir, savedPath)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(strings.NewReader(""))
+
+	if !confirmSave(r, &bytes.Buffer{}, "diff", []string{"-u"}, dir, savedPath, "secret.txt") {
+		t.Error("expected no question without changes")
+	}
+}
+
+func TestConfirmCreate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"y\n", true},
+		{"Yes\n", true},
+		{"\n", false},
+		{"n\n", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+
+		if got := confirmCreate(strings.NewReader(test.input), &output, "secret.age"); got != test.expected {
+			t.Errorf("input %q: expected %v, got %v", test.input, test.expected, got)
+		}
+
+		if !strings.Contains(output.String(), `"secret.age"`) {
+			t.Errorf("input %q: expected the path in the question, got %q", test.input, output.String())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"filippo.io/age"
+)
+
+// conflictError reports that the encrypted file changed on disk during an editing session,
+// for example, because a sync tool brought in an edit from another machine.
+// The changes of the session are in a separate file, so nothing is lost.
+type conflictError struct {
+	encPath  string
+	oursPath string
+	basePath string
+	// where is where the file changed, like "on disk".
+	where string
+}
+
+func (e *conflictError) Error() string {
+	message := fmt.Sprintf(
+		"%q changed %s since it was opened; your version was encrypted to %q instead",
+		e.encPath,
+		e.where,
+		e.oursPath,
+	)
+
+	if e.basePath != "" {
+		message += fmt.Sprintf(
+			", and the version you opened to %q; merge them with \"age-edit merge %s %s %s\"",
+			e.basePath,
+			shellQuote(e.basePath),
+			shellQuote(e.encPath),
+			shellQuote(e.oursPath),
+		)
+	}
+
+	return message
+}
+
+// changedOnDisk reports whether an encrypted file differs from the ciphertext that was opened.
+// A file that was removed since isn't a change; saving creates it again.
+func changedOnDisk(encPath string, opened []byte, existed bool) (bool, error) {
+	current, err := os.ReadFile(encPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !existed || !bytes.Equal(current, opened), nil
+}
+
+// sidecarStamp returns the part of the names of the copies of an encrypted file next to it
+// that makes them unique, like "20250102T150405-0123abcd".
+// The random part keeps sessions that write a copy in the same second from replacing each other's.
+func sidecarStamp(now time.Time) string {
+	return now.Format(trashTimeLayout) + "-" + randomID()
+}
+
+// keepConflict encrypts the plaintext next to an encrypted file that changed on disk instead of over it.
+// It also writes the ciphertext that was opened, so the versions can be merged with a common base.
+func keepConflict(
+	encPath string,
+	opened []byte,
+	existed bool,
+	tempFile string,
+	armored bool,
+	encodeCmd string,
+	encodeArgs []string,
+	recipients ...age.Recipient,
+) (*conflictError, error) {
+	root := getRoot(encPath)
+	stamp := sidecarStamp(time.Now())
+
+	conflict := &conflictError{
+		encPath:  encPath,
+		oursPath: fmt.Sprintf("%s.conflict-%s.age", root, stamp),
+		basePath: "",
+		where:    "on disk",
+	}
+
+	if err := encryptToFile(tempFile, conflict.oursPath, true, armored, encodeCmd, encodeArgs, recipients...); err != nil {
+		return nil, err
+	}
+
+	if existed {
+		basePath := fmt.Sprintf("%s.base-%s.age", root, stamp)
+
+		if err := os.WriteFile(basePath, opened, filePerm); err != nil {
+			return conflict, err
+		}
+
+		conflict.basePath = basePath
+	}
+
+	return conflict, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestChangedOnDisk(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	encPath := filepath.Join(dir, "secret.age")
+	missingPath := filepath.Join(dir, "missing.age")
+
+	if err := os.WriteFile(encPath, []byte("ciphertext"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		opened  string
+		existed bool
+		want    bool
+	}{
+		{encPath, "ciphertext", true, false},
+		{encPath, "other", true, true},
+		{encPath, "", false, true},
+		{missingPath, "ciphertext", true, false},
+		{missingPath, "", false, false},
+	}
+
+	for _, test := range tests {
+		got, err := changedOnDisk(test.path, []byte(test.opened), test.existed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != test.want {
+			t.Errorf("%s, opened %q, existed %v: expected %v, got %v", filepath.Base(test.path), test.opened, test.existed, test.want, got)
+		}
+	}
+}
+
+func TestKeepConflict(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	encPath := filepath.Join(dir, "secret.txt.age")
+	tempFile := filepath.Join(dir, "secret.txt")
+
+	if err := os.WriteFile(tempFile, []byte("ours"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	conflict, err := keepConflict(encPath, []byte("opened ciphertext"), true, tempFile, false, "", []string{}, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(filepath.Base(conflict.oursPath), "secret.txt.conflict-") || !strings.HasSuffix(conflict.oursPath, ".age") {
+		t.Errorf("unexpected conflict path %q", conflict.oursPath)
+	}
+
+	if err := decryptToFile(conflict.oursPath, filepath.Join(dir, "ours"), "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	ours, err := os.ReadFile(filepath.Join(dir, "ours"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ours) != "ours" {
+		t.Errorf("expected our version in the conflict file, got %q", ours)
+	}
+
+	base, err := os.ReadFile(conflict.basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(base) != "opened ciphertext" {
+		t.Errorf("expected the opened ciphertext in the base file, got %q", base)
+	}
+
+	if !strings.Contains(conflict.Error(), "age-edit merge") {
+		t.Errorf("expected a merge hint in %q", conflict.Error())
+	}
+
+	// Another session with a conflict in the same second doesn't replace the copies.
+	other, err := keepConflict(encPath, []byte("other ciphertext"), true, tempFile, false, "", []string{}, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other.oursPath == conflict.oursPath || other.basePath == conflict.basePath {
+		t.Errorf("expected new paths for another conflict, got %q and %q", other.oursPath, other.basePath)
+	}
+
+	if base, err := os.ReadFile(conflict.basePath); err != nil || string(base) != "opened ciphertext" {
+		t.Errorf("expected the first base file to be kept, got %q: %v", base, err)
+	}
+
+	sidecars, err := sidecarsOf(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sidecars) != 4 {
+		t.Errorf("expected rm to find the conflict and base files, got %q", sidecars)
+	}
+}
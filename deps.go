@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// dependency is an external command a session needs.
+type dependency struct {
+	role    string
+	command string
+	hint    string
+}
+
+// checkDependencies verifies that external commands exist and are executable.
+// It is called before anything is decrypted, so a missing command doesn't fail the session
+// halfway through.
+// It reports all missing commands at once.
+// Dependencies with an empty command are skipped.
+func checkDependencies(deps ...dependency) error {
+	problems := []string{}
+
+	for _, dep := range deps {
+		if dep.command == "" {
+			continue
+		}
+
+		if _, err := lookPath(dep.command); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q: %v; %s", dep.role, dep.command, unwrapLookPathError(err), dep.hint))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("missing commands:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// lookPath finds an external command like exec.LookPath.
+// A built-in filter needs no executable, so it is found if age-edit has it.
+func lookPath(command string) (string, error) {
+	if strings.HasPrefix(command, builtinFilterPrefix) {
+		if _, err := findBuiltinFilter(command); err != nil {
+			return "", err
+		}
+
+		return command, nil
+	}
+
+	return exec.LookPath(command)
+}
+
+// unwrapLookPathError removes the command name LookPath includes in its errors.
+func unwrapLookPathError(err error) error {
+	if execErr, ok := err.(*exec.Error); ok { //nolint:errorlint
+		return execErr.Err
+	}
+
+	return err
+}
+
+// decodeDependency describes a decode filter.
+func decodeDependency(command string) dependency {
+	return dependency{
+		role:    "decode filter",
+		command: command,
+		hint:    fmt.Sprintf("install it or change --decode or %s", decodeEnvVar),
+	}
+}
+
+// encodeDependency describes an encode filter.
+func encodeDependency(command string) dependency {
+	return dependency{
+		role:    "encode filter",
+		command: command,
+		hint:    fmt.Sprintf("install it or change --encode or %s", encodeEnvVar),
+	}
+}
+
+// editDependencies returns the external commands an editing session needs.
+func editDependencies(cfg config) []dependency {
+	deps := []dependency{
+		{
+			role:    "editor",
+			command: cfg.command,
+			hint: fmt.Sprintf(
+				"install it or change --editor, --command, %s, or %s",
+				strings.Join(editorEnvVars, ", "),
+				commandEnvVar,
+			),
+		},
+		decodeDependency(cfg.decodeCmd),
+		encodeDependency(cfg.encodeCmd),
+		validatorDependency(cfg.validateCmd),
+	}
+
+	return append(deps, hookDependencies(cfg.hooks)...)
+}
+
+// pagerDependency describes a pager.
+func pagerDependency(command string) dependency {
+	return dependency{
+		role:    "pager",
+		command: command,
+		hint: fmt.Sprintf(
+			"install it, change --pager or %s, or unset them to use the built-in pager",
+			strings.Join(pagerEnvVars, ", "),
+		),
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	t.Parallel()
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkDependencies(
+		dependency{role: "editor", command: self, hint: "-"},
+		decodeDependency(""),
+		dependency{role: "first", command: "age-edit-test-missing-1", hint: "hint 1"},
+		dependency{role: "second", command: "age-edit-test-missing-2", hint: "hint 2"},
+	)
+	if err == nil {
+		t.Fatal("checkDependencies() succeeded with missing commands")
+	}
+
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "hint 1") || !strings.Contains(lines[2], "hint 2") {
+		t.Errorf("checkDependencies() returned %q, expected both missing commands", err)
+	}
+
+	if err := checkDependencies(dependency{role: "editor", command: self, hint: "-"}); err != nil {
+		t.Errorf("checkDependencies() returned %v for an existing command", err)
+	}
+}
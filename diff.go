@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+const (
+	diffEnvVar         = "AGE_EDIT_DIFF"
+	defaultDiffCommand = "diff -u"
+	defaultDiffAgainst = "HEAD"
+
+	// diffExitDifferent is the exit status of diff(1) when the files differ.
+	diffExitDifferent = 1
+)
+
+// revisionCiphertext returns the encrypted contents of another version of a file.
+// The revision is a version in the history, like "@1",
+// the path of an encrypted file, like a trash entry,
+// or a Git revision of the repository the file is in.
+func revisionCiphertext(encPath, revision string) ([]byte, error) {
+	if n, ok := parseHistoryRevision(revision); ok {
+		path, err := historyVersion(encPath, n)
+		if err != nil {
+			return nil, err
+		}
+
+		return os.ReadFile(path)
+	}
+
+	if info, err := os.Stat(revision); err == nil && info.Mode().IsRegular() {
+		return os.ReadFile(revision)
+	}
+
+	absPath, err := filepath.Abs(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, name := filepath.Split(absPath)
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(context.Background(), "git", "-C", dir, "show", revision+":./"+name)
+	cmd.Stderr = &stderr
+
+	ciphertext, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%q is neither a file nor a Git revision of %q: %w: %s",
+			revision,
+			encPath,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	return ciphertext, nil
+}
+
+// diffVersions decrypts two versions of a file to a temporary directory,
+// compares them with the diff command, and shows the differences in the pager.
+// It returns the temporary directory path, whether the versions differ, and any error encountered.
+// The caller is responsible for cleaning up the temporary directory.
+func diffVersions(cfg config, against, diffCmd string, diffArgs []string) (string, bool, error) {
+	identities, _, err := openIdentities(cfg.idsPath, cfg.lockKeys)
+	if err != nil {
+		return "", false, err
+	}
+
+	identities = orderIdentities(identities, cfg.prefer)
+
+	ciphertext, err := revisionCiphertext(cfg.encPath, against)
+	if err != nil {
+		return "", false, err
+	}
+
+	tempDir, err := newTempDir(cfg.tempDirPrefix)
+	if err != nil {
+		return tempDir, false, err
+	}
+
+	revisionPath := filepath.Join(tempDir, "revision.age")
+	if err := os.WriteFile(revisionPath, ciphertext, filePerm); err != nil {
+		return tempDir, false, err
+	}
+
+	// The diff command runs in the temporary directory,
+	// so the headers of a unified diff show "a/name" and "b/name".
+	name := filepath.Base(getRoot(cfg.encPath))
+	versions := []struct {
+		encPath string
+		path    string
+	}{
+		{revisionPath, filepath.Join("a", name)},
+		{cfg.encPath, filepath.Join("b", name)},
+	}
+
+	for _, version := range versions {
+		path := filepath.Join(tempDir, version.path)
+
+		if err := os.Mkdir(filepath.Dir(path), tempDirPerm); err != nil {
+			return tempDir, false, err
+		}
+
+		if err := decryptToFile(version.encPath, path, cfg.decodeCmd, cfg.decodeArgs, identities...); err != nil {
+			return tempDir, false, fmt.Errorf("%s: %w", version.encPath, err)
+		}
+	}
+
+	diffPath := filepath.Join(tempDir, "diff")
+
+	out, err := os.OpenFile(diffPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+	if err != nil {
+		return tempDir, false, err
+	}
+
+	fullArgs := append([]string{}, diffArgs...)
+	fullArgs = append(fullArgs, versions[0].path, versions[1].path)
+
+	cmd := exec.CommandContext(context.Background(), diffCmd, fullArgs...)
+	cmd.Dir = tempDir
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	_ = out.Close()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil:
+		return tempDir, false, nil
+
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == diffExitDifferent:
+
+	default:
+		return tempDir, false, fmt.Errorf("diff command failed: %w", err)
+	}
+
+	if err := os.Chmod(diffPath, fileReadOnlyPerm); err != nil {
+		return tempDir, true, err
+	}
+
+	return tempDir, true, showFile(cfg, diffPath)
+}
+
+// diffCommand implements the "diff" subcommand.
+func diffCommand(sub subcommand, args []string) int {
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Decrypt two versions of a file and show the differences in a pager. The other version is a version in the history, like @1, an encrypted file, like an entry in the trash, or a Git revision of the repository the file is in. Like with diff(1), the exit status is 0 when the versions are the same, 1 when they differ, and 2 on trouble.",
+		fmt.Sprintf(
+			"  identities              identities file path (%s%s)\n  encrypted               encrypted file path (%s%s)\n",
+			identitiesFileEnvVar,
+			identitiesFileHelpDefault,
+			encryptedFileEnvVar,
+			encryptedFileHelpDefault,
+		),
+	)
+
+	against := flag.String(
+		"against",
+		defaultDiffAgainst,
+		"history version, encrypted file, or Git revision to compare with",
+	)
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	diff := flag.String(
+		"diff",
+		defaultDiff(),
+		fmt.Sprintf("diff command (%v)", diffEnvVar),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	pager := flag.StringP(
+		"pager",
+		"p",
+		defaultPager(),
+		fmt.Sprintf("pager command (default: built-in, %v)", strings.Join(pagerEnvVars, ", ")),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	tempDirPrefix := flag.StringP(
+		"temp-dir",
+		"t",
+		defaultTempDirPrefix(),
+		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > cliMaxArgs {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	cfg := config{
+		idsPath:       identitiesFileDefault,
+		encPath:       encryptedFileDefault,
+		otherPaths:    []string{},
+		tempDirPrefix: *tempDirPrefix,
+		trashDir:      "",
+		trashTTL:      0,
+		lockStrategy:  lockStrategyFlock,
+		lockExpiry:    0,
+		autosave:      0,
+		idleTimeout:   0,
+		history:       0,
+		historyMaxAge: 0,
+		historyStore:  historyStoreFile,
+		backups:       0,
+		maxShrink:     0,
+		minSize:       0,
+		template:      "",
+		gitMessage:    "",
+		plainName:     "",
+		wait:          "",
+
+		allowEmpty:    false,
+		allowShrink:   false,
+		armor:         false,
+		autoFilter:    false,
+		chdir:         false,
+		confirmSave:   false,
+		force:         false,
+		fsync:         true,
+		gitCommit:     false,
+		inhibitSleep:  false,
+		keepFormat:    false,
+		keepTemp:      false,
+		lock:          false,
+		lockKeys:      false,
+		notify:        false,
+		openBinary:    false,
+		park:          false,
+		preserveMtime: false,
+		readOnly:      true,
+		stay:          false,
+		supervise:     false,
+		tty:           false,
+		verbose:       false,
+		warnDroppings: false,
+		watch:         false,
+		yes:           false,
+
+		alsoSave: []string{},
+		prefer:   *prefer,
+
+		saveSignals:  []string{},
+		revertSignal: "",
+
+		command: "",
+		args:    []string{},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{level: 0, threads: 0, window: 0},
+
+		hooks: hookSet{},
+	}
+
+	//nolint:mnd
+	if flag.NArg() == 1 {
+		cfg.encPath = flag.Arg(0)
+	} else if flag.NArg() == 2 {
+		cfg.idsPath = flag.Arg(0)
+		cfg.encPath = flag.Arg(1)
+	}
+
+	if cfg.encPath == "" || (cfg.idsPath == "" && !agentAvailable()) {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file and an encrypted file")
+
+		return exitBadUsage
+	}
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			cfg.lockKeys = true
+		}
+	}
+
+	if *pager != "" {
+		args, err := shlex.Split(*pager, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split pager command")
+
+			return exitBadUsage
+		}
+
+		cfg.command = args[0]
+		cfg.args = args[1:]
+	}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		cfg.decodeCmd = args[0]
+		cfg.decodeArgs = args[1:]
+	}
+
+	diffArgs, err := shlex.Split(*diff, true)
+	if err != nil || len(diffArgs) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: failed to split diff command")
+
+		return exitBadUsage
+	}
+
+	deps := []dependency{
+		pagerDependency(cfg.command),
+		decodeDependency(cfg.decodeCmd),
+		{
+			role:    "diff command",
+			command: diffArgs[0],
+			hint:    fmt.Sprintf("install it or change --diff or %s", diffEnvVar),
+		},
+	}
+
+	_, isHistory := parseHistoryRevision(*against)
+
+	if info, err := os.Stat(*against); !isHistory && (err != nil || !info.Mode().IsRegular()) {
+		deps = append(deps, dependency{
+			role:    "Git",
+			command: "git",
+			hint:    "install Git or pass an encrypted file to --against",
+		})
+	}
+
+	if err := checkDependencies(deps...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	tempDir, different, err := diffVersions(cfg, *against, diffArgs[0], diffArgs[1:])
+	if tempDir != "" {
+		defer removeTempDir(tempDir)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	if !different {
+		return exitOK
+	}
+
+	return exitError
+}
+
+func defaultDiff() string {
+	diff := os.Getenv(diffEnvVar)
+	if diff == "" {
+		diff = defaultDiffCommand
+	}
+
+	return diff
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestDiffVersions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test pager is a shell script")
+	}
+
+	if _, err := exec.LookPath("diff"); err != nil {
+		t.Skip("diff(1) not found")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(name, content string) string {
+		plainPath := filepath.Join(tempDir, name)
+		encPath := plainPath + ".age"
+
+		if err := os.WriteFile(plainPath, []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encryptToFile(plainPath, encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+
+		return encPath
+	}
+
+	oldPath := encrypt("old", "one\ntwo\n")
+	newPath := encrypt("new", "one\nthree\n")
+	outPath := filepath.Join(tempDir, "out")
+
+	cfg := config{
+		idsPath:       idsPath,
+		encPath:       newPath,
+		tempDirPrefix: tempDir,
+
+		readOnly: true,
+
+		prefer: []string{},
+
+		command: "sh",
+		args:    []string{"-c", `cat "$1" >` + outPath, "sh"},
+	}
+
+	diffTempDir, different, err := diffVersions(cfg, oldPath, "diff", []string{"-u"})
+	if diffTempDir != "" {
+		defer os.RemoveAll(diffTempDir)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !different || !strings.Contains(string(out), "-two\n+three\n") || !strings.Contains(string(out), "+++ b/new") {
+		t.Errorf("diffVersions() returned %v and showed:\n%s", different, out)
+	}
+
+	sameTempDir, different, err := diffVersions(cfg, newPath, "diff", []string{"-u"})
+	if sameTempDir != "" {
+		defer os.RemoveAll(sameTempDir)
+	}
+
+	if err != nil || different {
+		t.Errorf("diffVersions() of the same version returned %v, %v", different, err)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+const doctorWarn = "warn"
+
+var (
+	errUnknownFilesystem = errors.New("can't tell the filesystem type on this platform")
+
+	// ramFilesystems are the names of filesystems stored in memory on the BSDs and macOS.
+	ramFilesystems = map[string]bool{"mfs": true, "tmpfs": true}
+)
+
+// doctorResult is the outcome of one check of the "doctor" subcommand.
+// Unless the check passed, fix tells the user what to do about it.
+type doctorResult struct {
+	check  string
+	status string
+	detail string
+	fix    string
+}
+
+// doctorOptions configures the checks of the "doctor" subcommand.
+type doctorOptions struct {
+	self          string
+	idsPath       string
+	encPath       string
+	tempDirPrefix string
+	memlock       bool
+	locking       lockOptions
+	deps          []dependency
+}
+
+// runDoctor checks the environment age-edit runs in without decrypting anything.
+func runDoctor(opts doctorOptions) []doctorResult {
+	results := []doctorResult{
+		doctorTempDir(opts.tempDirPrefix),
+		doctorMemlock(opts.memlock),
+	}
+
+	results = append(results, doctorDependencies(opts.deps)...)
+	results = append(results, doctorIdentities(opts.idsPath), doctorLocking(opts.self, opts.encPath, opts.locking))
+
+	return results
+}
+
+// doctorTempDir checks that the temporary directory prefix exists and is stored in memory,
+// so the plaintext never reaches the disk.
+func doctorTempDir(prefix string) doctorResult {
+	result := doctorResult{check: "temp-dir", status: exerciseOK, detail: prefix, fix: ""}
+
+	info, err := os.Stat(prefix)
+	if err != nil || !info.IsDir() {
+		if err == nil {
+			err = errors.New("not a directory")
+		}
+
+		result.status = exerciseFail
+		result.detail = err.Error()
+		result.fix = fmt.Sprintf("create %s or set --temp-dir or %s to a directory in memory", prefix, tempDirPrefixEnvVar)
+
+		return result
+	}
+
+	ram, err := ramBacked(prefix)
+
+	switch {
+	case errors.Is(err, errUnknownFilesystem):
+		result.status = exerciseSkip
+		result.detail = err.Error()
+
+	case err != nil:
+		result.status = exerciseFail
+		result.detail = err.Error()
+
+	case !ram:
+		result.status = doctorWarn
+		result.detail = prefix + " is stored on disk"
+		result.fix = fmt.Sprintf("set --temp-dir or %s to a directory on tmpfs, like /dev/shm", tempDirPrefixEnvVar)
+	}
+
+	return result
+}
+
+// doctorMemlock checks that memory can be locked to keep the plaintext and the keys out of swap.
+func doctorMemlock(enabled bool) doctorResult {
+	result := doctorResult{check: "memlock", status: exerciseOK, detail: "", fix: ""}
+
+	switch {
+	case !enabled:
+		result.status = exerciseSkip
+		result.detail = "disabled by " + memlockEnvVar
+
+	case !memlockSupported:
+		result.status = exerciseSkip
+		result.detail = "memory locking isn't available on this platform"
+
+	default:
+		if err := lockMemory(); err != nil {
+			result.status = doctorWarn
+			result.detail = err.Error()
+			result.fix = fmt.Sprintf(
+				"raise the limit on locked memory with \"ulimit -l\" or in /etc/security/limits.conf, or set %s=0 to accept swapping",
+				memlockEnvVar,
+			)
+
+			break
+		}
+
+		result.detail = memoryProtection(true, false)
+	}
+
+	return result
+}
+
+// doctorDependencies checks that the editor and the filters exist.
+func doctorDependencies(deps []dependency) []doctorResult {
+	results := []doctorResult{}
+
+	for _, dep := range deps {
+		if dep.command == "" {
+			continue
+		}
+
+		path, err := lookPath(dep.command)
+		if err != nil {
+			results = append(results, doctorResult{
+				check:  dep.role,
+				status: exerciseFail,
+				detail: fmt.Sprintf("%q: %v", dep.command, unwrapLookPathError(err)),
+				fix:    dep.hint,
+			})
+
+			continue
+		}
+
+		results = append(results, doctorResult{check: dep.role, status: exerciseOK, detail: path, fix: ""})
+	}
+
+	return results
+}
+
+// doctorIdentities checks that the identities file parses or that the agent is available.
+func doctorIdentities(idsPath string) doctorResult {
+	result := doctorResult{check: "identities", status: exerciseOK, detail: "", fix: ""}
+
+	if idsPath == "" && !agentAvailable() {
+		result.status = exerciseFail
+		result.detail = "no identities file"
+		result.fix = fmt.Sprintf("pass an identities file, set %s, or start \"age-edit agent\"", identitiesFileEnvVar)
+
+		return result
+	}
+
+	identities, _, err := openIdentities(idsPath, false)
+	if err != nil {
+		result.status = exerciseFail
+		result.detail = err.Error()
+		result.fix = "fix the identities file; \"age-edit identities\" lists what it can use"
+
+		return result
+	}
+
+	result.detail = fmt.Sprintf("%d usable", len(identities))
+
+	return result
+}
+
+// doctorLocking checks that locking works on the filesystem of the encrypted file.
+// It locks a scratch file next to the encrypted file and checks that the lock excludes other lockers.
+// The flock(2) lock is checked from another process
+// because some network filesystems only emulate it within a process.
+func doctorLocking(self, encPath string, opts lockOptions) doctorResult {
+	dir := filepath.Dir(encPath)
+	result := doctorResult{check: "locking", status: exerciseOK, detail: opts.strategy + " in " + dir, fix: ""}
+
+	fail := func(detail string) doctorResult {
+		result.status = exerciseFail
+		result.detail = detail
+
+		if opts.strategy == lockStrategyFlock {
+			result.fix = fmt.Sprintf("set --lock-strategy or %s to %s for this filesystem", lockStrategyEnvVar, lockStrategyDotlock)
+		} else {
+			result.fix = "make sure you can create files in " + dir
+		}
+
+		return result
+	}
+
+	f, err := os.CreateTemp(dir, ".age-edit-doctor-*")
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	scratch := f.Name()
+	_ = f.Close()
+
+	defer os.Remove(scratch)
+
+	fileLock := newFileLock(scratch, opts)
+
+	locked, err := fileLock.TryLock()
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	if !locked {
+		return fail("couldn't lock a new file")
+	}
+
+	defer func() {
+		_ = fileLock.Unlock()
+	}()
+
+	if opts.strategy == lockStrategyFlock {
+		if probe := exerciseLock(self, scratch); probe.status != exerciseOK {
+			return fail(probe.detail)
+		}
+
+		return result
+	}
+
+	locked, err = newFileLock(scratch, opts).TryLock()
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	if locked {
+		return fail("a second lock on the same file succeeded")
+	}
+
+	return result
+}
+
+// doctorCommand implements the "doctor" subcommand.
+func doctorCommand(sub subcommand, args []string) int {
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Check the environment age-edit runs in and suggest fixes: whether the temporary directory is in memory, whether memory can be locked, whether the editor and the filters exist, whether the identities parse, and whether file locking works where the encrypted file is. The settings come from the environment. Nothing is decrypted.",
+		fmt.Sprintf(
+			"  identities              identities file path (%s%s)\n  encrypted               encrypted file path (%s%s)\n",
+			identitiesFileEnvVar,
+			identitiesFileHelpDefault,
+			encryptedFileEnvVar,
+			encryptedFileHelpDefault,
+		),
+	)
+
+	tempDirPrefix := flag.StringP(
+		"temp-dir",
+		"t",
+		defaultTempDirPrefix(),
+		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > cliMaxArgs {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	cfg := config{
+		idsPath:       identitiesFileDefault,
+		encPath:       encryptedFileDefault,
+		otherPaths:    []string{},
+		tempDirPrefix: *tempDirPrefix,
+		trashDir:      "",
+		trashTTL:      0,
+		lockStrategy:  locking.strategy,
+		lockExpiry:    locking.expiry,
+		autosave:      0,
+		idleTimeout:   0,
+		history:       0,
+		historyMaxAge: 0,
+		historyStore:  historyStoreFile,
+		backups:       0,
+		maxShrink:     0,
+		minSize:       0,
+		template:      "",
+		gitMessage:    "",
+		plainName:     "",
+		wait:          "",
+
+		allowEmpty:    false,
+		allowShrink:   false,
+		armor:         false,
+		autoFilter:    false,
+		chdir:         false,
+		confirmSave:   false,
+		force:         false,
+		fsync:         true,
+		gitCommit:     false,
+		inhibitSleep:  false,
+		keepFormat:    false,
+		keepTemp:      false,
+		lock:          true,
+		lockKeys:      false,
+		notify:        false,
+		openBinary:    false,
+		park:          false,
+		preserveMtime: false,
+		readOnly:      false,
+		stay:          false,
+		supervise:     false,
+		tty:           false,
+		verbose:       false,
+		warnDroppings: false,
+		watch:         false,
+		yes:           false,
+
+		alsoSave: []string{},
+		prefer:   []string{},
+
+		saveSignals:  []string{},
+		revertSignal: "",
+
+		command: defaultEditor(),
+		args:    []string{},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{level: 0, threads: 0, window: 0},
+
+		hooks: hookSet{},
+	}
+
+	//nolint:mnd
+	if flag.NArg() == 1 {
+		cfg.encPath = flag.Arg(0)
+	} else if flag.NArg() == 2 {
+		cfg.idsPath = flag.Arg(0)
+		cfg.encPath = flag.Arg(1)
+	}
+
+	// Check locking in the current directory without an encrypted file.
+	if cfg.encPath == "" {
+		cfg.encPath = "file.age"
+	}
+
+	commands := []struct {
+		value string
+		name  string
+		cmd   *string
+	}{
+		{defaultCommand(), "editor", &cfg.command},
+		{defaultDecode(), "decode", &cfg.decodeCmd},
+		{defaultEncode(), "encode", &cfg.encodeCmd},
+	}
+
+	for _, command := range commands {
+		if command.value == "" {
+			continue
+		}
+
+		args, err := shlex.Split(command.value, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: failed to split %s command\n", command.name)
+
+			return exitBadUsage
+		}
+
+		*command.cmd = args[0]
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	results := runDoctor(doctorOptions{
+		self:          self,
+		idsPath:       cfg.idsPath,
+		encPath:       cfg.encPath,
+		tempDirPrefix: cfg.tempDirPrefix,
+		memlock:       defaultMemlockVal,
+		locking:       locking,
+		deps:          editDependencies(cfg),
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+	code := exitOK
+	fixes := []string{}
+
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+
+	for _, result := range results {
+		detail := result.detail
+		if detail == "" {
+			detail = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.check, result.status, detail)
+
+		if result.fix != "" {
+			fixes = append(fixes, fmt.Sprintf("%s: %s", result.check, result.fix))
+		}
+
+		if result.status == exerciseFail {
+			code = exitError
+		}
+	}
+
+	_ = w.Flush()
+
+	if len(fixes) > 0 {
+		fmt.Printf("\nTo fix:\n  %s\n", strings.Join(fixes, "\n  "))
+	}
+
+	return code
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	if result := doctorTempDir(filepath.Join(tempDir, "missing")); result.status != exerciseFail || result.fix == "" {
+		t.Errorf("doctorTempDir() with a missing directory returned %+v", result)
+	}
+
+	results := doctorDependencies([]dependency{
+		{role: "editor", command: "age-edit-nonexistent-editor", hint: "install it"},
+		{role: "decode filter", command: "", hint: ""},
+	})
+	if len(results) != 1 || results[0].status != exerciseFail || results[0].fix != "install it" {
+		t.Errorf("doctorDependencies() returned %+v", results)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids.txt")
+
+	if err := os.WriteFile(idsPath, []byte("not an identity\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := doctorIdentities(idsPath); result.status != exerciseFail {
+		t.Errorf("doctorIdentities() with a malformed file returned %+v", result)
+	}
+
+	encPath := filepath.Join(tempDir, "file.age")
+	locking := lockOptions{strategy: lockStrategyDotlock, expiry: 0}
+
+	if result := doctorLocking("", encPath, locking); result.status != exerciseOK {
+		t.Errorf("doctorLocking() returned %+v", result)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("doctorLocking() left behind %d files", len(entries)-1)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+)
+
+// droppingPatterns match the swap, backup, undo, and autosave files that editors write next to a file.
+var droppingPatterns = []string{
+	// Backups of many editors and undo files of Vim, like "secret.txt~" and ".secret.txt.un~".
+	"*~",
+	// Swap files of Vim, like ".secret.txt.swp" and ".secret.txt.swo".
+	".*.sw?",
+	"*.bak",
+	// Lock symlinks and autosave files of Emacs.
+	".#*",
+	"#*#",
+}
+
+// isDropping reports whether a file name is that of a file an editor leaves next to the file it edits.
+func isDropping(name string) bool {
+	for _, pattern := range droppingPatterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scrubDroppings shreds the files editors leave in the temporary directory, which can hold the plaintext.
+// The paths in own belong to the session and are skipped, like the plaintext and the trees of archives,
+// where a file like "notes.bak" belongs to the user.
+// It returns the files it has removed.
+func scrubDroppings(tempDir string, own []string) ([]string, error) {
+	removed := []string{}
+	errs := []error{}
+
+	err := filepath.WalkDir(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if slices.Contains(own, path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.IsDir() || !isDropping(d.Name()) {
+			return nil
+		}
+
+		if err := shredTree(path); err != nil {
+			errs = append(errs, err)
+
+			return nil
+		}
+
+		removed = append(removed, path)
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, err)
+	}
+
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIsDropping(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]bool{
+		"secret.txt~":       true,
+		".secret.txt.un~":   true,
+		".secret.txt.swp":   true,
+		".secret.txt.swo":   true,
+		"secret.txt.bak":    true,
+		".#secret.txt":      true,
+		"#secret.txt#":      true,
+		"secret.txt":        false,
+		"secret.swp":        false,
+		".age-edit-session": false,
+	} {
+		if got := isDropping(name); got != want {
+			t.Errorf("isDropping(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestScrubDroppings(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	tempFile := filepath.Join(tempDir, "notes.bak")
+	tree := filepath.Join(tempDir, "tree")
+	swap := filepath.Join(tempDir, ".notes.bak.swp")
+	backup := filepath.Join(tempDir, "sub", "secret.txt~")
+	inTree := filepath.Join(tree, "old.bak")
+
+	for _, path := range []string{tempFile, swap, backup, inTree} {
+		if err := os.MkdirAll(filepath.Dir(path), tempDirPerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte("secret"), filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := scrubDroppings(tempDir, []string{tempFile, tree})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(removed)
+
+	if want := []string{swap, backup}; !slices.Equal(removed, want) {
+		t.Errorf("expected %q to be removed, got %q", want, removed)
+	}
+
+	for _, path := range []string{tempFile, inTree} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %q to stay: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/term"
+)
+
+// editFile is an encrypted file in an editing session and its plaintext in the temporary directory.
+// A session can edit several files; each has its own lock and its own change detection.
+type editFile struct {
+	// cfg is the configuration of the session with the path and the format of this file.
+	cfg config
+
+	// linkPath is the path the user gave, which may be a symlink to cfg.encPath.
+	linkPath string
+	// remote is the file on a server when cfg.encPath is its local copy.
+	remote   remoteFile
+	tempFile string
+	// tempInfo is the temporary file as the session last saw it,
+	// to notice an editor that saves by renaming a new file over it.
+	tempInfo os.FileInfo
+	// dir is the unpacked tree of an archive, which the editor gets instead of the temporary file.
+	// The temporary file is then the tree packed again.
+	dir string
+	// savedPath is the plaintext as it was last saved for --confirm-save, relative to the temporary directory.
+	savedPath string
+	// env describes the file to its filters.
+	env []string
+	// recovered is the plaintext of a crashed session that replaces the decrypted plaintext.
+	recovered *leftover
+
+	exists    bool
+	opened    []byte
+	beforeSum []byte
+	savedSize int64
+	conflict  *conflictError
+	// unmirrored is set when copies of the last save couldn't be written.
+	unmirrored bool
+	// rejectedSum is the checksum of the plaintext the validator last rejected.
+	rejectedSum []byte
+
+	// declined and refused record why the changes weren't saved when the session ends.
+	declined bool
+	refused  error
+
+	refreshLock func() error
+	releaseLock func() bool
+	relock      func() error
+	cleanups    []func()
+}
+
+// newEditFile checks that an encrypted file can be edited before anything is decrypted.
+// Editing a symlink edits the file it points to.
+// A URL edits a local copy of the remote file, which saving stores on the server.
+func newEditFile(cfg config, path string) (*editFile, error) {
+	remote, isRemote, err := openRemote(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if isRemote {
+		if path, err = remoteCopyPath(remote); err != nil {
+			return nil, err
+		}
+
+		if err := fetchRemote(remote, path); err != nil {
+			return nil, err
+		}
+
+		// The local copy isn't in a repository.
+		cfg.gitCommit = false
+	}
+
+	target, err := resolveSymlink(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.encPath = target
+
+	exists, err := checkAccess(cfg.encPath, cfg.readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.readOnly {
+		if err := checkMirrors(cfg.alsoSave, cfg.encPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if isArchive(cfg.encPath) && (cfg.confirmSave || cfg.watch) {
+		return nil, fmt.Errorf("--confirm-save and --watch don't work with archives like %q", cfg.encPath)
+	}
+
+	// Scripts can't answer, so only a user at a terminal is asked.
+	if !exists && !cfg.yes && term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec
+		name := cfg.encPath
+		if remote != nil {
+			name = remote.String()
+		}
+
+		if !confirmCreate(os.Stdin, os.Stderr, name) {
+			return nil, fmt.Errorf("%q doesn't exist and wasn't created", name)
+		}
+	}
+
+	// The user decides about the plaintext of crashed sessions before a new session starts.
+	var recovered *leftover
+	if !cfg.readOnly {
+		recovered = handleLeftovers(cfg)
+	}
+
+	return &editFile{
+		cfg: cfg,
+
+		linkPath:  path,
+		remote:    remote,
+		tempFile:  "",
+		tempInfo:  nil,
+		dir:       "",
+		savedPath: "",
+		env:       []string{},
+		recovered: recovered,
+
+		exists:    exists,
+		opened:    nil,
+		beforeSum: nil,
+		savedSize: 0,
+		conflict:  nil,
+
+		unmirrored: false,
+
+		declined: false,
+		refused:  nil,
+
+		refreshLock: func() error { return nil },
+		releaseLock: func() bool { return false },
+		relock:      func() error { return nil },
+		cleanups:    []func(){},
+	}, nil
+}
+
+// open locks the encrypted file and decrypts it to the temporary file.
+// The caller must call close afterward, even if open fails.
+func (f *editFile) open(tempDir, tempFile string, identities []age.Identity) error {
+	cfg := f.cfg
+	f.tempFile = tempFile
+
+	if isArchive(cfg.encPath) {
+		f.dir = strings.TrimSuffix(tempFile, archiveSuffix)
+	}
+
+	f.env = sessionEnv(tempDir, cfg.readOnly, []string{tempFile}, []string{cfg.encPath})
+	setFilterEnv(f.env)
+
+	unregister, err := registerSession(cfg.encPath, tempDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to record session:", err)
+	} else {
+		f.cleanups = append(f.cleanups, func() {
+			if err := unregister(); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: failed to remove session:", err)
+			}
+		})
+	}
+
+	lockOpts := lockOptions{strategy: cfg.lockStrategy, expiry: cfg.lockExpiry}
+	encLock := newFileLock(cfg.encPath, lockOpts)
+
+	//nolint:nestif
+	if f.exists {
+		if cfg.lock && !cfg.readOnly {
+			locked, err := encLock.TryLock()
+			if err != nil {
+				return fmt.Errorf("failed to acquire lock: %w", err)
+			}
+
+			if !locked {
+				return fmt.Errorf("encrypted file %q is locked", cfg.encPath)
+			}
+
+			f.cleanups = append(f.cleanups, func() {
+				_ = encLock.Unlock()
+			})
+
+			if dl, ok := encLock.(*dotlock); ok {
+				f.cleanups = append(f.cleanups, keepLockAlive(dl))
+
+				f.refreshLock = dl.Refresh
+			} else {
+				lockedInfo, err := os.Stat(cfg.encPath)
+				if err != nil {
+					return err
+				}
+
+				held := true
+
+				// Windows can't replace a file that is open, and the lock keeps it open.
+				f.releaseLock = func() bool {
+					if runtime.GOOS != "windows" {
+						return false
+					}
+
+					_ = encLock.Unlock()
+					held = false
+
+					return true
+				}
+
+				// Saving replaces the file, and flock(2) locks stay with the old file.
+				// A file rewritten in place is still the locked file.
+				f.relock = func() error {
+					info, err := os.Stat(cfg.encPath)
+					if err != nil {
+						return err
+					}
+
+					if held && os.SameFile(info, lockedInfo) {
+						return nil
+					}
+
+					newLock := newFileLock(cfg.encPath, lockOpts)
+
+					locked, err := newLock.TryLock()
+					if err != nil {
+						return fmt.Errorf("failed to acquire lock: %w", err)
+					}
+
+					if !locked {
+						return errors.New("encrypted file is locked")
+					}
+
+					_ = encLock.Unlock()
+					encLock = newLock
+					lockedInfo, held = info, true
+
+					return nil
+				}
+			}
+		}
+
+		// Keep the ciphertext to notice when the file changes on disk during the session.
+		f.opened, err = os.ReadFile(cfg.encPath)
+		if err != nil {
+			return err
+		}
+
+		// Save in the format of the file unless the user picked one.
+		if cfg.keepFormat {
+			f.cfg.armor = hasArmorHeader(f.opened)
+		}
+
+		if err := cfg.hooks.run(hookPreDecrypt, f.env); err != nil {
+			return err
+		}
+
+		if err := decryptToFile(cfg.encPath, tempFile, cfg.decodeCmd, cfg.decodeArgs, identities...); err != nil {
+			return err
+		}
+
+		// Filters the user has given win over the format of the plaintext.
+		if cfg.autoFilter && cfg.decodeCmd == "" && cfg.encodeCmd == "" {
+			if err := f.applyAutoFilter(); err != nil {
+				return err
+			}
+		}
+
+		if f.dir != "" {
+			if err := f.unpack(); err != nil {
+				if isArchive(cfg.encPath) {
+					return err
+				}
+
+				// An archive recognized by its content that age-edit can't unpack,
+				// like one with hard links or devices, is edited as it is.
+				fmt.Fprintf(os.Stderr, "Warning: %v; it opens as a file\n", err)
+
+				if err := shredTree(f.dir); err != nil {
+					return err
+				}
+
+				f.dir = ""
+			}
+		}
+
+		// The plaintext starts with the time of the encrypted file,
+		// so a save without changes to the text keeps the time.
+		if cfg.preserveMtime {
+			if err := copyModTime(cfg.encPath, tempFile); err != nil {
+				return err
+			}
+		}
+
+		if cfg.verbose {
+			fmt.Fprintln(os.Stderr, "Decrypted with identity", matchedIdentity(identities))
+		}
+
+		cfg.hooks.runAfter(hookPostDecrypt, f.env)
+	} else if f.dir != "" {
+		if err := os.Mkdir(f.dir, tempDirPerm); err != nil {
+			return err
+		}
+
+		if err := f.pack(); err != nil {
+			return err
+		}
+	} else if cfg.template != "" {
+		// The template is the starting point for comparison,
+		// so the file isn't created unless the editor changes the template.
+		if err := os.WriteFile(tempFile, []byte(cfg.template), filePerm); err != nil {
+			return err
+		}
+	}
+
+	f.beforeSum, err = checksumFile(tempFile)
+	if err != nil {
+		return err
+	}
+
+	// The size of the plaintext as it was last saved, to notice accidental truncation.
+	f.savedSize, err = plaintextSize(tempFile)
+	if err != nil {
+		return err
+	}
+
+	edited, err := filepath.Rel(tempDir, tempFile)
+	if err != nil {
+		return err
+	}
+
+	f.savedPath = filepath.Join(confirmSavedDir, edited)
+	if cfg.confirmSave {
+		if err := snapshotFile(tempFile, filepath.Join(tempDir, f.savedPath)); err != nil {
+			return err
+		}
+	}
+
+	if cfg.readOnly {
+		if err := os.Chmod(tempFile, fileReadOnlyPerm); err != nil {
+			return err
+		}
+
+		if f.dir != "" {
+			if err := makeTreeReadOnly(f.dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	return f.adoptReplacement()
+}
+
+// adoptReplacement notices when an editor has replaced the temporary file with a new file,
+// like by writing the new file and renaming it over the old one,
+// and gives the new file the permissions and the owner the session intends.
+// In read-only mode, the new file is made read-only again.
+// A missing file is left for save, which treats it as empty.
+func (f *editFile) adoptReplacement() error {
+	// The files in the tree of an archive are replaced the same way.
+	if f.cfg.readOnly && f.dir != "" {
+		if err := makeTreeReadOnly(f.dir); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Lstat(f.tempFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Reading the plaintext through a symlink could encrypt another file.
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("temporary file %q was replaced with something that isn't a regular file", f.tempFile)
+	}
+
+	if f.tempInfo != nil && os.SameFile(f.tempInfo, info) {
+		return nil
+	}
+
+	perm := os.FileMode(filePerm)
+	if f.cfg.readOnly {
+		perm = fileReadOnlyPerm
+	}
+
+	if info.Mode().Perm() != perm {
+		if err := os.Chmod(f.tempFile, perm); err != nil {
+			return err
+		}
+	}
+
+	if f.tempInfo != nil {
+		if err := copyOwner(f.tempFile, f.tempInfo); err != nil && !errors.Is(err, errOwnerNotCopied) {
+			return err
+		}
+	}
+
+	f.tempInfo, err = os.Lstat(f.tempFile)
+
+	return err
+}
+
+// editPath is the path the editor opens: the temporary file or the unpacked tree of an archive.
+func (f *editFile) editPath() string {
+	if f.dir != "" {
+		return f.dir
+	}
+
+	return f.tempFile
+}
+
+// unpack extracts the decrypted archive into the tree for the editor
+// and packs the tree again, so the temporary file is in the form that pack produces.
+func (f *editFile) unpack() error {
+	archive, err := os.Open(f.tempFile)
+	if err != nil {
+		return err
+	}
+
+	err = unpackArchive(archive, f.dir)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to unpack %q: %w", f.cfg.encPath, err)
+	}
+
+	return f.pack()
+}
+
+// pack packs the tree of an archive into the temporary file.
+// The temporary file is only written when the archive has changed, so it keeps its modification time otherwise.
+func (f *editFile) pack() error {
+	if f.dir == "" {
+		return nil
+	}
+
+	var archive bytes.Buffer
+
+	if err := packArchive(f.dir, &archive); err != nil {
+		return err
+	}
+
+	current, err := os.ReadFile(f.tempFile)
+	if err == nil && bytes.Equal(current, archive.Bytes()) {
+		return nil
+	}
+
+	return os.WriteFile(f.tempFile, archive.Bytes(), filePerm)
+}
+
+// close unlocks the encrypted file and removes the session record.
+func (f *editFile) close() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+
+	f.cleanups = nil
+}
+
+// save encrypts the plaintext over the encrypted file if the plaintext has changed since the last save.
+// The caller must serialize calls.
+func (f *editFile) save(tempDir string, recipients []age.Recipient) error {
+	cfg := f.cfg
+	setFilterEnv(f.env)
+
+	if err := f.refreshLock(); err != nil {
+		return err
+	}
+
+	if err := f.pack(); err != nil {
+		return err
+	}
+
+	if err := f.adoptReplacement(); err != nil {
+		return err
+	}
+
+	currentSum, err := checksumFile(f.tempFile)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.force && bytes.Equal(f.beforeSum, currentSum) {
+		// The copies that failed are tried again, since nothing else writes them.
+		if f.unmirrored {
+			return f.saveMirrors()
+		}
+
+		return nil
+	}
+
+	size, err := plaintextSize(f.tempFile)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 && f.savedSize > 0 && !cfg.allowEmpty {
+		return errEmptyPlaintext
+	}
+
+	if err := checkShrink(f.savedSize, size, cfg.maxShrink, cfg.minSize); err != nil {
+		if !cfg.allowShrink {
+			return fmt.Errorf("%w, so the encrypted file wasn't changed; use --allow-shrink to save it", err)
+		}
+
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+
+	if err := validatePlaintext(cfg.validateCmd, cfg.validateArgs, f.editPath(), f.env); err != nil {
+		var validationErr *validationError
+		if errors.As(err, &validationErr) {
+			validationErr.repeated = bytes.Equal(f.rejectedSum, currentSum)
+			f.rejectedSum = currentSum
+		}
+
+		return err
+	}
+
+	if f.linkPath != cfg.encPath {
+		if err := checkSymlinkTarget(f.linkPath, cfg.encPath); err != nil {
+			return err
+		}
+	}
+
+	// Once the file has changed on disk, the session saves to the conflict file.
+	if f.conflict == nil {
+		changed, err := changedOnDisk(cfg.encPath, f.opened, f.exists)
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			f.conflict, err = keepConflict(cfg.encPath, f.opened, f.exists, f.tempFile, cfg.armor, cfg.encodeCmd, cfg.encodeArgs, recipients...)
+			if err != nil {
+				return err
+			}
+
+			f.beforeSum = currentSum
+
+			return f.conflict
+		}
+	} else {
+		if err := encryptToFile(f.tempFile, f.conflict.oursPath, cfg.fsync, cfg.armor, cfg.encodeCmd, cfg.encodeArgs, recipients...); err != nil {
+			return err
+		}
+
+		f.beforeSum = currentSum
+
+		return f.conflict
+	}
+
+	if err := cfg.hooks.run(hookPreEncrypt, f.env); err != nil {
+		return err
+	}
+
+	if cfg.backups > 0 {
+		if _, err := backupFile(cfg.encPath, cfg.backups, cfg.fsync); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to back up the encrypted file:", err)
+		}
+	}
+
+	if cfg.history > 0 {
+		history := historyOptions{keep: cfg.history, maxAge: cfg.historyMaxAge, store: cfg.historyStore}
+		if _, err := archiveVersion(cfg.encPath, history); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to keep the previous version:", err)
+		}
+	}
+
+	released := f.releaseLock()
+
+	if err := encryptToFile(f.tempFile, cfg.encPath, cfg.fsync, cfg.armor, cfg.encodeCmd, cfg.encodeArgs, recipients...); err != nil {
+		if released {
+			if err := f.relock(); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: failed to lock the encrypted file again:", err)
+			}
+		}
+
+		return err
+	}
+
+	if f.remote != nil {
+		if err := f.storeRemote(currentSum); err != nil {
+			if released {
+				if err := f.relock(); err != nil {
+					fmt.Fprintln(os.Stderr, "Warning: failed to lock the encrypted file again:", err)
+				}
+			}
+
+			return err
+		}
+	}
+
+	f.beforeSum = currentSum
+	f.savedSize = size
+
+	if cfg.preserveMtime {
+		if err := copyModTime(f.tempFile, cfg.encPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to set the modification time:", err)
+		}
+	}
+
+	if err := f.relock(); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to lock the saved file:", err)
+	}
+
+	if cfg.confirmSave {
+		if err := snapshotFile(f.tempFile, filepath.Join(tempDir, f.savedPath)); err != nil {
+			return err
+		}
+	}
+
+	f.opened, err = os.ReadFile(cfg.encPath)
+	if err != nil {
+		return err
+	}
+
+	f.exists = true
+
+	// The file is saved at this point, so failed copies are reported after the rest of the save.
+	mirrorErr := f.saveMirrors()
+
+	// A failed commit is only a warning.
+	if cfg.gitCommit {
+		if _, err := gitCommitFile(cfg.encPath, cfg.gitMessage); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to commit to Git:", err)
+		}
+	}
+
+	cfg.hooks.runAfter(hookPostEncrypt, f.env)
+
+	return mirrorErr
+}
+
+// revert replaces the plaintext with the encrypted file as it is on disk, discarding the changes that weren't saved.
+// The new plaintext is decrypted next to the old one first, so a failure leaves the old one intact.
+// The caller must serialize calls with save.
+func (f *editFile) revert(tempDir string, identities []age.Identity) error {
+	cfg := f.cfg
+	setFilterEnv(f.env)
+
+	opened, err := os.ReadFile(cfg.encPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%q hasn't been saved, so there is nothing to revert to", cfg.encPath)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	reverted := f.tempFile + ".revert"
+	defer os.Remove(reverted)
+
+	if err := decryptToFile(cfg.encPath, reverted, cfg.decodeCmd, cfg.decodeArgs, identities...); err != nil {
+		return err
+	}
+
+	if err := os.Rename(reverted, f.tempFile); err != nil {
+		return err
+	}
+
+	if f.dir != "" {
+		if err := shredTree(f.dir); err != nil {
+			return err
+		}
+
+		if err := f.unpack(); err != nil {
+			return err
+		}
+	}
+
+	if cfg.preserveMtime {
+		if err := copyModTime(cfg.encPath, f.tempFile); err != nil {
+			return err
+		}
+	}
+
+	// The session now starts from the file on disk, so it saves there again after a conflict.
+	f.opened = opened
+	f.exists = true
+	f.conflict = nil
+
+	if cfg.keepFormat {
+		f.cfg.armor = hasArmorHeader(opened)
+	}
+
+	if f.beforeSum, err = checksumFile(f.tempFile); err != nil {
+		return err
+	}
+
+	if f.savedSize, err = plaintextSize(f.tempFile); err != nil {
+		return err
+	}
+
+	if cfg.confirmSave {
+		if err := snapshotFile(f.tempFile, filepath.Join(tempDir, f.savedPath)); err != nil {
+			return err
+		}
+	}
+
+	// The reverted plaintext is a new file in place of the old one.
+	return f.adoptReplacement()
+}
+
+// stash encrypts changes that weren't saved to the trash.
+func (f *editFile) stash(recipients []age.Recipient) {
+	setFilterEnv(f.env)
+
+	if err := f.pack(); err != nil {
+		reportStash("", err)
+
+		return
+	}
+
+	reportStash(stashDiscarded(f.cfg, f.tempFile, f.beforeSum, recipients))
+}
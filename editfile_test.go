@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestEditMultipleFiles(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	editorPath := filepath.Join(tempDir, "test-editor")
+	if runtime.GOOS == "windows" {
+		editorPath += ".exe"
+	}
+
+	if err := exec.Command("go", "build", "-o", editorPath, "./test/edit").Run(); err != nil {
+		t.Fatalf("failed to build test/edit binary: %v", err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idFilePath := filepath.Join(tempDir, "id")
+	if err := os.WriteFile(idFilePath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two files have the same name, so their temporary files must not collide.
+	paths := []string{
+		filepath.Join(tempDir, "a", "secret.txt.age"),
+		filepath.Join(tempDir, "b", "secret.txt.age"),
+		filepath.Join(tempDir, "new.txt.age"),
+	}
+
+	for i, path := range paths[:2] {
+		if err := os.MkdirAll(filepath.Dir(path), tempDirPerm); err != nil {
+			t.Fatal(err)
+		}
+
+		plainPath := filepath.Join(tempDir, "plain")
+		if err := os.WriteFile(plainPath, []byte{byte('a' + i), '\n'}, filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encryptToFile(plainPath, path, true, false, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	editTempDir, err := edit(config{
+		idsPath:       idFilePath,
+		encPath:       paths[0],
+		otherPaths:    paths[1:],
+		tempDirPrefix: t.TempDir(),
+
+		command: editorPath,
+		args:    []string{},
+	})
+	if editTempDir != "" {
+		defer os.RemoveAll(editTempDir)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a\nedit\n", "b\nedit\n", "edit\n"}
+
+	for i, path := range paths {
+		var plaintext bytes.Buffer
+
+		if err := decryptToWriter(path, &plaintext, "", []string{}, identity); err != nil {
+			t.Fatalf("%q: %v", path, err)
+		}
+
+		if plaintext.String() != expected[i] {
+			t.Errorf("%q: expected %q, got %q", path, expected[i], plaintext.String())
+		}
+	}
+
+	// The same file can't be opened twice in a session.
+	_, err = edit(config{
+		idsPath:       idFilePath,
+		encPath:       paths[0],
+		otherPaths:    []string{filepath.Join(tempDir, "a", "..", "a", "secret.txt.age")},
+		tempDirPrefix: t.TempDir(),
+
+		command: editorPath,
+		args:    []string{},
+	})
+	if err == nil {
+		t.Error("expected an error for a file given twice")
+	}
+}
+
+func TestEditFileRevert(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	sessionDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+
+	encryptText := func(text string) {
+		plainPath := filepath.Join(tempDir, "plain")
+		if err := os.WriteFile(plainPath, []byte(text), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encryptToFile(plainPath, encPath, false, false, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encryptText("saved\n")
+
+	f, err := newEditFile(config{encPath: encPath, yes: true}, encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.close()
+
+	tempFile := filepath.Join(sessionDir, "secret.txt")
+	if err := f.open(sessionDir, tempFile, []age.Identity{identity}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another program changes the file on disk while the plaintext has changes that weren't saved.
+	if err := os.WriteFile(tempFile, []byte("unsaved\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptText("changed on disk\n")
+
+	if err := f.revert(sessionDir, []age.Identity{identity}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(tempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "changed on disk\n" {
+		t.Errorf("expected the file on disk after reverting, got %q", content)
+	}
+
+	// The session continues from the file on disk, so saving doesn't find a conflict.
+	if err := os.WriteFile(tempFile, []byte("edited\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.save(sessionDir, []age.Recipient{identity.Recipient()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := decryptToWriter(encPath, &plaintext, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext.String() != "edited\n" {
+		t.Errorf("expected the edit to be saved, got %q", plaintext.String())
+	}
+
+	newPath := filepath.Join(tempDir, "new.txt.age")
+
+	n, err := newEditFile(config{encPath: newPath, yes: true}, newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.close()
+
+	newTempDir := t.TempDir()
+	if err := n.open(newTempDir, filepath.Join(newTempDir, "new.txt"), []age.Identity{identity}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.revert(newTempDir, []age.Identity{identity}); err == nil {
+		t.Error("expected an error when reverting a file that was never saved")
+	}
+}
+
+func TestEditFileAdoptReplacement(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions")
+	}
+
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "secret.txt")
+
+	if err := os.WriteFile(tempFile, []byte("secret\n"), fileReadOnlyPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &editFile{cfg: config{readOnly: true}, tempFile: tempFile}
+	if err := f.adoptReplacement(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The editor saves by renaming a new file with the default permissions over the temporary file.
+	newFile := filepath.Join(tempDir, "secret.txt.new")
+	if err := os.WriteFile(newFile, []byte("edited\n"), 0o644); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(newFile, tempFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.adoptReplacement(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(tempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != fileReadOnlyPerm {
+		t.Errorf("expected the replacement to be read-only, got %v", info.Mode().Perm())
+	}
+
+	if !os.SameFile(f.tempInfo, info) {
+		t.Error("expected the replacement to be tracked")
+	}
+
+	// A symlink could make saving encrypt another file.
+	if err := os.Remove(tempFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(newFile, tempFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.adoptReplacement(); err == nil {
+		t.Error("expected an error for a symlink in place of the temporary file")
+	}
+}
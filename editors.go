@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+const editorsEnvVar = "AGE_EDIT_EDITORS"
+
+// editorRule opens plaintext files whose names match a pattern in an editor command.
+type editorRule struct {
+	pattern string
+	command string
+}
+
+// editorRules returns the rules from AGE_EDIT_EDITORS in order.
+// The variable is a semicolon-separated list of "pattern=command" entries, like "*.json=code --wait;*.md=nvim".
+// Patterns use the syntax of filepath.Match and match the file name of the plaintext.
+func editorRules() ([]editorRule, error) {
+	rules := []editorRule{}
+
+	for _, entry := range strings.Split(os.Getenv(editorsEnvVar), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, command, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+
+		if !ok || pattern == "" || strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("invalid editor rule in %s: %q", editorsEnvVar, entry)
+		}
+
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in %s: %q", editorsEnvVar, pattern)
+		}
+
+		rules = append(rules, editorRule{pattern: pattern, command: command})
+	}
+
+	return rules, nil
+}
+
+// editorFor returns the command and the arguments of the first editor rule that matches a plaintext file name.
+// The last result is false when no rule matches.
+func editorFor(name string) (string, []string, bool, error) {
+	rules, err := editorRules()
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	for _, rule := range rules {
+		// The patterns have already been validated.
+		if matched, _ := filepath.Match(rule.pattern, name); !matched {
+			continue
+		}
+
+		args, err := shlex.Split(rule.command, true)
+		if err != nil || len(args) == 0 {
+			return "", nil, false, fmt.Errorf("failed to split editor command for %q in %s", rule.pattern, editorsEnvVar)
+		}
+
+		return args[0], args[1:], true, nil
+	}
+
+	return "", nil, false, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditorFor(t *testing.T) {
+	t.Setenv(editorsEnvVar, "*.json=code --wait; *.md = nvim -c 'set spell' ;*=vi")
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{"config.json", "code", []string{"--wait"}},
+		{"notes.md", "nvim", []string{"-c", "set spell"}},
+		{"secret.txt", "vi", []string{}},
+	}
+
+	for _, tt := range tests {
+		command, args, ok, err := editorFor(tt.name)
+		if err != nil || !ok {
+			t.Fatalf("editorFor(%q) failed: %v, %v", tt.name, ok, err)
+		}
+
+		if command != tt.command || !slices.Equal(args, tt.args) {
+			t.Errorf("editorFor(%q) is %q %q, expected %q %q", tt.name, command, args, tt.command, tt.args)
+		}
+	}
+
+	t.Setenv(editorsEnvVar, "*.json=code")
+
+	if _, _, ok, err := editorFor("notes.md"); ok || err != nil {
+		t.Errorf("expected no match, got %v, %v", ok, err)
+	}
+
+	for _, value := range []string{"*.json", "*.json=", "[=vi", "=vi"} {
+		t.Setenv(editorsEnvVar, value)
+
+		if _, _, _, err := editorFor("a.json"); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+// encryptNewFile encrypts plaintext from a reader to a new encrypted file.
+// It refuses to replace an existing file unless force is true.
+// The file is written atomically.
+func encryptNewFile(
+	in io.Reader,
+	encPath string,
+	force bool,
+	armored bool,
+	encodeCmd string,
+	encodeArgs []string,
+	recipients ...age.Recipient,
+) error {
+	write := func(w io.Writer) error {
+		return encryptStream(in, w, armored, encodeCmd, encodeArgs, recipients...)
+	}
+
+	if force {
+		return writeFileAtomic(encPath, filePerm, true, write)
+	}
+
+	err := writeNewFileAtomic(encPath, filePerm, true, write)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%q already exists; use --force to replace it", encPath)
+	}
+
+	return err
+}
+
+// encryptCommand implements the "encrypt" subcommand.
+func encryptCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultArmorVal, err := defaultArmor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Encrypt a plaintext file or standard input to a new encrypted file. The file is encrypted to the given recipients or, if there are none, to the recipients of the identities, like a file saved after editing.",
+		"  plain                   plaintext file path or \"-\" for standard input\n  encrypted               encrypted file path\n",
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		defaultArmorVal,
+		fmt.Sprintf("write an armored age file (%v)", armorEnvVar),
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	force := flag.BoolP(
+		"force",
+		"f",
+		false,
+		"replace the encrypted file if it exists",
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	//nolint:mnd
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Error: need a plaintext file and an encrypted file")
+
+		return exitBadUsage
+	}
+
+	plainPath := flag.Arg(0)
+	encPath := flag.Arg(1)
+
+	encodeCmd := ""
+	encodeArgs := []string{}
+
+	if *encode != "" {
+		args, err := shlex.Split(*encode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split encode command")
+
+			return exitBadUsage
+		}
+
+		encodeCmd = args[0]
+		encodeArgs = args[1:]
+	}
+
+	if err := checkDependencies(encodeDependency(encodeCmd)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	var recipients []age.Recipient
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+	} else {
+		_, recipients, err = openIdentities(*idsPath, false)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	in := io.Reader(os.Stdin)
+
+	if plainPath != "-" {
+		f, err := os.Open(plainPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	if err := encryptNewFile(in, encPath, *force, *armored, encodeCmd, encodeArgs, recipients...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
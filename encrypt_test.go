@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestEncryptNewFile(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(t.TempDir(), "new.age")
+
+	if err := encryptNewFile(strings.NewReader("first"), encPath, false, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptNewFile(strings.NewReader("second"), encPath, false, true, "", []string{}, identity.Recipient()); err == nil {
+		t.Error("encryptNewFile() replaced an existing file without force")
+	}
+
+	if err := encryptNewFile(strings.NewReader("third"), encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	armored, err := isArmored(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	if err := decryptToWriter(encPath, &out, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if armored || out.String() != "third" {
+		t.Errorf("got armored %v, contents %q", armored, out.String())
+	}
+
+	info, err := os.Stat(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm() != filePerm {
+		t.Errorf("the encrypted file has permissions %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+	"github.com/gofrs/flock"
+)
+
+const (
+	exerciseContent      = "age-edit exercise\n"
+	exerciseEditorPause  = time.Second
+	exercisePollInterval = 10 * time.Millisecond
+	exerciseFileName     = "secret"
+
+	exerciseOK   = "ok"
+	exerciseFail = "FAIL"
+	exerciseSkip = "skip"
+)
+
+// exerciseResult is the outcome of one check of the "exercise" subcommand.
+type exerciseResult struct {
+	check  string
+	status string
+	detail string
+}
+
+// exerciseOptions configures an exercise run.
+type exerciseOptions struct {
+	self          string
+	dir           string
+	editorScript  string
+	tempDirPrefix string
+}
+
+// exerciseHelper runs age-edit as one of the helper processes of an exercise run:
+// the built-in pseudo-editor, a filter, or a lock probe.
+func exerciseHelper(role string, args []string) int {
+	var err error
+
+	switch role {
+	case "editor":
+		if len(args) == 0 {
+			err = errors.New("no file to edit")
+
+			break
+		}
+
+		err = exerciseEdit(args[len(args)-1])
+
+	case "encode":
+		w := base64.NewEncoder(base64.StdEncoding, os.Stdout)
+		if _, err = io.Copy(w, os.Stdin); err == nil {
+			err = w.Close()
+		}
+
+	case "decode":
+		_, err = io.Copy(os.Stdout, base64.NewDecoder(base64.StdEncoding, os.Stdin))
+
+	case "lock":
+		if len(args) != 1 {
+			err = errors.New("need a file to lock")
+
+			break
+		}
+
+		var locked bool
+
+		lock := flock.New(args[0])
+
+		locked, err = lock.TryLock()
+		if err == nil && locked {
+			_ = lock.Unlock()
+
+			return exitError
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown role %q\n", role)
+
+		return exitBadUsage
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+// exerciseEdit appends to a file twice with a pause in between,
+// which gives age-edit time to save the first change on a signal.
+func exerciseEdit(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString("edit 1\n"); err != nil {
+		return err
+	}
+
+	time.Sleep(exerciseEditorPause)
+
+	_, err = f.WriteString("edit 2\n")
+
+	return err
+}
+
+// runExercise edits a scratch file through the whole editing pipeline
+// and checks the subsystems involved along the way.
+// It returns an error when the exercise can't be set up.
+func runExercise(opts exerciseOptions) ([]exerciseResult, error) {
+	results := []exerciseResult{}
+	report := func(check, status, detail string) {
+		results = append(results, exerciseResult{check: check, status: status, detail: detail})
+	}
+
+	scratch, err := os.MkdirTemp(opts.dir, "age-edit-exercise-")
+	if err != nil {
+		return results, fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+
+	prefix, err := os.MkdirTemp(opts.tempDirPrefix, "age-edit-exercise-")
+	if err != nil {
+		report("temp-dir", exerciseFail, err.Error())
+
+		return results, nil
+	}
+	defer os.RemoveAll(prefix)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return results, err
+	}
+
+	idsPath := filepath.Join(scratch, "identities")
+	plainPath := filepath.Join(scratch, "plain")
+	encPath := filepath.Join(scratch, exerciseFileName+".age")
+
+	if err := os.WriteFile(idsPath, []byte(identity.String()+"\n"), filePerm); err != nil {
+		return results, err
+	}
+
+	if err := os.WriteFile(plainPath, []byte(exerciseContent), filePerm); err != nil {
+		return results, err
+	}
+
+	helperArgs := func(role string) []string {
+		return []string{"exercise", "--role", role}
+	}
+
+	cfg := config{
+		idsPath:       idsPath,
+		encPath:       encPath,
+		otherPaths:    []string{},
+		tempDirPrefix: prefix,
+		trashDir:      "",
+		trashTTL:      0,
+		lockStrategy:  lockStrategyFlock,
+		lockExpiry:    0,
+		autosave:      0,
+		idleTimeout:   0,
+		history:       0,
+		historyMaxAge: 0,
+		historyStore:  historyStoreFile,
+		backups:       0,
+		maxShrink:     0,
+		minSize:       0,
+		template:      "",
+		gitMessage:    "",
+		plainName:     "",
+		wait:          "",
+
+		allowEmpty:    false,
+		allowShrink:   false,
+		armor:         false,
+		autoFilter:    false,
+		chdir:         false,
+		confirmSave:   false,
+		force:         false,
+		fsync:         true,
+		gitCommit:     false,
+		inhibitSleep:  false,
+		keepFormat:    false,
+		keepTemp:      false,
+		lock:          true,
+		lockKeys:      false,
+		notify:        false,
+		openBinary:    false,
+		park:          false,
+		preserveMtime: false,
+		readOnly:      false,
+		stay:          false,
+		supervise:     false,
+		tty:           false,
+		verbose:       false,
+		warnDroppings: false,
+		watch:         false,
+		yes:           false,
+
+		alsoSave: []string{},
+		prefer:   []string{},
+
+		// sendSaveSignal sends SIGUSR1 on POSIX systems.
+		saveSignals:  []string{"USR1"},
+		revertSignal: "",
+
+		command: opts.self,
+		args:    helperArgs("editor"),
+
+		decodeCmd:  opts.self,
+		decodeArgs: helperArgs("decode"),
+		encodeCmd:  opts.self,
+		encodeArgs: helperArgs("encode"),
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{level: 0, threads: 0, window: 0},
+
+		hooks: hookSet{},
+	}
+
+	if opts.editorScript != "" {
+		cfg.command = opts.editorScript
+		cfg.args = []string{}
+	}
+
+	if err := encryptToFile(plainPath, encPath, cfg.fsync, cfg.armor, cfg.encodeCmd, cfg.encodeArgs, identity.Recipient()); err != nil {
+		report("encryption", exerciseFail, err.Error())
+
+		return results, nil
+	}
+
+	report("encryption", exerciseOK, "")
+
+	startSum, err := checksumFile(encPath)
+	if err != nil {
+		return results, err
+	}
+
+	userDir, err := userDirName()
+	if err != nil {
+		return results, err
+	}
+
+	type editResult struct {
+		tempDir string
+		err     error
+	}
+
+	done := make(chan editResult, 1)
+
+	go func() {
+		tempDir, err := edit(cfg)
+		done <- editResult{tempDir: tempDir, err: err}
+	}()
+
+	tempPattern := filepath.Join(prefix, userDir, "*", exerciseFileName)
+	tempFile := ""
+	signalSent := false
+	signalSaved := false
+	lockResult := exerciseResult{check: "locking", status: exerciseSkip, detail: "the editor exited before the check"}
+	permResult := exerciseResult{check: "temp-dir", status: exerciseSkip, detail: "the editor exited before the check"}
+	signalResult := exerciseResult{check: "signals", status: exerciseSkip, detail: "the editor exited before changing the file"}
+
+	var edited editResult
+
+loop:
+	for {
+		select {
+		case edited = <-done:
+			break loop
+
+		case <-time.After(exercisePollInterval):
+		}
+
+		switch {
+		case tempFile == "":
+			matches, _ := filepath.Glob(tempPattern)
+			if len(matches) != 1 {
+				continue
+			}
+
+			tempFile = matches[0]
+			lockResult = exerciseLock(opts.self, encPath)
+			permResult = exercisePerm(filepath.Dir(tempFile))
+
+		case !signalSent:
+			content, err := os.ReadFile(tempFile)
+			if err != nil || string(content) == exerciseContent {
+				continue
+			}
+
+			signalSent = true
+
+			if err := sendSaveSignal(filepath.Dir(tempFile)); err != nil {
+				signalResult.detail = err.Error()
+
+				continue
+			}
+
+			signalResult = exerciseResult{check: "signals", status: exerciseFail, detail: "the file wasn't saved before the editor exited"}
+
+		case !signalSaved && signalResult.status == exerciseFail:
+			sum, err := checksumFile(encPath)
+			if err == nil && !bytes.Equal(sum, startSum) {
+				signalSaved = true
+				signalResult = exerciseResult{check: "signals", status: exerciseOK, detail: ""}
+			}
+		}
+	}
+
+	results = append(results, permResult, lockResult, signalResult)
+
+	if edited.err != nil {
+		report("editing", exerciseFail, edited.err.Error())
+	} else {
+		results = append(results, exerciseCheckEdit(cfg, identity, scratch, opts.editorScript == "")...)
+	}
+
+	results = append(results, exerciseCleanup(edited.tempDir, prefix, scratch))
+
+	return results, nil
+}
+
+// exerciseLock checks from another process that the encrypted file is locked.
+func exerciseLock(self, path string) exerciseResult {
+	result := exerciseResult{check: "locking", status: exerciseOK, detail: ""}
+
+	cmd := exec.Command(self, "exercise", "--role", "lock", path)
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil:
+
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == exitError:
+		result.status = exerciseFail
+		result.detail = "another process could lock the file during editing"
+
+	default:
+		result.status = exerciseFail
+		result.detail = err.Error()
+	}
+
+	return result
+}
+
+// exercisePerm checks that other users can't access the temporary directory.
+func exercisePerm(dir string) exerciseResult {
+	if runtime.GOOS == "windows" {
+		return exerciseResult{check: "temp-dir", status: exerciseSkip, detail: "permissions aren't checked on Windows"}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return exerciseResult{check: "temp-dir", status: exerciseFail, detail: err.Error()}
+	}
+
+	if info.Mode().Perm()&0o077 != 0 {
+		return exerciseResult{
+			check:  "temp-dir",
+			status: exerciseFail,
+			detail: fmt.Sprintf("%s has permissions %v", dir, info.Mode().Perm()),
+		}
+	}
+
+	return exerciseResult{check: "temp-dir", status: exerciseOK, detail: ""}
+}
+
+// exerciseCheckEdit checks that the editor's changes were saved
+// and went through the filters.
+func exerciseCheckEdit(cfg config, identity age.Identity, scratch string, builtin bool) []exerciseResult {
+	decodedPath := filepath.Join(scratch, "decoded")
+	rawPath := filepath.Join(scratch, "raw")
+
+	if err := decryptToFile(cfg.encPath, decodedPath, cfg.decodeCmd, cfg.decodeArgs, identity); err != nil {
+		return []exerciseResult{{check: "editing", status: exerciseFail, detail: err.Error()}}
+	}
+
+	decoded, err := os.ReadFile(decodedPath)
+	if err != nil {
+		return []exerciseResult{{check: "editing", status: exerciseFail, detail: err.Error()}}
+	}
+
+	editing := exerciseResult{check: "editing", status: exerciseOK, detail: ""}
+
+	switch {
+	case builtin && string(decoded) != exerciseContent+"edit 1\nedit 2\n":
+		editing.status = exerciseFail
+		editing.detail = fmt.Sprintf("unexpected contents %q", decoded)
+
+	case string(decoded) == exerciseContent:
+		editing.status = exerciseFail
+		editing.detail = "the editor's changes weren't saved"
+	}
+
+	filters := exerciseResult{check: "filters", status: exerciseOK, detail: ""}
+
+	if err := decryptToFile(cfg.encPath, rawPath, "", []string{}, identity); err != nil {
+		filters.status = exerciseFail
+		filters.detail = err.Error()
+	} else if raw, err := os.ReadFile(rawPath); err != nil || string(raw) != base64.StdEncoding.EncodeToString(decoded) {
+		filters.status = exerciseFail
+		filters.detail = "the encode filter's output wasn't encrypted"
+	}
+
+	return []exerciseResult{editing, filters}
+}
+
+// exerciseCleanup removes the temporary directory the way the editing workflow does
+// and checks that nothing is left behind.
+func exerciseCleanup(tempDir, prefix, scratch string) exerciseResult {
+	if tempDir != "" {
+		removeTempDir(tempDir)
+	}
+
+	leftovers := []string{}
+
+	entries, err := os.ReadDir(prefix)
+	if err != nil {
+		return exerciseResult{check: "cleanup", status: exerciseFail, detail: err.Error()}
+	}
+
+	for _, entry := range entries {
+		leftovers = append(leftovers, filepath.Join(prefix, entry.Name()))
+	}
+
+	canaries, _ := filepath.Glob(filepath.Join(scratch, ".age-edit-*"))
+	leftovers = append(leftovers, canaries...)
+
+	if len(leftovers) > 0 {
+		return exerciseResult{check: "cleanup", status: exerciseFail, detail: "left behind " + strings.Join(leftovers, ", ")}
+	}
+
+	return exerciseResult{check: "cleanup", status: exerciseOK, detail: ""}
+}
+
+// exerciseCommand implements the "exercise" subcommand.
+func exerciseCommand(sub subcommand, args []string) int {
+	flag := sub.flagSet(
+		"Edit a scratch file with a throwaway identity through the whole editing workflow and report which parts work on this machine: the temporary directory, file locking, saving on a signal, filters, and cleanup. The pseudo-editor receives the file to edit as its last argument. It should append to the file, pause for a second, and append again. By default, age-edit acts as the pseudo-editor and the filters itself.",
+		"",
+	)
+
+	dir := flag.StringP(
+		"dir",
+		"d",
+		"",
+		"directory to create the scratch encrypted file in (default: the system temporary directory)",
+	)
+	editorScript := flag.StringP(
+		"editor-script",
+		"e",
+		"",
+		"pseudo-editor executable (default: built-in)",
+	)
+	role := flag.String(
+		"role",
+		"",
+		"run as a helper process",
+	)
+	tempDirPrefix := flag.StringP(
+		"temp-dir",
+		"t",
+		defaultTempDirPrefix(),
+		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
+	)
+
+	_ = flag.MarkHidden("role")
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if *role != "" {
+		return exerciseHelper(*role, flag.Args())
+	}
+
+	if flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	results, err := runExercise(exerciseOptions{
+		self:          self,
+		dir:           *dir,
+		editorScript:  *editorScript,
+		tempDirPrefix: *tempDirPrefix,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+	code := exitOK
+
+	fmt.Fprintln(w, "CHECK\tRESULT\tDETAIL")
+
+	for _, result := range results {
+		detail := result.detail
+		if detail == "" {
+			detail = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.check, result.status, detail)
+
+		if result.status == exerciseFail {
+			code = exitError
+		}
+	}
+
+	_ = w.Flush()
+
+	return code
+}
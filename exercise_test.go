@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExercise(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	ageEditPath := filepath.Join(tempDir, "age-edit")
+
+	if err := exec.Command("go", "build", "-o", ageEditPath, ".").Run(); err != nil {
+		t.Fatalf("failed to build age-edit binary: %v", err)
+	}
+
+	cmd := exec.Command(ageEditPath, "exercise", "--dir", tempDir, "--temp-dir", tempDir)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("exercise failed: %v\n%s", err, output)
+	}
+
+	for _, check := range []string{"encryption", "locking", "editing", "filters", "cleanup"} {
+		found := false
+
+		for _, line := range strings.Split(string(output), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == check && fields[1] == exerciseOK {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("check %q didn't pass:\n%s", check, output)
+		}
+	}
+}
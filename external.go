@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	externalPrefix    = "age-edit-"
+	executableEnvVar  = "AGE_EDIT_EXECUTABLE"
+	externalNameChars = "abcdefghijklmnopqrstuvwxyz0123456789-_"
+)
+
+// findExternal looks up an external subcommand "age-edit-name" in PATH.
+// Only names made of lowercase letters, digits, hyphens, and underscores are considered,
+// and a name that is also an existing path is left for editing,
+// so a file called like a command is still edited.
+func findExternal(name string) (string, bool) {
+	if name == "" || strings.HasPrefix(name, "-") || strings.Trim(name, externalNameChars) != "" {
+		return "", false
+	}
+
+	if _, err := os.Lstat(name); err == nil {
+		return "", false
+	}
+
+	path, err := exec.LookPath(externalPrefix + name)
+	if err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// externalListSeparators are the separators of list settings in their environment variables
+// that don't use commas.
+var externalListSeparators = map[string]string{
+	"also-save": string(os.PathListSeparator),
+	"hook":      ";",
+}
+
+// externalEnv returns the resolved configuration as environment variables for an external subcommand.
+// The values come from the options of the editing command before parsing,
+// so every setting has its effective value from the environment or the built-in fallback,
+// and the subcommand doesn't need to repeat the defaults of age-edit.
+func externalEnv(flag *pflag.FlagSet) ([]string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	env := os.Environ()
+
+	flag.VisitAll(func(f *pflag.Flag) {
+		envVars, ok := flagEnvVars[f.Name]
+		// The editor is passed as the command, since it has several variables.
+		if !ok || len(envVars) != 1 {
+			return
+		}
+
+		value := f.Value.String()
+
+		switch v := f.Value.(type) {
+		case pflag.SliceValue:
+			sep, ok := externalListSeparators[f.Name]
+			if !ok {
+				sep = ","
+			}
+
+			value = strings.Join(v.GetSlice(), sep)
+
+		default:
+			// The variable of an option like --no-lock enables the setting.
+			if f.Value.Type() == "bool" && strings.HasPrefix(f.Name, "no-") {
+				value = strconv.FormatBool(value != "true")
+			}
+		}
+
+		if f.Name == "command" && value == "" {
+			value = flag.Lookup("editor").Value.String()
+		}
+
+		env = append(env, envVars[0]+"="+value)
+	})
+
+	for _, setting := range []struct {
+		envVar string
+		value  string
+	}{
+		{encryptedFileEnvVar, os.Getenv(encryptedFileEnvVar)},
+		{executableEnvVar, self},
+		{identitiesFileEnvVar, os.Getenv(identitiesFileEnvVar)},
+		{mergeEnvVar, defaultMerge()},
+	} {
+		env = append(env, setting.envVar+"="+setting.value)
+	}
+
+	return env, nil
+}
+
+// runExternal runs an external subcommand with the arguments and the resolved configuration
+// from the options of the editing command.
+// It returns the exit status of the subcommand.
+func runExternal(path string, args []string, flag *pflag.FlagSet) int {
+	env, err := externalEnv(flag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	cmd := exec.CommandContext(context.Background(), path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestFindExternal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, externalPrefix+"hello")
+
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	if got, ok := findExternal("hello"); !ok || got != path {
+		t.Errorf("expected %q, got %q", path, got)
+	}
+
+	for _, name := range []string{"", "missing", "-hello", "../hello", "Hello"} {
+		if _, ok := findExternal(name); ok {
+			t.Errorf("expected no external subcommand for %q", name)
+		}
+	}
+
+	// A file with the name of a subcommand is edited instead.
+	if err := os.WriteFile("hello", []byte{}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := findExternal("hello"); ok {
+		t.Error("expected an existing file to take precedence")
+	}
+}
+
+func TestExternalEnv(t *testing.T) {
+	t.Parallel()
+
+	flag := pflag.NewFlagSet("age-edit", pflag.ContinueOnError)
+	flag.Bool("no-lock", false, "")
+	flag.String("command", "", "")
+	flag.String("editor", "nano", "")
+	flag.Duration("trash-ttl", defaultTrashTTL, "")
+	flag.StringArray("also-save", []string{"a", "b"}, "")
+	flag.StringArray("hook", []string{"post-encrypt=x", "pre-decrypt=y"}, "")
+	flag.StringSlice("prefer", []string{"c", "d"}, "")
+
+	env, err := externalEnv(flag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		lockEnvVar + "=true",
+		commandEnvVar + "=nano",
+		trashTTLEnvVar + "=" + defaultTrashTTL.String(),
+		alsoSaveEnvVar + "=a" + string(os.PathListSeparator) + "b",
+		hooksEnvVar + "=post-encrypt=x;pre-decrypt=y",
+		preferEnvVar + "=c,d",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("expected %q in the environment", want)
+		}
+	}
+}
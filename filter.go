@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultFilterTimeout is long enough to compress large files with slow settings.
+	defaultFilterTimeout = 10 * time.Minute
+	// filterWaitDelay is how long runFilter waits for the pipes of a killed filter to close,
+	// since a process the filter started may keep them open.
+	filterWaitDelay = time.Second
+)
+
+// filterBaseEnv are the variables that filters get from the environment of age-edit by default.
+// They let a filter find commands, temporary directories, and the locale.
+// The rest of the environment, which can hold secrets like API tokens, stays out of the filters.
+var filterBaseEnv = []string{
+	"HOME",
+	"LANG",
+	"LC_*",
+	"LOGNAME",
+	"PATH",
+	"TMPDIR",
+	"TZ",
+	"USER",
+	// Windows.
+	"ComSpec",
+	"PATHEXT",
+	"SystemDrive",
+	"SystemRoot",
+	"TEMP",
+	"TMP",
+	"USERPROFILE",
+	"windir",
+}
+
+// filters has how long runFilter lets an external filter run before it kills it,
+// the environment and the working directory of external filters,
+// and the filters that are running, so an exiting session can kill them.
+// The environment and the directory start from the environment variables,
+// so the subcommands that run filters use them too.
+var filters = struct {
+	sync.Mutex
+
+	timeout time.Duration
+	env     []string
+	dir     string
+	running map[*os.Process]struct{}
+}{
+	timeout: defaultFilterTimeout,
+	env:     defaultFilterEnv(),
+	dir:     defaultFilterDir(),
+	running: map[*os.Process]struct{}{},
+}
+
+// setFilterTimeout sets how long filters can run; zero lets them run for as long as they take.
+func setFilterTimeout(timeout time.Duration) {
+	filters.Lock()
+	defer filters.Unlock()
+
+	filters.timeout = timeout
+}
+
+// setFilterProcess sets the variables and the working directory of filters.
+// An entry of env is either "NAME=VALUE" or a name or a pattern like "ZSTD_*"
+// of variables to pass through from the environment of age-edit.
+// An empty dir is the working directory of age-edit.
+func setFilterProcess(env []string, dir string) {
+	filters.Lock()
+	defer filters.Unlock()
+
+	filters.env = env
+	filters.dir = dir
+}
+
+// checkFilterEnv checks the entries of the filter environment.
+func checkFilterEnv(env []string) error {
+	for _, entry := range env {
+		name, _, set := strings.Cut(entry, "=")
+		if name == "" {
+			return fmt.Errorf("filter variable %q has no name", entry)
+		}
+
+		if set {
+			continue
+		}
+
+		if _, err := path.Match(name, ""); err != nil {
+			return fmt.Errorf("bad pattern for filter variables %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkFilterDir checks that the working directory of filters is a directory.
+func checkFilterDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("bad filter directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("filter directory %q isn't a directory", dir)
+	}
+
+	return nil
+}
+
+// matchEnvName reports whether a variable name matches a name or a pattern.
+// Names are case-insensitive on Windows.
+func matchEnvName(goos, pattern, name string) bool {
+	if goos == "windows" {
+		pattern = strings.ToUpper(pattern)
+		name = strings.ToUpper(name)
+	}
+
+	ok, _ := path.Match(pattern, name)
+
+	return ok
+}
+
+// filterEnviron returns the environment of a filter.
+// From environ, the environment of age-edit, it keeps the variables in filterBaseEnv
+// and those that entries without a value pass through.
+// The variables entries set come next, and the variables of the session come last.
+func filterEnviron(goos string, environ, entries, session []string) []string {
+	patterns := slices.Clone(filterBaseEnv)
+	set := []string{}
+
+	for _, entry := range entries {
+		if strings.Contains(entry, "=") {
+			set = append(set, entry)
+		} else {
+			patterns = append(patterns, entry)
+		}
+	}
+
+	env := []string{}
+
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		// Windows has hidden variables like "=C:" for the working directory of each drive.
+		if name == "" {
+			continue
+		}
+
+		if slices.ContainsFunc(patterns, func(pattern string) bool {
+			return matchEnvName(goos, pattern, name)
+		}) {
+			env = append(env, kv)
+		}
+	}
+
+	env = append(env, set...)
+
+	return append(env, session...)
+}
+
+// configureFilterCommand gives an external filter its environment and working directory.
+// When a variable repeats, the last value wins.
+func configureFilterCommand(cmd *exec.Cmd) {
+	filters.Lock()
+	env, dir := filters.env, filters.dir
+	filters.Unlock()
+
+	cmd.Env = filterEnviron(runtime.GOOS, os.Environ(), env, currentFilterEnv())
+	cmd.Dir = dir
+}
+
+// filterContext returns the context for a filter that ends after the filter timeout.
+func filterContext() (context.Context, context.CancelFunc, time.Duration) {
+	filters.Lock()
+	timeout := filters.timeout
+	filters.Unlock()
+
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		return ctx, cancel, timeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	return ctx, cancel, timeout
+}
+
+// runFilterCommand runs a filter command in its own process group
+// and kills the group when the context of the command ends or the session kills its filters.
+func runFilterCommand(cmd *exec.Cmd) error {
+	startProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process)
+	}
+	cmd.WaitDelay = filterWaitDelay
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	filters.Lock()
+	filters.running[cmd.Process] = struct{}{}
+	filters.Unlock()
+
+	defer func() {
+		filters.Lock()
+		delete(filters.running, cmd.Process)
+		filters.Unlock()
+	}()
+
+	return cmd.Wait()
+}
+
+// killFilters kills the running filters and the processes they have started,
+// like when the session exits on a signal.
+func killFilters() {
+	filters.Lock()
+	defer filters.Unlock()
+
+	for p := range filters.running {
+		_ = killProcessGroup(p)
+	}
+}
+
+// filterTimeoutError explains a filter that was killed because it ran too long.
+func filterTimeoutError(command string, timeout time.Duration) error {
+	return fmt.Errorf(
+		"filter %q didn't finish in %v and was killed; if it needs more time, raise --filter-timeout or %s",
+		command,
+		timeout,
+		filterTimeoutEnvVar,
+	)
+}
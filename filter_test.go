@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterTimeout(t *testing.T) {
+	// The filter timeout is global, so the test doesn't run in parallel.
+	if runtime.GOOS == "windows" {
+		t.Skip("the filter needs a POSIX shell")
+	}
+
+	setFilterTimeout(200 * time.Millisecond)
+	defer setFilterTimeout(defaultFilterTimeout)
+
+	var out bytes.Buffer
+
+	// The shell waits for a process it has started, which holds the output pipe.
+	start := time.Now()
+	err := runFilter("sh", []string{"-c", "sleep 30 & wait"}, strings.NewReader(""), &out)
+
+	if err == nil || !strings.Contains(err.Error(), "didn't finish") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the filter to be killed, took %v", elapsed)
+	}
+
+	if err := runFilter("sh", []string{"-c", "cat"}, strings.NewReader("secret"), &out); err != nil || out.String() != "secret" {
+		t.Errorf("expected a quick filter to finish, got %q: %v", out.String(), err)
+	}
+}
+
+func TestFilterEnviron(t *testing.T) {
+	t.Parallel()
+
+	environ := []string{
+		"=C:=C:\\",
+		"API_TOKEN=secret",
+		"LC_ALL=C",
+		"PATH=/bin",
+		"ZSTD_CLEVEL=19",
+		"ZSTD_NBTHREADS=2",
+	}
+	entries := []string{"ZSTD_*", "ZSTD_NBTHREADS=4", "GZIP=-9"}
+	session := []string{plaintextEnvVar + "=/tmp/secret.txt"}
+
+	env := filterEnviron("linux", environ, entries, session)
+	expected := []string{
+		"LC_ALL=C",
+		"PATH=/bin",
+		"ZSTD_CLEVEL=19",
+		"ZSTD_NBTHREADS=2",
+		"ZSTD_NBTHREADS=4",
+		"GZIP=-9",
+		plaintextEnvVar + "=/tmp/secret.txt",
+	}
+
+	if strings.Join(env, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, env)
+	}
+
+	// Names are case-insensitive on Windows.
+	env = filterEnviron("windows", []string{"Path=C:\\Windows", "zstd_clevel=19"}, []string{"ZSTD_CLEVEL"}, []string{})
+	if len(env) != 2 {
+		t.Errorf("expected Path and zstd_clevel, got %q", env)
+	}
+}
+
+func TestCheckFilterEnv(t *testing.T) {
+	t.Parallel()
+
+	if err := checkFilterEnv([]string{"ZSTD_*", "A=", "B=1=2"}); err != nil {
+		t.Errorf("expected valid entries, got %v", err)
+	}
+
+	for _, entry := range []string{"", "=value", "ZSTD_["} {
+		if err := checkFilterEnv([]string{entry}); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+}
+
+func TestFilterProcess(t *testing.T) {
+	// The environment and the directory of filters are global, so the test doesn't run in parallel.
+	if runtime.GOOS == "windows" {
+		t.Skip("the filter needs a POSIX shell")
+	}
+
+	dir := t.TempDir()
+
+	t.Setenv("AGE_EDIT_TEST_SECRET", "secret")
+	setFilterProcess([]string{"AGE_EDIT_TEST_LEVEL=3"}, dir)
+
+	defer setFilterProcess([]string{}, "")
+
+	var out bytes.Buffer
+
+	err := runFilter("sh", []string{"-c", `printf '%s|%s|%s' "$AGE_EDIT_TEST_SECRET" "$AGE_EDIT_TEST_LEVEL" "$(pwd -P)"`}, strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "|3|" + realDir; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGitMessageTemplate = "Update {file}"
+	gitTimeLayout             = time.RFC3339
+)
+
+// gitCommitMessage expands the placeholders in a commit message template:
+// "{file}" is the path of the file in the repository and "{time}" is the time of the save.
+func gitCommitMessage(template, file string, now time.Time) string {
+	return strings.NewReplacer(
+		"{file}", file,
+		"{time}", now.Format(gitTimeLayout),
+	).Replace(template)
+}
+
+// gitCommitFile commits an encrypted file to the Git repository that contains it.
+// Only the file is committed; other staged changes stay staged.
+// It returns the path of the file in the repository.
+func gitCommitFile(encPath, template string) (string, error) {
+	dir, name := filepath.Split(encPath)
+	if dir == "" {
+		dir = "."
+	}
+
+	prefix, err := runGit(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+
+	file := filepath.ToSlash(filepath.Join(prefix, name))
+
+	if _, err := runGit(dir, "add", "--", name); err != nil {
+		return "", err
+	}
+
+	message := gitCommitMessage(template, file, time.Now())
+	if _, err := runGit(dir, "commit", "--quiet", "--message", message, "--", name); err != nil {
+		return "", err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGitCommitMessage(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{defaultGitMessageTemplate, "Update secrets/a.age"},
+		{"{file} at {time}", "secrets/a.age at 2025-01-02T15:04:05Z"},
+		{"No placeholders", "No placeholders"},
+	}
+
+	for _, test := range tests {
+		if got := gitCommitMessage(test.template, "secrets/a.age", now); got != test.want {
+			t.Errorf("%q: expected %q, got %q", test.template, test.want, got)
+		}
+	}
+}
+
+func TestGitCommitFile(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgsign", "false"},
+	} {
+		if _, err := runGit(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unrelated staged file must not be committed.
+	if err := os.WriteFile(filepath.Join(dir, "other"), []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runGit(dir, "add", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(sub, "a.age")
+	if err := os.WriteFile(encPath, []byte("ciphertext"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := gitCommitFile(encPath, "Save {file}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file != "sub/a.age" {
+		t.Errorf("expected %q, got %q", "sub/a.age", file)
+	}
+
+	subject, err := runGit(dir, "log", "-1", "--format=%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subject != "Save sub/a.age" {
+		t.Errorf("unexpected subject: %q", subject)
+	}
+
+	staged, err := runGit(dir, "diff", "--cached", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if staged != "other" {
+		t.Errorf("expected only %q to stay staged, got %q", "other", staged)
+	}
+}
@@ -7,9 +7,12 @@ require (
 	github.com/anmitsu/go-shlex v0.0.0-20200514113438-38f4b401e2be
 	github.com/carlmjohnson/crockford v0.23.1
 	github.com/gofrs/flock v0.12.0
+	github.com/klauspost/compress v1.18.0
 	github.com/mitchellh/go-wordwrap v1.0.1
 	github.com/spf13/pflag v1.0.10
+	github.com/ulikunitz/xz v0.5.17
 	golang.org/x/sys v0.30.0
+	golang.org/x/term v0.29.0
 	lukechampine.com/blake3 v1.4.1
 )
 
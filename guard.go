@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// errEmptyPlaintext means that saving would replace a file that has content with an empty one.
+var errEmptyPlaintext = errors.New(
+	"the edited file is empty, so the encrypted file wasn't changed; use --allow-empty to save an empty file",
+)
+
+// shrinkError means that the plaintext shrank more than the limits allow.
+type shrinkError struct {
+	before int64
+	after  int64
+	reason string
+}
+
+func (e *shrinkError) Error() string {
+	return fmt.Sprintf("the edited file shrank from %d to %d bytes, %s", e.before, e.after, e.reason)
+}
+
+// plaintextSize returns the size of the plaintext in the temporary directory.
+// A missing file is empty.
+func plaintextSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// checkShrink compares the size of the plaintext before and after editing with the limits:
+// the most it can shrink in percent and the size it can't go below.
+// A limit of zero is disabled.
+// A file that was already below the minimum size can stay there.
+func checkShrink(before, after int64, maxShrink int, minSize int64) error {
+	if after >= before {
+		return nil
+	}
+
+	if minSize > 0 && after < minSize && before >= minSize {
+		return &shrinkError{
+			before: before,
+			after:  after,
+			reason: fmt.Sprintf("below the minimum of %d bytes", minSize),
+		}
+	}
+
+	//nolint:mnd
+	if maxShrink > 0 && (before-after)*100 > before*int64(maxShrink) {
+		return &shrinkError{
+			before: before,
+			after:  after,
+			reason: fmt.Sprintf("more than %d%%", maxShrink),
+		}
+	}
+
+	return nil
+}
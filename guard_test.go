@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlaintextSize(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"empty":   "",
+		"content": "secret",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		expected int64
+	}{
+		{"empty", 0},
+		{"content", 6},
+		{"missing", 0},
+	}
+
+	for _, test := range tests {
+		size, err := plaintextSize(filepath.Join(dir, test.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, size)
+		}
+	}
+}
+
+func TestCheckShrink(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		before    int64
+		after     int64
+		maxShrink int
+		minSize   int64
+		refused   bool
+	}{
+		{1000, 100, 0, 0, false},
+		{1000, 500, 50, 0, false},
+		{1000, 499, 50, 0, true},
+		{1000, 2000, 50, 0, false},
+		{1000, 99, 0, 100, true},
+		{1000, 100, 0, 100, false},
+		{50, 10, 0, 100, false},
+	}
+
+	for _, test := range tests {
+		err := checkShrink(test.before, test.after, test.maxShrink, test.minSize)
+
+		var shrinkErr *shrinkError
+		if refused := errors.As(err, &shrinkErr); refused != test.refused {
+			t.Errorf("%+v: expected refused %v, got %v", test, test.refused, err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+const defaultHeadLines = 10
+
+var errHeadDone = errors.New("enough output")
+
+// headWriter passes through the first lines or bytes written to it
+// and then fails with errHeadDone to stop the decryption.
+type headWriter struct {
+	w     io.Writer
+	limit int64
+	lines bool
+	done  bool
+}
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	if h.done || h.limit <= 0 {
+		h.done = true
+
+		return 0, errHeadDone
+	}
+
+	n := len(p)
+
+	if h.lines {
+		for i, b := range p {
+			if b != '\n' {
+				continue
+			}
+
+			h.limit--
+			if h.limit == 0 {
+				n = i + 1
+
+				break
+			}
+		}
+	} else {
+		n = int(min(int64(n), h.limit))
+		h.limit -= int64(n)
+	}
+
+	written, err := h.w.Write(p[:n])
+	if err != nil {
+		return written, err
+	}
+
+	if h.limit == 0 {
+		h.done = true
+
+		return written, errHeadDone
+	}
+
+	return written, nil
+}
+
+// headFile decrypts the first lines or bytes of a file to w.
+// The decryption stops once there is enough output, so large files aren't decrypted in full.
+func headFile(
+	encPath string,
+	w io.Writer,
+	limit int64,
+	lines bool,
+	decodeCmd string,
+	decodeArgs []string,
+	identities ...age.Identity,
+) error {
+	hw := &headWriter{w: w, limit: limit, lines: lines, done: false}
+
+	err := decryptToWriter(encPath, hw, decodeCmd, decodeArgs, identities...)
+
+	// A decode filter fails when its output is cut off, which is expected.
+	if hw.done {
+		return nil
+	}
+
+	return err
+}
+
+// headCommand implements the "head" subcommand.
+func headCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Decrypt the first lines or bytes of files to standard output like head(1). The decryption stops early, so this is quick even for large files. With more than one file, each file's output is preceded by a header with its name.",
+		"  encrypted               encrypted file path\n",
+	)
+
+	byteCount := flag.Int64P(
+		"bytes",
+		"c",
+		-1,
+		"print this many bytes instead of lines",
+	)
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	lineCount := flag.Int64P(
+		"lines",
+		"n",
+		defaultHeadLines,
+		"print this many lines",
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one encrypted file")
+
+		return exitBadUsage
+	}
+
+	if flag.Changed("bytes") && flag.Changed("lines") {
+		fmt.Fprintln(os.Stderr, "Error: need only one of --bytes and --lines")
+
+		return exitBadUsage
+	}
+
+	limit, byLine := *lineCount, true
+	if flag.Changed("bytes") {
+		limit, byLine = *byteCount, false
+	}
+
+	if limit < 0 {
+		fmt.Fprintln(os.Stderr, "Error: the number of lines or bytes must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *idsPath == "" && !agentAvailable() {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file")
+
+		return exitBadUsage
+	}
+
+	lockKeys := false
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			lockKeys = true
+		}
+	}
+
+	decodeCmd := ""
+	decodeArgs := []string{}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		decodeCmd = args[0]
+		decodeArgs = args[1:]
+	}
+
+	if err := checkDependencies(decodeDependency(decodeCmd)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	identities, _, err := openIdentities(*idsPath, lockKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	identities = orderIdentities(identities, *prefer)
+	code := exitOK
+
+	for i, encPath := range flag.Args() {
+		if flag.NArg() > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+
+			fmt.Printf("==> %s <==\n", encPath)
+		}
+
+		resetMatches(identities)
+
+		if err := headFile(encPath, os.Stdout, limit, byLine, decodeCmd, decodeArgs, identities...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", encPath, err)
+
+			code = exitError
+		}
+	}
+
+	return code
+}
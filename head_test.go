@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestHeadFile(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Several chunks of the age payload.
+	var plain strings.Builder
+	for i := range 20000 {
+		plain.WriteString(strings.Repeat("x", i%7) + "\n")
+	}
+
+	encPath := filepath.Join(t.TempDir(), "big.age")
+
+	if err := encryptNewFile(strings.NewReader(plain.String()), encPath, false, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit int64
+		lines bool
+		want  string
+	}{
+		{0, true, ""},
+		{3, true, "\nx\nxx\n"},
+		{0, false, ""},
+		{4, false, "\nx\nx"},
+		{100000, false, plain.String()},
+		{100000, true, plain.String()},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+
+		if err := headFile(encPath, &out, test.limit, test.lines, "", []string{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != test.want {
+			t.Errorf("limit %d, lines %v: expected %d bytes, got %d", test.limit, test.lines, len(test.want), out.Len())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	ageIntro          = "age-encryption.org/v1\n"
+	ageStanzaPrefix   = "-> "
+	ageFooterPrefix   = "---"
+	ageColumnsPerLine = 64
+)
+
+// ageHeader is the header of an age file: the recipient stanzas that wrap the file key.
+type ageHeader struct {
+	armored bool
+	stanzas []*age.Stanza
+	size    int64
+}
+
+// readAgeHeader parses the header of an armored or binary age file without decrypting anything.
+// It returns the header and a reader positioned at the start of the payload.
+// For armored files, the payload reader returns the binary payload.
+func readAgeHeader(r io.Reader) (ageHeader, io.Reader, error) {
+	header := ageHeader{
+		armored: false,
+		stanzas: []*age.Stanza{},
+		size:    0,
+	}
+
+	r, armored, err := peekArmor(r)
+	if err != nil {
+		return header, nil, err
+	}
+
+	if armored {
+		header.armored = true
+		r = armor.NewReader(r)
+	}
+
+	br := bufio.NewReader(r)
+
+	intro, err := br.ReadString('\n')
+	if err != nil || intro != ageIntro {
+		return header, nil, errors.New("not an age file")
+	}
+
+	header.size += int64(len(intro))
+
+	var stanza *age.Stanza
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return header, nil, fmt.Errorf("failed to read header: %w", err)
+		}
+
+		header.size += int64(len(line))
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case stanza == nil && strings.HasPrefix(line, ageFooterPrefix):
+			return header, br, nil
+
+		case stanza == nil && strings.HasPrefix(line, ageStanzaPrefix):
+			fields := strings.Split(strings.TrimPrefix(line, ageStanzaPrefix), " ")
+			stanza = &age.Stanza{Type: fields[0], Args: fields[1:], Body: []byte{}}
+
+		case stanza != nil:
+			body, err := base64.RawStdEncoding.DecodeString(line)
+			if err != nil {
+				return header, nil, fmt.Errorf("malformed stanza body: %w", err)
+			}
+
+			stanza.Body = append(stanza.Body, body...)
+
+			// The last line of a body is shorter than a full line.
+			if len(line) < ageColumnsPerLine {
+				header.stanzas = append(header.stanzas, stanza)
+				stanza = nil
+			}
+
+		default:
+			return header, nil, fmt.Errorf("malformed header line: %q", line)
+		}
+	}
+}
+
+// format returns "armored" or "binary".
+func (h ageHeader) format() string {
+	if h.armored {
+		return "armored"
+	}
+
+	return "binary"
+}
+
+// stanzaTypes returns a summary of the stanza types in a header, like "X25519 x2, scrypt".
+func (h ageHeader) stanzaTypes() string {
+	counts := map[string]int{}
+	order := []string{}
+
+	for _, s := range h.stanzas {
+		if counts[s.Type] == 0 {
+			order = append(order, s.Type)
+		}
+
+		counts[s.Type]++
+	}
+
+	parts := make([]string, 0, len(order))
+
+	for _, t := range order {
+		if counts[t] > 1 {
+			t = fmt.Sprintf("%s x%d", t, counts[t])
+		}
+
+		parts = append(parts, t)
+	}
+
+	return strings.Join(parts, ", ")
+}
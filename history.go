@@ -0,0 +1,460 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	historyDirSuffix   = ".history"
+	historyTimeLayout  = "20060102T150405.000000000Z"
+	historyEntrySuffix = ".age"
+
+	// historyRevisionPrefix marks a version in the history, like "@1" for the newest.
+	historyRevisionPrefix = "@"
+
+	historyStoreFile  = "file"
+	historyStoreState = "state"
+
+	// historyStateKeyLength is the number of hex digits of the path hash in the name of a directory in the state store.
+	historyStateKeyLength = 16
+)
+
+// historyOptions selects how previous versions of files are kept.
+type historyOptions struct {
+	// keep is the number of versions to keep; zero or less keeps every version.
+	keep int
+	// maxAge is how long to keep a version after it is replaced; zero keeps it forever.
+	maxAge time.Duration
+	store  string
+}
+
+// historyEntry is a previous encrypted version of a file.
+type historyEntry struct {
+	path     string
+	saved    time.Time
+	archived time.Time
+	size     int64
+}
+
+// historyDir returns the directory that keeps the previous versions of an encrypted file.
+// It is a hidden directory next to the file, like ".secret.txt.age.history".
+func historyDir(encPath string) string {
+	dir, name := filepath.Split(encPath)
+
+	return filepath.Join(dir, "."+name+historyDirSuffix)
+}
+
+// historyStateDir returns the directory in the per-user state directory
+// that keeps the previous versions of an encrypted file.
+// It is keyed by the absolute path of the file, like "secret.txt.age-0123456789abcdef".
+func historyStateDir(encPath string) (string, error) {
+	stateDir, err := userStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(encPath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(absPath))
+	key := filepath.Base(absPath) + "-" + hex.EncodeToString(sum[:])[:historyStateKeyLength]
+
+	return filepath.Join(stateDir, "history", key), nil
+}
+
+// historyDirs returns every directory that can keep previous versions of an encrypted file:
+// the one next to it and the one in the state store.
+// Versions are read from both, so changing the store doesn't hide the older versions.
+func historyDirs(encPath string) []string {
+	dirs := []string{historyDir(encPath)}
+
+	if stateDir, err := historyStateDir(encPath); err == nil {
+		dirs = append(dirs, stateDir)
+	}
+
+	return dirs
+}
+
+// envHistoryOptions reads the history options from the environment.
+// It is for the commands that don't have command-line options for them.
+func envHistoryOptions() (historyOptions, error) {
+	keep, err := defaultHistory()
+	if err != nil {
+		return historyOptions{}, err //nolint:exhaustruct
+	}
+
+	maxAge, err := defaultHistoryMaxAgeValue()
+	if err != nil {
+		return historyOptions{}, err //nolint:exhaustruct
+	}
+
+	store := defaultHistoryStore()
+	if store != historyStoreFile && store != historyStoreState {
+		return historyOptions{}, fmt.Errorf("unknown history store %q", store) //nolint:exhaustruct
+	}
+
+	return historyOptions{keep: keep, maxAge: maxAge, store: store}, nil
+}
+
+// archiveVersion copies an encrypted file to its history directory in the store before it is replaced
+// and prunes the history.
+// Only the ciphertext is copied; nothing is decrypted.
+// It returns the path of the new entry or an empty string if the file doesn't exist yet.
+func archiveVersion(encPath string, opts historyOptions) (string, error) {
+	in, err := os.Open(encPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	dir := historyDir(encPath)
+	if opts.store == historyStoreState {
+		dir, err = historyStateDir(encPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(dir, tempDirPerm); err != nil {
+		return "", err
+	}
+
+	entryPath := filepath.Join(dir, time.Now().UTC().Format(historyTimeLayout)+historyEntrySuffix)
+
+	out, err := os.OpenFile(entryPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	// The modification time of the entry is when the version was saved.
+	if err == nil {
+		err = os.Chtimes(entryPath, info.ModTime(), info.ModTime())
+	}
+
+	if err != nil {
+		_ = os.Remove(entryPath)
+
+		return "", fmt.Errorf("failed to archive %q: %w", encPath, err)
+	}
+
+	return entryPath, pruneHistory(encPath, opts)
+}
+
+// historyEntries returns the previous versions of an encrypted file from the newest to the oldest.
+func historyEntries(encPath string) ([]historyEntry, error) {
+	entries := []historyEntry{}
+
+	for _, dir := range historyDirs(encPath) {
+		dirEntries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dirEntry := range dirEntries {
+			stamp, ok := strings.CutSuffix(dirEntry.Name(), historyEntrySuffix)
+			if !ok || !dirEntry.Type().IsRegular() {
+				continue
+			}
+
+			archived, err := time.Parse(historyTimeLayout, stamp)
+			if err != nil {
+				continue
+			}
+
+			info, err := dirEntry.Info()
+			if err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, historyEntry{
+				path:     filepath.Join(dir, dirEntry.Name()),
+				saved:    info.ModTime(),
+				archived: archived,
+				size:     info.Size(),
+			})
+		}
+	}
+
+	// The names sort in the order the versions were archived.
+	slices.SortFunc(entries, func(a, b historyEntry) int {
+		return strings.Compare(filepath.Base(b.path), filepath.Base(a.path))
+	})
+
+	return entries, nil
+}
+
+// pruneHistory removes the oldest versions of a file beyond the number to keep
+// and the versions replaced longer ago than the maximum age.
+func pruneHistory(encPath string, opts historyOptions) error {
+	if opts.keep <= 0 && opts.maxAge <= 0 {
+		return nil
+	}
+
+	entries, err := historyEntries(encPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for i, entry := range entries {
+		tooMany := opts.keep > 0 && i >= opts.keep
+		tooOld := opts.maxAge > 0 && now.Sub(entry.archived) > opts.maxAge
+
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := os.Remove(entry.path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseHistoryRevision parses a revision like "@1" into a version number.
+func parseHistoryRevision(revision string) (int, bool) {
+	number, ok := strings.CutPrefix(revision, historyRevisionPrefix)
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// historyVersion returns the path of a previous version of a file.
+// Version 1 is the newest.
+func historyVersion(encPath string, n int) (string, error) {
+	entries, err := historyEntries(encPath)
+	if err != nil {
+		return "", err
+	}
+
+	if n < 1 || n > len(entries) {
+		return "", fmt.Errorf("%q has %d previous version(s); no version %d", encPath, len(entries), n)
+	}
+
+	return entries[n-1].path, nil
+}
+
+// restoreVersion replaces an encrypted file with a previous version.
+// The current version is archived first, so restoring can be undone.
+// If lock is true, the encrypted file is locked while it is replaced.
+func restoreVersion(encPath string, n int, opts historyOptions, lock bool, locking lockOptions) error {
+	info, err := os.Stat(encPath)
+	if err != nil {
+		return err
+	}
+
+	if lock {
+		fileLock := newFileLock(encPath, locking)
+
+		locked, err := fileLock.TryLock()
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if !locked {
+			return errors.New("encrypted file is locked")
+		}
+
+		defer func() {
+			_ = fileLock.Unlock()
+		}()
+	}
+
+	entryPath, err := historyVersion(encPath, n)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := os.ReadFile(entryPath)
+	if err != nil {
+		return err
+	}
+
+	// Prune only after the restored version is in place.
+	if _, err := archiveVersion(encPath, historyOptions{keep: 0, maxAge: 0, store: opts.store}); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(encPath, info.Mode().Perm(), true, func(w io.Writer) error {
+		_, err := w.Write(ciphertext)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return pruneHistory(encPath, opts)
+}
+
+// historyCommand implements the "history" subcommand.
+func historyCommand(sub subcommand, args []string) int {
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	_, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	history, err := envHistoryOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		fmt.Sprintf(
+			"List, compare, and restore the previous encrypted versions of a file kept with --history or %s. Version @1 is the newest. Listing and restoring don't decrypt anything; the identities are only needed for --diff, which works like the \"diff\" command.",
+			historyEnvVar,
+		),
+		fmt.Sprintf(
+			"  identities              identities file path for --diff (%s%s)\n  encrypted               encrypted file path (%s%s)\n",
+			identitiesFileEnvVar,
+			identitiesFileHelpDefault,
+			encryptedFileEnvVar,
+			encryptedFileHelpDefault,
+		),
+	)
+
+	diff := flag.IntP(
+		"diff",
+		"d",
+		0,
+		"show the changes since a version",
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted file when restoring (negated %v)", lockEnvVar),
+	)
+	restore := flag.IntP(
+		"restore",
+		"r",
+		0,
+		"replace the file with a version; the current version is kept in the history",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > cliMaxArgs {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	if *diff != 0 && *restore != 0 {
+		fmt.Fprintln(os.Stderr, "Error: --diff and --restore are mutually exclusive")
+
+		return exitBadUsage
+	}
+
+	encPath := encryptedFileDefault
+	if flag.NArg() > 0 {
+		encPath = flag.Arg(flag.NArg() - 1)
+	}
+
+	if encPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: need an encrypted file")
+
+		return exitBadUsage
+	}
+
+	switch {
+	case *diff != 0:
+		diffSub, _ := findSubcommand("diff")
+
+		return diffSub.run(diffSub, append([]string{"--against", historyRevisionPrefix + strconv.Itoa(*diff)}, flag.Args()...))
+
+	case *restore != 0:
+		if err := restoreVersion(encPath, *restore, history, !*noLock, locking); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		return exitOK
+	}
+
+	entries, err := historyEntries(encPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+
+	fmt.Fprintln(w, "VERSION\tSAVED\tSIZE")
+
+	for i, entry := range entries {
+		fmt.Fprintf(
+			w,
+			"%s%d\t%s\t%d\n",
+			historyRevisionPrefix,
+			i+1,
+			entry.saved.Format(time.DateTime),
+			entry.size,
+		)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
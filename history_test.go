@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+
+	if path, err := archiveVersion(encPath, historyOptions{keep: 2, maxAge: 0, store: historyStoreFile}); err != nil || path != "" {
+		t.Errorf("archiveVersion() of a missing file returned %q, %v", path, err)
+	}
+
+	for _, content := range []string{"v1", "v2", "v3"} {
+		if err := os.WriteFile(encPath, []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := archiveVersion(encPath, historyOptions{keep: 2, maxAge: 0, store: historyStoreFile}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(encPath, []byte("v4"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	checkVersions := func(expected ...string) {
+		t.Helper()
+
+		entries, err := historyEntries(encPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		contents := []string{}
+
+		for _, entry := range entries {
+			content, err := os.ReadFile(entry.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			contents = append(contents, string(content))
+		}
+
+		if len(contents) != len(expected) {
+			t.Fatalf("got versions %q, expected %q", contents, expected)
+		}
+
+		for i := range expected {
+			if contents[i] != expected[i] {
+				t.Fatalf("got versions %q, expected %q", contents, expected)
+			}
+		}
+	}
+
+	checkVersions("v3", "v2")
+
+	if n, ok := parseHistoryRevision("@2"); !ok || n != 2 {
+		t.Errorf("parseHistoryRevision(\"@2\") returned %d, %v", n, ok)
+	}
+
+	if _, ok := parseHistoryRevision("HEAD@{1}"); ok {
+		t.Error("parseHistoryRevision() accepted a Git revision")
+	}
+
+	if _, err := revisionCiphertext(encPath, "@3"); err == nil {
+		t.Error("revisionCiphertext() returned a version that doesn't exist")
+	}
+
+	if err := restoreVersion(encPath, 2, historyOptions{keep: 2, maxAge: 0, store: historyStoreFile}, true, lockOptions{strategy: lockStrategyDotlock, expiry: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "v2" {
+		t.Errorf("restoreVersion() left %q", content)
+	}
+
+	checkVersions("v4", "v3")
+}
+
+func TestHistoryStateStore(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	encPath := filepath.Join(t.TempDir(), "secret.txt.age")
+	opts := historyOptions{keep: 0, maxAge: 0, store: historyStoreState}
+
+	if err := os.WriteFile(encPath, []byte("v1"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	entryPath, err := archiveVersion(encPath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(entryPath, filepath.Join(stateHome, "age-edit", "history", "secret.txt.age-")) {
+		t.Errorf("expected the version in the state directory, got %q", entryPath)
+	}
+
+	if _, err := os.Stat(historyDir(encPath)); !os.IsNotExist(err) {
+		t.Errorf("expected no history next to the file: %v", err)
+	}
+
+	// Versions in both stores are listed together.
+	if err := os.WriteFile(encPath, []byte("v2"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.store = historyStoreFile
+	if _, err := archiveVersion(encPath, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := historyEntries(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[1].path != entryPath {
+		t.Errorf("unexpected history %v", entries)
+	}
+}
+
+func TestPruneHistoryMaxAge(t *testing.T) {
+	t.Parallel()
+
+	encPath := filepath.Join(t.TempDir(), "secret.txt.age")
+	dir := historyDir(encPath)
+
+	if err := os.MkdirAll(dir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPath := filepath.Join(dir, time.Now().Add(-48*time.Hour).UTC().Format(historyTimeLayout)+historyEntrySuffix)
+	newPath := filepath.Join(dir, time.Now().UTC().Format(historyTimeLayout)+historyEntrySuffix)
+
+	for _, path := range []string{oldPath, newPath} {
+		if err := os.WriteFile(path, []byte("version"), filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneHistory(encPath, historyOptions{keep: 0, maxAge: 24 * time.Hour, store: historyStoreFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("expected the old version to be removed: %v", err)
+	}
+
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected the new version to be kept: %v", err)
+	}
+}
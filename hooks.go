@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+// The events that run hooks.
+const (
+	hookPreDecrypt  = "pre-decrypt"
+	hookPostDecrypt = "post-decrypt"
+	hookPreEncrypt  = "pre-encrypt"
+	hookPostEncrypt = "post-encrypt"
+	hookPostCleanup = "post-cleanup"
+)
+
+// hookEnvVar tells a hook the event that runs it.
+const hookEnvVar = "AGE_EDIT_HOOK"
+
+// hookEvents are the events in the order they happen in a session.
+var hookEvents = []string{hookPreDecrypt, hookPostDecrypt, hookPreEncrypt, hookPostEncrypt, hookPostCleanup}
+
+// hookCommand is a command that runs on an event.
+type hookCommand struct {
+	command string
+	args    []string
+}
+
+// hookSet has the commands of each event in the order they run.
+type hookSet map[string][]hookCommand
+
+// parseHooks parses "event=command" entries.
+// The command is split like --command, and an event can have several commands.
+func parseHooks(entries []string) (hookSet, error) {
+	hooks := hookSet{}
+
+	for _, entry := range entries {
+		event, command, ok := strings.Cut(entry, "=")
+		event = strings.TrimSpace(event)
+
+		if !ok || strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("invalid hook %q; use event=command", entry)
+		}
+
+		if !slices.Contains(hookEvents, event) {
+			return nil, fmt.Errorf("unknown hook event %q; the events are %s", event, strings.Join(hookEvents, ", "))
+		}
+
+		args, err := shlex.Split(command, true)
+		if err != nil || len(args) == 0 {
+			return nil, fmt.Errorf("failed to split %s hook command", event)
+		}
+
+		hooks[event] = append(hooks[event], hookCommand{command: args[0], args: args[1:]})
+	}
+
+	return hooks, nil
+}
+
+// run runs the hooks of an event in order and stops at the first one that fails.
+// A hook gets the environment of the session like the editor and the event in AGE_EDIT_HOOK.
+// Its output goes to standard error, so it doesn't mix with the output of age-edit.
+func (h hookSet) run(event string, env []string) error {
+	for _, hook := range h[event] {
+		cmd := exec.CommandContext(context.Background(), hook.command, hook.args...)
+		cmd.Env = append(append(os.Environ(), env...), hookEnvVar+"="+event)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", event, hook.command, err)
+		}
+	}
+
+	return nil
+}
+
+// runAfter runs the hooks of an event after the fact, when a failure can only be a warning.
+func (h hookSet) runAfter(event string, env []string) {
+	if err := h.run(event, env); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+}
+
+// hookDependencies describes the commands of the hooks.
+func hookDependencies(hooks hookSet) []dependency {
+	deps := []dependency{}
+
+	for _, event := range hookEvents {
+		for _, hook := range hooks[event] {
+			deps = append(deps, dependency{
+				role:    event + " hook",
+				command: hook.command,
+				hint:    fmt.Sprintf("install it or change --hook or %s", hooksEnvVar),
+			})
+		}
+	}
+
+	return deps
+}
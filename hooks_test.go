@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestParseHooks(t *testing.T) {
+	t.Parallel()
+
+	hooks, err := parseHooks([]string{"post-encrypt=systemctl reload app", " post-encrypt = touch 'a b'", "pre-decrypt=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hooks[hookPostEncrypt]) != 2 || hooks[hookPostEncrypt][1].args[0] != "a b" || len(hooks[hookPreDecrypt]) != 1 {
+		t.Errorf("unexpected hooks %v", hooks)
+	}
+
+	for _, entry := range []string{"post-encrypt", "post-encrypt=", "on-save=true", "post-encrypt='"} {
+		if _, err := parseHooks([]string{entry}); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor and hooks are shell scripts")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+	logPath := filepath.Join(tempDir, "log")
+
+	entries := []string{}
+	for _, event := range hookEvents {
+		entries = append(entries, event+`=sh -c 'echo "$AGE_EDIT_HOOK $AGE_EDIT_ENCRYPTED" >> "$0"' `+logPath)
+	}
+
+	edit := func(text string, extra ...string) error {
+		hooks, err := parseHooks(append(entries, extra...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		editTempDir, err := edit(config{
+			idsPath:       idsPath,
+			encPath:       encPath,
+			tempDirPrefix: t.TempDir(),
+			yes:           true,
+
+			command: "sh",
+			args:    []string{"-c", `printf '%s\n' "$0" > "$1"`, text},
+
+			hooks: hooks,
+		})
+		if editTempDir != "" {
+			defer os.RemoveAll(editTempDir)
+		}
+
+		return err
+	}
+
+	if err := edit("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := edit("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing pre-encrypt hook blocks the save.
+	if err := edit("third", "pre-encrypt=false"); err == nil {
+		t.Error("expected the failing hook to fail the save")
+	}
+
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"pre-encrypt", "post-encrypt",
+		"pre-decrypt", "post-decrypt", "pre-encrypt", "post-encrypt",
+		"pre-decrypt", "post-decrypt", "pre-encrypt",
+	}
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+
+	if len(lines) != len(expected) {
+		t.Fatalf("expected the hooks %q, got %q", expected, lines)
+	}
+
+	for i, event := range expected {
+		if lines[i] != event+" "+encPath {
+			t.Errorf("line %d: expected %q, got %q", i+1, event+" "+encPath, lines[i])
+		}
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := decryptToWriter(encPath, &plaintext, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext.String() != "second\n" {
+		t.Errorf("expected the blocked save to leave %q, got %q", "second\n", plaintext.String())
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// httpPasswordEnvVar has the password for a URL with a user name and no password.
+	httpPasswordEnvVar = "AGE_EDIT_HTTP_PASSWORD"
+	// httpTimeout is how long a request to a server can take, including the transfer of a large file.
+	httpTimeout = 5 * time.Minute
+)
+
+// httpFile is an encrypted file on a web server that accepts PUT, like a WebDAV share on Nextcloud.
+// A save sends the ETag of the version the session has in If-Match,
+// so the server refuses it when the file has changed.
+// A new file is created with "If-None-Match: *" for the same reason.
+type httpFile struct {
+	url    *url.URL
+	client *http.Client
+	etag   string
+	exists bool
+}
+
+// newHTTPFile parses the URL of a file.
+// A user name in the URL without a password takes the password from AGE_EDIT_HTTP_PASSWORD
+// or asks for it at a terminal, so the password doesn't have to be on the command line.
+func newHTTPFile(rawURL string) (*httpFile, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// The error of url.Parse has the URL with the password.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if name := path.Base(u.Path); name == "." || name == "/" || u.Host == "" {
+		return nil, fmt.Errorf("URL %q doesn't name a file", u.Redacted())
+	}
+
+	if u.User != nil {
+		if _, ok := u.User.Password(); !ok {
+			password, err := httpPassword(u)
+			if err != nil {
+				return nil, err
+			}
+
+			u.User = url.UserPassword(u.User.Username(), password)
+		}
+	}
+
+	return &httpFile{
+		url:    u,
+		client: &http.Client{Timeout: httpTimeout}, //nolint:exhaustruct
+		etag:   "",
+		exists: false,
+	}, nil
+}
+
+// httpPassword returns the password for a URL from the environment or the terminal.
+func httpPassword(u *url.URL) (string, error) {
+	if password, ok := os.LookupEnv(httpPasswordEnvVar); ok {
+		return password, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec
+		return "", fmt.Errorf("no password for %q; set %s", u.Redacted(), httpPasswordEnvVar)
+	}
+
+	return readValue(fmt.Sprintf("Enter password for %q: ", u.Redacted()), true)
+}
+
+func (h *httpFile) fetch() ([]byte, bool, error) {
+	resp, err := h.do(http.MethodGet, nil, http.Header{})
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		h.exists = false
+		h.etag = ""
+
+		return nil, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, httpStatusError(resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	h.exists = true
+	h.etag = strongETag(resp)
+
+	if h.etag == "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s has no strong ETag, so age-edit can't tell if it changes on the server during the session\n", h)
+	}
+
+	return data, true, nil
+}
+
+func (h *httpFile) store(data []byte) error {
+	header := http.Header{}
+
+	switch {
+	case !h.exists:
+		header.Set("If-None-Match", "*")
+
+	case h.etag != "":
+		header.Set("If-Match", h.etag)
+	}
+
+	resp, err := h.do(http.MethodPut, data, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return errRemoteChanged
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return httpStatusError(resp)
+	}
+
+	h.exists = true
+	h.etag = strongETag(resp)
+
+	// Servers don't have to send the ETag of what was stored, so it is asked for.
+	// Another change between the requests would go unnoticed.
+	if h.etag == "" {
+		head, err := h.do(http.MethodHead, nil, http.Header{})
+		if err != nil {
+			return err
+		}
+		head.Body.Close()
+
+		h.etag = strongETag(head)
+	}
+
+	return nil
+}
+
+func (h *httpFile) name() string {
+	return path.Base(h.url.Path)
+}
+
+func (h *httpFile) String() string {
+	return h.url.Redacted()
+}
+
+// do sends a request to the URL of the file.
+func (h *httpFile) do(method string, body []byte, header http.Header) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, h.url.String(), r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = header
+	req.Header.Set("User-Agent", "age-edit")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		// The caller names the file.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// strongETag returns the ETag of a response if it can be used in If-Match.
+// Servers only match strong ETags, so a weak one is as good as none.
+func strongETag(resp *http.Response) string {
+	etag := resp.Header.Get("ETag")
+	if strings.HasPrefix(etag, "W/") {
+		return ""
+	}
+
+	return etag
+}
+
+// httpStatusError describes a response that isn't a success.
+func httpStatusError(resp *http.Response) error {
+	return fmt.Errorf("the server responded %q", resp.Status)
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+)
+
+const (
+	ageHeaderPrefix = "age-encryption.org/"
+
+	passphraseAttemptsEnvVar  = "AGE_EDIT_PASSPHRASE_ATTEMPTS"
+	passphraseDelayEnvVar     = "AGE_EDIT_PASSPHRASE_DELAY"
+	defaultPassphraseAttempts = 3
+	defaultPassphraseDelay    = time.Second
+)
+
+// namedIdentity is an identity with a description for diagnostics.
+// It records whether it has unwrapped a file key.
+type namedIdentity struct {
+	age.Identity
+
+	label     string
+	recipient string
+	matched   atomic.Bool
+}
+
+// newNamedIdentity wraps an identity with a label and a recipient description.
+func newNamedIdentity(identity age.Identity, label, recipient string) *namedIdentity {
+	return &namedIdentity{
+		Identity: identity,
+
+		label:     label,
+		recipient: recipient,
+		matched:   atomic.Bool{},
+	}
+}
+
+// Unwrap unwraps the file key with the underlying identity.
+func (i *namedIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	fileKey, err := i.Identity.Unwrap(stanzas)
+	if err == nil {
+		i.matched.Store(true)
+	}
+
+	return fileKey, err //nolint:wrapcheck
+}
+
+// String describes the identity by its label and recipient.
+func (i *namedIdentity) String() string {
+	if i.label == "" {
+		return i.recipient
+	}
+
+	return fmt.Sprintf("%s (%s)", i.label, i.recipient)
+}
+
+// unwrapIdentity returns the identity inside a named identity.
+func unwrapIdentity(identity age.Identity) age.Identity {
+	if named, ok := identity.(*namedIdentity); ok {
+		return named.Identity
+	}
+
+	return identity
+}
+
+// identityLabel returns the label in a "# label: ..." comment.
+func identityLabel(line string) (string, bool) {
+	comment, ok := strings.CutPrefix(line, "#")
+	if !ok {
+		return "", false
+	}
+
+	label, ok := strings.CutPrefix(strings.TrimSpace(comment), "label:")
+	if !ok {
+		return "", false
+	}
+
+	return strings.TrimSpace(label), true
+}
+
+// recipientName describes a recipient for diagnostics.
+func recipientName(recipient age.Recipient) string {
+	switch r := recipient.(type) {
+	case *age.X25519Recipient:
+		return r.String()
+
+	case *plugin.Recipient:
+		return "plugin:" + r.Name()
+
+	default:
+		return "-"
+	}
+}
+
+// orderIdentities moves the identities whose labels or recipients are preferred to the front,
+// in the order of preference, so they are tried first.
+// The order of the other identities is preserved.
+func orderIdentities(identities []age.Identity, prefer []string) []age.Identity {
+	rank := func(identity age.Identity) int {
+		named, ok := identity.(*namedIdentity)
+		if !ok {
+			return len(prefer)
+		}
+
+		for i, p := range prefer {
+			if p != "" && (p == named.label || p == named.recipient) {
+				return i
+			}
+		}
+
+		return len(prefer)
+	}
+
+	ordered := slices.Clone(identities)
+	slices.SortStableFunc(ordered, func(a, b age.Identity) int {
+		return rank(a) - rank(b)
+	})
+
+	return ordered
+}
+
+// matchedIdentity describes the identity that unwrapped a file key.
+func matchedIdentity(identities []age.Identity) string {
+	for _, identity := range identities {
+		if named, ok := identity.(*namedIdentity); ok && named.matched.Load() {
+			return named.String()
+		}
+	}
+
+	return ""
+}
+
+// resetMatches forgets which identity unwrapped a file key,
+// so matchedIdentity can be used again for the next file.
+func resetMatches(identities []age.Identity) {
+	for _, identity := range identities {
+		if named, ok := identity.(*namedIdentity); ok {
+			named.matched.Store(false)
+		}
+	}
+}
+
+// describeIdentityList describes identities for diagnostics.
+func describeIdentityList(identities []age.Identity) string {
+	names := make([]string, 0, len(identities))
+
+	for _, identity := range identities {
+		if named, ok := identity.(*namedIdentity); ok {
+			names = append(names, named.String())
+		} else {
+			names = append(names, "-")
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// checkIdentitiesFit fails fast when none of the identities can possibly decrypt a file,
+// judging by the types of its recipient stanzas.
+// This avoids running plugins (which may ask for a PIN or a touch) for nothing.
+func checkIdentitiesFit(path string, identities []age.Identity) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header, _, err := readAgeHeader(f)
+	if err != nil {
+		// Let decryption report the problem.
+		return nil //nolint:nilerr
+	}
+
+	types := map[string]bool{}
+	for _, s := range header.stanzas {
+		types[s.Type] = true
+	}
+
+	if len(types) == 1 && types["scrypt"] {
+		return fmt.Errorf("%q is encrypted with a passphrase, not to a recipient", path)
+	}
+
+	if len(types) != 1 || !types["X25519"] {
+		return nil
+	}
+
+	for _, identity := range identities {
+		switch unwrapIdentity(identity).(type) {
+		case *age.X25519Identity, *agentIdentity:
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"%q is only encrypted to X25519 recipients, but no X25519 identities are loaded (tried %s)",
+		path,
+		describeIdentityList(identities),
+	)
+}
+
+// explainDecryptError adds the identities tried and the stanza types in the file
+// to an error about no identity matching.
+func explainDecryptError(err error, path string, identities []age.Identity) error {
+	var noMatch *age.NoIdentityMatchError
+	if !errors.As(err, &noMatch) {
+		return err
+	}
+
+	explanation := "tried " + describeIdentityList(identities)
+
+	if f, openErr := os.Open(path); openErr == nil {
+		defer f.Close()
+
+		if header, _, headerErr := readAgeHeader(f); headerErr == nil {
+			explanation += "; the file has recipient stanzas " + header.stanzaTypes()
+		}
+	}
+
+	return fmt.Errorf("%w (%s)", err, explanation)
+}
+
+// identityEntry describes an identity age-edit can use.
+type identityEntry struct {
+	kind      string
+	label     string
+	recipient string
+	origin    string
+	err       error
+}
+
+// readIdentityFile reads an identities file.
+// If the file is itself encrypted with age, like the files "age -p" creates,
+// it asks for the passphrase and returns the decrypted contents.
+// If lockKeys is true, the buffer with the contents is locked in memory
+// for when the whole process can't be.
+// Only the buffer is: a decrypted file is built before it is locked,
+// and the identities parsed from it are copies in unlocked memory.
+// The caller should clear the buffer after parsing.
+// The second return value is the SHA-256 hash of the file as it is stored,
+// which identifies the version of the file.
+func readIdentityFile(path string, lockKeys bool) ([]byte, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read identities file: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	if isEncryptedIdentityFile(data) {
+		encrypted := data
+
+		data, err = decryptIdentityFile(encrypted, path)
+		clear(encrypted)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if lockKeys {
+		if err := lockBuffer(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; the identities file is not protected from swapping\n", err)
+		}
+	}
+
+	return data, sum[:], nil
+}
+
+// isEncryptedIdentityFile reports whether the contents of an identities file
+// are an age-encrypted file rather than a list of identities.
+func isEncryptedIdentityFile(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+
+	return bytes.HasPrefix(trimmed, []byte(ageHeaderPrefix)) || hasArmorHeader(data)
+}
+
+// passphraseLimits returns the maximum number of passphrase attempts
+// and the delay after the first failed attempt.
+func passphraseLimits() (int, time.Duration, error) {
+	attempts := defaultPassphraseAttempts
+	delay := defaultPassphraseDelay
+
+	if val := os.Getenv(passphraseAttemptsEnvVar); val != "" {
+		i, err := strconv.Atoi(val)
+		if err != nil || i < 1 {
+			return 0, 0, fmt.Errorf("invalid positive integer value for %s: %q", passphraseAttemptsEnvVar, val)
+		}
+
+		attempts = i
+	}
+
+	if val := os.Getenv(passphraseDelayEnvVar); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid duration value for %s: %q", passphraseDelayEnvVar, val)
+		}
+
+		delay = d
+	}
+
+	return attempts, delay, nil
+}
+
+// decryptIdentityFile asks for a passphrase and decrypts a passphrase-protected identities file.
+// After a wrong passphrase, it waits before asking again, doubling the delay each time,
+// and gives up after the maximum number of attempts.
+func decryptIdentityFile(data []byte, path string) ([]byte, error) {
+	attempts, delay, err := passphraseLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := readValue(fmt.Sprintf("Enter passphrase for identities file %q: ", path), true)
+		if err != nil {
+			return nil, err
+		}
+
+		decrypted, err := decryptWithPassphrase(data, passphrase)
+		if err == nil {
+			return decrypted, nil
+		}
+
+		var noMatch *age.NoIdentityMatchError
+		if !errors.As(err, &noMatch) {
+			return nil, err
+		}
+
+		if attempt >= attempts {
+			return nil, fmt.Errorf("wrong passphrase for identities file %q after %d attempt(s)", path, attempts)
+		}
+
+		fmt.Fprintf(os.Stderr, "Wrong passphrase; try again in %v\n", delay)
+		time.Sleep(delay)
+
+		delay *= 2
+	}
+}
+
+// decryptWithPassphrase decrypts the contents of an age file encrypted with a passphrase.
+func decryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := wrapDecrypt(bytes.NewReader(bytes.TrimLeft(data, " \t\r\n")), identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identities file: %w", err)
+	}
+
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identities file: %w", err)
+	}
+
+	return decrypted, nil
+}
+
+// describeIdentities parses an identities file and describes every identity in it.
+// Unlike loadIdentities, it does not stop at the first identity it can't parse.
+func describeIdentities(path string) ([]identityEntry, error) {
+	identityData, _, err := readIdentityFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(identityData)
+
+	entries := []identityEntry{}
+	label := ""
+
+	for i, line := range strings.Split(string(identityData), "\n") {
+		line := strings.TrimSpace(line)
+		if l, ok := identityLabel(line); ok {
+			label = l
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry := identityEntry{
+			kind:      "invalid",
+			label:     label,
+			recipient: "-",
+			origin:    fmt.Sprintf("%s:%d", path, i+1),
+			err:       nil,
+		}
+
+		identity, _, err := parseIdentity(line)
+		entry.err = err
+
+		switch id := identity.(type) {
+		case *age.X25519Identity:
+			entry.kind = "x25519"
+			entry.recipient = id.Recipient().String()
+
+		case *plugin.Identity:
+			entry.kind = "plugin:" + id.Name()
+
+			if _, err := exec.LookPath(pluginPrefix + id.Name()); err != nil {
+				entry.origin += fmt.Sprintf(" (%s%s not found on PATH)", pluginPrefix, id.Name())
+			}
+
+		default:
+			if name, _, pluginErr := plugin.ParseIdentity(line); pluginErr == nil {
+				entry.kind = "plugin:" + name
+			}
+
+			if err != nil {
+				entry.origin += fmt.Sprintf(" (%v)", err)
+			}
+		}
+
+		entries = append(entries, entry)
+		label = ""
+	}
+
+	return entries, nil
+}
+
+// identitiesCommand implements the "identities" subcommand.
+// It lists the identities in the identities file and the age plugins on PATH.
+func identitiesCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	flag := sub.flagSet(
+		"List the identities age-edit can use with their recipients and where they come from: the identities file, the running agent, and the age plugins found on PATH.",
+		fmt.Sprintf("  identities  identities file path (%s%s)\n", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	idsPath := identitiesFileDefault
+	if flag.NArg() == 1 {
+		idsPath = flag.Arg(0)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+	code := exitOK
+
+	fmt.Fprintln(w, "TYPE\tLABEL\tRECIPIENT\tORIGIN")
+
+	if idsPath != "" {
+		entries, err := describeIdentities(idsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			code = exitError
+		}
+
+		for _, entry := range entries {
+			label := entry.label
+			if label == "" {
+				label = "-"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.kind, label, entry.recipient, entry.origin)
+
+			if entry.err != nil {
+				code = exitError
+			}
+		}
+	}
+
+	if socket, err := defaultAgentSocket(); err == nil {
+		if info, err := agentInfo(socket); err == nil {
+			for _, recipient := range info.Recipients {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "agent", "-", recipient, fmt.Sprintf("agent:%s (%s)", socket, info.Identities))
+			}
+		}
+	}
+
+	for _, p := range findPlugins() {
+		origin := p.path
+		if err := checkPlugin(p.name); err != nil {
+			origin += fmt.Sprintf(" (%v)", err)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "plugin", "-", "-", origin)
+	}
+
+	w.Flush()
+
+	return code
+}
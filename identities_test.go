@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+)
+
+func TestDescribeIdentities(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pluginIdentity := plugin.EncodeIdentity("agedittest", []byte{1, 2, 3})
+
+	content := strings.Join([]string{
+		"# Comment",
+		"# label: laptop",
+		identity.String(),
+		"",
+		pluginIdentity,
+		"invalid-key",
+	}, "\n")
+
+	idsPath := filepath.Join(t.TempDir(), "ids")
+	if err := os.WriteFile(idsPath, []byte(content), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := describeIdentities(idsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		kind      string
+		label     string
+		recipient string
+		origin    string
+	}{
+		{"x25519", "laptop", identity.Recipient().String(), idsPath + ":3"},
+		{"plugin:agedittest", "", "-", idsPath + ":5 (age-plugin-agedittest not found on PATH)"},
+		{"invalid", "", "-", idsPath + ":6"},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("describeIdentities() returned %d entries, expected %d", len(entries), len(expected))
+	}
+
+	for i, e := range expected {
+		entry := entries[i]
+
+		if entry.kind != e.kind || entry.label != e.label || entry.recipient != e.recipient ||
+			!strings.HasPrefix(entry.origin, e.origin) {
+			t.Errorf("entry %d is %+v, expected %+v", i, entry, e)
+		}
+	}
+}
+
+func TestOrderIdentities(t *testing.T) {
+	t.Parallel()
+
+	identities := []age.Identity{}
+	recipients := []string{}
+
+	for _, label := range []string{"", "laptop", "backup"} {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipient := identity.Recipient().String()
+		identities = append(identities, newNamedIdentity(identity, label, recipient))
+		recipients = append(recipients, recipient)
+	}
+
+	tests := []struct {
+		prefer   []string
+		expected []int
+	}{
+		{[]string{}, []int{0, 1, 2}},
+		{[]string{"backup"}, []int{2, 0, 1}},
+		{[]string{"backup", "laptop"}, []int{2, 1, 0}},
+		{[]string{recipients[1], "missing"}, []int{1, 0, 2}},
+	}
+
+	for _, tt := range tests {
+		ordered := orderIdentities(identities, tt.prefer)
+
+		for i, j := range tt.expected {
+			if ordered[i] != identities[j] {
+				t.Errorf("orderIdentities(%v)[%d] is %v, expected %v", tt.prefer, i, ordered[i], identities[j])
+			}
+		}
+	}
+}
+
+func TestIdentityDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	encrypting, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "file.age")
+
+	if err := os.WriteFile(plainPath, []byte("secret\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, true, "", []string{}, encrypting.Recipient(), encrypting.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	header, _, err := readAgeHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !header.armored || header.stanzaTypes() != "X25519 x2" {
+		t.Errorf("readAgeHeader() returned armored %v, stanzas %q", header.armored, header.stanzaTypes())
+	}
+
+	identities := []age.Identity{newNamedIdentity(other, "spare", other.Recipient().String())}
+
+	err = decryptToFile(encPath, filepath.Join(tempDir, "out"), "", []string{}, identities...)
+	if err == nil || !strings.Contains(err.Error(), "tried spare (") || !strings.Contains(err.Error(), "X25519 x2") {
+		t.Errorf("decryptToFile() returned %v, expected an explanation", err)
+	}
+
+	pluginIdentity, err := plugin.NewIdentity(plugin.EncodeIdentity("agedittest", []byte{1}), pluginUI())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identities = []age.Identity{newNamedIdentity(pluginIdentity, "", "plugin:agedittest")}
+	if err := checkIdentitiesFit(encPath, identities); err == nil {
+		t.Error("checkIdentitiesFit() succeeded without X25519 identities")
+	}
+
+	// A missing plugin is an error rather than a mismatch, so the X25519 identity must come first.
+	identities = orderIdentities(
+		append(identities, newNamedIdentity(encrypting, "", encrypting.Recipient().String())),
+		[]string{encrypting.Recipient().String()},
+	)
+
+	err = decryptToFile(encPath, filepath.Join(tempDir, "out"), "", []string{}, identities...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if matched := matchedIdentity(identities); matched != encrypting.Recipient().String() {
+		t.Errorf("matchedIdentity() returned %q", matched)
+	}
+}
+
+func TestCheckPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin executables need an extension on Windows")
+	}
+
+	pluginDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	for _, p := range []string{
+		filepath.Join(pluginDir, "age-plugin-good"),
+		filepath.Join(otherDir, "age-plugin-stray"),
+	} {
+		if err := os.WriteFile(p, []byte("#! /bin/sh\n"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("PATH", pluginDir+string(filepath.ListSeparator)+otherDir)
+
+	tests := []struct {
+		dir      string
+		allowed  string
+		name     string
+		expectOk bool
+	}{
+		// No restrictions.
+		{"", "", "stray", true},
+		// An allowlisted plugin.
+		{"", "good, other", "good", true},
+		// A plugin not on the allowlist.
+		{"", "good,other", "stray", false},
+		// A plugin in the plugin directory.
+		{pluginDir, "", "good", true},
+		// A plugin outside the plugin directory.
+		{pluginDir, "", "stray", false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(pluginDirEnvVar, tt.dir)
+		t.Setenv(pluginsEnvVar, tt.allowed)
+
+		err := checkPlugin(tt.name)
+		if (err == nil) != tt.expectOk {
+			t.Errorf("checkPlugin(%q) with dir %q and allowlist %q = %v, expected success %v", tt.name, tt.dir, tt.allowed, err, tt.expectOk)
+		}
+	}
+}
+
+func TestDecryptWithPassphrase(t *testing.T) {
+	t.Parallel()
+
+	recipient, err := age.NewScryptRecipient("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipient.SetWorkFactor(10)
+
+	var encrypted strings.Builder
+
+	w, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = w.Write([]byte("# identities\n"))
+	w.Close()
+
+	data := []byte(encrypted.String())
+
+	if !isEncryptedIdentityFile(data) {
+		t.Error("expected the encrypted file to be detected")
+	}
+
+	if isEncryptedIdentityFile([]byte("AGE-SECRET-KEY-1...")) {
+		t.Error("expected a plain identities file not to be detected as encrypted")
+	}
+
+	decrypted, err := decryptWithPassphrase(data, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(decrypted) != "# identities\n" {
+		t.Errorf("decrypted content is %q", decrypted)
+	}
+
+	_, err = decryptWithPassphrase(data, "wrong")
+
+	var noMatch *age.NoIdentityMatchError
+	if !errors.As(err, &noMatch) {
+		t.Errorf("expected NoIdentityMatchError for a wrong passphrase, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// idleCheckInterval is how often the idle timeout checks for activity.
+const idleCheckInterval = 5 * time.Second
+
+// lastActivity returns the latest time a file or a directory tree was modified
+// or the terminal on standard input was read, where the system records it, but not before since.
+func lastActivity(paths []string, since time.Time) time.Time {
+	latest := since
+
+	for _, path := range paths {
+		_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil //nolint:nilerr
+			}
+
+			if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+
+			return nil
+		})
+	}
+
+	// Reading input updates the access time of a terminal, which is how who(1) reports idle time.
+	if tty := ttyName(); tty != "" {
+		if info, err := os.Stat(tty); err == nil {
+			if atime, ok := accessTime(info); ok && atime.After(latest) {
+				latest = atime
+			}
+		}
+	}
+
+	return latest
+}
+
+// watchIdle calls expire when there has been no activity in the paths for the timeout.
+// When expire reports failure, the session counts as active, and the timeout starts over.
+// It returns a function that stops watching.
+func watchIdle(timeout, interval time.Duration, paths []string, expire func() bool) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		since := time.Now()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+			}
+
+			if time.Since(lastActivity(paths, since)) < timeout {
+				continue
+			}
+
+			if expire() {
+				return
+			}
+
+			since = time.Now()
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
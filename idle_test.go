@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchIdle(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "tree")
+	if err := os.Mkdir(dir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, []byte{}, filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	var expired atomic.Int32
+
+	stop := watchIdle(300*time.Millisecond, 20*time.Millisecond, []string{dir}, func() bool {
+		return expired.Add(1) > 1
+	})
+	defer stop()
+
+	// Writes to a file in the tree keep the session active.
+	for range 10 {
+		time.Sleep(100 * time.Millisecond)
+
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := expired.Load(); n != 0 {
+		t.Fatalf("expired %d time(s) during activity", n)
+	}
+
+	// The first expiration fails, so the timeout starts over, and the second succeeds.
+	time.Sleep(1200 * time.Millisecond)
+
+	if n := expired.Load(); n != 2 {
+		t.Errorf("expected 2 expirations, got %d", n)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestInspectFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+
+	if err := os.WriteFile(plainPath, []byte("secret\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, armored := range []bool{false, true} {
+		encPath := filepath.Join(tempDir, "file.age")
+
+		if err := encryptToFile(plainPath, encPath, true, armored, "", []string{}, identity.Recipient(), identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := inspectFile(encPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A nonce, the plaintext, and the tag of a single chunk.
+		if info.header.armored != armored || len(info.header.stanzas) != 2 || info.payloadSize != 16+7+16 {
+			t.Errorf(
+				"inspectFile() returned format %s, %d stanzas, payload %d bytes",
+				info.header.format(),
+				len(info.header.stanzas),
+				info.payloadSize,
+			)
+		}
+	}
+
+	if _, err := inspectFile(plainPath); err == nil {
+		t.Error("inspectFile() accepted a plaintext file")
+	}
+}
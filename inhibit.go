@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inhibitStartGrace is how long an inhibitor has to fail before it is considered to hold its lock.
+// systemd-inhibit exits at once when logind refuses the lock.
+const inhibitStartGrace = 300 * time.Millisecond
+
+// inhibitCommand returns the command that keeps the computer from sleeping while it runs.
+// systemd-inhibit holds its lock while cat waits for the standard input that age-edit keeps open,
+// and caffeinate exits with age-edit.
+// It returns an empty command where there is no inhibitor.
+func inhibitCommand(goos string, pid int) (string, []string) {
+	switch goos {
+	case "darwin":
+		return "caffeinate", []string{"-i", "-w", strconv.Itoa(pid)}
+
+	case "linux":
+		return "systemd-inhibit", []string{
+			"--what=sleep",
+			"--who=age-edit",
+			"--why=Decrypted files are open for editing",
+			"--mode=block",
+			"cat",
+		}
+	}
+
+	return "", nil
+}
+
+// inhibitSleep keeps the computer from suspending or hibernating
+// and returns a function that lets it sleep again.
+// Hibernation could write the plaintext in a RAM-backed temporary directory to an unencrypted disk.
+func inhibitSleep() (func(), error) {
+	command, args := inhibitCommand(runtime.GOOS, os.Getpid())
+	if command == "" {
+		return nil, errors.New("keeping the computer from sleeping isn't supported on this platform")
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(context.Background(), command, args...)
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to keep the computer from sleeping: %w", err)
+	}
+
+	exited := make(chan error, 1)
+
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		_ = stdin.Close()
+
+		if err == nil {
+			err = errors.New("exited early")
+		}
+
+		return nil, fmt.Errorf("failed to keep the computer from sleeping: %s %w: %s", command, err, strings.TrimSpace(stderr.String()))
+
+	case <-time.After(inhibitStartGrace):
+	}
+
+	return func() {
+		_ = stdin.Close()
+		_ = cmd.Process.Kill()
+		<-exited
+	}, nil
+}
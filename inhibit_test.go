@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInhibitSleep(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd-inhibit is only used on Linux")
+	}
+
+	binDir := t.TempDir()
+	inhibitPath := filepath.Join(binDir, "systemd-inhibit")
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The fake inhibitor runs its command like the real one.
+	script := "#!/bin/sh\nwhile [ \"${1#--}\" != \"$1\" ]; do shift; done\nexec \"$@\"\n"
+	if err := os.WriteFile(inhibitPath, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	allowSleep, err := inhibitSleep()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// This returns once the inhibitor has exited.
+	allowSleep()
+
+	script = "#!/bin/sh\necho 'Failed to connect to bus' >&2\nexit 1\n"
+	if err := os.WriteFile(inhibitPath, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := inhibitSleep(); err == nil || !strings.Contains(err.Error(), "Failed to connect to bus") {
+		t.Errorf("expected the error of the inhibitor, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// filesInUse reports whether another process has one of the files open
+// or a file or a working directory in one of the directories.
+// It reads the open files of processes from /proc and skips processes it can't inspect.
+func filesInUse(paths []string) (bool, error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, err
+	}
+
+	self := strconv.Itoa(os.Getpid())
+
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil || proc.Name() == self {
+			continue
+		}
+
+		procDir := filepath.Join("/proc", proc.Name())
+		targets := []string{}
+
+		if cwd, err := os.Readlink(filepath.Join(procDir, "cwd")); err == nil {
+			targets = append(targets, cwd)
+		}
+
+		fds, err := os.ReadDir(filepath.Join(procDir, "fd"))
+		if err != nil {
+			continue
+		}
+
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(procDir, "fd", fd.Name())); err == nil {
+				targets = append(targets, target)
+			}
+		}
+
+		for _, target := range targets {
+			for _, path := range paths {
+				if target == path || strings.HasPrefix(target, path+string(filepath.Separator)) {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// filesInUse can't list the open files of processes on this platform.
+func filesInUse(paths []string) (bool, error) {
+	return false, errors.New("waiting for the editor to close the file needs /proc, which this platform lacks")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonIndent is the indentation of JSON that builtin:json decodes for the editor.
+const jsonIndent = "  "
+
+// compactJSON writes the JSON values from in in canonical form:
+// one value per line without spaces and with the keys of objects sorted.
+// The same data always encrypts to the same text, whatever the editor has done to the formatting.
+func compactJSON(in io.Reader, out io.Writer) error {
+	return rewriteJSON(in, out, "")
+}
+
+// indentJSON writes the JSON values from in indented for editing, with the keys of objects sorted.
+func indentJSON(in io.Reader, out io.Writer) error {
+	return rewriteJSON(in, out, jsonIndent)
+}
+
+// rewriteJSON decodes a stream of JSON values, like JSON Lines, and encodes them again.
+// Numbers keep their text, so large integers and decimals don't lose precision.
+// Empty input, like a new file, stays empty.
+func rewriteJSON(in io.Reader, out io.Writer, indent string) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+
+	for {
+		var value any
+
+		err := dec.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return explainJSONError(data, err)
+		}
+
+		if err := enc.Encode(value); err != nil {
+			return err
+		}
+	}
+}
+
+// explainJSONError adds the line and the column of a syntax error.
+func explainJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	// The offset is after the character that broke the syntax.
+	before := data[:min(max(syntaxErr.Offset-1, 0), int64(len(data)))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return fmt.Errorf("invalid JSON on line %d, column %d: %w", line, column, err)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONFilter(t *testing.T) {
+	t.Parallel()
+
+	input := `{"b": [1, 2.50, 12345678901234567890], "a": {"y": "<&>", "x": null}}
+{"c": true}`
+
+	var encoded, decoded bytes.Buffer
+
+	if err := runFilter("builtin:json", []string{}, strings.NewReader(input), &encoded); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"a":{"x":null,"y":"<&>"},"b":[1,2.50,12345678901234567890]}
+{"c":true}
+`
+	if encoded.String() != expected {
+		t.Errorf("expected %q, got %q", expected, encoded.String())
+	}
+
+	if err := runFilter("builtin:json", []string{"-d"}, &encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	expected = `{
+  "a": {
+    "x": null,
+    "y": "<&>"
+  },
+  "b": [
+    1,
+    2.50,
+    12345678901234567890
+  ]
+}
+{
+  "c": true
+}
+`
+	if decoded.String() != expected {
+		t.Errorf("expected %q, got %q", expected, decoded.String())
+	}
+
+	encoded.Reset()
+
+	if err := runFilter("builtin:json", []string{}, strings.NewReader(" \n"), &encoded); err != nil || encoded.Len() != 0 {
+		t.Errorf("expected empty input to stay empty, got %q: %v", encoded.String(), err)
+	}
+
+	err := runFilter("builtin:json", []string{}, strings.NewReader("{\n  \"a\": 1,\n}"), &encoded)
+	if err == nil || !strings.Contains(err.Error(), "line 3, column 1") {
+		t.Errorf("expected an error with the position, got %v", err)
+	}
+}
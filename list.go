@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+)
+
+// listEntry describes an encrypted file in an inventory.
+type listEntry struct {
+	path     string
+	size     int64
+	modified time.Time
+	format   string
+
+	// opens is "yes" or "no" depending on whether the identities can open the file
+	// and "-" when there are no identities to check.
+	opens string
+}
+
+// listFile describes an encrypted file.
+// To check whether the identities can open the file,
+// it unwraps the file key from the header but doesn't decrypt the payload.
+func listFile(path string, identities []age.Identity) (listEntry, error) {
+	entry := listEntry{path: path, size: 0, modified: time.Time{}, format: "", opens: "-"}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.size = info.Size()
+	entry.modified = info.ModTime()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return entry, err
+	}
+	defer f.Close()
+
+	header, _, err := readAgeHeader(f)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.format = header.format()
+
+	if len(identities) == 0 {
+		return entry, nil
+	}
+
+	entry.opens = "no"
+
+	if err := checkIdentitiesFit(path, identities); err != nil {
+		return entry, nil //nolint:nilerr
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return entry, err
+	}
+
+	if _, err := wrapDecrypt(f, identities...); err == nil {
+		entry.opens = "yes"
+	}
+
+	return entry, nil
+}
+
+// inHistory reports whether a path is a version in a history directory.
+func inHistory(path string) bool {
+	return strings.HasSuffix(filepath.Base(filepath.Dir(path)), historyDirSuffix)
+}
+
+// listCommand implements the "list" subcommand.
+func listCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"List encrypted files with their size, modification time, and format, and whether the identities can open them. Directories are searched recursively; the versions in the history are skipped. Opening a file only unwraps the key in its header; the contents aren't decrypted. Without identities or an agent, the OPENS column shows \"-\".",
+		"  path                    encrypted file or directory (default: the current directory)\n",
+	)
+
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	pattern := flag.StringP(
+		"pattern",
+		"p",
+		defaultPathPattern,
+		"file name pattern to match in directories",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	paths, err := collectPaths(roots, *pattern)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	var identities []age.Identity
+
+	if *idsPath != "" || agentAvailable() {
+		lockKeys := false
+
+		if !*noMemlock {
+			if err := lockMemory(); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+				lockKeys = true
+			}
+		}
+
+		identities, _, err = openIdentities(*idsPath, lockKeys)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+	code := exitOK
+
+	fmt.Fprintln(w, "SIZE\tMODIFIED\tFORMAT\tOPENS\tPATH")
+
+	for _, path := range paths {
+		if inHistory(path) {
+			continue
+		}
+
+		entry, err := listFile(path, identities)
+		if err != nil {
+			_ = w.Flush()
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+
+			code = exitError
+
+			continue
+		}
+
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%s\t%s\n",
+			entry.size,
+			entry.modified.Format(time.DateTime),
+			entry.format,
+			entry.opens,
+			entry.path,
+		)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return code
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestListFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "plain.age")
+
+	if err := os.WriteFile(plainPath, []byte("listed\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		identities []age.Identity
+		opens      string
+	}{
+		{nil, "-"},
+		{[]age.Identity{identity}, "yes"},
+		{[]age.Identity{other}, "no"},
+	}
+
+	for _, test := range tests {
+		entry, err := listFile(encPath, test.identities)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.format != "armored" || entry.opens != test.opens || entry.size == 0 {
+			t.Errorf("listFile() returned %+v, expected opens %q", entry, test.opens)
+		}
+	}
+
+	if _, err := listFile(plainPath, nil); err == nil {
+		t.Error("listFile() accepted a plaintext file")
+	}
+
+	versionPath, err := archiveVersion(encPath, historyOptions{keep: 0, maxAge: 0, store: historyStoreFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !inHistory(versionPath) || inHistory(encPath) {
+		t.Error("inHistory() misclassified a path")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+const (
+	lockStrategyFlock   = "flock"
+	lockStrategyDotlock = "dotlock"
+
+	dotlockSuffix     = ".lock"
+	defaultLockExpiry = 5 * time.Minute
+
+	// dotlockRefreshes is how many times a dotlock is refreshed per expiry period.
+	dotlockRefreshes = 3
+)
+
+var (
+	errLockLost    = errors.New("lost the lock on the encrypted file to another process")
+	errLockRemoved = errors.New("lost the lock on the encrypted file because its lock file was removed")
+)
+
+// fileLock is an exclusive lock on an encrypted file.
+// *flock.Flock implements it.
+type fileLock interface {
+	TryLock() (bool, error)
+	Unlock() error
+}
+
+// lockOptions selects how encrypted files are locked.
+type lockOptions struct {
+	strategy string
+	expiry   time.Duration
+}
+
+// newFileLock returns a lock on a file using the strategy in the options.
+// The lock of a symlink is the lock of the file it points to,
+// so sessions that open the file through different paths exclude each other.
+func newFileLock(path string, opts lockOptions) fileLock {
+	if resolved, err := resolveSymlink(path); err == nil {
+		path = resolved
+	}
+
+	if opts.strategy == lockStrategyDotlock {
+		return newDotlock(path, opts.expiry)
+	}
+
+	return flock.New(path)
+}
+
+// envLockOptions reads the lock options from the environment.
+// It is for the commands that don't have command-line options for them.
+func envLockOptions() (lockOptions, error) {
+	expiry, err := defaultLockExpiryValue()
+	if err != nil {
+		return lockOptions{}, err //nolint:exhaustruct
+	}
+
+	strategy := defaultLockStrategy()
+	if strategy != lockStrategyFlock && strategy != lockStrategyDotlock {
+		return lockOptions{}, fmt.Errorf("unknown lock strategy %q", strategy) //nolint:exhaustruct
+	}
+
+	return lockOptions{strategy: strategy, expiry: expiry}, nil
+}
+
+// dotlock is a lock file next to the locked file.
+// Unlike flock(2), it works on network filesystems that don't support locking,
+// like some NFS setups.
+// A dotlock expires when its modification time is older than the expiry period,
+// so a crashed session doesn't lock the file forever.
+// Sessions keep their lock from expiring by refreshing it.
+type dotlock struct {
+	path   string
+	token  string
+	expiry time.Duration
+}
+
+// newDotlock creates a dotlock for a file.
+// An expiry of zero or less means the lock never expires.
+func newDotlock(path string, expiry time.Duration) *dotlock {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &dotlock{
+		path:   path + dotlockSuffix,
+		token:  fmt.Sprintf("%s %d %s", hostname, os.Getpid(), randomID()),
+		expiry: expiry,
+	}
+}
+
+// TryLock creates the lock file unless another process holds the lock.
+// It breaks expired locks.
+func (l *dotlock) TryLock() (bool, error) {
+	for range 2 {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+		if err == nil {
+			_, err = f.WriteString(l.token + "\n")
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+
+			if err != nil {
+				_ = os.Remove(l.path)
+
+				return false, err
+			}
+
+			return true, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+
+		info, err := os.Stat(l.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if l.expiry <= 0 || time.Since(info.ModTime()) < l.expiry {
+			return false, nil
+		}
+
+		token, err := os.ReadFile(l.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := l.breakLock(info, token); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// breakLock removes an expired lock file that TryLock has found.
+// Another session may break the same lock and take it first,
+// so the lock file is renamed to a unique name and only removed if it is still the expired one.
+// Otherwise it is put back, and if a third session has taken the lock in the meantime,
+// the session whose lock was moved finds it lost when it refreshes the lock.
+func (l *dotlock) breakLock(info os.FileInfo, token []byte) error {
+	stale := l.path + ".stale-" + randomID()
+
+	if err := os.Rename(l.path, stale); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	staleInfo, statErr := os.Stat(stale)
+	staleToken, readErr := os.ReadFile(stale)
+
+	if statErr == nil && readErr == nil &&
+		os.SameFile(info, staleInfo) &&
+		bytes.Equal(token, staleToken) &&
+		time.Since(staleInfo.ModTime()) >= l.expiry {
+		return os.Remove(stale)
+	}
+
+	err := os.Link(stale, l.path)
+	if errors.Is(err, os.ErrExist) {
+		err = nil
+	}
+
+	if removeErr := os.Remove(stale); err == nil {
+		err = removeErr
+	}
+
+	return err
+}
+
+// owned reports whether the lock file exists and was created by this lock.
+func (l *dotlock) owned() (bool, error) {
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(string(data)) == l.token, nil
+}
+
+// Refresh keeps the lock from expiring.
+// It returns errLockLost if another process holds the lock
+// and errLockRemoved if the lock file is gone.
+func (l *dotlock) Refresh() error {
+	owned, err := l.owned()
+	if err != nil {
+		return err
+	}
+
+	if !owned {
+		if _, err := os.Stat(l.path); errors.Is(err, os.ErrNotExist) {
+			return errLockRemoved
+		}
+
+		return errLockLost
+	}
+
+	now := time.Now()
+
+	return os.Chtimes(l.path, now, now)
+}
+
+// Unlock removes the lock file if this lock still owns it.
+func (l *dotlock) Unlock() error {
+	owned, err := l.owned()
+	if err != nil || !owned {
+		return err
+	}
+
+	return os.Remove(l.path)
+}
+
+// keepLockAlive refreshes a dotlock in the background until the returned function is called.
+// It alerts the user when the lock is lost and when it is taken again.
+// After it has alerted the user that the lock file was removed, it tries to take the lock again.
+// The saves of the session should check the lock themselves with Refresh.
+func keepLockAlive(l *dotlock) func() {
+	if l.expiry <= 0 {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(l.expiry / dotlockRefreshes)
+	done := make(chan struct{})
+
+	var lost atomic.Bool
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+			}
+
+			err := l.Refresh()
+			if errors.Is(err, errLockRemoved) && lost.Load() {
+				if locked, lockErr := l.TryLock(); lockErr == nil && locked {
+					err = nil
+				}
+			}
+
+			switch {
+			case err != nil && !lost.Swap(true):
+				fmt.Fprintf(os.Stderr, "\r\007age-edit: %v; saving is paused\n", err)
+
+			case err == nil && lost.Swap(false):
+				fmt.Fprintln(os.Stderr, "\r\007age-edit: took the lock on the encrypted file again; saving resumed")
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"filippo.io/age"
 )
@@ -81,7 +83,7 @@ func TestFileLocking(t *testing.T) {
 			}
 
 			encFilePath := filepath.Join(tempDir, "encrypted.age")
-			if err := encryptToFile(plainFilePath, encFilePath, false, "", []string{}, identity.Recipient()); err != nil {
+			if err := encryptToFile(plainFilePath, encFilePath, true, false, "", []string{}, identity.Recipient()); err != nil {
 				t.Fatal(err)
 			}
 
@@ -129,9 +131,128 @@ func TestFileLocking(t *testing.T) {
 			}
 
 			// Both edits should succeed.
-			if err1 != nil || err2 != nil {
-				t.Errorf("Expected both edits to succeed, got:\nedit1: %v\nedit2: %v", err1, err2)
+			// Without locking, the edit that saves second may find the file changed on disk
+			// and keep its version in a conflict file instead.
+			for _, err := range []error{err1, err2} {
+				var conflict *conflictError
+				if err != nil && !errors.As(err, &conflict) {
+					t.Errorf("Expected both edits to succeed, got:\nedit1: %v\nedit2: %v", err1, err2)
+				}
 			}
 		})
 	}
 }
+
+func TestDotlock(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "secret.age")
+
+	first := newDotlock(path, time.Minute)
+	second := newDotlock(path, time.Minute)
+
+	if locked, err := first.TryLock(); err != nil || !locked {
+		t.Fatalf("first TryLock() = %v, %v; expected the lock", locked, err)
+	}
+
+	if locked, err := second.TryLock(); err != nil || locked {
+		t.Fatalf("second TryLock() = %v, %v; expected the file to be locked", locked, err)
+	}
+
+	if err := first.Refresh(); err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+
+	// Expire the lock so the second session can break it.
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(path+dotlockSuffix, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, err := second.TryLock(); err != nil || !locked {
+		t.Fatalf("second TryLock() = %v, %v; expected to break the expired lock", locked, err)
+	}
+
+	if err := first.Refresh(); !errors.Is(err, errLockLost) {
+		t.Fatalf("Refresh() returned %v, expected a lost lock", err)
+	}
+
+	// Unlocking a lost lock must not remove the new owner's lock.
+	if err := first.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + dotlockSuffix); err != nil {
+		t.Fatalf("the lock file is gone: %v", err)
+	}
+
+	if err := second.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A session whose lock file was removed finds the lock lost and doesn't take it again by itself.
+	if err := first.Refresh(); !errors.Is(err, errLockRemoved) {
+		t.Fatalf("Refresh() after the lock file was removed returned %v, expected a removed lock", err)
+	}
+
+	if _, err := os.Stat(path + dotlockSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no lock file, got %v", err)
+	}
+}
+
+func TestDotlockBreakRace(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "secret.age")
+	lockPath := path + dotlockSuffix
+
+	crashed := newDotlock(path, time.Minute)
+	first := newDotlock(path, time.Minute)
+	second := newDotlock(path, time.Minute)
+
+	if locked, err := crashed.TryLock(); err != nil || !locked {
+		t.Fatalf("TryLock() = %v, %v; expected the lock", locked, err)
+	}
+
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second session sees the expired lock...
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ...but the first session breaks it and takes the lock first.
+	if locked, err := first.TryLock(); err != nil || !locked {
+		t.Fatalf("first TryLock() = %v, %v; expected to break the expired lock", locked, err)
+	}
+
+	if err := second.breakLock(info, token); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Refresh(); err != nil {
+		t.Fatalf("expected the first session to keep the lock, got %v", err)
+	}
+
+	if locked, err := second.TryLock(); err != nil || locked {
+		t.Fatalf("second TryLock() = %v, %v; expected the file to be locked", locked, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected only the lock file, got %d entries", len(entries))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
@@ -10,17 +11,20 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"filippo.io/age"
 	"filippo.io/age/armor"
+	"filippo.io/age/plugin"
 	"github.com/anmitsu/go-shlex"
 	"github.com/carlmjohnson/crockford"
-	"github.com/gofrs/flock"
 	"github.com/spf13/pflag"
+	"golang.org/x/term"
 	"lukechampine.com/blake3"
 )
 
@@ -40,35 +44,132 @@ const (
 	fileReadOnlyPerm = 0o400
 	tempDirPerm      = 0o700
 
-	armorEnvVar          = "AGE_EDIT_ARMOR"
-	commandEnvVar        = "AGE_EDIT_COMMAND"
-	decodeEnvVar         = "AGE_EDIT_DECODE"
-	encodeEnvVar         = "AGE_EDIT_ENCODE"
-	encryptedFileEnvVar  = "AGE_EDIT_ENCRYPTED_FILE"
-	forceEnvVar          = "AGE_EDIT_FORCE"
-	identitiesFileEnvVar = "AGE_EDIT_IDENTITIES_FILE"
-	lockEnvVar           = "AGE_EDIT_LOCK"
-	memlockEnvVar        = "AGE_EDIT_MEMLOCK"
-	readOnlyEnvVar       = "AGE_EDIT_READ_ONLY"
-	tempDirPrefixEnvVar  = "AGE_EDIT_TEMP_DIR"
-	warnEnvVar           = "AGE_EDIT_WARN"
+	allowEmptyEnvVar         = "AGE_EDIT_ALLOW_EMPTY"
+	allowShrinkEnvVar        = "AGE_EDIT_ALLOW_SHRINK"
+	alsoSaveEnvVar           = "AGE_EDIT_ALSO_SAVE"
+	armorEnvVar              = "AGE_EDIT_ARMOR"
+	autoFilterEnvVar         = "AGE_EDIT_AUTO_FILTER"
+	autosaveEnvVar           = "AGE_EDIT_AUTOSAVE"
+	backupsEnvVar            = "AGE_EDIT_BACKUPS"
+	chdirEnvVar              = "AGE_EDIT_CHDIR"
+	commandEnvVar            = "AGE_EDIT_COMMAND"
+	compressionLevelEnvVar   = "AGE_EDIT_COMPRESSION_LEVEL"
+	compressionThreadsEnvVar = "AGE_EDIT_COMPRESSION_THREADS"
+	compressionWindowEnvVar  = "AGE_EDIT_COMPRESSION_WINDOW"
+	confirmSaveEnvVar        = "AGE_EDIT_CONFIRM_SAVE"
+	decodeEnvVar             = "AGE_EDIT_DECODE"
+	decodeShellEnvVar        = "AGE_EDIT_DECODE_SHELL"
+	encodeEnvVar             = "AGE_EDIT_ENCODE"
+	encodeShellEnvVar        = "AGE_EDIT_ENCODE_SHELL"
+	encryptedFileEnvVar      = "AGE_EDIT_ENCRYPTED_FILE"
+	filterDirEnvVar          = "AGE_EDIT_FILTER_DIR"
+	filterEnvEnvVar          = "AGE_EDIT_FILTER_ENV"
+	filterTimeoutEnvVar      = "AGE_EDIT_FILTER_TIMEOUT"
+	forceEnvVar              = "AGE_EDIT_FORCE"
+	fsyncEnvVar              = "AGE_EDIT_FSYNC"
+	gitCommitEnvVar          = "AGE_EDIT_GIT_COMMIT"
+	gitMessageEnvVar         = "AGE_EDIT_GIT_MESSAGE"
+	historyEnvVar            = "AGE_EDIT_HISTORY"
+	historyMaxAgeEnvVar      = "AGE_EDIT_HISTORY_MAX_AGE"
+	historyStoreEnvVar       = "AGE_EDIT_HISTORY_STORE"
+	hooksEnvVar              = "AGE_EDIT_HOOKS"
+	identitiesFileEnvVar     = "AGE_EDIT_IDENTITIES_FILE"
+	idleTimeoutEnvVar        = "AGE_EDIT_IDLE_TIMEOUT"
+	inhibitSleepEnvVar       = "AGE_EDIT_INHIBIT_SLEEP"
+	lockEnvVar               = "AGE_EDIT_LOCK"
+	lockExpiryEnvVar         = "AGE_EDIT_LOCK_EXPIRY"
+	lockStrategyEnvVar       = "AGE_EDIT_LOCK_STRATEGY"
+	maxShrinkEnvVar          = "AGE_EDIT_MAX_SHRINK"
+	memlockEnvVar            = "AGE_EDIT_MEMLOCK"
+	minSizeEnvVar            = "AGE_EDIT_MIN_SIZE"
+	notifyEnvVar             = "AGE_EDIT_NOTIFY"
+	openBinaryEnvVar         = "AGE_EDIT_OPEN_BINARY"
+	parkEnvVar               = "AGE_EDIT_PARK"
+	plainNameEnvVar          = "AGE_EDIT_PLAIN_NAME"
+	preferEnvVar             = "AGE_EDIT_PREFER"
+	preserveMtimeEnvVar      = "AGE_EDIT_PRESERVE_MTIME"
+	readOnlyEnvVar           = "AGE_EDIT_READ_ONLY"
+	revertSignalEnvVar       = "AGE_EDIT_REVERT_SIGNAL"
+	saveSignalsEnvVar        = "AGE_EDIT_SAVE_SIGNALS"
+	stayEnvVar               = "AGE_EDIT_STAY"
+	supervisorEnvVar         = "AGE_EDIT_SUPERVISOR"
+	tempDirPrefixEnvVar      = "AGE_EDIT_TEMP_DIR"
+	templateEnvVar           = "AGE_EDIT_TEMPLATE"
+	templateTextEnvVar       = "AGE_EDIT_TEMPLATE_TEXT"
+	trashEnvVar              = "AGE_EDIT_TRASH"
+	trashTTLEnvVar           = "AGE_EDIT_TRASH_TTL"
+	ttyEnvVar                = "AGE_EDIT_TTY"
+	validateEnvVar           = "AGE_EDIT_VALIDATE"
+	verboseEnvVar            = "AGE_EDIT_VERBOSE"
+	waitEnvVar               = "AGE_EDIT_WAIT"
+	warnDroppingsEnvVar      = "AGE_EDIT_WARN_DROPPINGS"
+	warnEnvVar               = "AGE_EDIT_WARN"
+	watchEnvVar              = "AGE_EDIT_WATCH"
+	wrapEnvVar               = "AGE_EDIT_WRAP"
+	yesEnvVar                = "AGE_EDIT_YES"
 
 	version = "0.15.0"
 )
 
 var (
 	editorEnvVars = []string{"AGE_EDIT_EDITOR", "VISUAL", "EDITOR"}
+	pagerEnvVars  = []string{"AGE_EDIT_PAGER", "PAGER"}
 )
 
 type config struct {
 	idsPath       string
 	encPath       string
+	otherPaths    []string
 	tempDirPrefix string
-
-	armor    bool
-	force    bool
-	lock     bool
-	readOnly bool
+	trashDir      string
+	trashTTL      time.Duration
+	lockStrategy  string
+	lockExpiry    time.Duration
+	autosave      time.Duration
+	idleTimeout   time.Duration
+	history       int
+	historyMaxAge time.Duration
+	historyStore  string
+	backups       int
+	maxShrink     int
+	minSize       int64
+	template      string
+	gitMessage    string
+	plainName     string
+	wait          string
+
+	allowEmpty    bool
+	allowShrink   bool
+	armor         bool
+	autoFilter    bool
+	chdir         bool
+	confirmSave   bool
+	force         bool
+	fsync         bool
+	gitCommit     bool
+	inhibitSleep  bool
+	keepFormat    bool
+	keepTemp      bool
+	lock          bool
+	lockKeys      bool
+	notify        bool
+	openBinary    bool
+	park          bool
+	preserveMtime bool
+	readOnly      bool
+	stay          bool
+	supervise     bool
+	tty           bool
+	verbose       bool
+	warnDroppings bool
+	watch         bool
+	yes           bool
+
+	alsoSave []string
+	prefer   []string
+
+	saveSignals  []string
+	revertSignal string
 
 	command string
 	args    []string
@@ -77,6 +178,15 @@ type config struct {
 	decodeArgs []string
 	encodeCmd  string
 	encodeArgs []string
+	diffCmd    string
+	diffArgs   []string
+
+	validateCmd  string
+	validateArgs []string
+
+	compression compressionOptions
+
+	hooks hookSet
 }
 
 type saveError struct {
@@ -88,21 +198,20 @@ func (e *saveError) Error() string {
 	return fmt.Sprintf("encryption failed: %v", e.err)
 }
 
+func (e *saveError) Unwrap() error {
+	return e.err
+}
+
 // wrapDecrypt transparently handles both armored and binary age files
 // by detecting the armor header and wrapping the reader appropriately
 // before decryption.
+// The armor header can follow a byte order mark and whitespace.
 func wrapDecrypt(r io.Reader, identities ...age.Identity) (io.Reader, error) {
-	buffer := make([]byte, len(armor.Header))
-
-	// Check if the input starts with an armor header.
-	n, err := io.ReadFull(r, buffer)
-	if err != nil && !errors.Is(err, io.EOF) && n < len(armor.Header) {
-		return nil, fmt.Errorf("failed to read header: %w", err)
+	r, armored, err := peekArmor(r)
+	if err != nil {
+		return nil, err
 	}
 
-	armored := string(buffer[:n]) == armor.Header
-	r = io.MultiReader(bytes.NewReader(buffer[:n]), r)
-
 	if armored {
 		return age.Decrypt(armor.NewReader(r), identities...)
 	}
@@ -110,6 +219,66 @@ func wrapDecrypt(r io.Reader, identities ...age.Identity) (io.Reader, error) {
 	return age.Decrypt(r, identities...)
 }
 
+// armorPeekLength is how far into a file age-edit looks for the armor header.
+const armorPeekLength = 1024
+
+// utf8BOM is the byte order mark that some editors and clipboards put before text.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// armorStart returns where the armor header starts in the beginning of a file
+// after a byte order mark and whitespace, like after email or clipboard transport.
+// It returns -1 when the file isn't armored.
+func armorStart(head []byte) int {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(head, utf8BOM), " \t\r\n")
+	if !bytes.HasPrefix(trimmed, []byte(armor.Header)) {
+		return -1
+	}
+
+	return len(head) - len(trimmed)
+}
+
+// hasArmorHeader reports whether data is armored.
+func hasArmorHeader(data []byte) bool {
+	return armorStart(data) >= 0
+}
+
+// peekArmor reports whether the input is armored.
+// It returns a reader of the input that starts at the armor header of an armored file,
+// so the armor reader of age doesn't trip on a byte order mark.
+// Line endings are left to the armor reader, which accepts CRLF.
+func peekArmor(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReaderSize(r, armorPeekLength)
+
+	head, err := br.Peek(armorPeekLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	start := armorStart(head)
+	if start < 0 {
+		return br, false, nil
+	}
+
+	if _, err := br.Discard(start); err != nil {
+		return nil, false, err
+	}
+
+	return br, true, nil
+}
+
+// isArmored reports whether a file is armored.
+func isArmored(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	_, armored, err := peekArmor(f)
+
+	return armored, err
+}
+
 // withFiles opens input and output files and executes the provided action function,
 // ensuring both files are properly closed afterward.
 func withFiles(inputPath, outputPath string, action func(in io.Reader, out io.Writer) error) error {
@@ -131,6 +300,9 @@ func withFiles(inputPath, outputPath string, action func(in io.Reader, out io.Wr
 // runFilter executes a command with the given arguments,
 // piping input to stdin and output to stdout.
 // If cmd is empty, it copies input directly to output.
+// A command like "builtin:gzip" runs a built-in filter in the process.
+// An external filter that runs longer than the filter timeout is killed with the processes it has started.
+// It gets a minimal environment and runs in the filter directory; see configureFilterCommand.
 func runFilter(cmd string, args []string, in io.Reader, out io.Writer) error {
 	if strings.TrimSpace(cmd) == "" {
 		_, err := io.Copy(out, in)
@@ -138,50 +310,104 @@ func runFilter(cmd string, args []string, in io.Reader, out io.Writer) error {
 		return err
 	}
 
-	filterCmd := exec.CommandContext(context.Background(), cmd, args...)
+	if strings.HasPrefix(cmd, builtinFilterPrefix) {
+		return runBuiltinFilter(cmd, args, in, out)
+	}
+
+	ctx, cancel, timeout := filterContext()
+	defer cancel()
+
+	filterCmd := exec.CommandContext(ctx, cmd, args...)
 	filterCmd.Stdin = in
 	filterCmd.Stdout = out
 	filterCmd.Stderr = os.Stderr
+	configureFilterCommand(filterCmd)
+
+	err := runFilterCommand(filterCmd)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return filterTimeoutError(cmd, timeout)
+	}
 
-	return filterCmd.Run()
+	return err
 }
 
 // decryptToFile decrypts inputPath to outputPath,
 // optionally applying a decode filter command (e.g., decompressor)
 // to the decrypted contents.
 func decryptToFile(inputPath, outputPath string, decodeCmd string, decodeArgs []string, identities ...age.Identity) error {
-	return withFiles(inputPath, outputPath, func(in io.Reader, out io.Writer) error {
+	if err := checkIdentitiesFit(inputPath, identities); err != nil {
+		return err
+	}
+
+	err := withFiles(inputPath, outputPath, func(in io.Reader, out io.Writer) error {
 		d, err := wrapDecrypt(in, identities...)
 		if err != nil {
-			return err
+			return explainDecryptError(err, inputPath, identities)
 		}
 
 		return runFilter(decodeCmd, decodeArgs, d, out)
 	})
+
+	return explainTrailingData(err, inputPath)
 }
 
 // encryptToFile encrypts inputPath to outputPath,
 // optionally applying an encode filter command (e.g., a compressor)
 // before encryption and optionally armoring the output.
-func encryptToFile(inputPath, outputPath string, armored bool, encodeCmd string, encodeArgs []string, recipients ...age.Recipient) error {
-	return withFiles(inputPath, outputPath, func(in io.Reader, out io.Writer) error {
-		w := out
+// The output replaces outputPath atomically, so a crash or a failed filter leaves the old file intact.
+// An existing file keeps its permissions, owner, and extended attributes, and a symlink keeps pointing to the replaced file.
+// With fsync, the file is flushed to disk before encryptToFile returns.
+func encryptToFile(inputPath, outputPath string, fsync, armored bool, encodeCmd string, encodeArgs []string, recipients ...age.Recipient) error {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-		if armored {
-			armorWriter := armor.NewWriter(out)
-			defer armorWriter.Close()
+	perm := os.FileMode(filePerm)
 
-			w = armorWriter
-		}
+	info, err := os.Stat(outputPath)
+	if err == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
 
-		encryptWriter, err := age.Encrypt(w, recipients...)
-		if err != nil {
-			return err
+	return writeFileAtomic(outputPath, perm, fsync, func(w io.Writer) error {
+		return encryptStream(in, w, armored, encodeCmd, encodeArgs, recipients...)
+	})
+}
+
+// encryptStream encrypts in to out like encryptToFile.
+// Closing the writers writes the last chunk and the armor footer,
+// so their errors fail the encryption like the errors of the filter.
+func encryptStream(in io.Reader, out io.Writer, armored bool, encodeCmd string, encodeArgs []string, recipients ...age.Recipient) error {
+	w := out
+
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(out)
+		w = armorWriter
+	}
+
+	encryptWriter, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return err
+	}
+
+	err = runFilter(encodeCmd, encodeArgs, in, encryptWriter)
+
+	if closeErr := encryptWriter.Close(); err == nil {
+		err = closeErr
+	}
+
+	if armorWriter != nil {
+		if closeErr := armorWriter.Close(); err == nil {
+			err = closeErr
 		}
-		defer encryptWriter.Close()
+	}
 
-		return runFilter(encodeCmd, encodeArgs, in, encryptWriter)
-	})
+	return err
 }
 
 // randomID generates a random 8-character lowercase Crockford-base32-encoded string.
@@ -192,11 +418,6 @@ func randomID() string {
 	return string(buf)
 }
 
-// getRoot removes the ".age" suffix from a path if present.
-func getRoot(path string) string {
-	return strings.TrimSuffix(path, ".age")
-}
-
 // checksumFile computes the BLAKE3 hash of a file.
 // If the file does not exist it returns the hash of an empty file.
 func checksumFile(path string) ([]byte, error) {
@@ -223,6 +444,7 @@ func checksumFile(path string) ([]byte, error) {
 
 // checkAccess verifies that a file exists and is readable,
 // and if not in read-only mode, also writable.
+// A new file needs a writable directory, while an existing file in a read-only directory gets a warning.
 // It returns true if the file exists, false if it doesn't (and is allowed to be created).
 func checkAccess(path string, readOnly bool) (bool, error) {
 	_, err := os.Stat(path)
@@ -232,7 +454,7 @@ func checkAccess(path string, readOnly bool) (bool, error) {
 			return false, fmt.Errorf("%q does not exist; won't attempt to create it in read-only mode", path)
 		}
 
-		return false, nil
+		return false, checkDirWritable(path)
 	}
 
 	f, err := os.Open(path)
@@ -251,268 +473,1318 @@ func checkAccess(path string, readOnly bool) (bool, error) {
 		}
 
 		f.Close()
+
+		// Saves rewrite the file in place when they can't replace it.
+		if err := checkDirWritable(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: can't create files in directory %q, so saves rewrite %q in place instead of replacing it\n", filepath.Dir(path), path)
+		}
 	}
 
 	return true, nil
 }
 
+// checkDirWritable creates and removes an empty file next to path
+// to confirm that the encrypted file can be saved in its directory.
+// This catches read-only mounts and missing permissions before the user starts editing.
+func checkDirWritable(path string) error {
+	dir := filepath.Dir(path)
+
+	f, err := os.CreateTemp(dir, ".age-edit-canary-*")
+	if err != nil {
+		return fmt.Errorf("can't create files in directory %q: %w", dir, err)
+	}
+
+	f.Close()
+
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("can't remove files in directory %q: %w", dir, err)
+	}
+
+	return nil
+}
+
+// parseIdentity parses a single native X25519 or plugin identity.
+// It returns the identity and the recipient to encrypt to.
+func parseIdentity(line string) (age.Identity, age.Recipient, error) {
+	if strings.HasPrefix(line, "AGE-PLUGIN-") {
+		identity, err := plugin.NewIdentity(line, pluginUI())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := checkPlugin(identity.Name()); err != nil {
+			return nil, nil, err
+		}
+
+		return identity, identity.Recipient(), nil
+	}
+
+	identity, err := age.ParseX25519Identity(line)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return identity, identity.Recipient(), nil
+}
+
 // loadIdentities parses an identities file.
 // It returns both the private identities and their corresponding public recipients.
-// Comments and blank lines are ignored.
-func loadIdentities(path string) ([]age.Identity, []age.Recipient, error) {
-	identityData, err := os.ReadFile(path)
+// Comments and blank lines are ignored
+// except for "# label: ..." comments, which name the identity that follows.
+// See readIdentityFile for passphrase-protected files and the meaning of lockKeys.
+func loadIdentities(path string, lockKeys bool) ([]age.Identity, []age.Recipient, error) {
+	identityData, sum, err := readIdentityFile(path, lockKeys)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read identities file: %w", err)
+		return nil, nil, err
 	}
+	defer clear(identityData)
 
 	identityCount := 0
-	lines := strings.Split(string(identityData), "\n")
-	identities := make([]age.Identity, 0, len(lines))
-	recipients := make([]age.Recipient, 0, len(lines))
+	identities := []age.Identity{}
+	recipients := []age.Recipient{}
+
+	label := ""
+
+	// The lines are slices of the locked buffer.
+	// Only comments and the key being parsed become strings, since the parsers of age take them.
+	for _, line := range bytes.Split(identityData, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == '#' {
+			if l, ok := identityLabel(string(line)); ok {
+				label = l
+			}
 
-	for _, line := range strings.Split(string(identityData), "\n") {
-		line := strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 
 		identityCount++
 
-		identity, err := age.ParseX25519Identity(line)
+		identity, recipient, err := parseIdentity(string(line))
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to parse private key number %d: %w", identityCount, err)
 		}
 
-		identities = append(identities, identity)
-		recipients = append(recipients, identity.Recipient())
+		identities = append(identities, newNamedIdentity(identity, label, recipientName(recipient)))
+		recipients = append(recipients, recipient)
+		label = ""
 	}
 
 	if len(identities) == 0 {
 		return identities, recipients, errors.New("no identities found in file")
 	}
 
+	if err := rememberRecipients(sum, recipients); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to record the recipients for the agent:", err)
+	}
+
 	return identities, recipients, nil
 }
 
-// edit implements the edit workflow:
-// decrypt the file, launch an editor, detect changes, and re-encrypt if modified.
-// It returns the temporary directory path and any error encountered.
-// The caller is responsible for cleaning up the temporary directory.
-func edit(cfg config) (string, error) {
-	exists, err := checkAccess(cfg.encPath, cfg.readOnly)
+// memoryProtection describes how the keys are protected from swapping
+// after lockMemory has run if memlock is true and lockKeys is the fallback it chose.
+func memoryProtection(memlock, lockKeys bool) string {
+	switch {
+	case !memlock || !memlockSupported:
+		return "memory isn't locked, so keys can be swapped to disk"
+
+	case lockKeys:
+		return "only the buffer of the identities file is locked in memory, so the parsed keys can be swapped to disk"
+
+	default:
+		return "all memory is locked"
+	}
+}
+
+// userDirName returns the name of the per-user directory under the temporary directory prefix.
+func userDirName() (string, error) {
+	currentUser, err := user.Current()
 	if err != nil {
 		return "", err
 	}
 
-	identities, recipients, err := loadIdentities(cfg.idsPath)
+	hostname, err := os.Hostname()
 	if err != nil {
 		return "", err
 	}
 
-	currentUser, err := user.Current()
+	return fmt.Sprintf("age-edit-%s@%s", currentUser.Username, hostname), nil
+}
+
+// userRuntimeDir returns the per-user directory for the files of running processes,
+// like the agent socket.
+// It is in XDG_RUNTIME_DIR when it is set and in the system temporary directory otherwise.
+func userRuntimeDir() (string, error) {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "age-edit"), nil
+	}
+
+	userDir, err := userDirName()
 	if err != nil {
 		return "", err
 	}
 
-	hostname, err := os.Hostname()
+	return filepath.Join(os.TempDir(), userDir), nil
+}
+
+// userStateDir returns the per-user directory for data that outlives a session,
+// like the version history.
+// It is in XDG_STATE_HOME when it is set and in ~/.local/state otherwise.
+func userStateDir() (string, error) {
+	if stateDir := os.Getenv("XDG_STATE_HOME"); stateDir != "" {
+		return filepath.Join(stateDir, "age-edit"), nil
+	}
+
+	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 
-	userDir := fmt.Sprintf("age-edit-%s@%s", currentUser.Username, hostname)
-	subdir := randomID()
-	tempDir := filepath.Join(cfg.tempDirPrefix, userDir, subdir)
+	return filepath.Join(home, ".local", "state", "age-edit"), nil
+}
 
-	err = os.MkdirAll(tempDir, tempDirPerm)
+// newTempDir creates a random subdirectory of the per-user directory
+// under the temporary directory prefix.
+// The directory records the process right away,
+// so the sweep of another age-edit process doesn't take it for the directory of a crashed session.
+// It returns the path even on failure so the caller can clean up.
+func newTempDir(prefix string) (string, error) {
+	userDir, err := userDirName()
 	if err != nil {
+		return "", err
+	}
+
+	tempDir := filepath.Join(prefix, userDir, randomID())
+
+	if err := os.MkdirAll(tempDir, tempDirPerm); err != nil {
 		return tempDir, err
 	}
 
-	rootname := getRoot(cfg.encPath)
-	tempFile := filepath.Join(tempDir, filepath.Base(rootname))
+	return tempDir, writeSessionInfo(tempDir, []*editFile{}, false)
+}
 
-	encLock := flock.New(cfg.encPath)
+// commandArgs puts the paths of the plaintext in the arguments of the editor.
+// The placeholders "{}" and "{file}" are replaced with a path anywhere in an argument,
+// like "--goto={}:10", and an argument with a placeholder is repeated for each path.
+// Without placeholders, the paths are appended.
+func commandArgs(args, paths []string) []string {
+	hasPlaceholder := func(arg string) bool {
+		return strings.Contains(arg, "{}") || strings.Contains(arg, "{file}")
+	}
 
-	//nolint:nestif
-	if exists {
-		if cfg.lock && !cfg.readOnly {
-			locked, err := encLock.TryLock()
-			if err != nil {
-				return tempDir, fmt.Errorf("failed to acquire lock: %w", err)
-			}
+	if !slices.ContainsFunc(args, hasPlaceholder) {
+		return append(append([]string{}, args...), paths...)
+	}
 
-			if !locked {
-				return tempDir, errors.New("encrypted file is locked")
-			}
+	fullArgs := []string{}
+
+	for _, arg := range args {
+		if !hasPlaceholder(arg) {
+			fullArgs = append(fullArgs, arg)
 
-			defer func() {
-				_ = encLock.Unlock()
-			}()
+			continue
 		}
 
-		if err := decryptToFile(cfg.encPath, tempFile, cfg.decodeCmd, cfg.decodeArgs, identities...); err != nil {
-			return tempDir, err
+		for _, path := range paths {
+			fullArgs = append(fullArgs, strings.NewReplacer("{}", path, "{file}", path).Replace(arg))
 		}
 	}
 
-	beforeSum, err := checksumFile(tempFile)
-	if err != nil {
-		return tempDir, err
-	}
+	return fullArgs
+}
 
-	if cfg.readOnly {
-		if err := os.Chmod(tempFile, fileReadOnlyPerm); err != nil {
-			return tempDir, err
-		}
+// removeTempDir shreds the temporary directory of a session with the plaintext,
+// like the signal handler and the supervisor do,
+// and then removes the "age-edit-..." directory that contains it if it is empty.
+func removeTempDir(tempDir string) {
+	if err := shredTree(tempDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to remove the temporary directory:", err)
 	}
 
-	var mu sync.Mutex
+	_ = os.Remove(filepath.Dir(tempDir))
+}
 
-	saveChanges := func() error {
-		mu.Lock()
-		defer mu.Unlock()
+// edit implements the edit workflow:
+// decrypt the files, launch an editor, detect changes, and re-encrypt the modified files.
+// It returns the temporary directory path and any error encountered.
+// The caller is responsible for cleaning up the temporary directory.
+func edit(cfg config) (string, error) {
+	paths := append([]string{cfg.encPath}, cfg.otherPaths...)
+	files := make([]*editFile, 0, len(paths))
+	seen := map[string]bool{}
 
-		currentSum, err := checksumFile(tempFile)
+	for _, path := range paths {
+		f, err := newEditFile(cfg, path)
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		if cfg.force || !bytes.Equal(beforeSum, currentSum) {
-			if err = encryptToFile(tempFile, cfg.encPath, cfg.armor, cfg.encodeCmd, cfg.encodeArgs, recipients...); err != nil {
-				return err
-			}
+		absPath, err := filepath.Abs(f.cfg.encPath)
+		if err != nil {
+			return "", err
+		}
 
-			beforeSum = currentSum
+		if seen[absPath] {
+			return "", fmt.Errorf("%q is given more than once", path)
 		}
 
-		return nil
+		seen[absPath] = true
+		files = append(files, f)
 	}
 
-	if !cfg.readOnly {
-		stop := handleSignals(saveChanges)
-		defer stop()
+	if err := checkMirrorTargets(files); err != nil {
+		return "", err
 	}
 
-	fullArgs := append([]string{}, cfg.args...)
-	fullArgs = append(fullArgs, tempFile)
+	identities, recipients, err := openIdentities(cfg.idsPath, cfg.lockKeys)
+	if err != nil {
+		return "", err
+	}
 
-	cmd := exec.CommandContext(context.Background(), cfg.command, fullArgs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	identities = orderIdentities(identities, cfg.prefer)
 
-	if err = cmd.Run(); err != nil {
-		return tempDir, err
+	if err := pruneTrash(cfg.trashDir, cfg.trashTTL); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to prune trash:", err)
 	}
 
-	if !cfg.readOnly {
-		if err := saveChanges(); err != nil {
-			return tempDir, &saveError{err: err, tempFile: tempFile}
+	// The user has already been asked about the plaintext crashed sessions left for these files.
+	asked := []string{}
+	for _, f := range files {
+		if absPath, err := filepath.Abs(f.cfg.encPath); err == nil {
+			asked = append(asked, absPath)
 		}
 	}
 
-	return tempDir, nil
-}
-
-// parseBool converts a string to a boolean.
-// It accepts "1", "true", "yes" as true
-// and "0", "false", "no" as false.
-// An empty string returns the fallback value.
-func parseBool(s string, fallback bool) (bool, error) {
-	if s == "" {
-		return fallback, nil
+	if _, err := sweepStaleDirs(os.Stderr, cfg.tempDirPrefix, false, asked); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to remove stale temporary directories:", err)
 	}
 
-	switch strings.ToLower(s) {
-	case "1", "true", "yes":
-		return true, nil
-
-	case "0", "false", "no":
-		return false, nil
-
-	default:
-		return false, fmt.Errorf("invalid boolean value: %q", s)
+	tempDir, err := newTempDir(cfg.tempDirPrefix)
+	if err != nil {
+		return tempDir, err
 	}
-}
 
-// defaultArg retrieves an environment variable.
-// It returns the value and a help string indicating this value is the default.
-func defaultArg(envVar string) (string, string) {
-	value := os.Getenv(envVar)
+	if cfg.keepTemp {
+		fmt.Fprintf(os.Stderr, "Warning: --keep-temp leaves the plaintext unencrypted in %q after age-edit exits; remove it when you are done\n", tempDir)
+	} else if cfg.supervise {
+		if err := startSupervisor(tempDir); err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+	}
 
-	helpDefault := ""
-	if value != "" {
-		helpDefault = fmt.Sprintf(", default %q", value)
+	if cfg.inhibitSleep {
+		allowSleep, err := inhibitSleep()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		} else {
+			defer allowSleep()
+		}
 	}
 
-	return value, helpDefault
-}
+	// The filters of other commands don't belong to the session.
+	defer setFilterEnv(nil)
 
-// defaultBool retrieves a boolean environment variable, using parseBool to convert it.
-// If the variable is not set, the fallback value is returned.
-func defaultBool(envVar string, fallback bool) (bool, error) {
-	val := os.Getenv(envVar)
+	var (
+		mu     sync.Mutex
+		ready  atomic.Bool
+		editor atomic.Pointer[os.Process]
+	)
 
-	b, err := parseBool(val, fallback)
-	if err != nil {
-		return false, fmt.Errorf("invalid boolean value for %s: %q", envVar, val)
-	}
+	// A logout, a lost terminal, or a kill saves what it can and doesn't leave the plaintext behind.
+	stopTermination := handleTermination(func(sig os.Signal) {
+		fmt.Fprintf(os.Stderr, "\r\nage-edit: received %v; saving and exiting\n", sig)
 
-	return b, nil
-}
+		// A stuck filter would keep a save in progress from releasing the lock.
+		killFilters()
 
-func defaultArmor() (bool, error) {
-	return defaultBool(armorEnvVar, false)
-}
+		mu.Lock()
 
-func defaultCommand() string {
-	return os.Getenv(commandEnvVar)
-}
+		if ready.Load() && !cfg.readOnly {
+			for _, f := range files {
+				if err := f.save(tempDir, recipients); err != nil {
+					fmt.Fprintf(os.Stderr, "\r\007age-edit: saving failed: %v\n", err)
+				}
+			}
+		}
 
-func defaultDecode() string {
-	return os.Getenv(decodeEnvVar)
-}
+		closeEditor(&editor, editorExitGrace)
 
-func defaultEncode() string {
-	return os.Getenv(encodeEnvVar)
-}
+		for _, f := range files {
+			f.close()
+		}
 
-func defaultEditor() string {
-	for _, envVar := range editorEnvVars {
-		value := os.Getenv(envVar)
-		if value != "" {
-			return value
+		// The plaintext is overwritten, since nobody may be around to check that it is gone.
+		if cfg.keepTemp {
+			fmt.Fprintf(os.Stderr, "\r\nage-edit: kept the temporary directory %q\n", tempDir)
+		} else {
+			if err := shredTree(tempDir); err != nil {
+				fmt.Fprintf(os.Stderr, "\r\007age-edit: failed to remove the temporary directory: %v\n", err)
+			}
+
+			_ = os.Remove(filepath.Dir(tempDir))
 		}
-	}
 
-	return "vi"
-}
+		os.Exit(exitError)
+	})
+	defer stopTermination()
 
-func defaultForce() (bool, error) {
-	return defaultBool(forceEnvVar, false)
-}
+	tempFiles := []string{}
+	editPaths := []string{}
+	encPaths := []string{}
 
-func defaultLock() (bool, error) {
-	return defaultBool(lockEnvVar, true)
-}
+	for i, f := range files {
+		defer f.close()
 
-func defaultMemlock() (bool, error) {
-	return defaultBool(memlockEnvVar, true)
-}
+		// Files with the same name from different directories get subdirectories.
+		name := plaintextName(f.cfg)
+		tempFile := filepath.Join(tempDir, name)
 
-func defaultReadOnly() (bool, error) {
-	return defaultBool(readOnlyEnvVar, false)
-}
+		// An archive also takes the name without ".tar" for its tree.
+		taken := func(path string) bool {
+			return slices.Contains(tempFiles, path) || slices.Contains(editPaths, path)
+		}
 
-func defaultTempDirPrefix() string {
-	prefix := os.Getenv(tempDirPrefixEnvVar)
-	if prefix == "" {
+		if taken(tempFile) || taken(strings.TrimSuffix(tempFile, archiveSuffix)) {
+			subdir := filepath.Join(tempDir, strconv.Itoa(i+1))
+			if err := os.Mkdir(subdir, tempDirPerm); err != nil {
+				return tempDir, err
+			}
+
+			tempFile = filepath.Join(subdir, name)
+		}
+
+		if err := f.open(tempDir, tempFile, identities); err != nil {
+			return tempDir, err
+		}
+
+		// The tree of an archive recognized by its content is named only now.
+		if f.dir != "" && taken(f.dir) {
+			return tempDir, fmt.Errorf("the directory for %q would take the name of another file in the session", f.cfg.encPath)
+		}
+
+		if f.recovered != nil {
+			if err := f.recoverLeftover(*f.recovered); err != nil {
+				return tempDir, err
+			}
+
+			// The edits are in this session now.
+			if err := destroyLeftover(*f.recovered); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: failed to destroy the recovered plaintext:", err)
+			}
+		}
+
+		tempFiles = append(tempFiles, tempFile)
+		editPaths = append(editPaths, f.editPath())
+		encPaths = append(encPaths, f.cfg.encPath)
+	}
+
+	ready.Store(true)
+
+	// A later session can find the plaintext if this one crashes.
+	if err := writeSessionInfo(tempDir, files, cfg.keepTemp); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to record the session in the temporary directory:", err)
+	}
+
+	// saveFiles returns the encrypted files it has changed.
+	saveFiles := func(fs []*editFile) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		saved := []string{}
+		errs := []error{}
+
+		for _, f := range fs {
+			before := f.beforeSum
+
+			if err := f.save(tempDir, recipients); err != nil {
+				errs = append(errs, err)
+			} else if !bytes.Equal(before, f.beforeSum) {
+				saved = append(saved, f.cfg.encPath)
+			}
+		}
+
+		return saved, errors.Join(errs...)
+	}
+
+	saveChanges := func() error {
+		_, err := saveFiles(files)
+
+		return err
+	}
+
+	// Saves in the background can tell a user behind a GUI editor how they went.
+	// Each caller gets its own function, so a failure that repeats, like on every autosave, notifies once.
+	backgroundSave := func(fs ...*editFile) func() error {
+		lastErr := ""
+
+		return func() error {
+			saved, err := saveFiles(fs)
+
+			if cfg.notify && (err == nil || err.Error() != lastErr) {
+				notifySaved(saved, err)
+			}
+
+			lastErr = ""
+			if err != nil {
+				lastErr = err.Error()
+			}
+
+			return err
+		}
+	}
+
+	stashAll := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, f := range files {
+			f.stash(recipients)
+		}
+	}
+
+	revertChanges := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		errs := []error{}
+
+		for _, f := range files {
+			if err := f.revert(tempDir, identities); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+
+	// A read-only session can't save but can still pick up changes on disk.
+	saveSignals := cfg.saveSignals
+	saveTrigger := backgroundSave(files...)
+
+	if cfg.readOnly {
+		saveSignals = nil
+		saveTrigger = nil
+	}
+
+	stopSignals := handleSignals(saveSignals, cfg.revertSignal, backgroundSave(files...), revertChanges)
+	defer stopSignals()
+
+	// Trigger files do the same where there are no signals.
+	stopTriggers := watchTriggers(tempDir, triggerInterval, saveTrigger, revertChanges)
+	defer stopTriggers()
+
+	if !cfg.readOnly {
+		if cfg.autosave > 0 {
+			stopAutosave := autosave(cfg.autosave, backgroundSave(files...))
+			defer stopAutosave()
+		}
+
+		if cfg.watch {
+			for _, f := range files {
+				stopWatch, err := saveOnWrite(f.tempFile, backgroundSave(f))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Warning: failed to watch the temporary file:", err)
+				} else {
+					defer stopWatch()
+				}
+			}
+		}
+	}
+
+	// A suspended session saves and keeps the plaintext off the disk until it continues.
+	// The lock is held while suspended, so nothing saves the missing files.
+	if cfg.park {
+		parkPaths := []string{}
+
+		for _, f := range files {
+			parkPaths = append(parkPaths, f.tempFile)
+			if f.dir != "" {
+				parkPaths = append(parkPaths, f.dir)
+			}
+		}
+
+		stopSuspend := handleSuspend(func() func() {
+			mu.Lock()
+
+			if !cfg.readOnly {
+				for _, f := range files {
+					if err := f.save(tempDir, recipients); err != nil {
+						fmt.Fprintf(os.Stderr, "\r\007age-edit: saving failed: %v\n", err)
+					}
+				}
+			}
+
+			restore, err := parkPlaintext(parkPaths)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\r\007age-edit: failed to park the plaintext: %v\n", err)
+			} else {
+				fmt.Fprintln(os.Stderr, "\r\nage-edit: parked the plaintext while suspended")
+			}
+
+			return func() {
+				defer mu.Unlock()
+
+				if restore == nil {
+					return
+				}
+
+				if err := restore(); err != nil {
+					fmt.Fprintf(os.Stderr, "\r\007age-edit: failed to restore the plaintext: %v\n", err)
+				}
+			}
+		})
+		defer stopSuspend()
+	}
+
+	// The editor gets absolute paths, so they still work when it runs in the temporary directory.
+	if cfg.chdir {
+		for i, path := range editPaths {
+			if editPaths[i], err = filepath.Abs(path); err != nil {
+				return tempDir, err
+			}
+		}
+	}
+
+	// Binary files, like images and documents, open in the application of the desktop instead of a text editor.
+	if cfg.openBinary && len(files) == 1 && files[0].dir == "" {
+		binary, err := isBinaryFile(files[0].tempFile)
+		if err != nil {
+			return tempDir, err
+		}
+
+		if binary {
+			cfg.command, cfg.args, cfg.wait = systemOpener(cfg.wait)
+		}
+	}
+
+	args := cfg.args
+	if cfg.wait == waitFlags {
+		args = editorWaitArgs(cfg.command, args)
+	}
+
+	fullArgs := commandArgs(args, editPaths)
+
+	// The files of the session aren't droppings, whatever their names.
+	ownPaths := []string{filepath.Join(tempDir, confirmSavedDir)}
+	for _, f := range files {
+		ownPaths = append(ownPaths, f.tempFile)
+		if f.dir != "" {
+			ownPaths = append(ownPaths, f.dir)
+		}
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+
+	// Only a user at a terminal can choose what to do after a failed save.
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) //nolint:gosec
+
+	// failed has the files whose changes couldn't be saved, which the session doesn't save again.
+	failed := map[*editFile]error{}
+
+	var (
+		tty    *os.File
+		ownPTY bool
+	)
+
+	if cfg.tty {
+		var closeTTY func()
+
+		tty, ownPTY, closeTTY, err = editorTerminal()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		} else {
+			defer closeTTY()
+		}
+	}
+
+	var idled atomic.Bool
+
+	// An unattended session saves, closes the editor, and ends, so the plaintext doesn't stay on disk.
+	if cfg.idleTimeout > 0 {
+		stopIdle := watchIdle(cfg.idleTimeout, idleCheckInterval, editPaths, func() bool {
+			fmt.Fprintf(os.Stderr, "\r\nage-edit: no activity for %v; saving and closing the editor\n", cfg.idleTimeout)
+
+			if !cfg.readOnly {
+				if err := saveChanges(); err != nil {
+					fmt.Fprintf(os.Stderr, "\r\007age-edit: saving failed, so the editor stays open: %v\n", err)
+
+					return false
+				}
+			}
+
+			idled.Store(true)
+
+			if p := editor.Load(); p != nil {
+				if err := terminateProcess(p); err != nil {
+					fmt.Fprintln(os.Stderr, "Warning: failed to close the editor:", err)
+				}
+			}
+
+			return true
+		})
+		defer stopIdle()
+	}
+
+	for {
+		cmd := exec.CommandContext(context.Background(), cfg.command, fullArgs...)
+		cmd.Env = append(os.Environ(), sessionEnv(tempDir, cfg.readOnly, editPaths, encPaths)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if cfg.chdir {
+			cmd.Dir = tempDir
+		}
+
+		if tty != nil {
+			cmd.Stdin = tty
+			cmd.Stdout = tty
+			cmd.Stderr = tty
+
+			if ownPTY {
+				setControllingTerminal(cmd)
+			}
+		}
+
+		if err = cmd.Start(); err == nil {
+			editor.Store(cmd.Process)
+			err = cmd.Wait()
+			editor.Store(nil)
+		}
+
+		// The editor of an idle session exits with an error after it is closed.
+		if err != nil && !idled.Load() {
+			stashAll()
+
+			return tempDir, err
+		}
+
+		// A GUI editor may have returned while its window is still open.
+		if !idled.Load() {
+			if err := waitForEditor(cfg.wait, stdin, os.Stderr, editPaths); err != nil {
+				stashAll()
+
+				return tempDir, err
+			}
+		}
+
+		// Saving fails for a replacement that isn't a file, so this is only a warning.
+		for _, f := range files {
+			if err := f.adoptReplacement(); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning:", err)
+			}
+		}
+
+		// Swap, backup, and undo files the editor leaves behind can hold the plaintext.
+		scrubbed, err := scrubDroppings(tempDir, ownPaths)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to remove the files the editor left:", err)
+		}
+
+		if cfg.warnDroppings {
+			for _, path := range scrubbed {
+				fmt.Fprintf(os.Stderr, "Warning: removed %q that the editor left; configure the editor not to write such files\n", path)
+			}
+		}
+
+		reopen := false
+
+		for _, f := range files {
+			if cfg.readOnly || failed[f] != nil {
+				continue
+			}
+
+			if cfg.confirmSave {
+				edited, err := filepath.Rel(tempDir, f.tempFile)
+				if err != nil {
+					return tempDir, err
+				}
+
+				f.declined = !confirmSave(stdin, os.Stderr, cfg.diffCmd, cfg.diffArgs, tempDir, f.savedPath, edited)
+			}
+
+			for retry := !f.declined; retry; {
+				var (
+					conflictErr   *conflictError
+					mirrorErr     *mirrorError
+					shrinkErr     *shrinkError
+					validationErr *validationError
+				)
+
+				retry = false
+				f.refused = nil
+
+				mu.Lock()
+				err := f.save(tempDir, recipients)
+				mu.Unlock()
+
+				switch {
+				case errors.Is(err, errEmptyPlaintext) || errors.As(err, &shrinkErr):
+					// The encrypted file still has the content, and the trash gets the edited file.
+					f.refused = err
+
+					if cfg.stay {
+						fmt.Fprintln(os.Stderr, "Warning:", err)
+					}
+
+				// The editor opens again to fix what the validator has rejected.
+				// When the plaintext hasn't changed since, the user is asked what to do like after other failures.
+				case errors.As(err, &validationErr) && interactive && !validationErr.repeated && !idled.Load():
+					fmt.Fprintln(os.Stderr, "Error:", err)
+					fmt.Fprintf(os.Stderr, "Opening %q in the editor again\n", f.cfg.encPath)
+
+					reopen = true
+
+				// The file is saved, so only the copies are missing, and there is no plaintext to keep.
+				case errors.As(err, &mirrorErr):
+					failed[f] = err
+
+				case err != nil && !errors.As(err, &conflictErr):
+					if !interactive {
+						failed[f] = &saveError{err: err, tempFile: f.tempFile}
+
+						break
+					}
+
+					saveAs := func(path string) error {
+						mu.Lock()
+						defer mu.Unlock()
+
+						setFilterEnv(f.env)
+
+						in, err := os.Open(f.tempFile)
+						if err != nil {
+							return err
+						}
+						defer in.Close()
+
+						return writeNewFileAtomic(path, filePerm, f.cfg.fsync, func(w io.Writer) error {
+							return encryptStream(in, w, f.cfg.armor, f.cfg.encodeCmd, f.cfg.encodeArgs, recipients...)
+						})
+					}
+
+					encPath := f.cfg.encPath
+
+					switch choice, path := handleSaveFailure(stdin, os.Stderr, err, f.tempFile, saveAsPath(encPath, time.Now()), saveAs); choice {
+					case saveFailureRetry:
+						retry = true
+
+					case saveFailureEdit:
+						reopen = true
+
+					case saveFailureSaveAs:
+						failed[f] = fmt.Errorf("the changes to %q weren't saved there; they were encrypted to %q", encPath, path)
+
+					case saveFailureWrite:
+						failed[f] = fmt.Errorf("the changes to %q weren't saved; the plaintext is in %q", encPath, path)
+
+					default:
+						failed[f] = fmt.Errorf("the changes to %q weren't saved", encPath)
+					}
+				}
+			}
+
+			if reopen {
+				break
+			}
+		}
+
+		if reopen && !idled.Load() {
+			continue
+		}
+
+		if !cfg.stay || idled.Load() || len(failed) > 0 || !promptReopen(stdin, os.Stderr, cfg.encPath) {
+			break
+		}
+	}
+
+	errs := []error{}
+
+	for _, f := range files {
+		if err := failed[f]; err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if cfg.readOnly || f.declined || f.refused != nil {
+			if f.declined {
+				fmt.Fprintf(os.Stderr, "Changes to %q weren't saved\n", f.cfg.encPath)
+			}
+
+			mu.Lock()
+			f.stash(recipients)
+			mu.Unlock()
+		}
+
+		// The changes are safe in the conflict file, so there is no temporary file to keep.
+		if f.conflict != nil {
+			errs = append(errs, f.conflict)
+		}
+
+		if f.refused != nil {
+			errs = append(errs, f.refused)
+		}
+	}
+
+	if len(errs) == 1 {
+		return tempDir, errs[0]
+	}
+
+	return tempDir, errors.Join(errs...)
+}
+
+// parseBool converts a string to a boolean.
+// It accepts "1", "true", "yes" as true
+// and "0", "false", "no" as false.
+// An empty string returns the fallback value.
+func parseBool(s string, fallback bool) (bool, error) {
+	if s == "" {
+		return fallback, nil
+	}
+
+	switch strings.ToLower(s) {
+	case "1", "true", "yes":
+		return true, nil
+
+	case "0", "false", "no":
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("invalid boolean value: %q", s)
+	}
+}
+
+// defaultArg retrieves an environment variable.
+// It returns the value and a help string indicating this value is the default.
+func defaultArg(envVar string) (string, string) {
+	value := os.Getenv(envVar)
+
+	helpDefault := ""
+	if value != "" {
+		helpDefault = fmt.Sprintf(", default %q", value)
+	}
+
+	return value, helpDefault
+}
+
+// defaultBool retrieves a boolean environment variable, using parseBool to convert it.
+// If the variable is not set, the fallback value is returned.
+func defaultBool(envVar string, fallback bool) (bool, error) {
+	val := os.Getenv(envVar)
+
+	b, err := parseBool(val, fallback)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean value for %s: %q", envVar, val)
+	}
+
+	return b, nil
+}
+
+func defaultAllowEmpty() (bool, error) {
+	return defaultBool(allowEmptyEnvVar, false)
+}
+
+func defaultAllowShrink() (bool, error) {
+	return defaultBool(allowShrinkEnvVar, false)
+}
+
+func defaultAlsoSave() []string {
+	return filepath.SplitList(os.Getenv(alsoSaveEnvVar))
+}
+
+func defaultArmor() (bool, error) {
+	return defaultBool(armorEnvVar, false)
+}
+
+func defaultAutoFilter() (bool, error) {
+	return defaultBool(autoFilterEnvVar, true)
+}
+
+func defaultAutosave() (int, error) {
+	val := os.Getenv(autosaveEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid autosave interval for %s: %q", autosaveEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultBackups() (int, error) {
+	val := os.Getenv(backupsEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid number of backups for %s: %q", backupsEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultCompressionLevel() (int, error) {
+	val := os.Getenv(compressionLevelEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid compression level for %s: %q", compressionLevelEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultCompressionThreads() (int, error) {
+	val := os.Getenv(compressionThreadsEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid number of compression threads for %s: %q", compressionThreadsEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultCompressionWindow() (int, error) {
+	val := os.Getenv(compressionWindowEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid compression window for %s: %q", compressionWindowEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultChdir() (bool, error) {
+	return defaultBool(chdirEnvVar, false)
+}
+
+func defaultCommand() string {
+	return os.Getenv(commandEnvVar)
+}
+
+func defaultConfirmSave() (bool, error) {
+	return defaultBool(confirmSaveEnvVar, false)
+}
+
+func defaultDecode() string {
+	return os.Getenv(decodeEnvVar)
+}
+
+func defaultEncode() string {
+	return os.Getenv(encodeEnvVar)
+}
+
+func defaultDecodeShell() string {
+	return os.Getenv(decodeShellEnvVar)
+}
+
+func defaultEncodeShell() string {
+	return os.Getenv(encodeShellEnvVar)
+}
+
+func defaultEditor() string {
+	for _, envVar := range editorEnvVars {
+		// Skip age-edit when it is set as $EDITOR to wrap the real editor.
+		value := os.Getenv(envVar)
+		if value != "" && !refersToAgeEdit(value) {
+			return value
+		}
+	}
+
+	return "vi"
+}
+
+func defaultForce() (bool, error) {
+	return defaultBool(forceEnvVar, false)
+}
+
+func defaultFsync() (bool, error) {
+	return defaultBool(fsyncEnvVar, true)
+}
+
+func defaultGitCommit() (bool, error) {
+	return defaultBool(gitCommitEnvVar, false)
+}
+
+func defaultGitMessage() string {
+	if message := os.Getenv(gitMessageEnvVar); message != "" {
+		return message
+	}
+
+	return defaultGitMessageTemplate
+}
+
+func defaultHistory() (int, error) {
+	val := os.Getenv(historyEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid history size for %s: %q", historyEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultHistoryMaxAgeValue() (time.Duration, error) {
+	val := os.Getenv(historyMaxAgeEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration value for %s: %q", historyMaxAgeEnvVar, val)
+	}
+
+	return d, nil
+}
+
+func defaultHistoryStore() string {
+	store := os.Getenv(historyStoreEnvVar)
+	if store == "" {
+		store = historyStoreFile
+	}
+
+	return store
+}
+
+func defaultFilterDir() string {
+	return os.Getenv(filterDirEnvVar)
+}
+
+func defaultFilterEnv() []string {
+	val := os.Getenv(filterEnvEnvVar)
+	if val == "" {
+		return []string{}
+	}
+
+	return strings.Split(val, ",")
+}
+
+func defaultFilterTimeoutValue() (time.Duration, error) {
+	val := os.Getenv(filterTimeoutEnvVar)
+	if val == "" {
+		return defaultFilterTimeout, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration value for %s: %q", filterTimeoutEnvVar, val)
+	}
+
+	return d, nil
+}
+
+func defaultHooks() []string {
+	hooks := []string{}
+
+	for _, entry := range strings.Split(os.Getenv(hooksEnvVar), ";") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			hooks = append(hooks, entry)
+		}
+	}
+
+	return hooks
+}
+
+func defaultIdleTimeoutValue() (time.Duration, error) {
+	val := os.Getenv(idleTimeoutEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration value for %s: %q", idleTimeoutEnvVar, val)
+	}
+
+	return d, nil
+}
+
+func defaultInhibitSleep() (bool, error) {
+	return defaultBool(inhibitSleepEnvVar, false)
+}
+
+func defaultLock() (bool, error) {
+	return defaultBool(lockEnvVar, true)
+}
+
+func defaultLockExpiryValue() (time.Duration, error) {
+	val := os.Getenv(lockExpiryEnvVar)
+	if val == "" {
+		return defaultLockExpiry, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration value for %s: %q", lockExpiryEnvVar, val)
+	}
+
+	return d, nil
+}
+
+func defaultLockStrategy() string {
+	strategy := os.Getenv(lockStrategyEnvVar)
+	if strategy == "" {
+		strategy = lockStrategyFlock
+	}
+
+	return strategy
+}
+
+func defaultMaxShrink() (int, error) {
+	val := os.Getenv(maxShrinkEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil || i < 0 || i > 100 { //nolint:mnd
+		return 0, fmt.Errorf("invalid percentage for %s: %q", maxShrinkEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultMemlock() (bool, error) {
+	return defaultBool(memlockEnvVar, true)
+}
+
+func defaultMinSize() (int64, error) {
+	val := os.Getenv(minSizeEnvVar)
+	if val == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid size for %s: %q", minSizeEnvVar, val)
+	}
+
+	return i, nil
+}
+
+func defaultPager() string {
+	for _, envVar := range pagerEnvVars {
+		value := os.Getenv(envVar)
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func defaultNotify() (bool, error) {
+	return defaultBool(notifyEnvVar, false)
+}
+
+func defaultOpenBinary() (bool, error) {
+	return defaultBool(openBinaryEnvVar, false)
+}
+
+func defaultPark() (bool, error) {
+	return defaultBool(parkEnvVar, false)
+}
+
+func defaultPlainName() string {
+	return os.Getenv(plainNameEnvVar)
+}
+
+func defaultPrefer() []string {
+	val := os.Getenv(preferEnvVar)
+	if val == "" {
+		return []string{}
+	}
+
+	return strings.Split(val, ",")
+}
+
+func defaultPreserveMtime() (bool, error) {
+	return defaultBool(preserveMtimeEnvVar, false)
+}
+
+func defaultReadOnly() (bool, error) {
+	return defaultBool(readOnlyEnvVar, false)
+}
+
+func defaultRevertSignal() string {
+	if val := os.Getenv(revertSignalEnvVar); val != "" {
+		return val
+	}
+
+	return "USR2"
+}
+
+func defaultSaveSignals() []string {
+	val := os.Getenv(saveSignalsEnvVar)
+	if val == "" {
+		return []string{"USR1"}
+	}
+
+	return strings.Split(val, ",")
+}
+
+func defaultStay() (bool, error) {
+	return defaultBool(stayEnvVar, false)
+}
+
+func defaultSupervisor() (bool, error) {
+	return defaultBool(supervisorEnvVar, true)
+}
+
+func defaultTempDirPrefix() string {
+	prefix := os.Getenv(tempDirPrefixEnvVar)
+	if prefix == "" {
 		prefix = defaultTempDirPrefixLinux
 	}
 
 	return prefix
 }
 
+func defaultTemplate() string {
+	return os.Getenv(templateEnvVar)
+}
+
+func defaultTemplateText() string {
+	return os.Getenv(templateTextEnvVar)
+}
+
+func defaultTTY() (bool, error) {
+	return defaultBool(ttyEnvVar, true)
+}
+
+func defaultValidate() string {
+	return os.Getenv(validateEnvVar)
+}
+
+func defaultVerbose() (bool, error) {
+	return defaultBool(verboseEnvVar, false)
+}
+
 func defaultWarn() (int, error) {
 	val := os.Getenv(warnEnvVar)
 	if val == "" {
@@ -524,51 +1796,341 @@ func defaultWarn() (int, error) {
 		return 0, fmt.Errorf("invalid integer value for %s: %q", warnEnvVar, val)
 	}
 
-	return i, nil
-}
+	return i, nil
+}
+
+func defaultWarnDroppings() (bool, error) {
+	return defaultBool(warnDroppingsEnvVar, false)
+}
+
+func defaultWait() string {
+	strategy := os.Getenv(waitEnvVar)
+	if strategy == "" {
+		strategy = waitFlags
+	}
+
+	return strategy
+}
+
+func defaultWatch() (bool, error) {
+	return defaultBool(watchEnvVar, false)
+}
+
+func defaultWrap() (bool, error) {
+	return defaultBool(wrapEnvVar, false)
+}
+
+func defaultYes() (bool, error) {
+	return defaultBool(yesEnvVar, false)
+}
+
+func defaultTrash() string {
+	return os.Getenv(trashEnvVar)
+}
+
+func defaultTrashTTLValue() (time.Duration, error) {
+	val := os.Getenv(trashTTLEnvVar)
+	if val == "" {
+		return defaultTrashTTL, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration value for %s: %q", trashTTLEnvVar, val)
+	}
+
+	return d, nil
+}
+
+// cli parses command-line arguments, validates configuration, and invokes the edit function.
+// It returns an appropriate exit code.
+func cli() int {
+	if len(os.Args) == 3 && os.Args[1] == supervisorArg {
+		return supervise(os.Stdin, os.Args[2])
+	}
+
+	if err := applyPluginDir(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	if len(os.Args) > 1 {
+		if sub, ok := commandForArg(os.Args[1]); ok {
+			return sub.run(sub, os.Args[2:])
+		}
+	}
+
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultAllowEmptyVal, err := defaultAllowEmpty()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultAllowShrinkVal, err := defaultAllowShrink()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultArmorVal, err := defaultArmor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultAutoFilterVal, err := defaultAutoFilter()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultAutosaveVal, err := defaultAutosave()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultBackupsVal, err := defaultBackups()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultChdirVal, err := defaultChdir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultCompressionLevelVal, err := defaultCompressionLevel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultCompressionThreadsVal, err := defaultCompressionThreads()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultCompressionWindowVal, err := defaultCompressionWindow()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultForceVal, err := defaultForce()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultFilterTimeoutVal, err := defaultFilterTimeoutValue()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultConfirmSaveVal, err := defaultConfirmSave()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultFsyncVal, err := defaultFsync()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultGitCommitVal, err := defaultGitCommit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultHistoryVal, err := defaultHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultHistoryMaxAgeVal, err := defaultHistoryMaxAgeValue()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultIdleTimeoutVal, err := defaultIdleTimeoutValue()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultInhibitSleepVal, err := defaultInhibitSleep()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultLockExpiryVal, err := defaultLockExpiryValue()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMaxShrinkVal, err := defaultMaxShrink()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMinSizeVal, err := defaultMinSize()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultNotifyVal, err := defaultNotify()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultOpenBinaryVal, err := defaultOpenBinary()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultParkVal, err := defaultPark()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultPreserveMtimeVal, err := defaultPreserveMtime()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultReadOnlyVal, err := defaultReadOnly()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultStayVal, err := defaultStay()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultSupervisorVal, err := defaultSupervisor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultTTYVal, err := defaultTTY()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultVerboseVal, err := defaultVerbose()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 
-// cli parses command-line arguments, validates configuration, and invokes the edit function.
-// It returns an appropriate exit code.
-func cli() int {
-	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
-	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+		return exitBadUsage
+	}
 
-	defaultArmorVal, err := defaultArmor()
+	defaultWarnVal, err := defaultWarn()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		return exitBadUsage
 	}
 
-	defaultForceVal, err := defaultForce()
+	defaultWarnDroppingsVal, err := defaultWarnDroppings()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		return exitBadUsage
 	}
 
-	defaultLockVal, err := defaultLock()
+	defaultWatchVal, err := defaultWatch()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		return exitBadUsage
 	}
 
-	defaultMemlockVal, err := defaultMemlock()
+	defaultWrapVal, err := defaultWrap()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		return exitBadUsage
 	}
 
-	defaultReadOnlyVal, err := defaultReadOnly()
+	defaultYesVal, err := defaultYes()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		return exitBadUsage
 	}
 
-	defaultWarnVal, err := defaultWarn()
+	defaultTrashTTLVal, err := defaultTrashTTLValue()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
@@ -577,23 +2139,89 @@ func cli() int {
 
 	flag := pflag.NewFlagSet("age-edit", pflag.ContinueOnError)
 
+	allowEmpty := flag.Bool(
+		"allow-empty",
+		defaultAllowEmptyVal,
+		fmt.Sprintf("save an empty file over an encrypted file with content (%v)", allowEmptyEnvVar),
+	)
+	allowShrink := flag.Bool(
+		"allow-shrink",
+		defaultAllowShrinkVal,
+		fmt.Sprintf("save with a warning when the file shrinks past --max-shrink or --min-size (%v)", allowShrinkEnvVar),
+	)
+	alsoSave := flag.StringArray(
+		"also-save",
+		defaultAlsoSave(),
+		fmt.Sprintf("also write the encrypted file to a path or into a directory on every save; repeat for more (%v)", alsoSaveEnvVar),
+	)
 	armored := flag.BoolP(
 		"armor",
 		"a",
 		defaultArmorVal,
-		fmt.Sprintf("write an armored age file (%v)", armorEnvVar),
+		fmt.Sprintf("write an armored age file instead of keeping the format (%v for new files)", armorEnvVar),
+	)
+	autosaveInterval := flag.Int(
+		"autosave",
+		defaultAutosaveVal,
+		fmt.Sprintf("save changes every number of seconds while the editor is open (0 to disable, %v)", autosaveEnvVar),
+	)
+	backups := flag.Int(
+		"backups",
+		defaultBackupsVal,
+		fmt.Sprintf("keep a number of backups of the encrypted file next to it (0 to disable, %v)", backupsEnvVar),
+	)
+	binary := flag.BoolP(
+		"binary",
+		"b",
+		false,
+		"write a binary age file instead of keeping the format",
+	)
+	chdir := flag.Bool(
+		"chdir",
+		defaultChdirVal,
+		fmt.Sprintf("run the editor in the temporary directory (%v)", chdirEnvVar),
 	)
 	command := flag.StringP(
 		"command",
 		"c",
 		defaultCommand(),
-		fmt.Sprintf("editor command (overrides the editor executable, %v)", commandEnvVar),
+		fmt.Sprintf("editor command; \"{}\" is replaced with the file (overrides the editor executable, %v)", commandEnvVar),
+	)
+	compressionLevel := flag.Int(
+		"compression-level",
+		defaultCompressionLevelVal,
+		fmt.Sprintf("level of the built-in compressors, like 1 for speed and 9 for size (0 for the default, %v)", compressionLevelEnvVar),
+	)
+	compressionThreads := flag.Int(
+		"compression-threads",
+		defaultCompressionThreadsVal,
+		fmt.Sprintf("threads of builtin:xz and builtin:zstd (0 for one, %v)", compressionThreadsEnvVar),
+	)
+	compressionWindow := flag.Int(
+		"compression-window",
+		defaultCompressionWindowVal,
+		fmt.Sprintf("window of builtin:xz and builtin:zstd as a power of 2, like 27 for 128 MiB (0 for the default of the level, %v)", compressionWindowEnvVar),
+	)
+	confirmSave := flag.Bool(
+		"confirm-save",
+		defaultConfirmSaveVal,
+		fmt.Sprintf("show the changes and ask before saving them after the editor exits (%v)", confirmSaveEnvVar),
 	)
 	decode := flag.String(
 		"decode",
 		defaultDecode(),
 		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
 	)
+	decodeShell := flag.String(
+		"decode-shell",
+		defaultDecodeShell(),
+		fmt.Sprintf("shell command line after decryption, which can use pipes and redirection, instead of --decode (%v)", decodeShellEnvVar),
+	)
+	diff := flag.String(
+		"diff",
+		defaultDiff(),
+		fmt.Sprintf("diff command for --confirm-save (%v)", diffEnvVar),
+	)
 	editor := flag.StringP(
 		"editor",
 		"e",
@@ -605,12 +2233,118 @@ func cli() int {
 		defaultEncode(),
 		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
 	)
+	encodeShell := flag.String(
+		"encode-shell",
+		defaultEncodeShell(),
+		fmt.Sprintf("shell command line before encryption, which can use pipes and redirection, instead of --encode (%v)", encodeShellEnvVar),
+	)
+	filterDir := flag.String(
+		"filter-dir",
+		defaultFilterDir(),
+		fmt.Sprintf("working directory of the decode and encode filters (%v)", filterDirEnvVar),
+	)
+	filterEnv := flag.StringSlice(
+		"filter-env",
+		defaultFilterEnv(),
+		fmt.Sprintf("NAME=VALUE variables for the filters and NAME to pass a variable through, like ZSTD_* (%v)", filterEnvEnvVar),
+	)
+	filterTimeout := flag.Duration(
+		"filter-timeout",
+		defaultFilterTimeoutVal,
+		fmt.Sprintf("kill a decode or encode filter that runs longer than this (0 to disable, %v)", filterTimeoutEnvVar),
+	)
 	force := flag.BoolP(
 		"force",
 		"f",
 		defaultForceVal,
 		fmt.Sprintf("force re-encryption even if the file hasn't changed (%v)", forceEnvVar),
 	)
+	gc := flag.Bool(
+		"gc",
+		false,
+		"remove the temporary directories of crashed sessions, including their plaintext, and exit",
+	)
+	gitCommit := flag.Bool(
+		"git-commit",
+		defaultGitCommitVal,
+		fmt.Sprintf("commit the encrypted file to its Git repository after every save (%v)", gitCommitEnvVar),
+	)
+	gitMessage := flag.String(
+		"git-message",
+		defaultGitMessage(),
+		fmt.Sprintf("commit message for --git-commit; \"{file}\" and \"{time}\" are replaced (%v)", gitMessageEnvVar),
+	)
+	history := flag.Int(
+		"history",
+		defaultHistoryVal,
+		fmt.Sprintf("keep a number of previous encrypted versions of the file next to it (0 to disable, %v)", historyEnvVar),
+	)
+	historyMaxAge := flag.Duration(
+		"history-max-age",
+		defaultHistoryMaxAgeVal,
+		fmt.Sprintf("remove previous versions replaced longer ago than this (0 to keep them, %v)", historyMaxAgeEnvVar),
+	)
+	historyStore := flag.String(
+		"history-store",
+		defaultHistoryStore(),
+		fmt.Sprintf("where to keep previous versions: %q next to the file or %q in the user state directory (%v)", historyStoreFile, historyStoreState, historyStoreEnvVar),
+	)
+	hooks := flag.StringArray(
+		"hook",
+		defaultHooks(),
+		fmt.Sprintf("run a command on an event, like post-encrypt=COMMAND; repeat for more hooks (%v)", hooksEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		"",
+		"identities file path; all arguments are then encrypted files",
+	)
+	idleTimeout := flag.Duration(
+		"idle-timeout",
+		defaultIdleTimeoutVal,
+		fmt.Sprintf("save, close the editor, and remove the plaintext after this long without activity (0 to disable, %v)", idleTimeoutEnvVar),
+	)
+	inhibitSleep := flag.Bool(
+		"inhibit-sleep",
+		defaultInhibitSleepVal,
+		fmt.Sprintf("keep the computer from sleeping while the plaintext is on disk (%v)", inhibitSleepEnvVar),
+	)
+	keepTemp := flag.Bool(
+		"keep-temp",
+		false,
+		"keep the temporary directory with the plaintext after exit to debug filters and editors (insecure)",
+	)
+	lockExpiry := flag.Duration(
+		"lock-expiry",
+		defaultLockExpiryVal,
+		fmt.Sprintf("time after which a dotlock of a crashed session can be broken (0 for never, %v)", lockExpiryEnvVar),
+	)
+	lockStrategy := flag.String(
+		"lock-strategy",
+		defaultLockStrategy(),
+		fmt.Sprintf("how to lock the encrypted file: %q or %q for network filesystems (%v)", lockStrategyFlock, lockStrategyDotlock, lockStrategyEnvVar),
+	)
+	maxShrink := flag.Int(
+		"max-shrink",
+		defaultMaxShrinkVal,
+		fmt.Sprintf("refuse to save when the plaintext shrinks by more than this percentage (0 to disable, %v)", maxShrinkEnvVar),
+	)
+	minSize := flag.Int64(
+		"min-size",
+		defaultMinSizeVal,
+		fmt.Sprintf("refuse to save when the plaintext shrinks below this number of bytes (0 to disable, %v)", minSizeEnvVar),
+	)
+	noAutoFilter := flag.Bool(
+		"no-auto-filter",
+		!defaultAutoFilterVal,
+		fmt.Sprintf("do not decompress gzip, xz, and Zstandard plaintext and open tar archives as directories by their content (negated %v)", autoFilterEnvVar),
+	)
+	noFsync := flag.Bool(
+		"no-fsync",
+		!defaultFsyncVal,
+		fmt.Sprintf("do not flush the saved file and its directory to disk (negated %v)", fsyncEnvVar),
+	)
 	noLock := flag.BoolP(
 		"no-lock",
 		"L",
@@ -623,50 +2357,188 @@ func cli() int {
 		!defaultMemlockVal,
 		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
 	)
+	noSupervisor := flag.Bool(
+		"no-supervisor",
+		!defaultSupervisorVal,
+		fmt.Sprintf("do not start a process that removes the plaintext if age-edit is killed (negated %v)", supervisorEnvVar),
+	)
+	noTTY := flag.Bool(
+		"no-tty",
+		!defaultTTYVal,
+		fmt.Sprintf("do not give the editor a terminal when standard input or output isn't one (negated %v)", ttyEnvVar),
+	)
+	notify := flag.Bool(
+		"notify",
+		defaultNotifyVal,
+		fmt.Sprintf("show a desktop notification when saving in the background saves or fails (%v)", notifyEnvVar),
+	)
+	openBinary := flag.Bool(
+		"open-binary",
+		defaultOpenBinaryVal,
+		fmt.Sprintf("open a binary file in the default application of the desktop instead of the editor (%v)", openBinaryEnvVar),
+	)
+	park := flag.Bool(
+		"park",
+		defaultParkVal,
+		fmt.Sprintf("save and take the plaintext off the disk while age-edit is suspended (%v)", parkEnvVar),
+	)
+	plainName := flag.String(
+		"plain-name",
+		defaultPlainName(),
+		fmt.Sprintf("file name of the decrypted temporary file instead of the name of the encrypted file (%v)", plainNameEnvVar),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	preserveMtime := flag.Bool(
+		"preserve-mtime",
+		defaultPreserveMtimeVal,
+		fmt.Sprintf("give the encrypted file the modification time of the plaintext (%v)", preserveMtimeEnvVar),
+	)
+	printConfig := flag.Bool(
+		"print-config",
+		false,
+		"print the resolved configuration with the source of each value and exit",
+	)
 	readOnly := flag.BoolP(
 		"read-only",
 		"r",
 		defaultReadOnlyVal,
 		fmt.Sprintf("make the temporary file read-only and discard all changes (%v)", readOnlyEnvVar),
 	)
+	revertSignal := flag.String(
+		"revert-signal",
+		defaultRevertSignal(),
+		fmt.Sprintf("signal that replaces the plaintext with the encrypted file on disk, or \"none\" (%v)", revertSignalEnvVar),
+	)
+	saveSignals := flag.StringSlice(
+		"save-signals",
+		defaultSaveSignals(),
+		fmt.Sprintf("signals that save the changes without closing the editor, or \"none\" (%v)", saveSignalsEnvVar),
+	)
 	showVersion := flag.BoolP(
 		"version",
 		"V",
 		false,
 		"report the program version and exit",
 	)
+	stay := flag.Bool(
+		"stay",
+		defaultStayVal,
+		fmt.Sprintf("keep the session open after the editor exits to edit again without decrypting (%v)", stayEnvVar),
+	)
 	tempDirPrefix := flag.StringP(
 		"temp-dir",
 		"t",
 		defaultTempDirPrefix(),
 		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
 	)
+	template := flag.String(
+		"template",
+		defaultTemplate(),
+		fmt.Sprintf("plaintext file to start a new file from (%v)", templateEnvVar),
+	)
+	templateText := flag.String(
+		"template-text",
+		defaultTemplateText(),
+		fmt.Sprintf("text to start a new file from with ${VAR} expanded from the environment (%v)", templateTextEnvVar),
+	)
+	trash := flag.String(
+		"trash",
+		defaultTrash(),
+		fmt.Sprintf("directory to keep encrypted copies of discarded changes in (%v)", trashEnvVar),
+	)
+	trashTTL := flag.Duration(
+		"trash-ttl",
+		defaultTrashTTLVal,
+		fmt.Sprintf("how long to keep discarded changes in the trash (0 to keep forever, %v)", trashTTLEnvVar),
+	)
+	validate := flag.String(
+		"validate",
+		defaultValidate(),
+		fmt.Sprintf("command that checks the plaintext before saving and opens the editor again if it fails (%v)", validateEnvVar),
+	)
+	verbose := flag.BoolP(
+		"verbose",
+		"v",
+		defaultVerboseVal,
+		fmt.Sprintf("report which identity decrypted the file and how memory is protected (%v)", verboseEnvVar),
+	)
+	wait := flag.String(
+		"wait",
+		defaultWait(),
+		fmt.Sprintf("how to wait for GUI editors that return at once: %q to add the wait flag of known editors, %q to wait for <Enter>, %q to wait until the file is closed, or %q (%v)", waitFlags, waitEnter, waitOpen, waitNone, waitEnvVar),
+	)
 	warn := flag.IntP(
 		"warn",
 		"w",
 		defaultWarnVal,
 		fmt.Sprintf("warn if the editor exits after less than a number of seconds (0 to disable, %v)", warnEnvVar),
 	)
+	warnDroppings := flag.Bool(
+		"warn-droppings",
+		defaultWarnDroppingsVal,
+		fmt.Sprintf("warn about the swap, backup, and undo files the editor leaves in the temporary directory (%v)", warnDroppingsEnvVar),
+	)
+	watch := flag.Bool(
+		"watch",
+		defaultWatchVal,
+		fmt.Sprintf("save the encrypted file whenever the editor saves the temporary file (%v)", watchEnvVar),
+	)
+	wrap := flag.Bool(
+		"wrap",
+		defaultWrapVal,
+		fmt.Sprintf("act as $EDITOR for other programs: open files without the .age suffix in the editor directly (%v)", wrapEnvVar),
+	)
+	yes := flag.BoolP(
+		"yes",
+		"y",
+		defaultYesVal,
+		fmt.Sprintf("create a missing encrypted file without asking (%v)", yesEnvVar),
+	)
+
+	// External commands get the defaults of the options as their configuration.
+	if len(os.Args) > 1 {
+		if path, ok := findExternal(os.Args[1]); ok {
+			return runExternal(path, os.Args[2:], flag)
+		}
+	}
 
 	flag.Usage = func() {
 		message := fmt.Sprintf(
-			`Usage: %s [options] [[identities] encrypted]
+			`Usage: %s [options] [[identities] encrypted...]
+       %s command [options] [args]
 
 Arguments:
   identities              identities file path (%s%s)
   encrypted               encrypted file path (%s%s)
 
+Commands:
+%s
 Options:
 %s
-An identities file and an encrypted file, given in the arguments or the environment variables, are required. Default values are read from environment variables with a built-in fallback. Boolean environment variables accept 0, 1, true, false, yes, no.
+Run "%s command --help" to see the help for a command. Other commands run an executable "%scommand" from PATH with the arguments and the effective configuration in the environment variables. A file with the name of a command is edited instead.
+
+An identities file and an encrypted file, given in the arguments or the environment variables, are required. With two or more arguments, the first is the identities file unless --identities is given. Several encrypted files open in one editor session. The identities file can be omitted when an agent is running. Default values are read from environment variables with a built-in fallback. Boolean environment variables accept 0, 1, true, false, yes, no. %s sets a directory searched first for age plugins and refuses plugins outside it; %s limits plugins to a comma-separated list of names. %s lists the suffixes of encrypted files (default "%s"), separated by commas; "suffix=extension" names the temporary file with the extension instead of the suffix. %s picks the editor by the name of the temporary file with rules like "*.json=code --wait;*.md=nvim", which the editor options override.
 `,
+			filepath.Base(os.Args[0]),
 			filepath.Base(os.Args[0]),
 			identitiesFileEnvVar,
 			identitiesFileHelpDefault,
 			encryptedFileEnvVar,
 			encryptedFileHelpDefault,
+			subcommandUsages(),
 			// Merge "(default ...)" with our own parentheticals.
 			strings.ReplaceAll(flag.FlagUsages(), ") (", ", "),
+			filepath.Base(os.Args[0]),
+			externalPrefix,
+			pluginDirEnvVar,
+			pluginsEnvVar,
+			suffixesEnvVar,
+			defaultSuffix,
+			editorsEnvVar,
 		)
 
 		fmt.Fprint(os.Stderr, message)
@@ -687,11 +2559,142 @@ An identities file and an encrypted file, given in the arguments or the environm
 		return exitOK
 	}
 
-	if flag.NArg() > cliMaxArgs {
-		fmt.Fprintln(
-			os.Stderr,
-			"Error: too many arguments",
-		)
+	if *gc {
+		if _, err := sweepStaleDirs(os.Stdout, *tempDirPrefix, true, []string{}); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		return exitOK
+	}
+
+	if *wrap && wrapPassthrough(flag.Args()) {
+		return runWrappedEditor(*command, *editor, flag.Args())
+	}
+
+	if *armored && *binary {
+		fmt.Fprintln(os.Stderr, "Error: --armor and --binary are mutually exclusive")
+
+		return exitBadUsage
+	}
+
+	if *autosaveInterval < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --autosave must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *filterTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --filter-timeout must not be negative")
+
+		return exitBadUsage
+	}
+
+	setFilterTimeout(*filterTimeout)
+
+	if err := checkCompressionOptions(compressionOptions{
+		level:   *compressionLevel,
+		threads: *compressionThreads,
+		window:  *compressionWindow,
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	if err := checkFilterEnv(*filterEnv); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	if err := checkFilterDir(*filterDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	setFilterProcess(*filterEnv, *filterDir)
+
+	if *confirmSave && (*autosaveInterval > 0 || *watch) {
+		fmt.Fprintln(os.Stderr, "Error: --confirm-save can't be used with --autosave or --watch, which save without asking")
+
+		return exitBadUsage
+	}
+
+	if *maxShrink < 0 || *maxShrink > 100 { //nolint:mnd
+		fmt.Fprintln(os.Stderr, "Error: --max-shrink must be a percentage from 0 to 100")
+
+		return exitBadUsage
+	}
+
+	if *idleTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --idle-timeout must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *minSize < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --min-size must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *backups < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --backups must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *history < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --history must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *historyStore != historyStoreFile && *historyStore != historyStoreState {
+		fmt.Fprintf(os.Stderr, "Error: unknown history store %q\n", *historyStore)
+
+		return exitBadUsage
+	}
+
+	if *lockStrategy != lockStrategyFlock && *lockStrategy != lockStrategyDotlock {
+		fmt.Fprintf(os.Stderr, "Error: unknown lock strategy %q\n", *lockStrategy)
+
+		return exitBadUsage
+	}
+
+	if !slices.Contains([]string{waitFlags, waitEnter, waitOpen, waitNone}, *wait) {
+		fmt.Fprintf(os.Stderr, "Error: unknown wait strategy %q\n", *wait)
+
+		return exitBadUsage
+	}
+
+	if err := checkPlainName(*plainName); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	initial, err := loadTemplate(*template, *templateText)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	// "none" turns signals off.
+	if len(*saveSignals) == 1 && strings.EqualFold((*saveSignals)[0], "none") {
+		*saveSignals = []string{}
+	}
+
+	if strings.EqualFold(*revertSignal, "none") {
+		*revertSignal = ""
+	}
+
+	if err := checkSignals(*saveSignals, *revertSignal); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		return exitBadUsage
 	}
@@ -699,12 +2702,56 @@ An identities file and an encrypted file, given in the arguments or the environm
 	cfg := config{
 		idsPath:       identitiesFileDefault,
 		encPath:       encryptedFileDefault,
+		otherPaths:    []string{},
 		tempDirPrefix: *tempDirPrefix,
-
-		armor:    *armored,
-		force:    *force,
-		lock:     !*noLock,
-		readOnly: *readOnly,
+		trashDir:      *trash,
+		trashTTL:      *trashTTL,
+		lockStrategy:  *lockStrategy,
+		lockExpiry:    *lockExpiry,
+		autosave:      time.Duration(*autosaveInterval) * time.Second,
+		idleTimeout:   *idleTimeout,
+		history:       *history,
+		historyMaxAge: *historyMaxAge,
+		historyStore:  *historyStore,
+		backups:       *backups,
+		maxShrink:     *maxShrink,
+		minSize:       *minSize,
+		template:      initial,
+		gitMessage:    *gitMessage,
+		plainName:     *plainName,
+		wait:          *wait,
+
+		allowEmpty:    *allowEmpty,
+		allowShrink:   *allowShrink,
+		armor:         *armored,
+		autoFilter:    !*noAutoFilter,
+		chdir:         *chdir,
+		confirmSave:   *confirmSave,
+		force:         *force,
+		fsync:         !*noFsync,
+		gitCommit:     *gitCommit,
+		inhibitSleep:  *inhibitSleep,
+		keepFormat:    !flag.Changed("armor") && !flag.Changed("binary"),
+		keepTemp:      *keepTemp,
+		lock:          !*noLock,
+		notify:        *notify,
+		openBinary:    *openBinary,
+		park:          *park,
+		preserveMtime: *preserveMtime,
+		readOnly:      *readOnly,
+		stay:          *stay,
+		supervise:     !*noSupervisor,
+		tty:           !*noTTY,
+		verbose:       *verbose,
+		warnDroppings: *warnDroppings,
+		watch:         *watch,
+		yes:           *yes,
+
+		alsoSave: *alsoSave,
+		prefer:   *prefer,
+
+		saveSignals:  *saveSignals,
+		revertSignal: *revertSignal,
 
 		command: *editor,
 		args:    []string{},
@@ -713,17 +2760,52 @@ An identities file and an encrypted file, given in the arguments or the environm
 		decodeArgs: []string{},
 		encodeCmd:  "",
 		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{
+			level:   *compressionLevel,
+			threads: *compressionThreads,
+			window:  *compressionWindow,
+		},
+
+		hooks: hookSet{},
+	}
+
+	encPaths := flag.Args()
+
+	if flag.Changed("identities") {
+		cfg.idsPath = *idsPath
+	} else if len(encPaths) >= 2 { //nolint:mnd
+		cfg.idsPath = encPaths[0]
+		encPaths = encPaths[1:]
+	}
+
+	if len(encPaths) > 0 {
+		cfg.encPath = encPaths[0]
+		cfg.otherPaths = encPaths[1:]
+	}
+
+	if cfg.plainName != "" && len(cfg.otherPaths) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --plain-name works with one encrypted file")
+
+		return exitBadUsage
 	}
 
-	//nolint:mnd
-	if flag.NArg() == 1 {
-		cfg.encPath = flag.Arg(0)
-	} else if flag.NArg() == 2 {
-		cfg.idsPath = flag.Arg(0)
-		cfg.encPath = flag.Arg(1)
+	if *printConfig {
+		if err := writeConfig(os.Stdout, flag, cfg.idsPath, cfg.encPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		return exitOK
 	}
 
-	if cfg.encPath == "" || cfg.idsPath == "" {
+	if cfg.encPath == "" || (cfg.idsPath == "" && !agentAvailable()) {
 		fmt.Fprintln(
 			os.Stderr,
 			"Error: need an identities file and an encrypted file",
@@ -732,15 +2814,52 @@ An identities file and an encrypted file, given in the arguments or the environm
 		return exitBadUsage
 	}
 
+	paths := append([]string{cfg.encPath}, cfg.otherPaths...)
+
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			paths[i], err = pickFile(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+
+				return exitError
+			}
+		}
+	}
+
+	cfg.encPath = paths[0]
+	cfg.otherPaths = paths[1:]
+
 	if !*noMemlock {
 		if err := lockMemory(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v. You may need to increase the limit on locked memory. Pass --no-memlock to suppress this error.\n", err)
+			fmt.Fprintf(
+				os.Stderr,
+				"Warning: %v; only the identities file will be locked in memory. You may need to increase the limit on locked memory. Pass --no-memlock to suppress this warning.\n",
+				err,
+			)
 
-			return exitError
+			cfg.lockKeys = true
 		}
 	}
 
-	if *command != "" {
+	if cfg.verbose {
+		fmt.Fprintln(os.Stderr, "Memory protection:", memoryProtection(!*noMemlock, cfg.lockKeys))
+	}
+
+	// An editor for the kind of file replaces the editor from the environment but not one from the options.
+	ruleCommand, ruleArgs, ruleMatched, err := editorFor(plaintextName(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	switch {
+	case ruleMatched && !flag.Changed("command") && !flag.Changed("editor"):
+		cfg.command = ruleCommand
+		cfg.args = ruleArgs
+
+	case *command != "":
 		args, err := shlex.Split(*command, true)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error: failed to split command")
@@ -751,36 +2870,76 @@ An identities file and an encrypted file, given in the arguments or the environm
 		cfg.args = args[1:]
 	}
 
-	if *decode != "" {
-		args, err := shlex.Split(*decode, true)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
-			os.Exit(exitBadUsage)
+	cfg.decodeCmd, cfg.decodeArgs, err = pickFilter(flag, "decode", "decode-shell", *decode, *decodeShell)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	cfg.encodeCmd, cfg.encodeArgs, err = pickFilter(flag, "encode", "encode-shell", *encode, *encodeShell)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	cfg.encodeArgs = cfg.compression.filterArgs(cfg.encodeCmd, cfg.encodeArgs)
+	if err := checkFilterArgs(cfg.encodeCmd, cfg.encodeArgs); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	if cfg.confirmSave {
+		args, err := shlex.Split(*diff, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split diff command")
+
+			return exitBadUsage
 		}
 
-		cfg.decodeCmd = args[0]
-		cfg.decodeArgs = args[1:]
+		cfg.diffCmd = args[0]
+		cfg.diffArgs = args[1:]
 	}
 
-	if *encode != "" {
-		args, err := shlex.Split(*encode, true)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error: failed to split encode command")
-			os.Exit(exitBadUsage)
+	if *validate != "" {
+		args, err := shlex.Split(*validate, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split validate command")
+
+			return exitBadUsage
 		}
 
-		cfg.encodeCmd = args[0]
-		cfg.encodeArgs = args[1:]
+		cfg.validateCmd = args[0]
+		cfg.validateArgs = args[1:]
+	}
+
+	cfg.hooks, err = parseHooks(*hooks)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	if err := checkDependencies(editDependencies(cfg)...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
 	}
 
 	start := int(time.Now().Unix())
 
 	tempDir, err := edit(cfg)
-	if tempDir != "" {
-		// Remove the "age-edit-..." directory if empty
-		// after removing the temporary file and the random subdirectory.
-		defer os.Remove(filepath.Dir(tempDir))
-		defer os.RemoveAll(tempDir)
+	if tempDir != "" && !cfg.keepTemp {
+		// The hooks run after the temporary directory is gone.
+		defer cfg.hooks.runAfter(hookPostCleanup, sessionEnv(tempDir, cfg.readOnly, []string{}, encPaths))
+	}
+
+	if tempDir != "" && cfg.keepTemp {
+		fmt.Fprintf(os.Stderr, "Kept the temporary directory %q with the plaintext\n", tempDir)
+	} else if tempDir != "" {
+		defer removeTempDir(tempDir)
 	}
 
 	if *warn > 0 && int(time.Now().Unix())-start <= *warn {
@@ -794,6 +2953,11 @@ An identities file and an encrypted file, given in the arguments or the environm
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 
+		var trailingErr *trailingDataError
+		if errors.As(err, &trailingErr) && term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec
+			offerTrailingData(os.Stdin, os.Stderr, trailingErr)
+		}
+
 		var saveErr *saveError
 		if errors.As(err, &saveErr) {
 			fmt.Fprintf(
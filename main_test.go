@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,6 +37,8 @@ func TestCheckAccess(t *testing.T) {
 		{"nonexistent-file", true, false},
 		// File does not exist, not read-only mode.
 		{"nonexistent-file", false, true},
+		// File does not exist in a directory that does not exist.
+		{filepath.Join("nonexistent-dir", "nonexistent-file"), false, false},
 	}
 
 	for _, tt := range tests {
@@ -78,7 +85,7 @@ func TestEncryptAndDecryptToFile(t *testing.T) {
 	recipient := identity.Recipient()
 
 	// Test encryption.
-	err = encryptToFile(inputFile.Name(), encryptedFile.Name(), true, "", []string{}, recipient)
+	err = encryptToFile(inputFile.Name(), encryptedFile.Name(), true, true, "", []string{}, recipient)
 	if err != nil {
 		t.Errorf("encryptToFile() failed: %v", err)
 	}
@@ -96,6 +103,56 @@ func TestEncryptAndDecryptToFile(t *testing.T) {
 	}
 }
 
+func TestWrapDecryptTransportedArmor(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ciphertext bytes.Buffer
+
+	if err := encryptStream(strings.NewReader("secret\n"), &ciphertext, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	armored := ciphertext.String()
+
+	for name, text := range map[string]string{
+		"leading newline": "\n" + armored,
+		"byte order mark": "\ufeff" + armored,
+		"CRLF":            strings.ReplaceAll(armored, "\n", "\r\n"),
+		"indented header": "  \r\n\t" + armored + "\n\n",
+		"everything":      "\ufeff\r\n" + strings.ReplaceAll(armored, "\n", "\r\n"),
+	} {
+		if !hasArmorHeader([]byte(text)) {
+			t.Errorf("%s: expected the armor to be recognized", name)
+		}
+
+		r, err := wrapDecrypt(strings.NewReader(text), identity)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+
+			continue
+		}
+
+		var plaintext bytes.Buffer
+		if _, err := plaintext.ReadFrom(r); err != nil || plaintext.String() != "secret\n" {
+			t.Errorf("%s: expected the plaintext, got %q: %v", name, plaintext.String(), err)
+		}
+
+		header, _, err := readAgeHeader(strings.NewReader(text))
+		if err != nil || !header.armored {
+			t.Errorf("%s: expected an armored header: %v", name, err)
+		}
+	}
+
+	if hasArmorHeader([]byte("text\n" + armored)) {
+		t.Error("expected text before the armor not to be recognized")
+	}
+}
+
 func TestEncryptAndDecryptToFileWithGzip(t *testing.T) {
 	t.Parallel()
 
@@ -142,7 +199,7 @@ func TestEncryptAndDecryptToFileWithGzip(t *testing.T) {
 	recipient := identity.Recipient()
 
 	// Test encryption with gzip compression.
-	err = encryptToFile(inputFile.Name(), encryptedFile.Name(), true, gzipPath, []string{}, recipient)
+	err = encryptToFile(inputFile.Name(), encryptedFile.Name(), true, true, gzipPath, []string{}, recipient)
 	if err != nil {
 		t.Errorf("encryptToFile() failed: %v", err)
 	}
@@ -160,6 +217,148 @@ func TestEncryptAndDecryptToFileWithGzip(t *testing.T) {
 	}
 }
 
+func TestEncryptToFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain")
+	encPath := filepath.Join(dir, "secret.age")
+
+	if err := os.WriteFile(plainPath, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(encPath, []byte("old ciphertext"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing filter must leave the old file intact and no temporary files behind.
+	err = encryptToFile(plainPath, encPath, true, false, "age-edit-test-missing-filter", []string{}, identity.Recipient())
+	if err == nil {
+		t.Fatal("expected an error from the missing filter")
+	}
+
+	data, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "old ciphertext" {
+		t.Errorf("expected the old file to be intact, got %q", data)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Errorf("expected no temporary files, got %d entries", len(entries))
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// A successful save keeps the permissions and writes through a symlink.
+	linkPath := filepath.Join(dir, "link.age")
+	if err := os.Symlink(encPath, linkPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, linkPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(linkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symlink to stay a symlink")
+	}
+
+	info, err = os.Stat(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("expected permissions 0640, got %#o", info.Mode().Perm())
+	}
+
+	if err := decryptToFile(encPath, plainPath, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// shortWriter fails the writes past a number of bytes, like a full disk.
+type shortWriter struct {
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("no space left on device")
+	}
+
+	w.n -= len(p)
+
+	return len(p), nil
+}
+
+func TestEncryptStreamFlushError(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, armored := range []bool{false, true} {
+		var full bytes.Buffer
+
+		if err := encryptStream(strings.NewReader("secret\n"), &full, armored, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Closing the writers writes the last chunk and the armor footer, which don't fit.
+		w := &shortWriter{n: full.Len() - 1}
+		if err := encryptStream(strings.NewReader("secret\n"), w, armored, "", []string{}, identity.Recipient()); err == nil {
+			t.Errorf("armored %v: expected an error when the end of the ciphertext isn't written", armored)
+		}
+	}
+
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain")
+	encPath := filepath.Join(dir, "secret.age")
+
+	if err := os.WriteFile(plainPath, []byte("new"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(encPath, []byte("old ciphertext"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeFileAtomic(encPath, filePerm, false, func(w io.Writer) error {
+		return encryptStream(strings.NewReader("new"), io.MultiWriter(w, &shortWriter{n: 200}), false, "", []string{}, identity.Recipient())
+	})
+	if err == nil {
+		t.Fatal("expected an error from the short write")
+	}
+
+	if data, err := os.ReadFile(encPath); err != nil || string(data) != "old ciphertext" {
+		t.Errorf("expected the old file to be intact, got %q: %v", data, err)
+	}
+}
+
 func TestGetRoot(t *testing.T) {
 	t.Parallel()
 
@@ -182,6 +381,28 @@ func TestGetRoot(t *testing.T) {
 	}
 }
 
+func TestCommandArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args     []string
+		paths    []string
+		expected []string
+	}{
+		{[]string{"--wait"}, []string{"a"}, []string{"--wait", "a"}},
+		{[]string{"--goto", "{}:10", "--wait"}, []string{"a"}, []string{"--goto", "a:10", "--wait"}},
+		{[]string{"-c", "set ft=yaml", "{file}"}, []string{"a"}, []string{"-c", "set ft=yaml", "a"}},
+		{[]string{"-o", "{}"}, []string{"a", "b"}, []string{"-o", "a", "b"}},
+		{[]string{}, []string{"a", "b"}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		if result := commandArgs(tt.args, tt.paths); !slices.Equal(result, tt.expected) {
+			t.Errorf("commandArgs(%q, %q) is %q, expected %q", tt.args, tt.paths, result, tt.expected)
+		}
+	}
+}
+
 func TestLoadIdentities(t *testing.T) {
 	t.Parallel()
 
@@ -207,6 +428,8 @@ func TestLoadIdentities(t *testing.T) {
 		{"# Comment\n \n\n" + validKey + "\n", 1, false},
 		// An indented comment.
 		{"    # Comment\n" + validKey, 1, false},
+		// Windows line endings.
+		{"# Comment\r\n" + validKey + "\r\n" + validKey + "\r\n", 2, false},
 		// An empty file.
 		{"", 0, true},
 	}
@@ -224,7 +447,7 @@ func TestLoadIdentities(t *testing.T) {
 		}
 		tempFile.Close()
 
-		ids, recs, err := loadIdentities(tempFile.Name())
+		ids, recs, err := loadIdentities(tempFile.Name(), false)
 
 		if tt.hasError && err == nil {
 			t.Errorf("loadIdentities(%q) expected error, got none", tt.content)
@@ -278,6 +501,10 @@ func TestEdit(t *testing.T) {
 		lock            bool
 		readOnly        bool
 		force           bool
+		empty           bool
+		allowEmpty      bool
+		armored         bool
+		keepFormat      bool
 		checkFn         func(t *testing.T, tempDir string, encFilePath string, initialModTime time.Time)
 		expectEditError bool
 	}{
@@ -290,6 +517,10 @@ func TestEdit(t *testing.T) {
 				if err != nil {
 					t.Fatalf("could not read temp dir: %v", err)
 				}
+				// The session information sits next to the plaintext.
+				files = slices.DeleteFunc(files, func(entry os.DirEntry) bool {
+					return entry.Name() == sessionInfoName
+				})
 				if len(files) != 1 {
 					t.Fatalf("expected 1 file in temp dir, got %d", len(files))
 				}
@@ -324,6 +555,70 @@ func TestEdit(t *testing.T) {
 			},
 			expectEditError: false,
 		},
+		{
+			name:  "empty plaintext refused",
+			lock:  false,
+			empty: true,
+			checkFn: func(t *testing.T, tempDir string, encFilePath string, initialModTime time.Time) {
+				info, err := os.Stat(encFilePath)
+				if err != nil {
+					t.Fatalf("failed to stat encrypted file: %v", err)
+				}
+				if !info.ModTime().Equal(initialModTime) {
+					t.Error("expected the encrypted file to be unchanged")
+				}
+			},
+			expectEditError: true,
+		},
+		{
+			name:       "empty plaintext allowed",
+			lock:       false,
+			empty:      true,
+			allowEmpty: true,
+			checkFn: func(t *testing.T, tempDir string, encFilePath string, initialModTime time.Time) {
+				info, err := os.Stat(encFilePath)
+				if err != nil {
+					t.Fatalf("failed to stat encrypted file: %v", err)
+				}
+				if info.ModTime().Equal(initialModTime) {
+					t.Error("expected the encrypted file to be saved")
+				}
+			},
+			expectEditError: false,
+		},
+		{
+			name:       "armored format kept",
+			lock:       false,
+			force:      true,
+			armored:    true,
+			keepFormat: true,
+			checkFn: func(t *testing.T, tempDir string, encFilePath string, initialModTime time.Time) {
+				armored, err := isArmored(encFilePath)
+				if err != nil {
+					t.Fatalf("failed to check the format: %v", err)
+				}
+				if !armored {
+					t.Error("expected the encrypted file to stay armored")
+				}
+			},
+			expectEditError: false,
+		},
+		{
+			name:    "armored format changed",
+			lock:    false,
+			force:   true,
+			armored: true,
+			checkFn: func(t *testing.T, tempDir string, encFilePath string, initialModTime time.Time) {
+				armored, err := isArmored(encFilePath)
+				if err != nil {
+					t.Fatalf("failed to check the format: %v", err)
+				}
+				if armored {
+					t.Error("expected the encrypted file to become binary")
+				}
+			},
+			expectEditError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -346,7 +641,7 @@ func TestEdit(t *testing.T) {
 			}
 			defer os.Remove(encFile.Name())
 
-			if err := encryptToFile(plainFile.Name(), encFile.Name(), false, "", []string{}, identity.Recipient()); err != nil {
+			if err := encryptToFile(plainFile.Name(), encFile.Name(), true, tt.armored, "", []string{}, identity.Recipient()); err != nil {
 				t.Fatalf("failed to encrypt file for test: %v", err)
 			}
 
@@ -365,18 +660,23 @@ func TestEdit(t *testing.T) {
 			if tt.readOnly {
 				editArgs = append(editArgs, "--read-only")
 			}
+			if tt.empty {
+				editArgs = append(editArgs, "--empty")
+			}
 
 			tempDir, err := edit(config{
 				idsPath:       idFile.Name(),
 				encPath:       encFile.Name(),
 				tempDirPrefix: tempDirPrefix,
 
-				armor:    false,
-				lock:     tt.lock,
-				readOnly: tt.readOnly,
-				force:    tt.force,
-				command:  testEditorPath,
-				args:     editArgs,
+				allowEmpty: tt.allowEmpty,
+				armor:      false,
+				keepFormat: tt.keepFormat,
+				lock:       tt.lock,
+				readOnly:   tt.readOnly,
+				force:      tt.force,
+				command:    testEditorPath,
+				args:       editArgs,
 			})
 			if (err != nil) != tt.expectEditError {
 				t.Fatalf("edit() error = %v, expectEditError %v", err, tt.expectEditError)
@@ -391,3 +691,58 @@ func TestEdit(t *testing.T) {
 		})
 	}
 }
+
+func TestEditChdir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+
+	editTempDir, err := edit(config{
+		idsPath:       idsPath,
+		encPath:       encPath,
+		tempDirPrefix: t.TempDir(),
+		chdir:         true,
+		yes:           true,
+
+		command: "sh",
+		args:    []string{"-c", `pwd -P >> "$1"`, "sh"},
+	})
+	if editTempDir != "" {
+		defer os.RemoveAll(editTempDir)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := decryptToWriter(encPath, &plaintext, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := filepath.EvalSymlinks(editTempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext.String() != expected+"\n" {
+		t.Errorf("expected the editor to run in %q, got %q", expected, plaintext.String())
+	}
+}
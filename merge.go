@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+const (
+	mergeEnvVar         = "AGE_EDIT_MERGE"
+	defaultMergeCommand = "git merge-file"
+
+	// mergeMaxConflicts is the highest exit status of a merge tool that reports conflicts
+	// rather than an error, like git-merge-file(1).
+	mergeMaxConflicts = 127
+)
+
+// mergeVersions decrypts three versions of a file to a temporary directory
+// and runs the merge tool on them.
+// Like git-merge-file(1) and merge(1), the tool receives the paths of our version,
+// the base, and their version and merges into our version.
+// It returns the temporary directory path, the path of the merged plaintext,
+// whether the tool reported conflicts, and any error encountered.
+// The caller is responsible for cleaning up the temporary directory.
+func mergeVersions(
+	cfg config,
+	basePath, theirsPath string,
+	mergeCmd string,
+	mergeArgs []string,
+) (string, string, bool, error) {
+	identities, _, err := openIdentities(cfg.idsPath, cfg.lockKeys)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	identities = orderIdentities(identities, cfg.prefer)
+
+	tempDir, err := newTempDir(cfg.tempDirPrefix)
+	if err != nil {
+		return tempDir, "", false, err
+	}
+
+	// The merge tool runs in the temporary directory,
+	// so conflict markers show "ours/name", "base/name", and "theirs/name".
+	name := filepath.Base(getRoot(cfg.encPath))
+	versions := []struct {
+		encPath string
+		path    string
+	}{
+		{cfg.encPath, filepath.Join("ours", name)},
+		{basePath, filepath.Join("base", name)},
+		{theirsPath, filepath.Join("theirs", name)},
+	}
+
+	for _, version := range versions {
+		path := filepath.Join(tempDir, version.path)
+
+		if err := os.Mkdir(filepath.Dir(path), tempDirPerm); err != nil {
+			return tempDir, "", false, err
+		}
+
+		resetMatches(identities)
+
+		if err := decryptToFile(version.encPath, path, cfg.decodeCmd, cfg.decodeArgs, identities...); err != nil {
+			return tempDir, "", false, fmt.Errorf("%s: %w", version.encPath, err)
+		}
+	}
+
+	fullArgs := append([]string{}, mergeArgs...)
+	fullArgs = append(fullArgs, versions[0].path, versions[1].path, versions[2].path)
+
+	cmd := exec.CommandContext(context.Background(), mergeCmd, fullArgs...)
+	cmd.Dir = tempDir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	merged := filepath.Join(tempDir, versions[0].path)
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil:
+		return tempDir, merged, false, nil
+
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() <= mergeMaxConflicts:
+		return tempDir, merged, true, nil
+
+	default:
+		return tempDir, "", false, fmt.Errorf("merge tool failed: %w", err)
+	}
+}
+
+// mergeCommand implements the "merge" subcommand.
+func mergeCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		fmt.Sprintf(
+			"Merge two versions of an encrypted file that diverged from a common base, like the same file changed on two machines. The three versions are decrypted to the temporary directory, and the merge tool is run with the paths of our version, the base, and their version, like git-merge-file(1). It should merge into our version. If it reports conflicts with an exit status from 1 to %d, the editor is opened to resolve them. The result is encrypted to the output file, which is our version by default.",
+			mergeMaxConflicts,
+		),
+		"  base                    encrypted common ancestor\n  ours                    encrypted version to merge into\n  theirs                  encrypted version to merge\n",
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		false,
+		"write an armored age file (default: keep the format of the output or our version)",
+	)
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	mergeTool := flag.StringP(
+		"merge-tool",
+		"m",
+		defaultMerge(),
+		fmt.Sprintf("merge tool command (%v)", mergeEnvVar),
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock the output file (negated %v)", lockEnvVar),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	output := flag.StringP(
+		"output",
+		"o",
+		"",
+		"encrypted output file (default: our version)",
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+	tempDirPrefix := flag.StringP(
+		"temp-dir",
+		"t",
+		defaultTempDirPrefix(),
+		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	//nolint:mnd
+	if flag.NArg() != 3 {
+		fmt.Fprintln(os.Stderr, "Error: need a base, our version, and their version")
+
+		return exitBadUsage
+	}
+
+	if *idsPath == "" && !agentAvailable() {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file")
+
+		return exitBadUsage
+	}
+
+	basePath := flag.Arg(0)
+	oursPath := flag.Arg(1)
+	theirsPath := flag.Arg(2)
+
+	outPath := *output
+	if outPath == "" {
+		outPath = oursPath
+	}
+
+	cfg := config{
+		idsPath:       *idsPath,
+		encPath:       oursPath,
+		otherPaths:    []string{},
+		tempDirPrefix: *tempDirPrefix,
+		trashDir:      "",
+		trashTTL:      0,
+		lockStrategy:  locking.strategy,
+		lockExpiry:    locking.expiry,
+		autosave:      0,
+		idleTimeout:   0,
+		history:       0,
+		historyMaxAge: 0,
+		historyStore:  historyStoreFile,
+		backups:       0,
+		maxShrink:     0,
+		minSize:       0,
+		template:      "",
+		gitMessage:    "",
+		plainName:     "",
+		wait:          "",
+
+		allowEmpty:    false,
+		allowShrink:   false,
+		armor:         *armored,
+		autoFilter:    false,
+		chdir:         false,
+		confirmSave:   false,
+		force:         false,
+		fsync:         true,
+		gitCommit:     false,
+		inhibitSleep:  false,
+		keepFormat:    false,
+		keepTemp:      false,
+		lock:          !*noLock,
+		lockKeys:      false,
+		notify:        false,
+		openBinary:    false,
+		park:          false,
+		preserveMtime: false,
+		readOnly:      false,
+		stay:          false,
+		supervise:     false,
+		tty:           false,
+		verbose:       false,
+		warnDroppings: false,
+		watch:         false,
+		yes:           false,
+
+		alsoSave: []string{},
+		prefer:   *prefer,
+
+		saveSignals:  []string{},
+		revertSignal: "",
+
+		command: defaultEditor(),
+		args:    []string{},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{level: 0, threads: 0, window: 0},
+
+		hooks: hookSet{},
+	}
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			cfg.lockKeys = true
+		}
+	}
+
+	commands := []struct {
+		value string
+		name  string
+		cmd   *string
+		args  *[]string
+	}{
+		{defaultCommand(), "editor", &cfg.command, &cfg.args},
+		{*decode, "decode", &cfg.decodeCmd, &cfg.decodeArgs},
+		{*encode, "encode", &cfg.encodeCmd, &cfg.encodeArgs},
+	}
+
+	for _, command := range commands {
+		if command.value == "" {
+			continue
+		}
+
+		args, err := shlex.Split(command.value, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: failed to split %s command\n", command.name)
+
+			return exitBadUsage
+		}
+
+		*command.cmd = args[0]
+		*command.args = args[1:]
+	}
+
+	mergeArgs, err := shlex.Split(*mergeTool, true)
+	if err != nil || len(mergeArgs) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: failed to split merge tool command")
+
+		return exitBadUsage
+	}
+
+	deps := append(editDependencies(cfg), dependency{
+		role:    "merge tool",
+		command: mergeArgs[0],
+		hint:    fmt.Sprintf("install it or change --merge-tool or %s", mergeEnvVar),
+	})
+
+	if err := checkDependencies(deps...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	opts := replaceOptions{
+		recipients: []age.Recipient{},
+
+		armor:  cfg.armor,
+		binary: false,
+
+		lock:    cfg.lock,
+		locking: locking,
+
+		encodeCmd:  cfg.encodeCmd,
+		encodeArgs: cfg.encodeArgs,
+	}
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		opts.recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+	} else {
+		_, opts.recipients, err = openIdentities(cfg.idsPath, false)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	// A new output file gets the format of our version.
+	if _, err := os.Stat(outPath); errors.Is(err, os.ErrNotExist) && !opts.armor {
+		if opts.armor, err = isArmored(oursPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+	}
+
+	tempDir, merged, conflicts, err := mergeVersions(cfg, basePath, theirsPath, mergeArgs[0], mergeArgs[1:])
+	if tempDir != "" {
+		defer removeTempDir(tempDir)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	if conflicts {
+		fmt.Fprintln(os.Stderr, "The merge has conflicts; opening the editor to resolve them")
+
+		editorArgs := append([]string{}, cfg.args...)
+		editorArgs = append(editorArgs, merged)
+
+		cmd := exec.CommandContext(context.Background(), cfg.command, editorArgs...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: editor failed; nothing was written:", err)
+
+			return exitError
+		}
+	}
+
+	in, err := os.Open(merged)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+	defer in.Close()
+
+	if err := replaceFile(in, outPath, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+func defaultMerge() string {
+	merge := os.Getenv(mergeEnvVar)
+	if merge == "" {
+		merge = defaultMergeCommand
+	}
+
+	return merge
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestMergeVersions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git not found")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(name, content string) string {
+		plainPath := filepath.Join(tempDir, name)
+		encPath := plainPath + ".age"
+
+		if err := os.WriteFile(plainPath, []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := encryptToFile(plainPath, encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+
+		return encPath
+	}
+
+	basePath := encrypt("base", "one\ntwo\nthree\n")
+
+	tests := []struct {
+		ours   string
+		theirs string
+		// merged is the expected merge result or a part of it.
+		merged    string
+		conflicts bool
+	}{
+		{"ONE\ntwo\nthree\n", "one\ntwo\nTHREE\n", "ONE\ntwo\nTHREE\n", false},
+		{"one\n2\nthree\n", "one\nzwei\nthree\n", "<<<<<<< ours/", true},
+	}
+
+	for i, test := range tests {
+		cfg := config{
+			idsPath:       idsPath,
+			encPath:       encrypt(fmt.Sprintf("ours%d", i), test.ours),
+			tempDirPrefix: tempDir,
+
+			prefer: []string{},
+		}
+
+		mergeTempDir, merged, conflicts, err := mergeVersions(cfg, basePath, encrypt(fmt.Sprintf("theirs%d", i), test.theirs), "git", []string{"merge-file"})
+		if mergeTempDir != "" {
+			defer os.RemoveAll(mergeTempDir)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := os.ReadFile(merged)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if conflicts != test.conflicts || !strings.Contains(string(content), test.merged) {
+			t.Errorf("mergeVersions() returned conflicts %v and %q", conflicts, content)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mirrorError reports copies of a saved encrypted file that couldn't be written.
+// The encrypted file itself is saved.
+type mirrorError struct {
+	encPath string
+	paths   []string
+	errs    []error
+}
+
+func (e *mirrorError) Error() string {
+	msgs := []string{}
+	for _, err := range e.errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf(
+		"%q was saved, but the copies weren't (%s); copy it to %s yourself",
+		e.encPath,
+		strings.Join(msgs, "; "),
+		strings.Join(quoteAll(e.paths), ", "),
+	)
+}
+
+// quoteAll quotes strings for a message.
+func quoteAll(strs []string) []string {
+	quoted := []string{}
+	for _, s := range strs {
+		quoted = append(quoted, fmt.Sprintf("%q", s))
+	}
+
+	return quoted
+}
+
+// mirrorPath returns where a mirror gets the copy of an encrypted file.
+// In a directory, the copy has the name of the file.
+func mirrorPath(mirror, encPath string) string {
+	if info, err := os.Stat(mirror); (err == nil && info.IsDir()) || strings.HasSuffix(mirror, string(os.PathSeparator)) {
+		return filepath.Join(mirror, filepath.Base(encPath))
+	}
+
+	return mirror
+}
+
+// checkMirrors checks before the session that the copies of an encrypted file can be written,
+// so a backup disk that isn't mounted is found before the user edits the file.
+func checkMirrors(mirrors []string, encPath string) error {
+	absEncPath, err := filepath.Abs(encPath)
+	if err != nil {
+		return err
+	}
+
+	for _, mirror := range mirrors {
+		path := mirrorPath(mirror, encPath)
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		if absPath == absEncPath {
+			return fmt.Errorf("--also-save %q is the encrypted file itself", mirror)
+		}
+
+		if err := checkDirWritable(path); err != nil {
+			return fmt.Errorf("can't save a copy to %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// checkMirrorTargets checks that no two files of a session are copied to the same path.
+func checkMirrorTargets(files []*editFile) error {
+	targets := map[string]string{}
+
+	for _, f := range files {
+		for _, mirror := range f.cfg.alsoSave {
+			path, err := filepath.Abs(mirrorPath(mirror, f.cfg.encPath))
+			if err != nil {
+				return err
+			}
+
+			if other, ok := targets[path]; ok {
+				return fmt.Errorf("%q and %q would both be copied to %q; give --also-save a directory", other, f.cfg.encPath, path)
+			}
+
+			targets[path] = f.cfg.encPath
+		}
+	}
+
+	return nil
+}
+
+// saveMirrors writes the ciphertext as it was saved to the mirrors.
+// Every mirror is tried, even when one fails.
+func (f *editFile) saveMirrors() error {
+	failed := &mirrorError{encPath: f.cfg.encPath, paths: []string{}, errs: []error{}}
+
+	for _, mirror := range f.cfg.alsoSave {
+		path := mirrorPath(mirror, f.cfg.encPath)
+
+		err := writeFileAtomic(path, filePerm, f.cfg.fsync, func(w io.Writer) error {
+			_, err := w.Write(f.opened)
+
+			return err
+		})
+		if err != nil {
+			failed.paths = append(failed.paths, path)
+			failed.errs = append(failed.errs, err)
+		}
+	}
+
+	f.unmirrored = len(failed.errs) > 0
+	if f.unmirrored {
+		return failed
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestMirrorPath(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sep := string(os.PathSeparator)
+
+	tests := []struct {
+		mirror   string
+		expected string
+	}{
+		{dir, filepath.Join(dir, "secret.txt.age")},
+		{filepath.Join(dir, "copy.age"), filepath.Join(dir, "copy.age")},
+		{filepath.Join(dir, "new") + sep, filepath.Join(dir, "new", "secret.txt.age")},
+	}
+
+	for _, test := range tests {
+		if got := mirrorPath(test.mirror, "/home/user/secret.txt.age"); got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.mirror, test.expected, got)
+		}
+	}
+}
+
+func TestCheckMirrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	encPath := filepath.Join(dir, "secret.txt.age")
+
+	if err := checkMirrors([]string{t.TempDir(), filepath.Join(t.TempDir(), "copy.age")}, encPath); err != nil {
+		t.Errorf("expected writable mirrors, got %v", err)
+	}
+
+	if err := checkMirrors([]string{dir}, encPath); err == nil || !strings.Contains(err.Error(), "itself") {
+		t.Errorf("expected an error for the encrypted file itself, got %v", err)
+	}
+
+	if err := checkMirrors([]string{filepath.Join(dir, "missing", "copy.age")}, encPath); err == nil {
+		t.Error("expected an error for a directory that doesn't exist")
+	}
+
+	backup := t.TempDir()
+	files := []*editFile{
+		{cfg: config{encPath: filepath.Join(dir, "a.age"), alsoSave: []string{backup}}},                         //nolint:exhaustruct
+		{cfg: config{encPath: filepath.Join(dir, "b.age"), alsoSave: []string{backup}}},                         //nolint:exhaustruct
+		{cfg: config{encPath: filepath.Join(dir, "c.age"), alsoSave: []string{filepath.Join(backup, "a.age")}}}, //nolint:exhaustruct
+	}
+
+	if err := checkMirrorTargets(files[:2]); err != nil {
+		t.Errorf("expected different copies in a directory, got %v", err)
+	}
+
+	if err := checkMirrorTargets(files); err == nil {
+		t.Error("expected an error for two files with the same copy")
+	}
+}
+
+func TestSaveMirrors(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipients := []age.Recipient{identity.Recipient()}
+
+	var ciphertext bytes.Buffer
+	if err := encryptStream(strings.NewReader("opened\n"), &ciphertext, false, "", []string{}, recipients...); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(t.TempDir(), "secret.txt.age")
+	if err := os.WriteFile(encPath, ciphertext.Bytes(), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := t.TempDir()
+	diskDir := t.TempDir()
+	diskPath := filepath.Join(diskDir, "disk.age")
+
+	f, err := newEditFile(config{encPath: encPath, yes: true, alsoSave: []string{backupDir, diskPath}}, encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.close()
+
+	sessionDir := t.TempDir()
+	tempFile := filepath.Join(sessionDir, "secret.txt")
+
+	if err := f.open(sessionDir, tempFile, []age.Identity{identity}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(tempFile, []byte("edited\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.save(sessionDir, recipients); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(backupDir, "secret.txt.age"), diskPath} {
+		copied, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(copied, saved) {
+			t.Errorf("expected %q to be a copy of the saved file", path)
+		}
+	}
+
+	// The disk goes away during the session.
+	if err := os.RemoveAll(diskDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(tempFile, []byte("edited again\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.save(sessionDir, recipients)
+
+	var mirrorErr *mirrorError
+	if !errors.As(err, &mirrorErr) || len(mirrorErr.paths) != 1 || mirrorErr.paths[0] != diskPath {
+		t.Fatalf("expected a copy that wasn't written, got %v", err)
+	}
+
+	saved, err = os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if copied, err := os.ReadFile(filepath.Join(backupDir, "secret.txt.age")); err != nil || !bytes.Equal(copied, saved) {
+		t.Errorf("expected the other copy to be written: %v", err)
+	}
+
+	// The next save writes the copy without changes to the plaintext.
+	if err := os.MkdirAll(diskDir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.save(sessionDir, recipients); err != nil {
+		t.Fatal(err)
+	}
+
+	if copied, err := os.ReadFile(diskPath); err != nil || !bytes.Equal(copied, saved) {
+		t.Errorf("expected the copy to be written again: %v", err)
+	}
+}
@@ -2,7 +2,15 @@
 
 package main
 
+// memlockSupported reports whether lockMemory can lock memory on this platform.
+const memlockSupported = false
+
 // lockMemory is a no-op on non-POSIX systems where memory locking is not available.
 func lockMemory() error {
 	return nil
 }
+
+// lockBuffer is a no-op on non-POSIX systems where memory locking is not available.
+func lockBuffer(b []byte) error {
+	return nil
+}
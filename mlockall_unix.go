@@ -8,12 +8,38 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// memlockSupported reports whether lockMemory can lock memory on this platform.
+const memlockSupported = true
+
 // lockMemory locks all current and future memory pages
 // to prevent the process from being swapped to disk.
 // This protects sensitive data like private keys.
+// If the limit on locked memory is too low,
+// it attempts to raise the soft limit to the hard limit and tries again.
 func lockMemory() error {
-	if err := unix.Mlockall(unix.MCL_CURRENT | unix.MCL_FUTURE); err != nil {
-		return fmt.Errorf("failed to lock memory: %w", err)
+	err := unix.Mlockall(unix.MCL_CURRENT | unix.MCL_FUTURE)
+	if err == nil {
+		return nil
+	}
+
+	if raiseErr := raiseMemlockLimit(); raiseErr == nil {
+		if err = unix.Mlockall(unix.MCL_CURRENT | unix.MCL_FUTURE); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to lock memory: %w", err)
+}
+
+// lockBuffer locks the memory pages that contain a buffer.
+// It is a fallback for when the whole process can't be locked.
+func lockBuffer(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	if err := unix.Mlock(b); err != nil {
+		return fmt.Errorf("failed to lock the identities file in memory: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+)
+
+// copyModTime gives dst the modification time of src.
+// The access time is set to the same time,
+// since only the modification time matters to sync and backup tools.
+func copyModTime(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
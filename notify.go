@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	notificationTitle   = "age-edit"
+	notificationTimeout = 10 * time.Second
+
+	// notificationTitleEnvVar and notificationTextEnvVar pass the notification to PowerShell,
+	// so the text needs no quoting in the script.
+	notificationTitleEnvVar = "AGE_EDIT_NOTIFICATION_TITLE"
+	notificationTextEnvVar  = "AGE_EDIT_NOTIFICATION_TEXT"
+
+	// windowsToastScript shows a toast as PowerShell, which Windows lets show toasts without registering an app.
+	windowsToastScript = `$m = [Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime]
+$t = $m::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$x = $t.GetElementsByTagName('text')
+$x.Item(0).AppendChild($t.CreateTextNode($env:AGE_EDIT_NOTIFICATION_TITLE)) > $null
+$x.Item(1).AppendChild($t.CreateTextNode($env:AGE_EDIT_NOTIFICATION_TEXT)) > $null
+$id = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+$m::CreateToastNotifier($id).Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+)
+
+// notificationCommand returns the command that shows a desktop notification on an operating system
+// and the variables it needs in its environment.
+// The title and the text are passed as separate arguments or variables, never as code.
+func notificationCommand(goos, title, text string) (string, []string, []string) {
+	switch goos {
+	case "darwin":
+		return "osascript", []string{
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title,
+			text,
+		}, []string{}
+
+	case "windows":
+		return "powershell", []string{"-NoProfile", "-NonInteractive", "-Command", windowsToastScript}, []string{
+			notificationTitleEnvVar + "=" + title,
+			notificationTextEnvVar + "=" + text,
+		}
+	}
+
+	return "notify-send", []string{"--app-name", notificationTitle, "--", title, text}, []string{}
+}
+
+// notifyDesktop shows a desktop notification.
+func notifyDesktop(title, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	command, args, env := notificationCommand(runtime.GOOS, title, text)
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = append(os.Environ(), env...)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", command, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// notifySaved tells a user behind a GUI editor about a save in the background.
+// A save that finds no changes doesn't notify.
+func notifySaved(saved []string, err error) {
+	var title, text string
+
+	switch {
+	case err != nil:
+		title = notificationTitle + ": saving failed"
+		text = err.Error()
+
+	case len(saved) > 0:
+		names := []string{}
+		for _, path := range saved {
+			names = append(names, filepath.Base(path))
+		}
+
+		title = notificationTitle
+		text = "Saved " + strings.Join(names, ", ")
+
+	default:
+		return
+	}
+
+	if err := notifyDesktop(title, text); err != nil {
+		fmt.Fprintf(os.Stderr, "\r\nage-edit: failed to show a notification: %v\n", err)
+	}
+}
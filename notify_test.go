@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestNotificationCommand(t *testing.T) {
+	t.Parallel()
+
+	// The text can't escape into the script.
+	text := `Saved "x" & $(y)`
+
+	for _, goos := range []string{"darwin", "linux", "windows"} {
+		command, args, env := notificationCommand(goos, "age-edit", text)
+
+		switch goos {
+		case "windows":
+			if command != "powershell" || !slices.Contains(env, notificationTextEnvVar+"="+text) {
+				t.Errorf("%s: unexpected command %q %q with %q", goos, command, args, env)
+			}
+
+		default:
+			if !slices.Contains(args, text) || len(env) != 0 {
+				t.Errorf("%s: unexpected command %q %q with %q", goos, command, args, env)
+			}
+		}
+	}
+}
+
+func TestNotifySaved(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("notify-send is only used on other systems")
+	}
+
+	binDir := t.TempDir()
+	logPath := filepath.Join(binDir, "log")
+
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" >> " + logPath + "\n"
+	if err := os.WriteFile(filepath.Join(binDir, "notify-send"), []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", binDir)
+
+	// A save without changes doesn't notify.
+	notifySaved([]string{}, nil)
+
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no notification, got %v", err)
+	}
+
+	notifySaved([]string{filepath.Join("dir", "a.txt.age"), "b.txt.age"}, nil)
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "--app-name\nage-edit\n--\nage-edit\nSaved a.txt.age, b.txt.age\n"
+	if string(content) != expected {
+		t.Errorf("expected %q, got %q", expected, content)
+	}
+}
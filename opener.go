@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"unicode/utf8"
+)
+
+// binarySniffSize is how much of a file isBinaryFile reads, like Git.
+const binarySniffSize = 8000
+
+// isBinaryFile reports whether a file looks like binary data rather than text:
+// it has a NUL byte or isn't valid UTF-8 at the start.
+// A missing or empty file is text.
+func isBinaryFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, binarySniffSize)
+
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+
+	head = head[:n]
+
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true, nil
+	}
+
+	// A full read may have split the last character.
+	if n == binarySniffSize {
+		for start := n - 1; start >= max(0, n-utf8.UTFMax); start-- {
+			if utf8.RuneStart(head[start]) {
+				if !utf8.FullRune(head[start:]) {
+					head = head[:start]
+				}
+
+				break
+			}
+		}
+	}
+
+	return !utf8.Valid(head), nil
+}
+
+// systemOpener returns the command that opens a file in the default application of the desktop
+// and the wait strategy that fits it.
+// Only the commands of macOS and Windows can wait for the application to quit,
+// so with xdg-open, age-edit waits for <Enter> unless the user picked another strategy.
+func systemOpener(wait string) (string, []string, string) {
+	switch runtime.GOOS {
+	case "darwin":
+		return "open", []string{"-W"}, wait
+
+	case "windows":
+		// The empty argument is the title of the window, which "start" expects before the file.
+		return "cmd", []string{"/c", "start", "/wait", ""}, wait
+	}
+
+	if wait == waitFlags {
+		wait = waitEnter
+	}
+
+	return "xdg-open", []string{}, wait
+}
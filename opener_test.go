@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsBinaryFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	// A multibyte character split at the end of what is read doesn't make the file binary.
+	split := strings.Repeat("a", binarySniffSize-1) + "é"
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected bool
+	}{
+		{"empty", []byte{}, false},
+		{"text", []byte("hello\nworld\n"), false},
+		{"utf8", []byte("привіт\n"), false},
+		{"split", []byte(split), false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), true},
+		{"latin1", []byte("caf\xe9\n"), true},
+		{"nul", append(bytes.Repeat([]byte("a"), 100), 0), true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(tempDir, tt.name)
+		if err := os.WriteFile(path, tt.content, filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		binary, err := isBinaryFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if binary != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, binary)
+		}
+	}
+
+	if binary, err := isBinaryFile(filepath.Join(tempDir, "missing")); binary || err != nil {
+		t.Errorf("expected a missing file to be text, got %v, %v", binary, err)
+	}
+}
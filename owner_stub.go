@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// copyOwner is a no-op on systems without POSIX ownership.
+func copyOwner(path string, like os.FileInfo) error {
+	return nil
+}
+
+// checkPrivate only checks that a file exists on systems without POSIX ownership.
+func checkPrivate(path string) error {
+	_, err := os.Lstat(path)
+
+	return err
+}
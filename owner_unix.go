@@ -0,0 +1,65 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// copyOwner gives a file the owner and the group of another file.
+// Only root can give a file away, and other users can only change the group to one they are a member of.
+// When the owner or the group can't be copied, copyOwner returns errOwnerNotCopied.
+func copyOwner(path string, like os.FileInfo) error {
+	want, ok := like.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	have, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if have.Uid == want.Uid && have.Gid == want.Gid {
+		return nil
+	}
+
+	err = os.Chown(path, int(want.Uid), int(want.Gid)) //nolint:gosec
+	if errors.Is(err, os.ErrPermission) {
+		return errOwnerNotCopied
+	}
+
+	return err
+}
+
+// checkPrivate checks that a file belongs to the current user
+// and that other users have no access to it.
+// A symbolic link is refused, since it could lead anywhere.
+func checkPrivate(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%q is a symbolic link", path)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%q belongs to another user", path)
+	}
+
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("other users have access to %q (mode %04o)", path, perm)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWriteFileAtomicOwner(t *testing.T) {
+	t.Parallel()
+
+	if os.Getuid() != 0 {
+		t.Skip("only root can change the owner of a file")
+	}
+
+	path := filepath.Join(t.TempDir(), "secret.age")
+
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	err := writeFileAtomic(path, 0o600, false, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Uid != 1234 || st.Gid != 5678 {
+		t.Errorf("expected owner 1234:5678, got %d:%d", st.Uid, st.Gid)
+	}
+}
+
+func TestRewriteInPlace(t *testing.T) {
+	t.Parallel()
+
+	if os.Getuid() != 0 {
+		t.Skip("only root can change the owner of a file")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.age")
+	tempPath := filepath.Join(dir, "new")
+
+	if err := os.WriteFile(path, []byte("old ciphertext"), 0o660); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chown(path, 1234, 5678); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(path, 0o660); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(tempPath, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rewriteInPlace(path, tempPath, true); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "new" {
+		t.Errorf("expected the new contents without the rest of the old, got %q", data)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Uid != 1234 || st.Gid != 5678 || st.Mode&0o777 != 0o660 {
+		t.Errorf("expected owner 1234:5678 and mode 0660, got %d:%d and %#o", st.Uid, st.Gid, st.Mode&0o777)
+	}
+}
+
+func TestWriteFileAtomicReadOnlyDir(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can create files in a read-only directory")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.age")
+
+	if err := os.WriteFile(path, []byte("old data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chmod(dir, 0o700)
+	})
+
+	err := writeFileAtomic(path, 0o600, true, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "new" {
+		t.Errorf("expected %q, got %q", "new", data)
+	}
+
+	if _, err := checkAccess(path, false); err != nil {
+		t.Errorf("expected a file in a read-only directory to be editable: %v", err)
+	}
+}
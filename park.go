@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// parkedFile is a plaintext file taken off the disk while the session is suspended.
+type parkedFile struct {
+	path    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	// removed is false when the file couldn't be removed, like in a read-only tree, and only lost its permissions.
+	removed bool
+}
+
+// parkPlaintext takes the plaintext files under paths off the disk and keeps their contents in memory.
+// It returns a function that puts them back with their permissions and modification times,
+// so an editor that checks the files doesn't see a change.
+func parkPlaintext(paths []string) (func() error, error) {
+	parked := []*parkedFile{}
+
+	restore := func() error {
+		errs := []error{}
+
+		for _, p := range parked {
+			if err := p.restore(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		parked = nil
+
+		return errors.Join(errs...)
+	}
+
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			p, err := parkFile(path)
+			if err != nil {
+				return err
+			}
+
+			parked = append(parked, p)
+
+			return nil
+		})
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Join(err, restore())
+		}
+	}
+
+	return restore, nil
+}
+
+// parkFile reads a file and removes it or, failing that, clears its permissions.
+func parkFile(path string) (*parkedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parkedFile{
+		path:    path,
+		data:    data,
+		mode:    info.Mode().Perm(),
+		modTime: info.ModTime(),
+		removed: true,
+	}
+
+	if err := os.Remove(path); err != nil {
+		if err := os.Chmod(path, 0); err != nil {
+			clear(data)
+
+			return nil, err
+		}
+
+		p.removed = false
+	}
+
+	return p, nil
+}
+
+// restore puts a parked file back and forgets its contents.
+func (p *parkedFile) restore() error {
+	defer clear(p.data)
+
+	if p.removed {
+		if err := os.WriteFile(p.path, p.data, p.mode); err != nil {
+			return err
+		}
+	}
+
+	// The umask may have narrowed the permissions of the new file.
+	if err := os.Chmod(p.path, p.mode); err != nil {
+		return err
+	}
+
+	return os.Chtimes(p.path, p.modTime, p.modTime)
+}
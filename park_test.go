@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParkPlaintext(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	file := filepath.Join(tempDir, "file.txt")
+	dir := filepath.Join(tempDir, "tree")
+	nested := filepath.Join(dir, "sub", "nested.txt")
+	missing := filepath.Join(tempDir, "missing.txt")
+
+	if err := os.MkdirAll(filepath.Dir(nested), tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(file, []byte("secret\n"), fileReadOnlyPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(nested, []byte("nested\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	restore, err := parkPlaintext([]string{file, dir, missing})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{file, nested} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%q is still on disk while parked: %v", path, err)
+		}
+	}
+
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{file: "secret\n", nested: "nested\n"} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != want {
+			t.Errorf("expected %q in %q, got %q", want, path, got)
+		}
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != fileReadOnlyPerm {
+		t.Errorf("expected permissions %v, got %v", fileReadOnlyPerm, info.Mode().Perm())
+	}
+
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("expected modification time %v, got %v", modTime, info.ModTime())
+	}
+}
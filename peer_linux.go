@@ -0,0 +1,45 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkPeer checks that the process on the other end of a Unix socket belongs to the current user.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED) //nolint:gosec
+	}); err != nil {
+		return err
+	}
+
+	if credErr != nil {
+		return fmt.Errorf("failed to get the credentials of the peer: %w", credErr)
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("the process on the other end belongs to user %d", cred.Uid)
+	}
+
+	return nil
+}
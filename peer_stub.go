@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// checkPeer can't get the credentials of the peer on this platform,
+// so it relies on the permissions of the socket.
+func checkPeer(conn net.Conn) error {
+	return nil
+}
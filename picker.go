@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+const (
+	pickerPrompt         = "> "
+	pickerDefaultHeight  = 24
+	pickerReservedHeight = 3
+
+	// Fuzzy match scores.
+	pickerScoreMatch       = 1
+	pickerScoreConsecutive = 2
+	pickerScoreBoundary    = 3
+
+	// Keys.
+	keyCtrlC     = 3
+	keyBackspace = 8
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+var errPickCancelled = errors.New("no file selected")
+
+// fuzzyScore matches a query against a candidate like a fuzzy finder:
+// the characters of the query must appear in the candidate in order, ignoring case.
+// Consecutive characters and characters at the start of a word score higher.
+// It returns false if the candidate doesn't match.
+func fuzzyScore(query, candidate string) (int, bool) {
+	query = strings.ToLower(query)
+	candidate = strings.ToLower(candidate)
+
+	score := 0
+	previous := -2
+	last := '/'
+
+	for i, r := range candidate {
+		if query == "" {
+			break
+		}
+
+		q, size := utf8.DecodeRuneInString(query)
+		if r == q {
+			score += pickerScoreMatch
+
+			if previous == i-1 {
+				score += pickerScoreConsecutive
+			}
+
+			if strings.ContainsRune("/.-_ ", last) {
+				score += pickerScoreBoundary
+			}
+
+			previous = i
+			query = query[size:]
+		}
+
+		last = r
+	}
+
+	return score, query == ""
+}
+
+// fuzzyFilter returns the candidates that match a query, best matches first.
+// Among equal matches, shorter candidates come first.
+// An empty query keeps all candidates in their order.
+func fuzzyFilter(query string, candidates []string) []string {
+	if query == "" {
+		return slices.Clone(candidates)
+	}
+
+	type match struct {
+		candidate string
+		score     int
+	}
+
+	matches := []match{}
+
+	for _, candidate := range candidates {
+		if score, ok := fuzzyScore(query, candidate); ok {
+			matches = append(matches, match{candidate: candidate, score: score})
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+
+		return len(a.candidate) - len(b.candidate)
+	})
+
+	filtered := make([]string, 0, len(matches))
+	for _, m := range matches {
+		filtered = append(filtered, m.candidate)
+	}
+
+	return filtered
+}
+
+// pickerPreview describes an encrypted file for the picker without decrypting it.
+func pickerPreview(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err.Error()
+	}
+
+	header, _, err := readAgeHeader(f)
+	if err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf(
+		"%s, %d bytes, modified %s, %s",
+		header.format(),
+		stat.Size(),
+		stat.ModTime().Format(time.DateTime),
+		header.stanzaTypes(),
+	)
+}
+
+// encryptedFilesIn returns the files with an encrypted file suffix in a directory for the picker.
+// Versions in the history are skipped.
+func encryptedFilesIn(dir string) ([]string, error) {
+	paths, err := collectPaths([]string{dir}, "*")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+
+	for _, path := range paths {
+		if hasEncryptedSuffix(path) && !inHistory(path) {
+			files = append(files, path)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no encrypted files in %q", dir)
+	}
+
+	return files, nil
+}
+
+// pickFile lets the user choose an encrypted file in a directory with a fuzzy finder.
+// Type to filter, use <Up> and <Down> or Ctrl+P and Ctrl+N to move, <Enter> to choose,
+// and <Esc> or Ctrl+C to cancel.
+// The picker is drawn on stderr and needs a terminal.
+func pickFile(dir string) (string, error) {
+	paths, err := encryptedFilesIn(dir)
+	if err != nil {
+		return "", err
+	}
+
+	inFd := int(os.Stdin.Fd())   //nolint:gosec
+	outFd := int(os.Stderr.Fd()) //nolint:gosec
+
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		return "", fmt.Errorf("%q is a directory, and there is no terminal to pick a file in", dir)
+	}
+
+	_, height, err := term.GetSize(outFd)
+	if err != nil || height <= pickerReservedHeight {
+		height = pickerDefaultHeight
+	}
+
+	state, err := term.MakeRaw(inFd)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = term.Restore(inFd, state)
+	}()
+
+	names := make([]string, 0, len(paths))
+	byName := map[string]string{}
+
+	for _, path := range paths {
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = path
+		}
+
+		names = append(names, name)
+		byName[name] = path
+	}
+
+	previews := map[string]string{}
+	query := ""
+	selected := 0
+	drawn := 0
+	buffer := make([]byte, 16) //nolint:mnd
+
+	for {
+		matches := fuzzyFilter(query, names)
+		shown := matches[:min(len(matches), height-pickerReservedHeight)]
+		selected = max(0, min(selected, len(shown)-1))
+
+		// Go back to the top of the previous frame and clear it.
+		var frame strings.Builder
+
+		if drawn > 0 {
+			fmt.Fprintf(&frame, "\x1b[%dA", drawn)
+		}
+
+		frame.WriteString("\r\x1b[J")
+
+		for i, name := range shown {
+			marker := "  "
+			if i == selected {
+				marker = "> "
+			}
+
+			frame.WriteString(marker + name + "\r\n")
+		}
+
+		preview := ""
+		if len(matches) > 0 {
+			name := matches[selected]
+			if _, ok := previews[name]; !ok {
+				previews[name] = pickerPreview(byName[name])
+			}
+
+			preview = previews[name]
+		}
+
+		fmt.Fprintf(&frame, "  %d/%d %s\r\n%s%s", len(matches), len(names), preview, pickerPrompt, query)
+		drawn = len(shown) + 1
+
+		fmt.Fprint(os.Stderr, frame.String())
+
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			return "", err
+		}
+
+		input := string(buffer[:n])
+
+		switch {
+		case input == "\r" || input == "\n":
+			fmt.Fprint(os.Stderr, "\r\n")
+
+			if len(matches) == 0 {
+				return "", errPickCancelled
+			}
+
+			return byName[matches[selected]], nil
+
+		case input == string(rune(keyCtrlC)) || input == string(rune(keyEscape)):
+			fmt.Fprint(os.Stderr, "\r\n")
+
+			return "", errPickCancelled
+
+		case input == "\x1b[A" || input == string(rune(keyCtrlP)):
+			selected = max(0, selected-1)
+
+		case input == "\x1b[B" || input == string(rune(keyCtrlN)):
+			selected++
+
+		case input == string(rune(keyBackspace)) || input == string(rune(keyDelete)):
+			if query != "" {
+				_, size := utf8.DecodeLastRuneInString(query)
+				query = query[:len(query)-size]
+				selected = 0
+			}
+
+		case input == string(rune(keyCtrlU)):
+			query = ""
+			selected = 0
+
+		case utf8.ValidString(input) && !strings.ContainsFunc(input, func(r rune) bool { return r < ' ' }):
+			query += input
+			selected = 0
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query     string
+		candidate string
+		ok        bool
+	}{
+		{"", "anything", true},
+		{"mail", "email/work.age", true},
+		{"ewa", "email/work.age", true},
+		{"WORK", "email/work.age", true},
+		{"krow", "email/work.age", false},
+		{"x", "email/work.age", false},
+		{"é", "café.age", true},
+	}
+
+	for _, test := range tests {
+		if _, ok := fuzzyScore(test.query, test.candidate); ok != test.ok {
+			t.Errorf("fuzzyScore(%q, %q): expected %v, got %v", test.query, test.candidate, test.ok, ok)
+		}
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	candidates := []string{"bank/web.age", "email/work.age", "web.age", "wifi.age"}
+
+	got := fuzzyFilter("web", candidates)
+	want := []string{"web.age", "bank/web.age"}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if got := fuzzyFilter("", candidates); !slices.Equal(got, candidates) {
+		t.Errorf("expected all candidates in order, got %v", got)
+	}
+
+	if got := fuzzyFilter("zzz", candidates); len(got) != 0 {
+		t.Errorf("expected no matches, got %v", got)
+	}
+}
+
+func TestEncryptedFilesIn(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"a.age", "notes.txt", filepath.Join("sub", "b.age"), filepath.Join(".a.age.history", "1.age")} {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte{}, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := encryptedFilesIn(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{filepath.Join(dir, "a.age"), filepath.Join(dir, "sub", "b.age")}
+	if !slices.Equal(files, want) {
+		t.Errorf("expected %v, got %v", want, files)
+	}
+
+	if _, err := encryptedFilesIn(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+
+	empty := t.TempDir()
+	if _, err := encryptedFilesIn(empty); err == nil {
+		t.Error("expected an error for a directory without encrypted files")
+	}
+}
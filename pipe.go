@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+// pipeOptions configures how pipeStream transforms a stream of ciphertext.
+type pipeOptions struct {
+	identities []age.Identity
+	recipients []age.Recipient
+
+	command string
+	args    []string
+
+	decodeCmd  string
+	decodeArgs []string
+	encodeCmd  string
+	encodeArgs []string
+
+	// armored is nil to keep the format of the input.
+	armored *bool
+}
+
+// pipeStream decrypts ciphertext from in, runs the plaintext through a command,
+// and writes the output encrypted to out.
+// The plaintext is kept in memory and never written to disk.
+// Nothing is written to out unless every step succeeds,
+// so a failed command doesn't leave partial ciphertext in the pipeline.
+func pipeStream(in io.Reader, out io.Writer, opts pipeOptions) error {
+	ciphertext, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	armored := hasArmorHeader(ciphertext)
+	if opts.armored != nil {
+		armored = *opts.armored
+	}
+
+	d, err := wrapDecrypt(bytes.NewReader(ciphertext), opts.identities...)
+	if err != nil {
+		return explainDecryptError(err, "", opts.identities)
+	}
+
+	var before bytes.Buffer
+
+	// Only the errors of the command are wrapped, so its exit status can be passed on.
+	if err := runFilter(opts.decodeCmd, opts.decodeArgs, d, &before); err != nil {
+		return fmt.Errorf("decryption failed: %v", err) //nolint:errorlint
+	}
+
+	var after bytes.Buffer
+
+	if err := runFilter(opts.command, opts.args, &before, &after); err != nil {
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	var result bytes.Buffer
+
+	if err := encryptStream(&after, &result, armored, opts.encodeCmd, opts.encodeArgs, opts.recipients...); err != nil {
+		return fmt.Errorf("encryption failed: %v", err) //nolint:errorlint
+	}
+
+	_, err = out.Write(result.Bytes())
+
+	return err
+}
+
+// pipeCommand implements the "pipe" subcommand.
+func pipeCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Read an encrypted file from standard input, run its plaintext through a command, and write the output encrypted to standard output. The command reads the plaintext from its standard input and writes the result to its standard output. Without a command, the plaintext is encrypted again unchanged, which is a way to change the recipients or the format. The output is in the format of the input unless --armor or --binary is given. The plaintext stays in memory, and nothing is written if a step fails; the exit status is the command's if the command fails.",
+		"  command                 command and its arguments\n",
+	)
+	flag.SetInterspersed(false)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		false,
+		"write an armored age file",
+	)
+	binary := flag.BoolP(
+		"binary",
+		"b",
+		false,
+		"write a binary age file",
+	)
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if *armored && *binary {
+		fmt.Fprintln(os.Stderr, "Error: --armor and --binary are mutually exclusive")
+
+		return exitBadUsage
+	}
+
+	if *idsPath == "" && !agentAvailable() {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file")
+
+		return exitBadUsage
+	}
+
+	opts := pipeOptions{
+		identities: []age.Identity{},
+		recipients: []age.Recipient{},
+
+		command: "",
+		args:    []string{},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+
+		armored: nil,
+	}
+
+	if flag.NArg() > 0 {
+		opts.command = flag.Arg(0)
+		opts.args = flag.Args()[1:]
+	}
+
+	if *armored || *binary {
+		opts.armored = armored
+	}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		opts.decodeCmd = args[0]
+		opts.decodeArgs = args[1:]
+	}
+
+	if *encode != "" {
+		args, err := shlex.Split(*encode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split encode command")
+
+			return exitBadUsage
+		}
+
+		opts.encodeCmd = args[0]
+		opts.encodeArgs = args[1:]
+	}
+
+	deps := []dependency{
+		decodeDependency(opts.decodeCmd),
+		encodeDependency(opts.encodeCmd),
+	}
+
+	if opts.command != "" {
+		deps = append(deps, dependency{
+			role:    "command",
+			command: opts.command,
+			hint:    "install it or fix the command",
+		})
+	}
+
+	if err := checkDependencies(deps...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	lockKeys := false
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			lockKeys = true
+		}
+	}
+
+	identities, identityRecipients, err := openIdentities(*idsPath, lockKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	opts.identities = orderIdentities(identities, *prefer)
+	opts.recipients = identityRecipients
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		opts.recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+	}
+
+	if err := pipeStream(os.Stdin, os.Stdout, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+
+		return exitError
+	}
+
+	return exitOK
+}
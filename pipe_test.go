@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func TestPipeStream(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("tr not found")
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yes := true
+
+	tests := []struct {
+		name    string
+		armored bool
+		format  *bool
+		command string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"binary", false, nil, "tr", []string{"a-z", "A-Z"}, "HELLO\n", false},
+		{"armored", true, nil, "tr", []string{"a-z", "A-Z"}, "HELLO\n", false},
+		{"no command", false, nil, "", []string{}, "hello\n", false},
+		{"armor output", false, &yes, "", []string{}, "hello\n", false},
+		{"failing command", false, nil, "false", []string{}, "", true},
+	}
+
+	for _, test := range tests {
+		var in bytes.Buffer
+
+		if err := encryptStream(strings.NewReader("hello\n"), &in, test.armored, "", []string{}, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := pipeOptions{
+			identities: []age.Identity{identity},
+			recipients: []age.Recipient{identity.Recipient()},
+			command:    test.command,
+			args:       test.args,
+			armored:    test.format,
+		}
+
+		var out bytes.Buffer
+
+		err := pipeStream(&in, &out, opts)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+
+			if out.Len() > 0 {
+				t.Errorf("%s: expected no output after a failure", test.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		wantArmored := test.armored
+		if test.format != nil {
+			wantArmored = *test.format
+		}
+
+		if got := bytes.HasPrefix(out.Bytes(), []byte(armor.Header)); got != wantArmored {
+			t.Errorf("%s: expected armored %v, got %v", test.name, wantArmored, got)
+		}
+
+		var plain bytes.Buffer
+
+		d, err := wrapDecrypt(&out, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := plain.ReadFrom(d); err != nil {
+			t.Fatal(err)
+		}
+
+		if plain.String() != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, plain.String())
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+
+	"filippo.io/age/plugin"
+)
+
+const (
+	pluginPrefix = "age-plugin-"
+
+	pluginDirEnvVar = "AGE_EDIT_PLUGIN_DIR"
+	pluginsEnvVar   = "AGE_EDIT_PLUGINS"
+)
+
+// pluginBinary is an age plugin executable found on PATH.
+type pluginBinary struct {
+	name string
+	path string
+}
+
+// pluginUI returns the callbacks age plugins use to interact with the user.
+func pluginUI() *plugin.ClientUI {
+	return &plugin.ClientUI{
+		DisplayMessage: func(name, message string) error {
+			fmt.Fprintf(os.Stderr, "%s%s: %s\n", pluginPrefix, name, message)
+
+			return nil
+		},
+		RequestValue: func(name, prompt string, secret bool) (string, error) {
+			return readValue(fmt.Sprintf("%s%s: %s ", pluginPrefix, name, prompt), secret)
+		},
+		Confirm: func(name, prompt, yes, no string) (bool, error) {
+			if no == "" {
+				_, err := readValue(fmt.Sprintf("%s%s: %s [press Enter for %q] ", pluginPrefix, name, prompt, yes), false)
+
+				return err == nil, err
+			}
+
+			answer, err := readValue(fmt.Sprintf("%s%s: %s [1: %s, 2: %s] ", pluginPrefix, name, prompt, yes, no), false)
+			if err != nil {
+				return false, err
+			}
+
+			return strings.TrimSpace(answer) == "1", nil
+		},
+		WaitTimer: func(name string) {
+			fmt.Fprintf(os.Stderr, "%s%s: waiting on the plugin...\n", pluginPrefix, name)
+		},
+	}
+}
+
+// findPlugins returns the age plugin executables on PATH.
+// When several directories contain a plugin with the same name,
+// only the first one, which is the one that would run, is returned.
+func findPlugins() []pluginBinary {
+	seen := make(map[string]bool)
+	plugins := []pluginBinary{}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), pluginPrefix)
+			if !ok || entry.IsDir() {
+				continue
+			}
+
+			if runtime.GOOS == "windows" {
+				name, ok = strings.CutSuffix(name, ".exe")
+				if !ok {
+					continue
+				}
+			} else if info, err := entry.Info(); err != nil || info.Mode()&0o111 == 0 {
+				continue
+			}
+
+			if name == "" || seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			plugins = append(plugins, pluginBinary{name: name, path: filepath.Join(dir, entry.Name())})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].name < plugins[j].name
+	})
+
+	return plugins
+}
+
+// allowedPlugins returns the names of the plugins age-edit may run.
+// An empty list means all plugins are allowed.
+func allowedPlugins() []string {
+	return strings.FieldsFunc(os.Getenv(pluginsEnvVar), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// applyPluginDir puts the plugin directory first on PATH,
+// so age plugins are looked up there before anywhere else.
+func applyPluginDir() error {
+	dir := os.Getenv(pluginDirEnvVar)
+	if dir == "" {
+		return nil
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	return os.Setenv("PATH", absDir+string(filepath.ListSeparator)+os.Getenv("PATH"))
+}
+
+// checkPlugin verifies that a plugin may be run.
+// When an allowlist is configured, the plugin must be on it.
+// When a plugin directory is configured, the plugin executable must be in it.
+func checkPlugin(name string) error {
+	allowed := allowedPlugins()
+	if len(allowed) > 0 && !slices.Contains(allowed, name) {
+		return fmt.Errorf("plugin %q is not in the allowlist (%s)", name, pluginsEnvVar)
+	}
+
+	dir := os.Getenv(pluginDirEnvVar)
+	if dir == "" {
+		return nil
+	}
+
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return fmt.Errorf("plugin %q not found: %w", name, err)
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Dir(absPath) != absDir {
+		return fmt.Errorf("plugin %q is outside the plugin directory %q", name, absDir)
+	}
+
+	return nil
+}
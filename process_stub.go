@@ -0,0 +1,32 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// processAlive reports whether a process with the PID exists.
+// On Windows, finding a process fails when it has exited.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	_ = p.Release()
+
+	return true
+}
+
+// startProcessGroup does nothing where there are no process groups.
+func startProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the process where there are no process groups.
+func killProcessGroup(p *os.Process) error {
+	return p.Kill() //nolint:wrapcheck
+}
+
+// detachProcess does nothing where there are no sessions.
+func detachProcess(cmd *exec.Cmd) {}
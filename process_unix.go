@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// processAlive reports whether a process with the PID exists.
+// A process owned by another user counts as alive.
+func processAlive(pid int) bool {
+	err := unix.Kill(pid, 0)
+
+	return err == nil || errors.Is(err, unix.EPERM)
+}
+
+// startProcessGroup starts a command in a new process group, so killProcessGroup reaches the processes it starts.
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true} //nolint:exhaustruct
+}
+
+// killProcessGroup kills a process started with startProcessGroup and the rest of its process group.
+func killProcessGroup(p *os.Process) error {
+	return unix.Kill(-p.Pid, unix.SIGKILL) //nolint:wrapcheck
+}
+
+// detachProcess starts a command in a new session,
+// so signals for the terminal of age-edit, like on hangup, don't reach it.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true} //nolint:exhaustruct
+}
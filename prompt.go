@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// readValue prints a prompt to stderr and reads a line from stdin.
+// If secret is true and stdin is a terminal, the input is not echoed.
+func readValue(prompt string, secret bool) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	fd := int(os.Stdin.Fd()) //nolint:gosec
+
+	if secret && term.IsTerminal(fd) {
+		value, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+
+		return string(value), nil
+	}
+
+	line, err := readLine(os.Stdin)
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readLine reads a line one byte at a time.
+// Unlike a buffered reader, it doesn't consume input past the end of the line,
+// so it can be called repeatedly on the same pipe.
+func readLine(r io.Reader) (string, error) {
+	var sb strings.Builder
+
+	b := make([]byte, 1)
+
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			sb.WriteByte(b[0])
+
+			if b[0] == '\n' {
+				return sb.String(), nil
+			}
+		}
+
+		if err != nil {
+			return sb.String(), err
+		}
+	}
+}
+
+// confirm asks a yes/no question and returns true if the answer is yes.
+// An empty answer returns the fallback value.
+func confirm(prompt string, fallback bool) (bool, error) {
+	choices := "[y/N]"
+	if fallback {
+		choices = "[Y/n]"
+	}
+
+	answer, err := readValue(fmt.Sprintf("%s %s ", prompt, choices), false)
+	if err != nil {
+		return false, err
+	}
+
+	switch answer = strings.ToLower(strings.TrimSpace(answer)); answer {
+	case "y":
+		return true, nil
+
+	case "n":
+		return false, nil
+
+	default:
+		return parseBool(answer, fallback)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY allocates a pseudo-terminal of a size and returns its master and slave ends.
+func openPTY(columns, rows int) (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fd := int(master.Fd()) //nolint:gosec
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+
+		return nil, nil, err
+	}
+
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+
+		return nil, nil, err
+	}
+
+	size := &unix.Winsize{Row: uint16(rows), Col: uint16(columns)} //nolint:exhaustruct,gosec
+
+	if err := unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, size); err != nil { //nolint:gosec
+		slave.Close()
+		master.Close()
+
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+// setControllingTerminal makes the standard input of a command its controlling terminal in a new session.
+func setControllingTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true} //nolint:exhaustruct
+}
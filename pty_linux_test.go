@@ -0,0 +1,54 @@
+//go:build linux
+
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/term"
+)
+
+func TestOpenPTY(t *testing.T) {
+	t.Parallel()
+
+	master, slave, err := openPTY(ptyColumns, ptyRows)
+	if err != nil {
+		t.Skip("can't allocate a pseudo-terminal:", err)
+	}
+	defer master.Close()
+
+	if !term.IsTerminal(int(slave.Fd())) {
+		t.Error("the slave end isn't a terminal")
+	}
+
+	width, height, err := term.GetSize(int(slave.Fd()))
+	if err != nil || width != ptyColumns || height != ptyRows {
+		t.Errorf("expected a size of %dx%d, got %dx%d (%v)", ptyColumns, ptyRows, width, height, err)
+	}
+
+	// The command has the pseudo-terminal as its controlling terminal.
+	cmd := exec.Command("sh", "-c", "echo tty: $(tty)")
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	setControllingTerminal(cmd)
+
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	slave.Close()
+
+	buffer := make([]byte, 256)
+
+	n, err := master.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output := string(buffer[:n]); !strings.HasPrefix(output, "tty: /dev/pts/") {
+		t.Errorf("unexpected output %q", output)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// openPTY can't allocate a pseudo-terminal on this platform.
+func openPTY(columns, rows int) (*os.File, *os.File, error) {
+	return nil, nil, errors.New("no terminal for the editor, and pseudo-terminals aren't supported on this platform")
+}
+
+// setControllingTerminal does nothing on this platform.
+func setControllingTerminal(cmd *exec.Cmd) {}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// ramBacked reports whether a directory is on a filesystem stored in memory.
+func ramBacked(dir string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return false, err
+	}
+
+	fsType := int64(st.Type) //nolint:unconvert
+
+	return fsType == unix.TMPFS_MAGIC || fsType == unix.RAMFS_MAGIC, nil
+}
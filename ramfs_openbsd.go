@@ -0,0 +1,17 @@
+//go:build openbsd
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// ramBacked reports whether a directory is on a filesystem stored in memory.
+func ramBacked(dir string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return false, err
+	}
+
+	return ramFilesystems[unix.ByteSliceToString(st.F_fstypename[:])], nil
+}
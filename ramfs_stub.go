@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !openbsd
+
+package main
+
+// ramBacked can't tell the filesystem type on this platform.
+func ramBacked(dir string) (bool, error) {
+	return false, errUnknownFilesystem
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// rcloneCommand is the rclone executable.
+const rcloneCommand = "rclone"
+
+// rcloneNotFoundCodes are the exit codes of rclone for a directory and a file that don't exist.
+var rcloneNotFoundCodes = []int{3, 4}
+
+// rcloneRemoteName matches the names rclone allows for remotes.
+var rcloneRemoteName = regexp.MustCompile(`^[\w.+@-][\w.+@ -]*$`)
+
+// rcloneFile is an encrypted file on an rclone remote, like "gdrive:secrets/db.env.age".
+// rclone can't write a file only if it hasn't changed,
+// so a save compares the size, the time, and the hashes of the file with those the session has seen first.
+// A change in the moment between the comparison and the upload goes unnoticed.
+type rcloneFile struct {
+	remotePath string
+	version    string
+	exists     bool
+}
+
+// rcloneStat is the output of "rclone lsjson --stat".
+type rcloneStat struct {
+	Size    int64             `json:"Size"`
+	ModTime string            `json:"ModTime"`
+	IsDir   bool              `json:"IsDir"`
+	Hashes  map[string]string `json:"Hashes"`
+}
+
+// isRclonePath reports whether a path is on a remote that rclone has configured.
+// A local file, a drive letter, and a path without a remote name before the colon aren't,
+// and neither is anything when rclone isn't installed.
+func isRclonePath(p string) bool {
+	name, _, ok := strings.Cut(p, ":")
+	if !ok || len(name) < 2 || !rcloneRemoteName.MatchString(name) {
+		return false
+	}
+
+	if _, err := os.Lstat(p); err == nil {
+		return false
+	}
+
+	output, err := runRclone(nil, "listremotes")
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(strings.Fields(string(output)), name+":")
+}
+
+// newRcloneFile returns the file at a path like "remote:path/file.age".
+func newRcloneFile(remotePath string) (*rcloneFile, error) {
+	_, filePath, _ := strings.Cut(remotePath, ":")
+	if filePath == "" || strings.HasSuffix(filePath, "/") {
+		return nil, fmt.Errorf("%q doesn't name a file on the remote", remotePath)
+	}
+
+	return &rcloneFile{remotePath: remotePath, version: "", exists: false}, nil
+}
+
+func (r *rcloneFile) fetch() ([]byte, bool, error) {
+	version, exists, err := r.stat()
+	if err != nil || !exists {
+		r.version, r.exists = "", false
+
+		return nil, false, err
+	}
+
+	data, err := runRclone(nil, "cat", r.remotePath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The file is fetched in two steps, so a change in between would mix up the versions.
+	after, exists, err := r.stat()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !exists || after != version {
+		return nil, false, errors.New("the file changed while it was fetched; try again")
+	}
+
+	r.version, r.exists = version, true
+
+	return data, true, nil
+}
+
+func (r *rcloneFile) store(data []byte) error {
+	version, exists, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	if exists != r.exists || version != r.version {
+		return errRemoteChanged
+	}
+
+	if _, err := runRclone(data, "rcat", r.remotePath); err != nil {
+		return err
+	}
+
+	r.version, r.exists, err = r.stat()
+
+	return err
+}
+
+func (r *rcloneFile) name() string {
+	_, filePath, _ := strings.Cut(r.remotePath, ":")
+
+	return path.Base(filePath)
+}
+
+func (r *rcloneFile) String() string {
+	return r.remotePath
+}
+
+// stat returns the version of the file on the remote and whether it exists.
+func (r *rcloneFile) stat() (string, bool, error) {
+	output, err := runRclone(nil, "lsjson", "--stat", "--hash", r.remotePath)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && slices.Contains(rcloneNotFoundCodes, exitErr.ExitCode()) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	var stat rcloneStat
+	if err := json.Unmarshal(output, &stat); err != nil {
+		return "", false, fmt.Errorf("failed to parse the output of rclone: %w", err)
+	}
+
+	if stat.IsDir {
+		return "", false, fmt.Errorf("%q is a directory", r.remotePath)
+	}
+
+	// encoding/json sorts the keys of the hashes.
+	hashes, err := json.Marshal(stat.Hashes)
+	if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprintf("%d %s %s", stat.Size, stat.ModTime, hashes), true, nil
+}
+
+// runRclone runs rclone with input on standard input and returns its output.
+// The error has the messages of rclone.
+func runRclone(input []byte, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(context.Background(), rcloneCommand, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("rclone %s failed: %w: %s", args[0], err, msg)
+		}
+
+		return nil, fmt.Errorf("rclone %s failed: %w", args[0], err)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeRclone is an rclone with a remote "vault:" in a directory.
+const fakeRclone = `#!/bin/sh
+case "$1" in
+listremotes)
+	echo "vault:"
+	;;
+lsjson)
+	f="$FAKE_RCLONE_DIR/${4#vault:}"
+	if [ ! -e "$f" ]; then
+		echo "object not found" >&2
+		exit 3
+	fi
+	printf '{"Size":%d,"ModTime":"2024-01-01T00:00:00Z","IsDir":false,"Hashes":{"md5":"%s"}}\n' \
+		"$(wc -c < "$f")" "$(cksum < "$f" | cut -d ' ' -f 1)"
+	;;
+cat)
+	cat "$FAKE_RCLONE_DIR/${2#vault:}"
+	;;
+rcat)
+	mkdir -p "$(dirname "$FAKE_RCLONE_DIR/${2#vault:}")"
+	cat > "$FAKE_RCLONE_DIR/${2#vault:}"
+	;;
+*)
+	exit 1
+	;;
+esac
+`
+
+func TestRcloneFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake rclone is a shell script")
+	}
+
+	binDir := t.TempDir()
+	storeDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(binDir, "rclone"), []byte(fakeRclone), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_RCLONE_DIR", storeDir)
+
+	for p, expected := range map[string]bool{
+		"vault:secrets/db.env.age": true,
+		"other:secrets/db.env.age": false,
+		"C:secret.age":             false,
+		"secret.age":               false,
+		"/tmp/vault:secret.age":    false,
+	} {
+		if got := isRclonePath(p); got != expected {
+			t.Errorf("%q: expected %v, got %v", p, expected, got)
+		}
+	}
+
+	r, isRemote, err := openRemote("vault:secrets/db.env.age")
+	if err != nil || !isRemote {
+		t.Fatalf("expected a file on the remote: %v", err)
+	}
+
+	if r.name() != "db.env.age" {
+		t.Errorf("expected the name of the file, got %q", r.name())
+	}
+
+	if _, exists, err := r.fetch(); err != nil || exists {
+		t.Fatalf("expected a missing file: %v", err)
+	}
+
+	if err := r.store([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.store([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, exists, err := r.fetch()
+	if err != nil || !exists || string(data) != "second" {
+		t.Errorf("expected the second version, got %q: %v", data, err)
+	}
+
+	// Another client changes the file.
+	if err := os.WriteFile(filepath.Join(storeDir, "secrets", "db.env.age"), []byte("theirs"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.store([]byte("ours")); !errors.Is(err, errRemoteChanged) {
+		t.Errorf("expected a change on the remote, got %v", err)
+	}
+
+	if _, err := newRcloneFile("vault:secrets/"); err == nil {
+		t.Error("expected an error for a directory")
+	}
+}
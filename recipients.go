@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+)
+
+// parseRecipient parses a single native X25519 or plugin recipient.
+func parseRecipient(s string) (age.Recipient, error) {
+	if recipient, err := age.ParseX25519Recipient(s); err == nil {
+		return recipient, nil
+	}
+
+	if name, _, err := plugin.ParseRecipient(s); err == nil {
+		if err := checkPlugin(name); err != nil {
+			return nil, err
+		}
+
+		return plugin.NewRecipient(s, pluginUI())
+	}
+
+	return nil, fmt.Errorf("malformed recipient %q", s)
+}
+
+// loadRecipients parses recipients given directly and in recipients files.
+// Comments and blank lines in the files are ignored.
+func loadRecipients(recipientStrings []string, paths []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(recipientStrings))
+
+	for _, s := range recipientStrings {
+		recipient, err := parseRecipient(s)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipients file: %w", err)
+		}
+
+		count := 0
+
+		for i, line := range strings.Split(string(data), "\n") {
+			line := strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			recipient, err := parseRecipient(line)
+			if err != nil {
+				// Don't show the line in case the file isn't a recipients file.
+				return nil, fmt.Errorf("malformed recipient at line %d of %q", i+1, path)
+			}
+
+			recipients = append(recipients, recipient)
+			count++
+		}
+
+		if count == 0 {
+			return nil, fmt.Errorf("no recipients found in %q", path)
+		}
+	}
+
+	return recipients, nil
+}
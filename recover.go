@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// sessionInfoName is the file in the temporary directory that tells a later session
+// which encrypted files the plaintext belongs to if this session crashes.
+const sessionInfoName = ".age-edit-session"
+
+// The choices for plaintext left by a crashed session.
+const (
+	leftoverRecover = "r"
+	leftoverDestroy = "d"
+	leftoverKeep    = "k"
+)
+
+// sessionInfo describes a session to a later session.
+// A session with --keep-temp leaves its plaintext on purpose, so it is not a leftover.
+type sessionInfo struct {
+	PID   int           `json:"pid"`
+	Files []sessionFile `json:"files"`
+	Kept  bool          `json:"kept,omitempty"`
+}
+
+// sessionFile is an encrypted file and its plaintext, relative to the temporary directory.
+type sessionFile struct {
+	Encrypted string `json:"encrypted"`
+	Plaintext string `json:"plaintext"`
+}
+
+// leftover is plaintext in the temporary directory of a session whose process is gone.
+type leftover struct {
+	dir       string
+	encrypted string
+	plaintext string
+}
+
+// writeSessionInfo records the files of a session in its temporary directory.
+func writeSessionInfo(tempDir string, files []*editFile, kept bool) error {
+	info := sessionInfo{PID: os.Getpid(), Files: []sessionFile{}, Kept: kept}
+
+	for _, f := range files {
+		encrypted, err := filepath.Abs(f.cfg.encPath)
+		if err != nil {
+			return err
+		}
+
+		plaintext, err := filepath.Rel(tempDir, f.editPath())
+		if err != nil {
+			return err
+		}
+
+		info.Files = append(info.Files, sessionFile{Encrypted: encrypted, Plaintext: plaintext})
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(tempDir, sessionInfoName), data, filePerm)
+}
+
+// findLeftovers returns the plaintext that crashed sessions left in the temporary directories under prefix.
+// Directories without session information, like those of running sessions before it is written, are skipped.
+func findLeftovers(prefix string) ([]leftover, error) {
+	userDir, err := userDirName()
+	if err != nil {
+		return nil, err
+	}
+
+	infoPaths, err := filepath.Glob(filepath.Join(prefix, userDir, "*", sessionInfoName))
+	if err != nil {
+		return nil, err
+	}
+
+	leftovers := []leftover{}
+
+	for _, infoPath := range infoPaths {
+		dir := filepath.Dir(infoPath)
+
+		info, err := readSessionInfo(dir)
+		if err != nil || info.Kept || processAlive(info.PID) {
+			continue
+		}
+
+		leftovers = append(leftovers, info.leftovers(dir)...)
+	}
+
+	return leftovers, nil
+}
+
+// readSessionInfo reads the session information in a temporary directory.
+func readSessionInfo(dir string) (sessionInfo, error) {
+	var info sessionInfo
+
+	data, err := os.ReadFile(filepath.Join(dir, sessionInfoName))
+	if err != nil {
+		return info, err
+	}
+
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, fmt.Errorf("failed to parse the session information in %q: %w", dir, err)
+	}
+
+	return info, nil
+}
+
+// leftovers returns the plaintext of the session that is still in its temporary directory.
+func (info sessionInfo) leftovers(dir string) []leftover {
+	leftovers := []leftover{}
+
+	for _, file := range info.Files {
+		if !filepath.IsLocal(file.Plaintext) {
+			continue
+		}
+
+		plaintext := filepath.Join(dir, file.Plaintext)
+		if _, err := os.Stat(plaintext); err != nil {
+			continue
+		}
+
+		leftovers = append(leftovers, leftover{dir: dir, encrypted: file.Encrypted, plaintext: plaintext})
+	}
+
+	return leftovers
+}
+
+// leftoversOf returns the plaintext that crashed sessions left for an encrypted file.
+func leftoversOf(prefix, encPath string) ([]leftover, error) {
+	absPath, err := filepath.Abs(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	leftovers, err := findLeftovers(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(leftovers, func(l leftover) bool {
+		return l.encrypted != absPath
+	}), nil
+}
+
+// askLeftover asks what to do with plaintext a crashed session left:
+// recover the edits into the new session, destroy the plaintext, or keep it for later.
+// Only one leftover can be recovered into a session.
+// The end of input keeps the plaintext.
+func askLeftover(r io.Reader, w io.Writer, l leftover, canRecover bool) string {
+	fmt.Fprintf(w, "A crashed session left plaintext for %q in %q.\n", l.encrypted, l.plaintext)
+
+	choices := map[string]bool{leftoverDestroy: true, leftoverKeep: true}
+	prompt := "[d]estroy it or [k]eep it for later? "
+
+	if canRecover {
+		choices[leftoverRecover] = true
+		prompt = "[r]ecover the edits, [d]estroy them, or [k]eep them for later? "
+	}
+
+	for {
+		fmt.Fprint(w, prompt)
+
+		line, err := readLine(r)
+		answer := strings.ToLower(strings.TrimSpace(line))
+
+		if choices[answer] {
+			return answer
+		}
+
+		if err != nil {
+			fmt.Fprintln(w)
+
+			return leftoverKeep
+		}
+	}
+}
+
+// recoverLeftover puts the plaintext a crashed session left in place of the decrypted plaintext of a file,
+// so the session saves the recovered edits like other changes.
+// The tree of an archive is replaced with the leftover tree.
+func (f *editFile) recoverLeftover(l leftover) error {
+	if f.dir != "" {
+		var archive bytes.Buffer
+
+		if err := packArchive(l.plaintext, &archive); err != nil {
+			return err
+		}
+
+		if err := shredTree(f.dir); err != nil {
+			return err
+		}
+
+		if err := unpackArchive(&archive, f.dir); err != nil {
+			return err
+		}
+	} else {
+		data, err := os.ReadFile(l.plaintext)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(f.tempFile, data, filePerm)
+		clear(data)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// destroyLeftover shreds the plaintext a crashed session left for one file.
+// The temporary directory goes with the plaintext of its last file,
+// so the leftovers of other files from the same session stay until they are handled.
+func destroyLeftover(l leftover) error {
+	if err := shredTree(l.plaintext); err != nil {
+		return err
+	}
+
+	info, err := readSessionInfo(l.dir)
+	if err != nil {
+		return err
+	}
+
+	if len(info.leftovers(l.dir)) > 0 {
+		return nil
+	}
+
+	return shredTree(l.dir)
+}
+
+// handleLeftovers asks what to do with the plaintext crashed sessions left for the encrypted file of a session.
+// It destroys the leftovers the user chooses to destroy and returns the one to recover, if any.
+// Scripts can't answer, so without a terminal, it only warns.
+func handleLeftovers(cfg config) *leftover {
+	leftovers, err := leftoversOf(cfg.tempDirPrefix, cfg.encPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to look for plaintext left by crashed sessions:", err)
+
+		return nil
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) //nolint:gosec
+
+	var recovered *leftover
+
+	for _, l := range leftovers {
+		if !interactive {
+			fmt.Fprintf(os.Stderr, "Warning: a crashed session left plaintext for %q in %q\n", l.encrypted, l.plaintext)
+
+			continue
+		}
+
+		switch askLeftover(os.Stdin, os.Stderr, l, recovered == nil) {
+		case leftoverRecover:
+			recovered = &l
+
+		case leftoverDestroy:
+			if err := destroyLeftover(l); err != nil {
+				fmt.Fprintln(os.Stderr, "Warning: failed to destroy the leftover plaintext:", err)
+			}
+		}
+	}
+
+	return recovered
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLeftovers(t *testing.T) {
+	t.Parallel()
+
+	prefix := t.TempDir()
+
+	userDir, err := userDirName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The PID of a process that has exited.
+	cmd := exec.Command("go", "version")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(prefix, userDir, "crashed")
+	if err := os.MkdirAll(dir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	aPath := filepath.Join(prefix, "a.txt.age")
+	bPath := filepath.Join(prefix, "b.txt.age")
+
+	info := sessionInfo{
+		PID: cmd.ProcessState.Pid(),
+		Files: []sessionFile{
+			{Encrypted: aPath, Plaintext: "a.txt"},
+			{Encrypted: bPath, Plaintext: "b.txt"},
+			{Encrypted: bPath, Plaintext: "../outside.txt"},
+		},
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string][]byte{sessionInfoName: data, "a.txt": []byte("a"), "b.txt": []byte("b")} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A running session isn't a leftover.
+	running := filepath.Join(prefix, userDir, "running")
+	if err := os.MkdirAll(running, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeSessionInfo(running, []*editFile{{cfg: config{encPath: aPath}, tempFile: filepath.Join(running, "a.txt")}}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(running, "a.txt"), []byte("running"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	leftovers, err := leftoversOf(prefix, aPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leftovers) != 1 || leftovers[0].plaintext != filepath.Join(dir, "a.txt") {
+		t.Fatalf("unexpected leftovers of %q: %+v", aPath, leftovers)
+	}
+
+	// The directory stays while another file of the session has plaintext.
+	if err := destroyLeftover(leftovers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	leftovers, err = leftoversOf(prefix, bPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leftovers) != 1 {
+		t.Fatalf("unexpected leftovers of %q: %+v", bPath, leftovers)
+	}
+
+	if err := destroyLeftover(leftovers[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be removed with its last plaintext: %v", dir, err)
+	}
+}
+
+func TestAskLeftover(t *testing.T) {
+	t.Parallel()
+
+	l := leftover{dir: "dir", encrypted: "secret.txt.age", plaintext: "dir/secret.txt"}
+
+	tests := []struct {
+		input      string
+		canRecover bool
+		expected   string
+	}{
+		{"r\n", true, leftoverRecover},
+		{"x\nD\n", true, leftoverDestroy},
+		{"r\nk\n", false, leftoverKeep},
+		{"", true, leftoverKeep},
+	}
+
+	for _, test := range tests {
+		var w bytes.Buffer
+
+		if got := askLeftover(strings.NewReader(test.input), &w, l, test.canRecover); got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.input, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age/armor"
+)
+
+// reformatFile converts an encrypted file between the armored and the binary format.
+// The armor is only an encoding of the binary file,
+// so the conversion needs no identities and keeps the recipients and the payload as they are.
+// The file is replaced atomically and keeps its permissions.
+// It returns false if the file is already in the requested format.
+func reformatFile(path string, armored, lock bool, locking lockOptions) (bool, error) {
+	if lock {
+		fileLock := newFileLock(path, locking)
+
+		locked, err := fileLock.TryLock()
+		if err != nil {
+			return false, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if !locked {
+			return false, errors.New("encrypted file is locked")
+		}
+
+		defer func() {
+			_ = fileLock.Unlock()
+		}()
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	header, _, err := readAgeHeader(in)
+	if err != nil {
+		return false, err
+	}
+
+	if header.armored == armored {
+		return false, nil
+	}
+
+	info, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	return true, writeFileAtomic(path, info.Mode().Perm(), true, func(w io.Writer) error {
+		if !armored {
+			// The armor can follow a byte order mark and whitespace.
+			r, _, err := peekArmor(in)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(w, armor.NewReader(r))
+
+			return err
+		}
+
+		armorWriter := armor.NewWriter(w)
+
+		if _, err := io.Copy(armorWriter, in); err != nil {
+			return err
+		}
+
+		return armorWriter.Close()
+	})
+}
+
+// reformatCommand implements the "reformat" subcommand.
+func reformatCommand(sub subcommand, args []string) int {
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Convert encrypted files between the armored and the binary format in place. The armor is only an encoding, so nothing is decrypted, and the recipients stay the same. Files already in the requested format are left alone.",
+		"  encrypted               encrypted file path\n",
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		false,
+		"convert to armored age files",
+	)
+	binary := flag.BoolP(
+		"binary",
+		"b",
+		false,
+		"convert to binary age files",
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted files (negated %v)", lockEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if *armored == *binary {
+		fmt.Fprintln(os.Stderr, "Error: need exactly one of --armor and --binary")
+
+		return exitBadUsage
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one encrypted file")
+
+		return exitBadUsage
+	}
+
+	code := exitOK
+
+	for _, path := range flag.Args() {
+		changed, err := reformatFile(path, *armored, !*noLock, locking)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+
+			code = exitError
+
+			continue
+		}
+
+		if changed {
+			fmt.Printf("reformatted %s\n", path)
+		}
+	}
+
+	return code
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestReformatFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "plain.age")
+	locking := lockOptions{strategy: lockStrategyFlock, expiry: 0}
+
+	if err := os.WriteFile(plainPath, []byte("format\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	binary, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, armored := range []bool{true, true, false} {
+		if _, err := reformatFile(encPath, armored, true, locking); err != nil {
+			t.Fatal(err)
+		}
+
+		isArmoredFile, err := isArmored(encPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isArmoredFile != armored {
+			t.Errorf("reformatFile() to armored %v produced armored %v", armored, isArmoredFile)
+		}
+
+		var out bytes.Buffer
+
+		if err := decryptToWriter(encPath, &out, "", []string{}, identity); err != nil || out.String() != "format\n" {
+			t.Errorf("decrypting the reformatted file returned %q, %v", out.String(), err)
+		}
+	}
+
+	// The round trip restores the file byte for byte.
+	roundTrip, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(roundTrip, binary) {
+		t.Error("converting to armored and back changed the file")
+	}
+
+	if _, err := reformatFile(plainPath, true, false, locking); err == nil {
+		t.Error("reformatFile() accepted a plaintext file")
+	}
+}
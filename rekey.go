@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const defaultPathPattern = "*.age"
+
+// rekeyOptions configures the re-encryption of files.
+type rekeyOptions struct {
+	identities []age.Identity
+	recipients []age.Recipient
+
+	// armor and binary force the output format.
+	// When neither is set, each file keeps its format.
+	armor  bool
+	binary bool
+
+	lock    bool
+	locking lockOptions
+}
+
+// rekeyResult is the outcome of re-encrypting one file.
+type rekeyResult struct {
+	path string
+	err  error
+}
+
+// rekeyFile re-encrypts a file to new recipients.
+// The plaintext is streamed from the decryptor to the encryptor
+// and never written to disk.
+// The file is replaced atomically and keeps its permissions.
+func rekeyFile(path string, opts rekeyOptions) error {
+	if opts.lock {
+		fileLock := newFileLock(path, opts.locking)
+
+		locked, err := fileLock.TryLock()
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if !locked {
+			return errors.New("encrypted file is locked")
+		}
+
+		defer func() {
+			_ = fileLock.Unlock()
+		}()
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	armored, err := isArmored(path)
+	if err != nil {
+		return err
+	}
+
+	if opts.armor {
+		armored = true
+	} else if opts.binary {
+		armored = false
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	d, err := wrapDecrypt(in, opts.identities...)
+	if err != nil {
+		return explainDecryptError(err, path, opts.identities)
+	}
+
+	return writeFileAtomic(path, info.Mode().Perm(), true, func(w io.Writer) error {
+		var armorWriter io.WriteCloser
+
+		if armored {
+			armorWriter = armor.NewWriter(w)
+			w = armorWriter
+		}
+
+		encryptWriter, err := age.Encrypt(w, opts.recipients...)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(encryptWriter, d); err != nil {
+			return err
+		}
+
+		if err := encryptWriter.Close(); err != nil {
+			return err
+		}
+
+		if armorWriter != nil {
+			return armorWriter.Close()
+		}
+
+		return nil
+	})
+}
+
+// collectPaths expands file and directory arguments, like those of the rekey command, into a list of files.
+// Files are used as is.
+// Directories are searched recursively for files whose names match the pattern.
+func collectPaths(args []string, pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	paths := []string{}
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			paths = append(paths, arg)
+
+			continue
+		}
+
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.Type().IsRegular() {
+				// The pattern has already been validated.
+				if matched, _ := filepath.Match(pattern, d.Name()); matched {
+					paths = append(paths, path)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// rekeyFiles re-encrypts files using a pool of workers.
+// It returns the results sorted by path.
+func rekeyFiles(paths []string, jobs int, opts rekeyOptions) []rekeyResult {
+	jobs = max(1, min(jobs, len(paths)))
+
+	pathChan := make(chan string)
+	resultChan := make(chan rekeyResult)
+
+	var wg sync.WaitGroup
+
+	for range jobs {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for path := range pathChan {
+				resultChan <- rekeyResult{path: path, err: rekeyFile(path, opts)}
+			}
+		}()
+	}
+
+	go func() {
+		for _, path := range paths {
+			pathChan <- path
+		}
+
+		close(pathChan)
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	results := make([]rekeyResult, 0, len(paths))
+	for result := range resultChan {
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].path < results[j].path
+	})
+
+	return results
+}
+
+// rekeyCommand implements the "rekey" subcommand.
+func rekeyCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Re-encrypt files to new recipients without writing the plaintext to disk. Directories are searched recursively for files that match the pattern. Files are rekeyed in parallel; a failure to rekey one file doesn't stop the others. If no recipients are given, the recipients of the identities are used.",
+		"  path                    encrypted file or directory\n",
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		false,
+		"write armored age files (default: keep the format of each file)",
+	)
+	binary := flag.BoolP(
+		"binary",
+		"b",
+		false,
+		"write binary age files (default: keep the format of each file)",
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	jobs := flag.IntP(
+		"jobs",
+		"j",
+		runtime.NumCPU(),
+		"number of files to rekey in parallel",
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted files (negated %v)", lockEnvVar),
+	)
+	pattern := flag.StringP(
+		"pattern",
+		"p",
+		defaultPathPattern,
+		"file name pattern to match in directories",
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if *armored && *binary {
+		fmt.Fprintln(os.Stderr, "Error: --armor and --binary are mutually exclusive")
+
+		return exitBadUsage
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one path")
+
+		return exitBadUsage
+	}
+
+	identities, recipients, err := openIdentities(*idsPath, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+	}
+
+	paths, err := collectPaths(flag.Args(), *pattern)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	results := rekeyFiles(paths, *jobs, rekeyOptions{
+		identities: identities,
+		recipients: recipients,
+
+		armor:   *armored,
+		binary:  *binary,
+		lock:    !*noLock,
+		locking: locking,
+	})
+
+	failed := 0
+
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", result.path, result.err)
+
+			continue
+		}
+
+		fmt.Printf("rekeyed %s\n", result.path)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d file(s) rekeyed, %d failed\n", len(results)-failed, failed)
+
+	if failed > 0 {
+		return exitError
+	}
+
+	return exitOK
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestRekeyFiles(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	oldIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	if err := os.WriteFile(plainPath, []byte("rekey me\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	storeDir := filepath.Join(tempDir, "store")
+	if err := os.MkdirAll(filepath.Join(storeDir, "sub"), tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	armoredPath := filepath.Join(storeDir, "a.age")
+	binaryPath := filepath.Join(storeDir, "sub", "b.age")
+	otherPath := filepath.Join(storeDir, "c.txt")
+	brokenPath := filepath.Join(storeDir, "broken.age")
+
+	if err := encryptToFile(plainPath, armoredPath, true, true, "", []string{}, oldIdentity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, binaryPath, true, false, "", []string{}, oldIdentity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, otherPath, true, false, "", []string{}, oldIdentity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(brokenPath, []byte("not an age file"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := collectPaths([]string{storeDir}, defaultPathPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 3 {
+		t.Fatalf("collectPaths() found %d files, expected 3: %v", len(paths), paths)
+	}
+
+	results := rekeyFiles(paths, 2, rekeyOptions{
+		identities: []age.Identity{oldIdentity},
+		recipients: []age.Recipient{newIdentity.Recipient()},
+
+		armor:  false,
+		binary: false,
+		lock:   true,
+	})
+
+	for _, result := range results {
+		if (result.err != nil) != (result.path == brokenPath) {
+			t.Errorf("unexpected result for %q: %v", result.path, result.err)
+		}
+	}
+
+	for _, tt := range []struct {
+		path    string
+		armored bool
+	}{
+		{armoredPath, true},
+		{binaryPath, false},
+	} {
+		armored, err := isArmored(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if armored != tt.armored {
+			t.Errorf("%q armored is %v, expected %v", tt.path, armored, tt.armored)
+		}
+
+		decPath := filepath.Join(tempDir, "dec")
+
+		if err := decryptToFile(tt.path, decPath, "", []string{}, oldIdentity); err == nil {
+			t.Errorf("%q can still be decrypted with the old identity", tt.path)
+		}
+
+		if err := decryptToFile(tt.path, decPath, "", []string{}, newIdentity); err != nil {
+			t.Errorf("failed to decrypt %q with the new identity: %v", tt.path, err)
+		}
+
+		content, err := os.ReadFile(decPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != "rekey me\n" {
+			t.Errorf("decrypted content of %q is %q", tt.path, content)
+		}
+	}
+
+	// The file that didn't match the pattern is unchanged.
+	if err := decryptToFile(otherPath, filepath.Join(tempDir, "dec"), "", []string{}, oldIdentity); err != nil {
+		t.Errorf("file outside the pattern was modified: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteDir is the directory under the state directory with the local copies of remote files.
+const remoteDir = "remote"
+
+// errRemoteChanged is a save to a remote file that changed since the session fetched it.
+var errRemoteChanged = errors.New("the file changed on the server since it was fetched")
+
+// remoteFile is an encrypted file on a server, like a file on a WebDAV share.
+// A session edits a local copy of the ciphertext,
+// and every save stores the copy on the server unless the file there has changed in the meantime.
+type remoteFile interface {
+	// fetch downloads the file and remembers its version for store.
+	// It reports false for a file that doesn't exist yet.
+	fetch() ([]byte, bool, error)
+	// store uploads the file if the server still has the version that fetch or the last store saw.
+	// It returns errRemoteChanged otherwise.
+	store(data []byte) error
+	// name is the name of the file, which picks the filters like the name of a local file.
+	name() string
+	// String describes the file without credentials.
+	String() string
+}
+
+// openRemote returns the remote file for a URL like "https://..." or "s3://..."
+// or a path on an rclone remote like "gdrive:secret.age" and false for a local path.
+func openRemote(path string) (remoteFile, bool, error) {
+	switch {
+	case strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://"):
+		r, err := newHTTPFile(path)
+
+		return r, true, err
+
+	case strings.HasPrefix(path, "s3://"):
+		r, err := newS3File(path)
+
+		return r, true, err
+
+	case isRclonePath(path):
+		r, err := newRcloneFile(path)
+
+		return r, true, err
+	}
+
+	return nil, false, nil
+}
+
+// remoteCopyPath returns where the local copy of a remote file is kept:
+// in a directory for the file under the state directory, with the name of the file.
+// The copy is ciphertext and stays between sessions,
+// so backups, history, and the plaintext of crashed sessions work like for a local file.
+func remoteCopyPath(r remoteFile) (string, error) {
+	stateDir, err := userStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(r.String()))
+
+	return filepath.Join(stateDir, remoteDir, hex.EncodeToString(sum[:8]), r.name()), nil
+}
+
+// fetchRemote downloads a remote file to its local copy.
+// When the file doesn't exist on the server, the copy is removed, so the session creates the file.
+func fetchRemote(r remoteFile, localPath string) error {
+	data, exists, err := r.fetch()
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", r, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), tempDirPerm); err != nil {
+		return err
+	}
+
+	if !exists {
+		if err := os.Remove(localPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	return writeFileAtomic(localPath, filePerm, false, func(w io.Writer) error {
+		_, err := w.Write(data)
+
+		return err
+	})
+}
+
+// storeRemote uploads the local copy of a remote file after it is saved.
+// When the upload fails, the copy goes back to the version on the server,
+// so the next save tries again instead of finding a change on disk.
+// When the file has changed on the server, the saved copy becomes a conflict file
+// and the session saves there from then on, like for a local file.
+func (f *editFile) storeRemote(currentSum []byte) error {
+	data, err := os.ReadFile(f.cfg.encPath)
+	if err != nil {
+		return err
+	}
+
+	err = f.remote.store(data)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, errRemoteChanged) {
+		if restoreErr := f.restoreRemoteCopy(); restoreErr != nil {
+			fmt.Fprintln(os.Stderr, "Warning: failed to restore the local copy:", restoreErr)
+		}
+
+		return fmt.Errorf("failed to store %s: %w", f.remote, err)
+	}
+
+	oursPath := fmt.Sprintf("%s.conflict-%s.age", getRoot(f.cfg.encPath), sidecarStamp(time.Now()))
+
+	if err := os.Rename(f.cfg.encPath, oursPath); err != nil {
+		return err
+	}
+
+	if err := f.restoreRemoteCopy(); err != nil {
+		return err
+	}
+
+	f.conflict = &conflictError{
+		encPath:  f.remote.String(),
+		oursPath: oursPath,
+		basePath: "",
+		where:    "on the server",
+	}
+	f.beforeSum = currentSum
+
+	return f.conflict
+}
+
+// restoreRemoteCopy puts back the local copy of a remote file as the session fetched it or last stored it.
+func (f *editFile) restoreRemoteCopy() error {
+	if !f.exists {
+		err := os.Remove(f.cfg.encPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	return writeFileAtomic(f.cfg.encPath, filePerm, false, func(w io.Writer) error {
+		_, err := w.Write(f.opened)
+
+		return err
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestEditRemoteFile(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipients := []age.Recipient{identity.Recipient()}
+
+	encrypt := func(text string) string {
+		var ciphertext bytes.Buffer
+
+		if err := encryptStream(strings.NewReader(text), &ciphertext, false, "", []string{}, recipients...); err != nil {
+			t.Fatal(err)
+		}
+
+		return ciphertext.String()
+	}
+
+	decrypt := func(ciphertext []byte) string {
+		r, err := wrapDecrypt(bytes.NewReader(ciphertext), identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var plaintext bytes.Buffer
+		if _, err := plaintext.ReadFrom(r); err != nil {
+			t.Fatal(err)
+		}
+
+		return plaintext.String()
+	}
+
+	dav := &davServer{} //nolint:exhaustruct
+	dav.put(encrypt("opened\n"))
+
+	server := httptest.NewServer(dav)
+	defer server.Close()
+
+	fileURL := server.URL + "/dav/secret.txt.age"
+
+	f, err := newEditFile(config{encPath: fileURL, yes: true}, fileURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.close()
+
+	if filepath.Base(f.cfg.encPath) != "secret.txt.age" {
+		t.Errorf("expected a local copy with the name of the file, got %q", f.cfg.encPath)
+	}
+
+	sessionDir := t.TempDir()
+	tempFile := filepath.Join(sessionDir, "secret.txt")
+
+	if err := f.open(sessionDir, tempFile, []age.Identity{identity}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(tempFile, []byte("edited\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.save(sessionDir, recipients); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := decrypt(dav.data); got != "edited\n" {
+		t.Errorf("expected the edit on the server, got %q", got)
+	}
+
+	// Another client changes the file, so the next save is a conflict.
+	dav.put(encrypt("theirs\n"))
+
+	if err := os.WriteFile(tempFile, []byte("ours\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.save(sessionDir, recipients)
+
+	var conflictErr *conflictError
+	if !errors.As(err, &conflictErr) || !strings.Contains(err.Error(), "on the server") {
+		t.Fatalf("expected a conflict on the server, got %v", err)
+	}
+
+	if got := decrypt(dav.data); got != "theirs\n" {
+		t.Errorf("expected the change of the other client to stay, got %q", got)
+	}
+
+	ours, err := os.ReadFile(conflictErr.oursPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := decrypt(ours); got != "ours\n" {
+		t.Errorf("expected our version in the conflict file, got %q", got)
+	}
+
+	// The local copy is still the version the session stored, so opening it again doesn't find a change on disk.
+	local, err := os.ReadFile(f.cfg.encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := decrypt(local); got != "edited\n" {
+		t.Errorf("expected the stored version in the local copy, got %q", got)
+	}
+
+	// A server that can't be reached is an error.
+	server.Close()
+
+	g, err := newEditFile(config{encPath: fileURL, yes: true}, fileURL)
+	if err == nil {
+		g.close()
+		t.Error("expected an error for a server that can't be reached")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// renameNoReplace renames a file unless the new path exists.
+// There is no rename that refuses to replace a file on this platform, so it uses a hard link.
+func renameNoReplace(oldPath, newPath string) error {
+	return linkNoReplace(oldPath, newPath)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+// replaceOptions configures the replacement of an encrypted file's contents.
+type replaceOptions struct {
+	recipients []age.Recipient
+
+	// armor and binary force the output format.
+	// When neither is set, an existing file keeps its format.
+	armor  bool
+	binary bool
+
+	lock    bool
+	locking lockOptions
+
+	encodeCmd  string
+	encodeArgs []string
+}
+
+// replaceFile encrypts new plaintext from a reader over an encrypted file.
+// An existing file is locked while it is replaced and keeps its permissions.
+// The file is replaced atomically, so it is left unchanged if reading the plaintext fails.
+func replaceFile(in io.Reader, encPath string, opts replaceOptions) error {
+	perm := os.FileMode(filePerm)
+	armored := false
+
+	info, err := os.Stat(encPath)
+
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+
+		armored, err = isArmored(encPath)
+		if err != nil {
+			return err
+		}
+
+		if opts.lock {
+			fileLock := newFileLock(encPath, opts.locking)
+
+			locked, err := fileLock.TryLock()
+			if err != nil {
+				return fmt.Errorf("failed to acquire lock: %w", err)
+			}
+
+			if !locked {
+				return errors.New("encrypted file is locked")
+			}
+
+			defer func() {
+				_ = fileLock.Unlock()
+			}()
+		}
+
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	if opts.armor {
+		armored = true
+	} else if opts.binary {
+		armored = false
+	}
+
+	return writeFileAtomic(encPath, perm, true, func(w io.Writer) error {
+		return encryptStream(in, w, armored, opts.encodeCmd, opts.encodeArgs, opts.recipients...)
+	})
+}
+
+// replaceCommand implements the "replace" subcommand.
+func replaceCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Replace the contents of an encrypted file with plaintext read from standard input without an editor, for example, in scripts. The file is locked like when editing and replaced atomically. If no recipients are given, the recipients of the identities are used.",
+		"  encrypted               encrypted file path\n",
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		false,
+		"write an armored age file (default: keep the format of the file)",
+	)
+	binary := flag.BoolP(
+		"binary",
+		"b",
+		false,
+		"write a binary age file (default: keep the format of the file)",
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted file (negated %v)", lockEnvVar),
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if *armored && *binary {
+		fmt.Fprintln(os.Stderr, "Error: --armor and --binary are mutually exclusive")
+
+		return exitBadUsage
+	}
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Error: need an encrypted file")
+
+		return exitBadUsage
+	}
+
+	opts := replaceOptions{
+		recipients: []age.Recipient{},
+
+		armor:  *armored,
+		binary: *binary,
+
+		lock:    !*noLock,
+		locking: locking,
+
+		encodeCmd:  "",
+		encodeArgs: []string{},
+	}
+
+	if *encode != "" {
+		args, err := shlex.Split(*encode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split encode command")
+
+			return exitBadUsage
+		}
+
+		opts.encodeCmd = args[0]
+		opts.encodeArgs = args[1:]
+	}
+
+	if err := checkDependencies(encodeDependency(opts.encodeCmd)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		opts.recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+	} else {
+		_, opts.recipients, err = openIdentities(*idsPath, false)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	if err := replaceFile(os.Stdin, flag.Arg(0), opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
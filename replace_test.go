@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestReplaceFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "secret.age")
+
+	if err := os.WriteFile(plainPath, []byte("old"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chmod(encPath, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := replaceOptions{
+		recipients: []age.Recipient{identity.Recipient()},
+		lock:       true,
+		locking:    lockOptions{strategy: lockStrategyDotlock, expiry: 0},
+		encodeArgs: []string{},
+	}
+
+	if err := replaceFile(strings.NewReader("new"), encPath, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	if err := decryptToWriter(encPath, &out, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	armored, err := isArmored(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "new" || !armored {
+		t.Errorf("got contents %q, armored %v", out.String(), armored)
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o640 {
+		t.Errorf("the file has permissions %v", info.Mode().Perm())
+	}
+
+	// A locked file is left alone.
+	if err := os.WriteFile(encPath+dotlockSuffix, []byte("other"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceFile(strings.NewReader("newer"), encPath, opts); err == nil {
+		t.Error("replaceFile() replaced a locked file")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// The choices after a failed save.
+const (
+	saveFailureRetry   = "r"
+	saveFailureEdit    = "e"
+	saveFailureSaveAs  = "s"
+	saveFailureWrite   = "w"
+	saveFailureDiscard = "d"
+)
+
+// rescuePlaintext copies the plaintext to a path the user chose when it can't be encrypted.
+// It refuses to replace an existing file.
+func rescuePlaintext(tempFile, path string) error {
+	in, err := os.Open(tempFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+
+		return err
+	}
+
+	return nil
+}
+
+// saveAsPath suggests another path for an encrypted file that can't be saved,
+// like "secret.txt.saved-20250102T150405-0123abcd.age" next to it.
+func saveAsPath(encPath string, now time.Time) string {
+	return fmt.Sprintf("%s.saved-%s.age", getRoot(encPath), sidecarStamp(now))
+}
+
+// handleSaveFailure asks what to do after a failed save:
+// retry the save, open the editor again, encrypt to another path with saveAs,
+// write the plaintext to a file, or discard the changes.
+// An empty path for saveAs means defaultPath.
+// saveAs must not replace an existing file and should fail with an error that matches os.ErrExist instead.
+// It returns the choice and, for saving elsewhere and writing, the path of the new file.
+// The end of input discards the changes.
+func handleSaveFailure(
+	r *bufio.Reader,
+	w io.Writer,
+	saveErr error,
+	tempFile string,
+	defaultPath string,
+	saveAs func(path string) error,
+) (string, string) {
+	fmt.Fprintln(w, "Error: encryption failed:", saveErr)
+
+	for {
+		fmt.Fprint(w, "[r]etry the save, [e]dit again, [s]ave encrypted elsewhere, [w]rite the plaintext to a file, or [d]iscard the changes? ")
+
+		line, err := r.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+
+		switch answer {
+		case saveFailureRetry, saveFailureEdit, saveFailureDiscard:
+			return answer, ""
+
+		case saveFailureSaveAs:
+			fmt.Fprintf(w, "Path for the encrypted file (default %q): ", defaultPath)
+
+			line, err := r.ReadString('\n')
+			if err != nil && line == "" {
+				fmt.Fprintln(w)
+
+				return saveFailureDiscard, ""
+			}
+
+			path := strings.TrimSpace(line)
+			if path == "" {
+				path = defaultPath
+			}
+
+			if err := saveAs(path); errors.Is(err, os.ErrExist) {
+				fmt.Fprintf(w, "Error: %q already exists\n", path)
+
+				continue
+			} else if err != nil {
+				fmt.Fprintln(w, "Error:", err)
+
+				continue
+			}
+
+			return saveFailureSaveAs, path
+
+		case saveFailureWrite:
+			fmt.Fprint(w, "Path for the plaintext (it must not exist): ")
+
+			line, err := r.ReadString('\n')
+			path := strings.TrimSpace(line)
+
+			if path != "" {
+				if err := rescuePlaintext(tempFile, path); err != nil {
+					fmt.Fprintln(w, "Error:", err)
+
+					continue
+				}
+
+				return saveFailureWrite, path
+			}
+
+			if err != nil {
+				fmt.Fprintln(w)
+
+				return saveFailureDiscard, ""
+			}
+
+			continue
+		}
+
+		if err != nil {
+			fmt.Fprintln(w)
+
+			return saveFailureDiscard, ""
+		}
+	}
+}
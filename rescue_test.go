@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleSaveFailure(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tempFile := filepath.Join(dir, "secret.txt")
+	existingPath := filepath.Join(dir, "existing.txt")
+	rescuePath := filepath.Join(dir, "rescue.txt")
+	defaultPath := filepath.Join(dir, "secret.txt.saved.age")
+	otherPath := filepath.Join(dir, "other.age")
+
+	if err := os.WriteFile(tempFile, []byte("plaintext"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(existingPath, []byte("other"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input  string
+		choice string
+		path   string
+	}{
+		{"r\n", saveFailureRetry, ""},
+		{"x\nE\n", saveFailureEdit, ""},
+		{"d\n", saveFailureDiscard, ""},
+		{"", saveFailureDiscard, ""},
+		{"s\n\n", saveFailureSaveAs, defaultPath},
+		{"s\n" + existingPath + "\ns\n" + otherPath + "\n", saveFailureSaveAs, otherPath},
+		{"w\n\nw\n" + existingPath + "\nw\n" + rescuePath + "\n", saveFailureWrite, rescuePath},
+	}
+
+	saveAs := func(path string) error {
+		return writeNewFileAtomic(path, filePerm, false, func(w io.Writer) error {
+			_, err := w.Write([]byte("ciphertext"))
+
+			return err
+		})
+	}
+
+	for _, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.input))
+
+		choice, path := handleSaveFailure(r, &bytes.Buffer{}, errors.New("test"), tempFile, defaultPath, saveAs)
+		if choice != test.choice || path != test.path {
+			t.Errorf("input %q: expected %q, %q, got %q, %q", test.input, test.choice, test.path, choice, path)
+		}
+	}
+
+	for _, path := range []string{defaultPath, otherPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected the encrypted file %q: %v", path, err)
+		}
+	}
+
+	data, err := os.ReadFile(rescuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "plaintext" {
+		t.Errorf("expected the plaintext in the rescue file, got %q", data)
+	}
+
+	data, err = os.ReadFile(existingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "other" {
+		t.Errorf("expected the existing file to be unchanged, got %q", data)
+	}
+}
+
+func TestSaveAsPath(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	path := saveAsPath(filepath.Join("dir", "secret.txt.age"), now)
+	if !regexp.MustCompile(`^secret\.txt\.saved-20250102T150405-[0-9a-z]{8}\.age$`).MatchString(filepath.Base(path)) || filepath.Dir(path) != "dir" {
+		t.Errorf("unexpected path %q", path)
+	}
+
+	if other := saveAsPath(filepath.Join("dir", "secret.txt.age"), now); other == path {
+		t.Errorf("expected another path in the same second, got %q twice", path)
+	}
+}
+
+func TestWriteNewFileAtomic(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.age")
+
+	write := func(data string) func(w io.Writer) error {
+		return func(w io.Writer) error {
+			// Another process creates the file while this one writes it.
+			if data == "second" {
+				if err := os.WriteFile(path, []byte("other"), filePerm); err != nil {
+					return err
+				}
+			}
+
+			_, err := w.Write([]byte(data))
+
+			return err
+		}
+	}
+
+	if err := writeNewFileAtomic(path, filePerm, true, write("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeNewFileAtomic(path, filePerm, true, write("first")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected an error for an existing file, got %v", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeNewFileAtomic(path, filePerm, true, write("second")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected an error for a file created during the write, got %v", err)
+	}
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != "other" {
+		t.Errorf("expected the other file to be kept, got %q: %v", data, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,8 @@
+//go:build aix || solaris
+
+package main
+
+// raiseMemlockLimit is a no-op on systems without RLIMIT_MEMLOCK.
+func raiseMemlockLimit() error {
+	return nil
+}
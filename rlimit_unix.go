@@ -0,0 +1,23 @@
+//go:build unix && !aix && !solaris
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// raiseMemlockLimit raises the soft limit on locked memory to the hard limit.
+func raiseMemlockLimit() error {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &limit); err != nil {
+		return err
+	}
+
+	if limit.Cur == limit.Max {
+		return nil
+	}
+
+	limit.Cur = limit.Max
+
+	return unix.Setrlimit(unix.RLIMIT_MEMLOCK, &limit)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// sidecarPattern matches the end of the names of the files age-edit writes next to an encrypted file:
+// the copies of a conflict and its base, including the conflicts with a remote file,
+// and the copies saved elsewhere after a failed save.
+// Older versions named them without the random part.
+const sidecarPattern = `\.(?:conflict|base|saved)-\d{8}T\d{6}(?:-[0-9a-z]{8})?\.age$`
+
+// artifactsOf returns the files age-edit keeps for an encrypted file:
+// the file itself followed by its backups, its previous versions in the history,
+// the conflict and saved copies next to it, and its copies in the trash.
+// Trash entries are matched by the name and the path of the file they come from.
+func artifactsOf(encPath, trashDir string) ([]string, error) {
+	backups, err := backupFiles(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := append([]string{encPath}, backups...)
+
+	versions, err := historyEntries(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range versions {
+		artifacts = append(artifacts, version.path)
+	}
+
+	sidecars, err := sidecarsOf(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts = append(artifacts, sidecars...)
+
+	if trashDir == "" {
+		slices.Sort(artifacts[1+len(backups)+len(versions):])
+
+		return artifacts, nil
+	}
+
+	entries, err := os.ReadDir(trashDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return artifacts, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sourceID, err := trashSourceID(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	trashName := regexp.MustCompile(
+		`^` + regexp.QuoteMeta(filepath.Base(getRoot(encPath))+"."+sourceID) + trashEntryPattern,
+	)
+
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && trashName.MatchString(entry.Name()) {
+			artifacts = append(artifacts, filepath.Join(trashDir, entry.Name()))
+		}
+	}
+
+	slices.Sort(artifacts[1+len(backups)+len(versions):])
+
+	return artifacts, nil
+}
+
+// sidecarsOf returns the conflict and saved copies of an encrypted file.
+func sidecarsOf(encPath string) ([]string, error) {
+	dir := filepath.Dir(encPath)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sidecarName := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(getRoot(encPath))) + sidecarPattern)
+	sidecars := []string{}
+
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && sidecarName.MatchString(entry.Name()) {
+			sidecars = append(sidecars, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return sidecars, nil
+}
+
+// shredFile overwrites a file with random data before removing it.
+// This is a best effort: journaling and copy-on-write filesystems and SSDs
+// may keep the old contents elsewhere.
+// Only regular files are shredded, so a symlink doesn't lead to overwriting the file it points to.
+func shredFile(path string) error {
+	before, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if !before.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", path)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err == nil && !os.SameFile(before, info) {
+		err = errors.New("the file was replaced")
+	}
+
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to overwrite %q: %w", path, err)
+	}
+
+	return os.Remove(path)
+}
+
+// shredTree shreds the files in a directory and removes the directory.
+// Read-only files and directories, like those of a read-only session, are made writable first.
+func shredTree(dir string) error {
+	errs := []error{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			// The entries of a directory are read after this, so they can be removed later.
+			if err := os.Chmod(path, tempDirPerm); err != nil {
+				errs = append(errs, err)
+			}
+
+		case d.Type().IsRegular():
+			if err := os.Chmod(path, filePerm); err != nil {
+				errs = append(errs, err)
+
+				return nil
+			}
+
+			if err := shredFile(path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// removeEncrypted shreds an encrypted file and its artifacts.
+// If lock is true, it first checks that the encrypted file isn't locked,
+// so a file open in another age-edit session isn't removed.
+// The lock is released before shredding because Windows doesn't allow
+// writing to or removing a locked file.
+func removeEncrypted(artifacts []string, lock bool, locking lockOptions) error {
+	if lock {
+		encLock := newFileLock(artifacts[0], locking)
+
+		locked, err := encLock.TryLock()
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if !locked {
+			return errors.New("encrypted file is locked")
+		}
+
+		if err := encLock.Unlock(); err != nil {
+			return fmt.Errorf("failed to release lock: %w", err)
+		}
+	}
+
+	for _, path := range artifacts {
+		if err := shredFile(path); err != nil {
+			return err
+		}
+	}
+
+	// Remove the history directories if they are now empty.
+	for _, dir := range historyDirs(artifacts[0]) {
+		_ = os.Remove(dir)
+	}
+
+	return nil
+}
+
+// rmCommand implements the "rm" subcommand.
+func rmCommand(sub subcommand, args []string) int {
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Delete encrypted files together with the copies age-edit has kept of them in the backups, the history, the trash, and the conflict and saved copies next to them. The files are overwritten with random data before they are removed. The command lists the files and asks for confirmation first.",
+		"  encrypted               encrypted file path\n",
+	)
+
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted files (negated %v)", lockEnvVar),
+	)
+	trash := flag.String(
+		"trash",
+		defaultTrash(),
+		fmt.Sprintf("trash directory to remove copies from (%v)", trashEnvVar),
+	)
+	yes := flag.BoolP(
+		"yes",
+		"y",
+		false,
+		"do not ask for confirmation",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one encrypted file")
+
+		return exitBadUsage
+	}
+
+	all := [][]string{}
+	count := 0
+
+	for _, encPath := range flag.Args() {
+		// Shredding through a symlink would overwrite the file it points to and only remove the link.
+		info, err := os.Lstat(encPath)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			err = fmt.Errorf("%q is a symbolic link; remove the file it points to instead", encPath)
+		} else if err == nil && !info.Mode().IsRegular() {
+			err = fmt.Errorf("%q is not a regular file", encPath)
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		artifacts, err := artifactsOf(encPath, *trash)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		all = append(all, artifacts)
+		count += len(artifacts)
+	}
+
+	if !*yes {
+		for _, artifacts := range all {
+			for _, path := range artifacts {
+				fmt.Fprintln(os.Stderr, path)
+			}
+		}
+
+		ok, err := confirm(fmt.Sprintf("Delete %d file(s)?", count), false)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		if !ok {
+			return exitError
+		}
+	}
+
+	code := exitOK
+
+	for _, artifacts := range all {
+		if err := removeEncrypted(artifacts, !*noLock, locking); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", artifacts[0], err)
+
+			code = exitError
+
+			continue
+		}
+
+		for _, path := range artifacts {
+			fmt.Printf("removed %s\n", path)
+		}
+	}
+
+	return code
+}
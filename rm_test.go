@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRemoveEncrypted(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	trashDir := filepath.Join(tempDir, "trash")
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+
+	if err := os.Mkdir(trashDir, tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceID, err := trashSourceID(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherID, err := trashSourceID(filepath.Join(tempDir, "other", "secret.txt.age"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldPath := filepath.Join(trashDir, "secret.txt."+sourceID+".20250101T120000-0123abcd.age")
+	olderPath := filepath.Join(trashDir, "secret.txt."+sourceID+".20250102T120000-4567efgh.age")
+	conflictPath := filepath.Join(tempDir, "secret.txt.conflict-20250101T120000-0123abcd.age")
+	basePath := filepath.Join(tempDir, "secret.txt.base-20250101T120000-0123abcd.age")
+	oldConflictPath := filepath.Join(tempDir, "secret.txt.conflict-20240101T120000.age")
+	savedPath := filepath.Join(tempDir, "secret.txt.saved-20250101T120000-4567efgh.age")
+
+	files := map[string]string{
+		encPath:         "ciphertext",
+		oldPath:         "old",
+		olderPath:       "older",
+		conflictPath:    "conflict",
+		basePath:        "base",
+		oldConflictPath: "conflict without a random part",
+		savedPath:       "saved",
+		filepath.Join(tempDir, "other.txt.conflict-20250101T120000-0123abcd.age"):      "unrelated",
+		filepath.Join(tempDir, "secret.txt.conflict-20250101T120000-0123abcd.age.1"):   "unrelated",
+		filepath.Join(trashDir, "other.txt."+sourceID+".20250101T120000-0123abcd.age"): "unrelated",
+		// A file with the same name in another directory.
+		filepath.Join(trashDir, "secret.txt."+otherID+".20250101T120000-0123abcd.age"): "unrelated",
+		filepath.Join(trashDir, "secret.txt.20250101T120000-0123abcd.age"):             "unrelated",
+		filepath.Join(trashDir, "secret.txt.age"):                                      "unrelated",
+	}
+
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backupPath, err := backupFile(encPath, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versionPath, err := archiveVersion(encPath, historyOptions{keep: 0, maxAge: 0, store: historyStoreFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts, err := artifactsOf(encPath, trashDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		encPath,
+		backupPath,
+		versionPath,
+		basePath,
+		oldConflictPath,
+		conflictPath,
+		savedPath,
+		oldPath,
+		olderPath,
+	}
+
+	if !slices.Equal(artifacts, expected) {
+		t.Fatalf("artifactsOf() returned %v, expected %v", artifacts, expected)
+	}
+
+	if err := removeEncrypted(artifacts, true, lockOptions{strategy: lockStrategyFlock, expiry: 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	for path := range files {
+		_, err := os.Stat(path)
+		if removed := os.IsNotExist(err); removed != slices.Contains(expected, path) {
+			t.Errorf("%s removed: %v", path, removed)
+		}
+	}
+
+	if _, err := os.Stat(historyDir(encPath)); !os.IsNotExist(err) {
+		t.Errorf("the history directory wasn't removed: %v", err)
+	}
+}
+
+func TestShredTree(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "session")
+	nested := filepath.Join(dir, "tree", "nested.txt")
+
+	if err := os.MkdirAll(filepath.Dir(nested), tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("secret"), fileReadOnlyPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(nested, []byte("nested"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// A read-only session makes the tree of an archive read-only.
+	if err := makeTreeReadOnly(filepath.Join(dir, "tree")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := shredTree(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%q wasn't removed: %v", dir, err)
+	}
+
+	if err := shredTree(dir); err != nil {
+		t.Errorf("shredding a missing directory failed: %v", err)
+	}
+}
+
+func TestShredFileSymlink(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "secret.txt.age")
+	link := filepath.Join(dir, "link.age")
+
+	if err := os.WriteFile(target, []byte("ciphertext"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("can't create a symlink: %v", err)
+	}
+
+	if err := shredFile(link); err == nil {
+		t.Error("expected an error for a symlink")
+	}
+
+	if content, err := os.ReadFile(target); err != nil || string(content) != "ciphertext" {
+		t.Errorf("expected the target to be intact, got %q: %v", content, err)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+// runCommand implements the "run" subcommand.
+// It is the editing workflow with an arbitrary command in place of the editor.
+func runCommand(sub subcommand, args []string) int {
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultAllowEmptyVal, err := defaultAllowEmpty()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultAllowShrinkVal, err := defaultAllowShrink()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultArmorVal, err := defaultArmor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultBackupsVal, err := defaultBackups()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultChdirVal, err := defaultChdir()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultForceVal, err := defaultForce()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultFsyncVal, err := defaultFsync()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultHistoryVal, err := defaultHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMaxShrinkVal, err := defaultMaxShrink()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultMinSizeVal, err := defaultMinSize()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultPreserveMtimeVal, err := defaultPreserveMtime()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultTrashTTLVal, err := defaultTrashTTLValue()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultYesVal, err := defaultYes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	historyOpts, err := envHistoryOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Decrypt a file, run a command with the path of the plaintext as its last argument or in place of \"{}\", and encrypt the file again if the command changed it. The command runs like the editor but needs no terminal, which makes it suitable for automation. If the command fails, the changes aren't saved, and the exit status is the command's.",
+		fmt.Sprintf(
+			"  identities              identities file path (%s%s)\n  encrypted               encrypted file path (%s%s)\n  command                 command and its arguments after \"--\"\n",
+			identitiesFileEnvVar,
+			identitiesFileHelpDefault,
+			encryptedFileEnvVar,
+			encryptedFileHelpDefault,
+		),
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		defaultArmorVal,
+		fmt.Sprintf("write an armored age file instead of keeping the format (%v for new files)", armorEnvVar),
+	)
+	backups := flag.Int(
+		"backups",
+		defaultBackupsVal,
+		fmt.Sprintf("keep a number of backups of the encrypted file next to it (0 to disable, %v)", backupsEnvVar),
+	)
+	binary := flag.BoolP(
+		"binary",
+		"b",
+		false,
+		"write a binary age file instead of keeping the format",
+	)
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	force := flag.BoolP(
+		"force",
+		"f",
+		defaultForceVal,
+		fmt.Sprintf("force re-encryption even if the file hasn't changed (%v)", forceEnvVar),
+	)
+	history := flag.Int(
+		"history",
+		defaultHistoryVal,
+		fmt.Sprintf("keep a number of previous encrypted versions of the file next to it (0 to disable, %v)", historyEnvVar),
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted file (negated %v)", lockEnvVar),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	tempDirPrefix := flag.StringP(
+		"temp-dir",
+		"t",
+		defaultTempDirPrefix(),
+		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	dash := flag.ArgsLenAtDash()
+	if dash < 0 || dash == flag.NArg() {
+		fmt.Fprintln(os.Stderr, "Error: need a command after \"--\"")
+
+		return exitBadUsage
+	}
+
+	if dash > cliMaxArgs {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	if *armored && *binary {
+		fmt.Fprintln(os.Stderr, "Error: --armor and --binary are mutually exclusive")
+
+		return exitBadUsage
+	}
+
+	if *backups < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --backups must not be negative")
+
+		return exitBadUsage
+	}
+
+	if *history < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --history must not be negative")
+
+		return exitBadUsage
+	}
+
+	initial, err := loadTemplate(defaultTemplate(), defaultTemplateText())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	cfg := config{
+		idsPath:       identitiesFileDefault,
+		encPath:       encryptedFileDefault,
+		otherPaths:    []string{},
+		tempDirPrefix: *tempDirPrefix,
+		trashDir:      defaultTrash(),
+		trashTTL:      defaultTrashTTLVal,
+		lockStrategy:  locking.strategy,
+		lockExpiry:    locking.expiry,
+		autosave:      0,
+		idleTimeout:   0,
+		history:       *history,
+		historyMaxAge: historyOpts.maxAge,
+		historyStore:  historyOpts.store,
+		backups:       *backups,
+		maxShrink:     defaultMaxShrinkVal,
+		minSize:       defaultMinSizeVal,
+		template:      initial,
+		gitMessage:    "",
+		plainName:     defaultPlainName(),
+		wait:          defaultWait(),
+
+		allowEmpty:    defaultAllowEmptyVal,
+		allowShrink:   defaultAllowShrinkVal,
+		armor:         *armored,
+		autoFilter:    false,
+		chdir:         defaultChdirVal,
+		confirmSave:   false,
+		force:         *force,
+		fsync:         defaultFsyncVal,
+		gitCommit:     false,
+		inhibitSleep:  false,
+		keepFormat:    !flag.Changed("armor") && !flag.Changed("binary"),
+		keepTemp:      false,
+		lock:          !*noLock,
+		lockKeys:      false,
+		notify:        false,
+		openBinary:    false,
+		park:          false,
+		preserveMtime: defaultPreserveMtimeVal,
+		readOnly:      false,
+		stay:          false,
+		supervise:     false,
+		tty:           false,
+		verbose:       false,
+		warnDroppings: false,
+		watch:         false,
+		yes:           defaultYesVal,
+
+		alsoSave: defaultAlsoSave(),
+		prefer:   *prefer,
+
+		saveSignals:  []string{"USR1"},
+		revertSignal: "",
+
+		command: flag.Arg(dash),
+		args:    flag.Args()[dash+1:],
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{level: 0, threads: 0, window: 0},
+
+		hooks: hookSet{},
+	}
+
+	//nolint:mnd
+	if dash == 1 {
+		cfg.encPath = flag.Arg(0)
+	} else if dash == 2 {
+		cfg.idsPath = flag.Arg(0)
+		cfg.encPath = flag.Arg(1)
+	}
+
+	if cfg.encPath == "" || (cfg.idsPath == "" && !agentAvailable()) {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file and an encrypted file")
+
+		return exitBadUsage
+	}
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			cfg.lockKeys = true
+		}
+	}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		cfg.decodeCmd = args[0]
+		cfg.decodeArgs = args[1:]
+	}
+
+	if *encode != "" {
+		args, err := shlex.Split(*encode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split encode command")
+
+			return exitBadUsage
+		}
+
+		cfg.encodeCmd = args[0]
+		cfg.encodeArgs = args[1:]
+	}
+
+	deps := []dependency{
+		{
+			role:    "command",
+			command: cfg.command,
+			hint:    "install it or fix the command after \"--\"",
+		},
+		decodeDependency(cfg.decodeCmd),
+		encodeDependency(cfg.encodeCmd),
+	}
+
+	if err := checkDependencies(deps...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	tempDir, err := edit(cfg)
+	if tempDir != "" {
+		defer removeTempDir(tempDir)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+
+		return exitError
+	}
+
+	return exitOK
+}
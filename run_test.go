@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test command is a shell script")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(plainPath, []byte("hello\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, _ := findSubcommand("run")
+	run := func(script string) int {
+		return runCommand(sub, []string{"-L", "-M", "-t", tempDir, idsPath, encPath, "--", "sh", "-c", script, "sh"})
+	}
+
+	if code := run(`echo changed >> "$1"`); code != exitOK {
+		t.Fatalf("runCommand() returned %d", code)
+	}
+
+	// A failing command's changes aren't saved.
+	if code := run(`echo discarded >> "$1"; exit 3`); code != 3 {
+		t.Errorf("runCommand() with a failing command returned %d", code)
+	}
+
+	var out bytes.Buffer
+
+	if err := decryptToWriter(encPath, &out, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "hello\nchanged\n" {
+		t.Errorf("the file contains %q", out.String())
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// s3DefaultRegion is the region of S3 when the environment doesn't set one.
+	s3DefaultRegion = "us-east-1"
+	// s3TimeLayout is the format of the time of a signed request.
+	s3TimeLayout = "20060102T150405Z"
+)
+
+// s3Credentials are the AWS access key that signs requests to S3.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// s3File is an encrypted object in an S3 bucket or in a bucket of a compatible service, like MinIO.
+// It is an httpFile whose requests are signed with AWS Signature Version 4:
+// S3 checks If-Match and If-None-Match on PUT like a WebDAV server does,
+// and a bucket with versioning keeps every version a session saves.
+type s3File struct {
+	*httpFile
+
+	bucket string
+	key    string
+}
+
+// newS3File returns the object of a URL like "s3://bucket/key".
+// The credentials, the region, and the endpoint of a compatible service come from
+// the environment variables and the credentials file that the AWS tools use.
+func newS3File(rawURL string) (*s3File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("URL %q doesn't name an object; use s3://bucket/key", rawURL)
+	}
+
+	creds, err := loadS3Credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	region := s3Region()
+
+	objectURL, err := s3ObjectURL(bucket, key, region, s3Endpoint())
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3File{
+		httpFile: &httpFile{
+			url: objectURL,
+			client: &http.Client{ //nolint:exhaustruct
+				Timeout:   httpTimeout,
+				Transport: &s3Signer{creds: creds, region: region, now: time.Now},
+			},
+			etag:   "",
+			exists: false,
+		},
+		bucket: bucket,
+		key:    key,
+	}, nil
+}
+
+func (s *s3File) name() string {
+	return path.Base(s.key)
+}
+
+func (s *s3File) String() string {
+	return "s3://" + s.bucket + "/" + s.key
+}
+
+// s3Region returns the region from AWS_REGION or AWS_DEFAULT_REGION.
+func s3Region() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+
+	return s3DefaultRegion
+}
+
+// s3Endpoint returns the endpoint of a service compatible with S3
+// from AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, or nothing for S3 itself.
+func s3Endpoint() string {
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(name); endpoint != "" {
+			return endpoint
+		}
+	}
+
+	return ""
+}
+
+// s3ObjectURL returns the HTTP URL of an object.
+// S3 gets the bucket in the host name unless the name has dots, which the certificate doesn't cover.
+// An endpoint of a compatible service gets the bucket in the path, which these services support.
+func s3ObjectURL(bucket, key, region, endpoint string) (*url.URL, error) {
+	u := &url.URL{Scheme: "https", Host: "s3." + region + ".amazonaws.com"} //nolint:exhaustruct
+	objectPath := "/" + bucket + "/" + key
+
+	switch {
+	case endpoint != "":
+		var err error
+
+		u, err = url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+
+		objectPath = strings.TrimSuffix(u.Path, "/") + objectPath
+
+	case !strings.Contains(bucket, "."):
+		u.Host = bucket + "." + u.Host
+		objectPath = "/" + key
+	}
+
+	u.Path = objectPath
+	u.RawPath = s3Escape(objectPath, true)
+
+	return u, nil
+}
+
+// loadS3Credentials reads the access key from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+// or from the profile in AWS_PROFILE (default "default") of the credentials file.
+func loadS3Credentials() (s3Credentials, error) {
+	creds := s3Credentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if creds.accessKeyID != "" && creds.secretAccessKey != "" {
+		return creds, nil
+	}
+
+	credsPath := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credsPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return creds, err
+		}
+
+		credsPath = filepath.Join(home, ".aws", "credentials")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	file, err := os.Open(credsPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return creds, err
+	}
+
+	if err == nil {
+		defer file.Close()
+
+		creds, err = parseS3Credentials(file, profile)
+		if err != nil {
+			return creds, fmt.Errorf("failed to read %q: %w", credsPath, err)
+		}
+	}
+
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return creds, fmt.Errorf("no AWS credentials; set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or add profile %q to %q", profile, credsPath)
+	}
+
+	return creds, nil
+}
+
+// parseS3Credentials reads the keys of a profile from a credentials file in the INI format of the AWS tools.
+func parseS3Credentials(r io.Reader, profile string) (s3Credentials, error) {
+	creds := s3Credentials{accessKeyID: "", secretAccessKey: "", sessionToken: ""}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "aws_access_key_id":
+			creds.accessKeyID = value
+
+		case "aws_secret_access_key":
+			creds.secretAccessKey = value
+
+		case "aws_session_token":
+			creds.sessionToken = value
+		}
+	}
+
+	return creds, scanner.Err()
+}
+
+// s3Signer is a transport that signs requests with AWS Signature Version 4.
+type s3Signer struct {
+	creds  s3Credentials
+	region string
+	now    func() time.Time
+}
+
+func (s *s3Signer) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	payload := []byte{}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = io.ReadAll(body)
+		body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.sign(req, payload)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// sign adds the signature of a request to its headers.
+// Every header the request has is signed, except for User-Agent,
+// which proxies may change.
+func (s *s3Signer) sign(req *http.Request, payload []byte) {
+	payloadSum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(payloadSum[:])
+	stamp := s.now().UTC().Format(s3TimeLayout)
+	date := stamp[:8]
+
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if s.creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.creds.sessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" || name == "user-agent" {
+			continue
+		}
+
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := []byte("AWS4" + s.creds.secretAccessKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		s.creds.accessKeyID,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+// s3CanonicalQuery returns the query of a request sorted and escaped for signing.
+func s3CanonicalQuery(query url.Values) string {
+	pairs := []string{}
+
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes everything but the unreserved characters of RFC 3986 like AWS does.
+// Slashes stay in a path.
+func s3Escape(s string, path bool) string {
+	var sb strings.Builder
+
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', path && b == '/':
+			sb.WriteByte(b)
+
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+
+	return sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	exitError    = 1
+	exitBadUsage = 2
+	filePerm     = 0o644
+	manFile      = "age-edit.1"
+)
+
+var (
+	envVarRe  = regexp.MustCompile(`\b(?:AGE_EDIT_[A-Z_]+|EDITOR|PAGER|VISUAL)\b`)
+	itemRe    = regexp.MustCompile(`^  (\S+)\s{2,}(.*)$`)
+	optionRe  = regexp.MustCompile(`^  (?:(-\S), )?\s*(--\S+)(?: (\S+))?\s{2,}(.*)$`)
+	sectionRe = regexp.MustCompile(`^(Arguments|Commands|Options):$`)
+)
+
+// help is the parsed help message of age-edit or one of its commands.
+type help struct {
+	usage       []string
+	description []string
+	arguments   [][2]string
+	commands    [][2]string
+	options     []option
+}
+
+type option struct {
+	short string
+	long  string
+	value string
+	usage string
+}
+
+// envVar is an environment variable and where it is documented.
+type envVar struct {
+	name  string
+	where []string
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s age-edit-binary\n", filepath.Base(os.Args[0]))
+		os.Exit(exitBadUsage)
+	}
+
+	binary := os.Args[1]
+
+	version, err := run(binary, "--version")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get version: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	mainHelp, err := readHelp(binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get help: %v\n", err)
+		os.Exit(exitError)
+	}
+
+	commandHelps := make([]help, 0, len(mainHelp.commands))
+
+	for _, command := range mainHelp.commands {
+		commandHelp, err := readHelp(binary, command[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get help for %q: %v\n", command[0], err)
+			os.Exit(exitError)
+		}
+
+		commandHelps = append(commandHelps, commandHelp)
+	}
+
+	page := render(strings.TrimSpace(version), mainHelp, commandHelps)
+
+	if err := os.WriteFile(manFile, []byte(page), filePerm); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %q: %v\n", manFile, err)
+		os.Exit(exitError)
+	}
+}
+
+// run runs age-edit without the environment variables that change the defaults in the help.
+func run(binary string, args ...string) (string, error) {
+	cmd := exec.Command(binary, args...)
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "AGE_EDIT_") || slices.Contains([]string{"EDITOR", "PAGER", "VISUAL"}, name) {
+			continue
+		}
+
+		cmd.Env = append(cmd.Env, kv)
+	}
+
+	output, err := cmd.CombinedOutput()
+
+	return string(output), err
+}
+
+func readHelp(binary string, command ...string) (help, error) {
+	output, err := run(binary, append(command, "--help")...)
+	if err != nil {
+		return help{}, err
+	}
+
+	return parseHelp(output), nil
+}
+
+// parseHelp splits a help message into sections.
+// Paragraphs outside the sections form the description.
+func parseHelp(text string) help {
+	h := help{}
+	section := "Usage"
+
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		switch {
+		case line == "":
+			section = ""
+
+		case sectionRe.MatchString(line):
+			section = strings.TrimSuffix(line, ":")
+
+		case section == "Usage":
+			h.usage = append(h.usage, strings.TrimSpace(strings.TrimPrefix(line, "Usage:")))
+
+		case section == "Arguments" || section == "Commands":
+			match := itemRe.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			item := [2]string{match[1], match[2]}
+
+			if section == "Arguments" {
+				h.arguments = append(h.arguments, item)
+			} else {
+				h.commands = append(h.commands, item)
+			}
+
+		case section == "Options":
+			match := optionRe.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			h.options = append(h.options, option{
+				short: match[1],
+				long:  match[2],
+				value: match[3],
+				usage: match[4],
+			})
+
+		default:
+			h.description = append(h.description, line)
+		}
+	}
+
+	return h
+}
+
+// escape escapes text for roff.
+func escape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+
+	return s
+}
+
+// renderSynopsis renders usage lines with the program name and the command in bold.
+func renderSynopsis(sb *strings.Builder, usage []string, command string) {
+	name := "age-edit"
+	if command != "" {
+		name += " " + command
+	}
+
+	for _, line := range usage {
+		fields := strings.Fields(line)
+		rest := fields[min(len(fields), len(strings.Fields(name))):]
+
+		fmt.Fprintf(sb, ".B %s\n%s\n.br\n", escape(name), escape(strings.Join(rest, " ")))
+	}
+}
+
+func renderDescription(sb *strings.Builder, description []string) {
+	for i, paragraph := range description {
+		if i > 0 {
+			sb.WriteString(".PP\n")
+		}
+
+		sb.WriteString(escape(paragraph) + "\n")
+	}
+}
+
+func renderItems(sb *strings.Builder, items [][2]string) {
+	for _, item := range items {
+		fmt.Fprintf(sb, ".TP\n.I %s\n%s\n", escape(item[0]), escape(item[1]))
+	}
+}
+
+func renderOptions(sb *strings.Builder, options []option) {
+	for _, opt := range options {
+		sb.WriteString(".TP\n")
+
+		if opt.short != "" {
+			fmt.Fprintf(sb, `\fB%s\fR, `, escape(opt.short))
+		}
+
+		fmt.Fprintf(sb, `\fB%s\fR`, escape(opt.long))
+
+		if opt.value != "" {
+			fmt.Fprintf(sb, ` \fI%s\fR`, escape(opt.value))
+		}
+
+		fmt.Fprintf(sb, "\n%s\n", escape(opt.usage))
+	}
+}
+
+// collectEnvVars finds the environment variables in the help messages
+// and where they are documented as roff text.
+// A variable documented for age-edit itself only refers to that place.
+func collectEnvVars(mainHelp help, commandHelps []help) []envVar {
+	found := map[string]*envVar{}
+	inMain := map[string]bool{}
+	order := []string{}
+
+	add := func(text, where, command string) {
+		for _, name := range envVarRe.FindAllString(text, -1) {
+			if _, ok := found[name]; !ok {
+				found[name] = &envVar{name: name, where: []string{}}
+				order = append(order, name)
+			}
+
+			if command == "" {
+				inMain[name] = true
+			} else if inMain[name] {
+				continue
+			}
+
+			if !slices.Contains(found[name].where, where) {
+				found[name].where = append(found[name].where, where)
+			}
+		}
+	}
+
+	scan := func(h help, command string) {
+		prefix := ""
+		if command != "" {
+			prefix = `\fB` + escape(command) + `\fR `
+		}
+
+		for _, arg := range h.arguments {
+			add(arg[1], prefix+`\fI`+escape(arg[0])+`\fR`, command)
+		}
+
+		for _, opt := range h.options {
+			add(opt.usage, prefix+`\fB`+escape(opt.long)+`\fR`, command)
+		}
+
+		for _, paragraph := range h.description {
+			if command == "" {
+				add(paragraph, "DESCRIPTION", command)
+			} else {
+				add(paragraph, `\fB`+escape(command)+`\fR`, command)
+			}
+		}
+	}
+
+	scan(mainHelp, "")
+
+	for i, command := range mainHelp.commands {
+		scan(commandHelps[i], command[0])
+	}
+
+	slices.Sort(order)
+
+	envVars := make([]envVar, 0, len(order))
+	for _, name := range order {
+		envVars = append(envVars, *found[name])
+	}
+
+	return envVars
+}
+
+func render(version string, mainHelp help, commandHelps []help) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, ".TH AGE\\-EDIT 1 \"\" \"age\\-edit %s\" \"User Commands\"\n", escape(version))
+	sb.WriteString(".SH NAME\nage\\-edit \\- edit an age\\-encrypted file\n")
+
+	sb.WriteString(".SH SYNOPSIS\n")
+	renderSynopsis(&sb, mainHelp.usage, "")
+
+	sb.WriteString(".SH DESCRIPTION\n")
+	renderDescription(&sb, mainHelp.description)
+
+	sb.WriteString(".SH ARGUMENTS\n")
+	renderItems(&sb, mainHelp.arguments)
+
+	sb.WriteString(".SH OPTIONS\n")
+	renderOptions(&sb, mainHelp.options)
+
+	sb.WriteString(".SH COMMANDS\n")
+
+	for i, command := range mainHelp.commands {
+		h := commandHelps[i]
+
+		fmt.Fprintf(&sb, ".SS %s\n", escape(command[0]))
+		renderSynopsis(&sb, h.usage, command[0])
+		sb.WriteString(".PP\n")
+		renderDescription(&sb, h.description)
+		renderItems(&sb, h.arguments)
+		renderOptions(&sb, h.options)
+	}
+
+	sb.WriteString(".SH ENVIRONMENT\n")
+
+	for _, v := range collectEnvVars(mainHelp, commandHelps) {
+		fmt.Fprintf(&sb, ".TP\n.B %s\nSee %s.\n", escape(v.name), strings.Join(v.where, ", "))
+	}
+
+	sb.WriteString(".SH EXIT STATUS\n")
+	fmt.Fprintf(&sb, ".TP\n.B 0\nSuccess.\n.TP\n.B %d\nAn error.\n.TP\n.B %d\nA usage error.\n", exitError, exitBadUsage)
+
+	sb.WriteString(".SH SEE ALSO\n.BR age (1),\n.BR age\\-keygen (1)\n")
+
+	return sb.String()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	encryptedEnvVar     = "AGE_EDIT_ENCRYPTED"
+	plaintextEnvVar     = "AGE_EDIT_PLAINTEXT"
+	revertTriggerEnvVar = "AGE_EDIT_REVERT_TRIGGER"
+	saveTriggerEnvVar   = "AGE_EDIT_SAVE_TRIGGER"
+	sessionIDEnvVar     = "AGE_EDIT_SESSION_ID"
+)
+
+// filterEnv has the variables that runFilter adds to the environment of the decode and encode filters.
+// The filters of a file in an editing session see the session of the file.
+var filterEnv struct {
+	sync.Mutex
+
+	env []string
+}
+
+// sessionEnv describes an editing session to the editor and the filters.
+// Several paths are separated like in PATH.
+// The session ID is the name of the temporary directory of the session.
+func sessionEnv(tempDir string, readOnly bool, plaintexts, encrypted []string) []string {
+	separator := string(os.PathListSeparator)
+
+	return []string{
+		encryptedEnvVar + "=" + strings.Join(encrypted, separator),
+		plaintextEnvVar + "=" + strings.Join(plaintexts, separator),
+		readOnlyEnvVar + "=" + strconv.FormatBool(readOnly),
+		revertTriggerEnvVar + "=" + filepath.Join(tempDir, revertTriggerName),
+		saveTriggerEnvVar + "=" + filepath.Join(tempDir, saveTriggerName),
+		sessionIDEnvVar + "=" + filepath.Base(tempDir),
+	}
+}
+
+// setFilterEnv sets the variables for the filters that run next.
+func setFilterEnv(env []string) {
+	filterEnv.Lock()
+	defer filterEnv.Unlock()
+
+	filterEnv.env = env
+}
+
+// currentFilterEnv returns the variables for a filter.
+func currentFilterEnv() []string {
+	filterEnv.Lock()
+	defer filterEnv.Unlock()
+
+	return filterEnv.env
+}
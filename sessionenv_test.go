@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// The test isn't parallel because the environment of the filters is shared by the process.
+func TestSessionEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor and filter are shell scripts")
+	}
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+
+	editTempDir, err := edit(config{
+		idsPath:       idsPath,
+		encPath:       encPath,
+		tempDirPrefix: t.TempDir(),
+		yes:           true,
+
+		command: "sh",
+		args:    []string{"-c", `printf '%s\n' "$AGE_EDIT_ENCRYPTED" "$AGE_EDIT_READ_ONLY" "$AGE_EDIT_SESSION_ID" >> "$1"`, "sh"},
+
+		encodeCmd:  "sh",
+		encodeArgs: []string{"-c", `cat; printf '%s\n' "$AGE_EDIT_PLAINTEXT"`},
+	})
+	if editTempDir != "" {
+		defer os.RemoveAll(editTempDir)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := decryptToWriter(encPath, &plaintext, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(plaintext.String()), "\n")
+	expected := []string{
+		encPath,
+		"false",
+		filepath.Base(editTempDir),
+		filepath.Join(editTempDir, "secret.txt"),
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d: expected %q, got %q", i+1, expected[i], lines[i])
+		}
+	}
+
+	if env := currentFilterEnv(); len(env) > 0 {
+		t.Errorf("the session left the filter environment %q", env)
+	}
+}
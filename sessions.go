@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofrs/flock"
+	"golang.org/x/term"
+)
+
+const (
+	sessionsFileName = "sessions.json"
+	sessionsLockName = "sessions.lock"
+)
+
+// session is a running edit recorded in the per-user state file.
+type session struct {
+	PID     int       `json:"pid"`
+	File    string    `json:"file"`
+	Started time.Time `json:"started"`
+	TempDir string    `json:"temp_dir"`
+	TTY     string    `json:"tty,omitempty"`
+}
+
+// updateSessions reads the state file, drops the sessions of processes that have exited,
+// applies update, and writes the result back.
+// A lock next to the state file serializes concurrent updates.
+// It returns the updated sessions.
+func updateSessions(update func([]session) []session) ([]session, error) {
+	dir, err := userRuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, tempDirPerm); err != nil {
+		return nil, err
+	}
+
+	lock := flock.New(filepath.Join(dir, sessionsLockName))
+	if err := lock.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock sessions: %w", err)
+	}
+
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	path := filepath.Join(dir, sessionsFileName)
+	sessions := []session{}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+		}
+	}
+
+	sessions = slices.DeleteFunc(sessions, func(s session) bool {
+		return !processAlive(s.PID)
+	})
+	sessions = update(sessions)
+
+	return sessions, writeFileAtomic(path, filePerm, true, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(sessions)
+	})
+}
+
+// registerSession records an edit of a file in the state file.
+// It returns a function that removes the record.
+func registerSession(encPath, tempDir string) (func() error, error) {
+	absPath, err := filepath.Abs(encPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := session{
+		PID:     os.Getpid(),
+		File:    absPath,
+		Started: time.Now(),
+		TempDir: tempDir,
+		TTY:     ttyName(),
+	}
+
+	if _, err := updateSessions(func(sessions []session) []session {
+		return append(sessions, s)
+	}); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		_, err := updateSessions(func(sessions []session) []session {
+			return slices.DeleteFunc(sessions, func(other session) bool {
+				return other.PID == s.PID && other.TempDir == s.TempDir
+			})
+		})
+
+		return err
+	}, nil
+}
+
+// ttyName returns the terminal on standard input where the system reveals it, like on Linux.
+func ttyName() string {
+	if !term.IsTerminal(int(os.Stdin.Fd())) { //nolint:gosec
+		return ""
+	}
+
+	name, err := os.Readlink("/proc/self/fd/0")
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
+
+// sessionsCommand implements the "sessions" subcommand.
+func sessionsCommand(sub subcommand, args []string) int {
+	flag := sub.flagSet(
+		"List the running edits of this user: the process ID, the start time, the terminal where the system reveals it, the encrypted file, and the temporary directory with the plaintext. Sessions of processes that have exited are forgotten.",
+		"",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	sessions, err := updateSessions(func(sessions []session) []session {
+		return sessions
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+
+	fmt.Fprintln(w, "PID\tSTARTED\tTTY\tFILE\tTEMP DIR")
+
+	for _, s := range sessions {
+		tty := s.TTY
+		if tty == "" {
+			tty = "-"
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			strconv.Itoa(s.PID),
+			s.Started.Format(time.DateTime),
+			tty,
+			s.File,
+			s.TempDir,
+		)
+	}
+
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
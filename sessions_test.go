@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	unregister, err := registerSession("secret.age", "/tmp/age-edit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A session of a process that has exited.
+	stale := session{PID: 1<<31 - 1, File: "/stale.age", Started: time.Now(), TempDir: "/tmp/stale", TTY: ""}
+
+	sessions, err := updateSessions(func(sessions []session) []session {
+		return append(sessions, stale)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	sessions, err = updateSessions(func(sessions []session) []session {
+		return sessions
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 1 {
+		t.Fatalf("expected the stale session to be dropped, got %v", sessions)
+	}
+
+	absPath, err := filepath.Abs("secret.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := sessions[0]; s.PID != os.Getpid() || s.File != absPath || s.TempDir != "/tmp/age-edit-test" {
+		t.Errorf("unexpected session: %+v", s)
+	}
+
+	if err := unregister(); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err = updateSessions(func(sessions []session) []session {
+		return sessions
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 0 {
+		t.Errorf("expected no sessions, got %v", sessions)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/anmitsu/go-shlex"
+	"github.com/spf13/pflag"
+)
+
+// shellCommand returns the command that runs a command line with the shell of the user:
+// $SHELL or sh on Unix and %ComSpec% or cmd on Windows.
+func shellCommand(goos, line string) (string, []string) {
+	if goos == "windows" {
+		shell := os.Getenv("ComSpec")
+		if shell == "" {
+			shell = "cmd"
+		}
+
+		return shell, []string{"/C", line}
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "sh"
+	}
+
+	return shell, []string{"-c", line}
+}
+
+// pickFilter chooses between a filter command and a shell command line for the same filter.
+// An option overrides the environment variable of the other setting;
+// two options or two environment variables are an error.
+// It returns the command and its arguments or an empty command for no filter.
+func pickFilter(flag *pflag.FlagSet, name, shellName, value, shellValue string) (string, []string, error) {
+	if value != "" && shellValue != "" {
+		switch {
+		case flag.Changed(shellName) && !flag.Changed(name):
+			value = ""
+
+		case flag.Changed(name) && !flag.Changed(shellName):
+			shellValue = ""
+
+		default:
+			return "", nil, fmt.Errorf("--%s and --%s are mutually exclusive", name, shellName)
+		}
+	}
+
+	if shellValue != "" {
+		command, args := shellCommand(runtime.GOOS, shellValue)
+
+		return command, args, nil
+	}
+
+	if value == "" {
+		return "", []string{}, nil
+	}
+
+	args, err := shlex.Split(value, true)
+	if err != nil || len(args) == 0 {
+		return "", nil, fmt.Errorf("failed to split %s command", name)
+	}
+
+	return args[0], args[1:], nil
+}
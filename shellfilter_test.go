@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestShellFilter(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the pipeline needs a POSIX shell")
+	}
+
+	command, args := shellCommand(runtime.GOOS, "tr a-z A-Z | tr -d E")
+
+	var out bytes.Buffer
+
+	if err := runFilter(command, args, strings.NewReader("secret\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.String() != "SCRT\n" {
+		t.Errorf("expected the output of the pipeline, got %q", out.String())
+	}
+
+	if command, args := shellCommand("windows", "a | b"); !slices.Equal(args, []string{"/C", "a | b"}) {
+		t.Errorf("unexpected Windows shell command %q %q", command, args)
+	}
+}
+
+func TestPickFilter(t *testing.T) {
+	t.Parallel()
+
+	newFlags := func(args ...string) *pflag.FlagSet {
+		flag := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flag.String("decode", "", "")
+		flag.String("decode-shell", "", "")
+
+		if err := flag.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+
+		return flag
+	}
+
+	command, args, err := pickFilter(newFlags(), "decode", "decode-shell", "gzip -d", "")
+	if err != nil || command != "gzip" || !slices.Equal(args, []string{"-d"}) {
+		t.Errorf("unexpected filter %q %q: %v", command, args, err)
+	}
+
+	// The option overrides the environment variable of the other setting.
+	command, args, err = pickFilter(newFlags("--decode-shell", "gzip -d | cat"), "decode", "decode-shell", "gzip -d", "gzip -d | cat")
+	if err != nil || args[len(args)-1] != "gzip -d | cat" {
+		t.Errorf("expected the shell filter, got %q %q: %v", command, args, err)
+	}
+
+	if _, _, err := pickFilter(newFlags(), "decode", "decode-shell", "gzip -d", "gzip -d | cat"); err == nil {
+		t.Error("expected an error for both settings")
+	}
+
+	command, _, err = pickFilter(newFlags(), "decode", "decode-shell", "", "")
+	if err != nil || command != "" {
+		t.Errorf("expected no filter, got %q: %v", command, err)
+	}
+}
@@ -2,8 +2,57 @@
 
 package main
 
+import (
+	"os"
+	"os/signal"
+)
+
+// checkSignals accepts any names on non-POSIX systems, which ignore the signals.
+func checkSignals(saveNames []string, revertName string) error {
+	return nil
+}
+
 // handleSignals is a no-op on non-POSIX systems where signal handling is not implemented.
 // It returns a function that does nothing.
-func handleSignals(save func() error) func() {
+func handleSignals(saveNames []string, revertName string, save, revert func() error) func() {
+	return func() {}
+}
+
+// handleSuspend is a no-op on non-POSIX systems, which don't suspend processes with a signal.
+func handleSuspend(park func() func()) func() {
 	return func() {}
 }
+
+// handleTermination calls the exit function on an interrupt, like Ctrl-C.
+// It returns a stop function that should be called to clean up the signal handler.
+func handleTermination(exit func(sig os.Signal)) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+
+	go func() {
+		for sig := range c {
+			exit(sig)
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
+
+// sendSaveSignal asks the session with a temporary directory to save with a trigger file
+// on non-POSIX systems where signal handling is not implemented.
+func sendSaveSignal(tempDir string) error {
+	return requestSave(tempDir)
+}
+
+// terminateProcessGroup stops a process on systems without process groups.
+func terminateProcessGroup(p *os.Process) error {
+	return terminateProcess(p)
+}
+
+// terminateProcess stops a process on systems without SIGTERM.
+func terminateProcess(p *os.Process) error {
+	return p.Kill() //nolint:wrapcheck
+}
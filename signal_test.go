@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
@@ -54,7 +55,7 @@ func TestSignalSave(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := encryptToFile(plainFilePath, encFilePath, true, "", []string{}, identity.Recipient()); err != nil {
+	if err := encryptToFile(plainFilePath, encFilePath, true, true, "", []string{}, identity.Recipient()); err != nil {
 		t.Fatal(err)
 	}
 
@@ -141,3 +142,106 @@ func TestSignalSave(t *testing.T) {
 		t.Error("Final save did not contain phase2")
 	}
 }
+
+func TestSignalTerminate(t *testing.T) {
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idFilePath := filepath.Join(tempDir, "id")
+	if err := os.WriteFile(idFilePath, []byte(identity.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The editor saves its change and then waits to be closed.
+	editorPath := filepath.Join(tempDir, "editor")
+	if err := os.WriteFile(editorPath, []byte("#!/bin/sh\necho terminated > \"$1\"\nexec sleep 30\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	ageEditPath := filepath.Join(tempDir, "age-edit")
+	if err := exec.Command("go", "build", "-o", ageEditPath, ".").Run(); err != nil {
+		t.Fatalf("failed to build age-edit binary: %v", err)
+	}
+
+	for _, sig := range []os.Signal{os.Interrupt, syscall.SIGHUP} {
+		t.Run(sig.String(), func(t *testing.T) {
+			sessionDir := filepath.Join(tempDir, "sessions")
+			encFilePath := filepath.Join(tempDir, sig.String()+".age")
+
+			cmd := exec.Command(
+				ageEditPath,
+				"--editor", editorPath,
+				"--no-memlock",
+				"--temp-dir", sessionDir,
+				"--yes",
+				idFilePath,
+				encFilePath,
+			)
+			cmd.Stderr = os.Stderr
+
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Wait for the editor to write the plaintext.
+			written := false
+			for i := 0; i < 100 && !written; i++ {
+				time.Sleep(50 * time.Millisecond)
+
+				_ = filepath.WalkDir(sessionDir, func(path string, d os.DirEntry, err error) error {
+					if err == nil && !d.IsDir() {
+						content, _ := os.ReadFile(path)
+						written = written || bytes.Contains(content, []byte("terminated"))
+					}
+
+					return nil
+				})
+			}
+
+			if !written {
+				t.Fatal("the editor didn't write the temporary file")
+			}
+
+			if err := cmd.Process.Signal(sig); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+
+			if err := cmd.Wait(); err == nil {
+				t.Errorf("expected age-edit to fail after %v", sig)
+			}
+
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("age-edit took %v to exit", elapsed)
+			}
+
+			// No plaintext is left behind.
+			_ = filepath.WalkDir(sessionDir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					t.Errorf("%q is left behind", path)
+				}
+
+				return nil
+			})
+
+			decFilePath := filepath.Join(tempDir, "dec")
+			if err := decryptToFile(encFilePath, decFilePath, "", []string{}, identity); err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(decFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Contains(content, []byte("terminated")) {
+				t.Errorf("the change wasn't saved: %q", content)
+			}
+		})
+	}
+}
@@ -6,19 +6,86 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 
 	"golang.org/x/sys/unix"
 )
 
-// handleSignals sets up a signal handler for SIGUSR1.
-// The handler calls the save function when the signal is received.
+// parseSignal returns the signal with a name like "USR1" or "SIGUSR1".
+// Signals that can't be caught or that age-edit handles otherwise are refused.
+func parseSignal(name string) (os.Signal, error) {
+	sig := unix.SignalNum("SIG" + strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG"))
+	if sig == 0 {
+		return nil, fmt.Errorf("unknown signal %q", name)
+	}
+
+	switch sig { //nolint:exhaustive
+	case unix.SIGCONT, unix.SIGHUP, unix.SIGINT, unix.SIGKILL, unix.SIGSTOP, unix.SIGTERM, unix.SIGTSTP:
+		return nil, fmt.Errorf("signal %q can't save or revert", name)
+	}
+
+	return sig, nil
+}
+
+// checkSignals checks the names of the signals that save and the signal that reverts.
+// An empty revert signal turns reverting off.
+func checkSignals(saveNames []string, revertName string) error {
+	saves := map[os.Signal]bool{}
+
+	for _, name := range saveNames {
+		sig, err := parseSignal(name)
+		if err != nil {
+			return err
+		}
+
+		saves[sig] = true
+	}
+
+	if revertName == "" {
+		return nil
+	}
+
+	sig, err := parseSignal(revertName)
+	if err != nil {
+		return err
+	}
+
+	if saves[sig] {
+		return fmt.Errorf("signal %q can't both save and revert", revertName)
+	}
+
+	return nil
+}
+
+// handleSignals sets up a signal handler for the signals that save and revert.
+// The handler calls the save function when a save signal is received
+// and the revert function when the revert signal is received.
+// Signals with bad names are ignored; check them with checkSignals first.
 // It returns a stop function that should be called to clean up the signal handler.
-func handleSignals(save func() error) func() {
+func handleSignals(saveNames []string, revertName string, save, revert func() error) func() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, unix.SIGUSR1)
+
+	for _, name := range saveNames {
+		if sig, err := parseSignal(name); err == nil {
+			signal.Notify(c, sig)
+		}
+	}
+
+	revertSig, err := parseSignal(revertName)
+	if revertName != "" && err == nil {
+		signal.Notify(c, revertSig)
+	}
 
 	go func() {
-		for range c {
+		for sig := range c {
+			if sig == revertSig {
+				if err := revert(); err != nil {
+					fmt.Fprintf(os.Stderr, "\r\007age-edit: reverting failed: %v\n", err)
+				}
+
+				continue
+			}
+
 			if err := save(); err != nil {
 				fmt.Fprintf(os.Stderr, "\r\007age-edit: saving failed: %v\n", err)
 			}
@@ -30,3 +97,77 @@ func handleSignals(save func() error) func() {
 		close(c)
 	}
 }
+
+// handleSuspend parks the session when it is suspended with SIGTSTP, like with Ctrl-Z.
+// The park function is called before the process stops,
+// and the function it returns is called when the process continues.
+// It returns a stop function that should be called to clean up the signal handler.
+func handleSuspend(park func() func()) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, unix.SIGTSTP)
+
+	go func() {
+		for range c {
+			unpark := park()
+
+			// SIGSTOP can't be caught, so the process stops like it would have without the handler.
+			// The kill returns after SIGCONT.
+			_ = unix.Kill(os.Getpid(), unix.SIGSTOP)
+
+			unpark()
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
+
+// handleTermination calls the exit function when the process is asked to exit with SIGTERM or SIGINT
+// or loses its terminal with SIGHUP.
+// The exit function shouldn't return.
+// It returns a stop function that should be called to clean up the signal handler.
+func handleTermination(exit func(sig os.Signal)) func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, unix.SIGTERM, unix.SIGINT, unix.SIGHUP)
+
+	go func() {
+		for sig := range c {
+			exit(sig)
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
+
+// sendSaveSignal asks the current process to save the file being edited.
+// The signal reaches the session without its temporary directory.
+func sendSaveSignal(_ string) error {
+	return unix.Kill(os.Getpid(), unix.SIGUSR1) //nolint:wrapcheck
+}
+
+// terminateProcessGroup asks a process and the rest of its process group to exit.
+// A process in the group of age-edit only gets the signal itself,
+// so the shell or the script that started age-edit doesn't.
+func terminateProcessGroup(p *os.Process) error {
+	pgid, err := unix.Getpgid(p.Pid)
+	if err != nil {
+		return terminateProcess(p)
+	}
+
+	ownPGID, err := unix.Getpgid(os.Getpid())
+	if err != nil || pgid == ownPGID {
+		return terminateProcess(p)
+	}
+
+	return unix.Kill(-pgid, unix.SIGTERM) //nolint:wrapcheck
+}
+
+// terminateProcess asks a process to exit.
+func terminateProcess(p *os.Process) error {
+	return p.Signal(unix.SIGTERM) //nolint:wrapcheck
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// promptReopen asks whether to open the editor again in a session kept open with --stay.
+// The changes are saved before the prompt, and the plaintext stays in the temporary directory.
+// An empty line reopens the editor; "q" or the end of input ends the session.
+func promptReopen(r *bufio.Reader, w io.Writer, encPath string) bool {
+	for {
+		fmt.Fprintf(w, "Session for %q is open. Press <Enter> to edit again or \"q\" and <Enter> to end it: ", encPath)
+
+		line, err := r.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+
+		switch {
+		case answer == "q" || answer == "quit":
+			return false
+
+		case err != nil:
+			fmt.Fprintln(w)
+
+			return false
+
+		case answer == "":
+			return true
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPromptReopen(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"\n", true},
+		{"  \n", true},
+		{"q\n", false},
+		{"Quit\n", false},
+		{"", false},
+		{"x\n\n", true},
+		{"x\nq\n", false},
+		{"q", false},
+	}
+
+	for _, test := range tests {
+		r := bufio.NewReader(strings.NewReader(test.input))
+
+		if got := promptReopen(r, io.Discard, "secret.age"); got != test.want {
+			t.Errorf("%q: expected %v, got %v", test.input, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	suffixesEnvVar = "AGE_EDIT_SUFFIXES"
+	defaultSuffix  = ".age"
+)
+
+// suffixRule says how to name the plaintext of an encrypted file with a suffix.
+// The suffix is removed, and the replacement, if any, is added,
+// so a rule like ".asc=.txt" gives the temporary file an extension that editors recognize.
+type suffixRule struct {
+	suffix      string
+	replacement string
+}
+
+// suffixRules returns the rules from AGE_EDIT_SUFFIXES with the longest suffix first.
+// The variable is a comma-separated list of suffixes, each optionally followed by "=" and a replacement.
+// Entries without a suffix are ignored.
+func suffixRules() []suffixRule {
+	rules := []suffixRule{}
+
+	for _, entry := range strings.Split(os.Getenv(suffixesEnvVar), ",") {
+		suffix, replacement, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if suffix == "" {
+			continue
+		}
+
+		rules = append(rules, suffixRule{suffix: suffix, replacement: replacement})
+	}
+
+	if len(rules) == 0 {
+		return []suffixRule{{suffix: defaultSuffix, replacement: ""}}
+	}
+
+	slices.SortStableFunc(rules, func(a, b suffixRule) int {
+		return cmp.Compare(len(b.suffix), len(a.suffix))
+	})
+
+	return rules
+}
+
+// matchSuffix returns the rule for the suffix of a path.
+func matchSuffix(path string) (suffixRule, bool) {
+	for _, rule := range suffixRules() {
+		if strings.HasSuffix(path, rule.suffix) {
+			return rule, true
+		}
+	}
+
+	return suffixRule{suffix: "", replacement: ""}, false
+}
+
+// hasEncryptedSuffix reports whether a path has the suffix of an encrypted file.
+func hasEncryptedSuffix(path string) bool {
+	_, ok := matchSuffix(path)
+
+	return ok
+}
+
+// getRoot removes the encrypted file suffix from a path if present.
+// It applies the replacement of the suffix rule, so the result is the name of the plaintext.
+func getRoot(path string) string {
+	rule, ok := matchSuffix(path)
+	if !ok {
+		return path
+	}
+
+	return strings.TrimSuffix(path, rule.suffix) + rule.replacement
+}
+
+// plaintextName returns the file name of the decrypted temporary file.
+// An archive keeps its ".tar" suffix, so its tree can be named without it.
+func plaintextName(cfg config) string {
+	if cfg.plainName == "" {
+		return filepath.Base(getRoot(cfg.encPath))
+	}
+
+	if isArchive(cfg.encPath) && !strings.HasSuffix(cfg.plainName, archiveSuffix) {
+		return cfg.plainName + archiveSuffix
+	}
+
+	return cfg.plainName
+}
+
+// checkPlainName confirms that a name for the temporary file is a file name without a directory.
+func checkPlainName(name string) error {
+	if name != "" && (name != filepath.Base(name) || name == "." || name == "..") {
+		return fmt.Errorf("plain name %q must be a file name without a directory", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestGetRootSuffixes(t *testing.T) {
+	t.Setenv(suffixesEnvVar, ".age, .enc=, .asc=.txt,=.md, .tar.asc=.tar")
+
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"file.txt.age", "file.txt", true},
+		{"secrets.yaml.enc", "secrets.yaml", true},
+		{"notes.asc", "notes.txt", true},
+		{"dir.tar.asc", "dir.tar", true},
+		{"example.odt", "example.odt", false},
+		{"file.md", "file.md", false},
+	}
+
+	for _, tt := range tests {
+		if result := getRoot(tt.input); result != tt.expected {
+			t.Errorf("getRoot(%q) is %q, expected %q", tt.input, result, tt.expected)
+		}
+
+		if ok := hasEncryptedSuffix(tt.input); ok != tt.ok {
+			t.Errorf("hasEncryptedSuffix(%q) is %v, expected %v", tt.input, ok, tt.ok)
+		}
+	}
+}
+
+func TestPlainName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		encPath   string
+		plainName string
+		expected  string
+	}{
+		{"dir/prod.age", "", "prod"},
+		{"dir/prod.age", "secrets.yaml", "secrets.yaml"},
+		{"dir/certs.tar.age", "", "certs.tar"},
+		{"dir/certs.tar.age", "certs", "certs.tar"},
+	}
+
+	for _, tt := range tests {
+		cfg := config{encPath: tt.encPath, plainName: tt.plainName}
+
+		if result := plaintextName(cfg); result != tt.expected {
+			t.Errorf("plaintextName(%q, %q) is %q, expected %q", tt.encPath, tt.plainName, result, tt.expected)
+		}
+	}
+
+	for _, name := range []string{"../secrets.yaml", "dir/secrets.yaml", ".", ".."} {
+		if err := checkPlainName(name); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+)
+
+// supervisorArg is the hidden first argument that runs age-edit as the supervisor of a temporary directory.
+const supervisorArg = "--supervise-temp-dir"
+
+var (
+	// supervisorPipes stay open until age-edit exits; their supervisors act when they close.
+	supervisorPipes   []io.WriteCloser
+	supervisorPipesMu sync.Mutex
+)
+
+// startSupervisor starts a process that outlives age-edit and shreds the temporary directory
+// when age-edit exits without removing it, like when it is killed with SIGKILL or panics.
+// The supervisor learns that age-edit has exited when the pipe to its standard input closes,
+// which the operating system does however age-edit exits.
+func startSupervisor(tempDir string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to start the supervisor: %w", err)
+	}
+
+	cmd := exec.CommandContext(context.Background(), self, supervisorArg, tempDir)
+	cmd.Stderr = os.Stderr
+	detachProcess(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the supervisor: %w", err)
+	}
+
+	// Nothing waits for the supervisor: it must not exit with age-edit.
+	_ = cmd.Process.Release()
+
+	supervisorPipesMu.Lock()
+	defer supervisorPipesMu.Unlock()
+
+	supervisorPipes = append(supervisorPipes, stdin)
+
+	return nil
+}
+
+// supervise waits for the end of its standard input and shreds the temporary directory if it is still there.
+// The "age-edit-..." directory of the user goes too when it is empty.
+func supervise(r io.Reader, tempDir string) int {
+	// An interrupt meant for age-edit or its editor doesn't stop the supervisor.
+	signal.Ignore(os.Interrupt)
+
+	_, _ = io.Copy(io.Discard, r)
+
+	if _, err := os.Lstat(tempDir); err != nil {
+		return exitOK
+	}
+
+	if err := shredTree(tempDir); err != nil {
+		fmt.Fprintf(os.Stderr, "\r\nage-edit: exited without removing the plaintext, and removing it failed: %v\n", err)
+
+		return exitError
+	}
+
+	_ = os.Remove(filepath.Dir(tempDir))
+
+	fmt.Fprintf(os.Stderr, "\r\nage-edit: exited without removing the plaintext; removed %q\n", tempDir)
+
+	return exitOK
+}
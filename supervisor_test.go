@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSupervise(t *testing.T) {
+	t.Parallel()
+
+	userDir := filepath.Join(t.TempDir(), "age-edit-user")
+	tempDir := filepath.Join(userDir, "session")
+
+	if err := os.MkdirAll(filepath.Join(tempDir, "archive"), tempDirPerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"secret.txt", filepath.Join("archive", "secret.txt")} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("secret"), filePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code := supervise(strings.NewReader(""), tempDir); code != exitOK {
+		t.Fatalf("supervise() returned %d", code)
+	}
+
+	if _, err := os.Stat(userDir); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be removed", userDir)
+	}
+
+	// A session that has cleaned up leaves nothing to do.
+	if code := supervise(strings.NewReader(""), tempDir); code != exitOK {
+		t.Errorf("supervise() without the directory returned %d", code)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// staleDirMinAge keeps --gc away from the temporary directory of a process
+// that has just created it and hasn't recorded itself yet.
+const staleDirMinAge = time.Minute
+
+// staleDir is a temporary directory under the prefix that no running session owns.
+type staleDir struct {
+	path string
+	// kept is true for the directory of a session with --keep-temp.
+	kept bool
+	// unknown is true for a directory without session information,
+	// like one of an older version of age-edit, whose process can't be told.
+	unknown bool
+	// leftovers is the plaintext in the directory that a later session can recover.
+	leftovers []leftover
+}
+
+// findStaleDirs returns the temporary directories of the user under prefix
+// that belong to processes that are gone.
+// A directory without session information is returned as unknown
+// when no running session has recorded it and it is older than staleDirMinAge.
+func findStaleDirs(prefix string, now time.Time) ([]staleDir, error) {
+	userDir, err := userDirName()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(prefix, userDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []staleDir{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := updateSessions(func(sessions []session) []session {
+		return sessions
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	running := map[string]bool{}
+	for _, s := range sessions {
+		running[filepath.Clean(s.TempDir)] = true
+	}
+
+	stale := []staleDir{}
+
+	for _, entry := range entries {
+		dir := filepath.Join(prefix, userDir, entry.Name())
+		if !entry.IsDir() || running[dir] {
+			continue
+		}
+
+		info, err := readSessionInfo(dir)
+		if err == nil {
+			if !processAlive(info.PID) {
+				stale = append(stale, staleDir{path: dir, kept: info.Kept, unknown: false, leftovers: info.leftovers(dir)})
+			}
+
+			continue
+		}
+
+		dirInfo, err := entry.Info()
+		if err != nil || now.Sub(dirInfo.ModTime()) < staleDirMinAge {
+			continue
+		}
+
+		stale = append(stale, staleDir{path: dir, kept: false, unknown: true, leftovers: []leftover{}})
+	}
+
+	return stale, nil
+}
+
+// sweepStaleDirs shreds the stale temporary directories under prefix and reports them.
+// Unless all is true, the directories of sessions with --keep-temp are kept,
+// and so are directories of unknown processes, which may still be running,
+// and directories with plaintext that editing its file again can recover.
+// The latter are reported except for the encrypted files in asked, whose user has been asked about them.
+// It returns the number of directories it has removed.
+func sweepStaleDirs(w io.Writer, prefix string, all bool, asked []string) (int, error) {
+	stale, err := findStaleDirs(prefix, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	errs := []error{}
+
+	for _, dir := range stale {
+		if (dir.kept || dir.unknown) && !all {
+			continue
+		}
+
+		if len(dir.leftovers) > 0 && !all {
+			for _, l := range dir.leftovers {
+				if slices.Contains(asked, l.encrypted) {
+					continue
+				}
+
+				fmt.Fprintf(w, "Kept plaintext for %q from a crashed session in %q; edit the file to recover it or run \"age-edit --gc\" to remove it\n", l.encrypted, l.plaintext)
+			}
+
+			continue
+		}
+
+		if err := shredTree(dir.path); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		removed++
+
+		fmt.Fprintf(w, "Removed stale temporary directory %q\n", dir.path)
+	}
+
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSweepStaleDirs(t *testing.T) {
+	t.Parallel()
+
+	prefix := t.TempDir()
+
+	userDir, err := userDirName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The PID of a process that has exited.
+	cmd := exec.Command("go", "version")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	aPath := filepath.Join(prefix, "a.txt.age")
+
+	mkdir := func(name string, info *sessionInfo, files map[string]string) string {
+		dir := filepath.Join(prefix, userDir, name)
+		if err := os.MkdirAll(dir, tempDirPerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if info != nil {
+			data, err := json.Marshal(info)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files[sessionInfoName] = string(data)
+		}
+
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), filePerm); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return dir
+	}
+
+	crashed := &sessionInfo{PID: cmd.ProcessState.Pid(), Files: []sessionFile{{Encrypted: aPath, Plaintext: "a.txt"}}}
+
+	recoverable := mkdir("recoverable", crashed, map[string]string{"a.txt": "a"})
+	empty := mkdir("empty", crashed, map[string]string{})
+	kept := mkdir("kept", &sessionInfo{PID: crashed.PID, Files: crashed.Files, Kept: true}, map[string]string{"a.txt": "a"})
+	running := mkdir("running", &sessionInfo{PID: os.Getpid(), Files: []sessionFile{}}, map[string]string{"a.txt": "a"})
+	recent := mkdir("recent", nil, map[string]string{"b.txt": "b"})
+	old := mkdir("old", nil, map[string]string{"c.txt": "c"})
+
+	// A directory like that of a running view, diff, or merge.
+	live, err := newTempDir(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-2 * staleDirMinAge)
+	for _, dir := range []string{old, live} {
+		if err := os.Chtimes(dir, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exists := func(dir string) bool {
+		_, err := os.Stat(dir)
+
+		return err == nil
+	}
+
+	var output bytes.Buffer
+
+	removed, err := sweepStaleDirs(&output, prefix, false, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 1 || exists(empty) {
+		t.Errorf("expected the empty directory to be removed, removed %d: %q", removed, output.String())
+	}
+
+	// The old directory has no session information, so its process may still be running.
+	if !exists(recoverable) || !exists(kept) || !exists(running) || !exists(recent) || !exists(old) || !exists(live) {
+		t.Error("expected the recoverable, the kept, the running, the recent, the old, and the live directory to stay")
+	}
+
+	if !strings.Contains(output.String(), "Kept plaintext for "+`"`+aPath+`"`) {
+		t.Errorf("expected the recoverable plaintext to be reported: %q", output.String())
+	}
+
+	// The user has already been asked about the file.
+	output.Reset()
+
+	if _, err := sweepStaleDirs(&output, prefix, false, []string{aPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.Len() != 0 {
+		t.Errorf("expected no report: %q", output.String())
+	}
+
+	removed, err = sweepStaleDirs(&output, prefix, true, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 3 || exists(recoverable) || exists(kept) || exists(old) {
+		t.Errorf("expected the recoverable, the kept, and the old directory to be removed, removed %d", removed)
+	}
+
+	if !exists(running) || !exists(recent) || !exists(live) {
+		t.Error("expected the running, the recent, and the live directory to stay")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// maxSymlinks limits how many symlinks resolveSymlink follows, like the kernel does.
+const maxSymlinks = 40
+
+// resolveSymlink returns the file a symlink points to, following chains of symlinks.
+// Other paths are returned unchanged, so messages show them as the user gave them.
+// A dangling symlink resolves to its missing target, so a new file is created there
+// instead of replacing the link.
+func resolveSymlink(path string) (string, error) {
+	current := path
+
+	for range maxSymlinks {
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return current, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			return current, nil
+		}
+
+		target, err := os.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(current), target)
+		}
+
+		current = target
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic links in %q", path)
+}
+
+// checkSymlinkTarget confirms that a symlink still points to the file it pointed to when it was opened.
+// Saving through a symlink that was swapped for another one would write to a file the user didn't open.
+func checkSymlinkTarget(linkPath, target string) error {
+	current, err := resolveSymlink(linkPath)
+	if err != nil {
+		return err
+	}
+
+	if current != target {
+		return fmt.Errorf("%q now points to %q instead of %q", linkPath, current, target)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSymlink(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "secret.age")
+	link := filepath.Join(dir, "link.age")
+	chain := filepath.Join(dir, "chain.age")
+	dangling := filepath.Join(dir, "dangling.age")
+	loop := filepath.Join(dir, "loop.age")
+
+	if err := os.WriteFile(target, []byte("old"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("secret.age", link); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+
+	for _, pair := range [][2]string{
+		{link, chain},
+		{filepath.Join(dir, "new.age"), dangling},
+		{loop, loop},
+	} {
+		if err := os.Symlink(pair[0], pair[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{target, target},
+		{link, target},
+		{chain, target},
+		{dangling, filepath.Join(dir, "new.age")},
+	}
+
+	for _, test := range tests {
+		got, err := resolveSymlink(test.path)
+		if err != nil {
+			t.Errorf("%q: %v", test.path, err)
+
+			continue
+		}
+
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.path, test.expected, got)
+		}
+	}
+
+	if _, err := resolveSymlink(loop); err == nil {
+		t.Error("expected an error for a symlink loop")
+	}
+
+	// Saving through the symlink replaces the file and keeps the link.
+	err := writeFileAtomic(link, filePerm, false, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symlink to stay a symlink")
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "new" {
+		t.Errorf("expected %q in the target, got %q", "new", data)
+	}
+}
+
+func TestCheckSymlinkTarget(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link.age")
+	first := filepath.Join(dir, "first.age")
+	second := filepath.Join(dir, "second.age")
+
+	if err := os.Symlink(first, link); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+
+	if err := checkSymlinkTarget(link, first); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(second, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkSymlinkTarget(link, first); err == nil {
+		t.Error("expected an error after the symlink was swapped")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"regexp"
+)
+
+var templateVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// loadTemplate returns the initial contents of a new file:
+// the contents of the template file or the template text with variables expanded.
+// It returns an empty string when there is no template.
+func loadTemplate(path, text string) (string, error) {
+	if path != "" && text != "" {
+		return "", errors.New("only one of a template file and a template text can be given")
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		return string(data), nil
+	}
+
+	return expandTemplate(text), nil
+}
+
+// expandTemplate replaces "${NAME}" in a template text with the value of the environment variable NAME.
+// Unset variables expand to nothing like in the shell.
+// Other dollar signs are kept, so "$5" and "$HOME" stay as they are.
+func expandTemplate(text string) string {
+	return templateVarRe.ReplaceAllStringFunc(text, func(match string) string {
+		return os.Getenv(templateVarRe.FindStringSubmatch(match)[1])
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	t.Setenv("AGE_EDIT_TEST_USER", "alice")
+	t.Setenv("AGE_EDIT_TEST_UNSET", "")
+
+	tests := map[string]string{
+		"":                              "",
+		"user: ${AGE_EDIT_TEST_USER}\n": "user: alice\n",
+		"${AGE_EDIT_TEST_UNSET}empty":   "empty",
+		"$AGE_EDIT_TEST_USER costs $5":  "$AGE_EDIT_TEST_USER costs $5",
+		"${not a var} ${}":              "${not a var} ${}",
+		"${AGE_EDIT_TEST_USER}${AGE_EDIT_TEST_USER}": "alicealice",
+	}
+
+	for text, want := range tests {
+		if got := expandTemplate(text); got != want {
+			t.Errorf("expandTemplate(%q): expected %q, got %q", text, want, got)
+		}
+	}
+}
+
+func TestLoadTemplate(t *testing.T) {
+	t.Setenv("AGE_EDIT_TEST_USER", "alice")
+
+	path := filepath.Join(t.TempDir(), "template.txt")
+
+	// Template files are used as they are.
+	if err := os.WriteFile(path, []byte("user: ${AGE_EDIT_TEST_USER}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{path, "", "user: ${AGE_EDIT_TEST_USER}\n", false},
+		{"", "user: ${AGE_EDIT_TEST_USER}", "user: alice", false},
+		{path, "text", "", true},
+		{filepath.Join(t.TempDir(), "missing.txt"), "", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := loadTemplate(test.path, test.text)
+		if (err != nil) != test.wantErr {
+			t.Errorf("loadTemplate(%q, %q): unexpected error %v", test.path, test.text, err)
+		}
+
+		if got != test.want {
+			t.Errorf("loadTemplate(%q, %q): expected %q, got %q", test.path, test.text, test.want, got)
+		}
+	}
+}
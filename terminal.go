@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+const (
+	ptyColumns = 80
+	ptyRows    = 24
+)
+
+// editorTerminal gives the editor a terminal when age-edit runs without one on standard input or output,
+// like in a script or a pipeline, because editors like Vim need one.
+// It prefers the controlling terminal of the process, /dev/tty.
+// Without one, it allocates a pseudo-terminal and copies standard input to it and its output to standard output.
+// It returns nil when the standard streams are terminals.
+// The ownPTY result reports whether the terminal is a new pseudo-terminal,
+// which the editor needs as its controlling terminal.
+func editorTerminal() (tty *os.File, ownPTY bool, closeTTY func(), err error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) { //nolint:gosec
+		return nil, false, func() {}, nil
+	}
+
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		return tty, false, func() { _ = tty.Close() }, nil
+	}
+
+	master, slave, err := openPTY(ptyColumns, ptyRows)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	go func() {
+		_, _ = io.Copy(os.Stdout, master)
+	}()
+
+	// The copy from standard input ends with the process, since a read can't be interrupted.
+	go func() {
+		_, _ = io.Copy(master, os.Stdin)
+	}()
+
+	return slave, true, func() {
+		_ = slave.Close()
+		_ = master.Close()
+	}, nil
+}
@@ -1,24 +1,38 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 func main() {
 	args := os.Args[1:]
 	readOnly := false
+	empty := false
 
 	if args[0] == "--read-only" {
 		readOnly = true
 		args = args[1:]
 	}
 
-	f, err := os.OpenFile(args[0], os.O_RDONLY, 0)
-	if err != nil {
-		panic(err)
+	if args[0] == "--empty" {
+		empty = true
+		args = args[1:]
+	}
+
+	for _, path := range args {
+		// A new file doesn't exist until the editor writes it.
+		f, err := os.OpenFile(path, os.O_RDONLY, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+		_ = f.Close()
 	}
-	_ = f.Close()
 
 	time.Sleep(100 * time.Millisecond)
 
@@ -26,13 +40,29 @@ func main() {
 		return
 	}
 
-	f, err = os.OpenFile(args[0], os.O_APPEND|os.O_WRONLY, 0)
-	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
+	for _, path := range args {
+		if empty {
+			if err := os.Truncate(path, 0); err != nil {
+				panic(err)
+			}
+
+			continue
+		}
+
+		// A directory, like the tree of an archive, gets the text in a file.
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "edit.txt")
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			panic(err)
+		}
+
+		if _, err := f.WriteString("edit\n"); err != nil {
+			panic(err)
+		}
 
-	if _, err := f.WriteString("edit\n"); err != nil {
-		panic(err)
+		_ = f.Close()
 	}
 }
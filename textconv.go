@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+const (
+	gitDiffDriver     = "age"
+	gitAttributesFile = ".gitattributes"
+	gitAttributesLine = "*.age diff=" + gitDiffDriver
+	shellSafeChars    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_"
+)
+
+// shellQuote quotes a word for sh(1) if it needs quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, shellSafeChars) == "" {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runGit runs Git in a directory and returns its trimmed output.
+func runGit(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(context.Background(), "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// installTextconv sets up the Git repository containing dir to show the plaintext of age files in diffs.
+// It configures a diff driver that runs the textconv command
+// and assigns the driver to age files in the .gitattributes file at the top of the repository.
+// It returns the path of the .gitattributes file.
+func installTextconv(dir, textconvCmd string) (string, error) {
+	top, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := runGit(top, "config", "--local", "diff."+gitDiffDriver+".textconv", textconvCmd); err != nil {
+		return "", err
+	}
+
+	attributesPath := filepath.Join(top, gitAttributesFile)
+
+	data, err := os.ReadFile(attributesPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if slices.Contains(lines, gitAttributesLine) {
+		return attributesPath, nil
+	}
+
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+
+	data = append(data, gitAttributesLine+"\n"...)
+
+	//nolint:gosec
+	return attributesPath, os.WriteFile(attributesPath, data, 0o644)
+}
+
+// textconvCommand implements the "git-textconv" subcommand.
+func textconvCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	flag := sub.flagSet(
+		fmt.Sprintf(
+			"Print the plaintext of an encrypted file for \"git diff\" and \"git log -p\". Git runs this command as the textconv filter of a diff driver. A file that can't be decrypted is shown as a placeholder line, so diffs keep working without the identities. With --install, set up the Git repository in the current directory: configure the diff driver %q and add %q to .gitattributes. Don't enable diff.%s.cachetextconv, since it stores the plaintext in the repository.",
+			gitDiffDriver,
+			gitAttributesLine,
+			gitDiffDriver,
+		),
+		"  encrypted               encrypted file path\n",
+	)
+
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	install := flag.Bool(
+		"install",
+		false,
+		"configure the Git repository in the current directory to use this command",
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if *install {
+		if flag.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "Error: --install takes no encrypted file")
+
+			return exitBadUsage
+		}
+
+		if err := checkDependencies(dependency{role: "Git", command: "git", hint: "install Git"}); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		// Git runs the command through the shell.
+		words := []string{"age-edit", sub.name}
+		if *idsPath != "" {
+			absPath, err := filepath.Abs(*idsPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+
+				return exitError
+			}
+
+			words = append(words, "-i", absPath)
+		}
+
+		if *decode != "" {
+			words = append(words, "--decode", *decode)
+		}
+
+		quoted := make([]string, 0, len(words))
+		for _, word := range words {
+			quoted = append(quoted, shellQuote(word))
+		}
+
+		attributesPath, err := installTextconv(".", strings.Join(quoted, " "))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		fmt.Printf("configured diff driver %q and updated %s\n", gitDiffDriver, attributesPath)
+
+		return exitOK
+	}
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Error: need exactly one encrypted file")
+
+		return exitBadUsage
+	}
+
+	encPath := flag.Arg(0)
+
+	decodeCmd := ""
+	decodeArgs := []string{}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		decodeCmd = args[0]
+		decodeArgs = args[1:]
+	}
+
+	// Decrypt to memory first, so a failure doesn't leave partial plaintext in the diff.
+	var plaintext bytes.Buffer
+
+	err := checkDependencies(decodeDependency(decodeCmd))
+	if err == nil {
+		if *idsPath == "" && !agentAvailable() {
+			err = errors.New("need an identities file")
+		}
+	}
+
+	if err == nil {
+		identities, _, openErr := openIdentities(*idsPath, false)
+		if openErr != nil {
+			err = openErr
+		} else {
+			err = decryptToWriter(encPath, &plaintext, decodeCmd, decodeArgs, identities...)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", encPath, err)
+		fmt.Printf("[age-edit: cannot decrypt: %v]\n", err)
+
+		return exitOK
+	}
+
+	if _, err := os.Stdout.Write(plaintext.Bytes()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"age-edit", "age-edit"},
+		{"/home/user/ids.txt", "/home/user/ids.txt"},
+		{"", "''"},
+		{"gzip -d", "'gzip -d'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+	}
+
+	for _, test := range tests {
+		if got := shellQuote(test.word); got != test.want {
+			t.Errorf("%q: expected %s, got %s", test.word, test.want, got)
+		}
+	}
+}
+
+func TestInstallTextconv(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+
+	if _, err := runGit(dir, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	attributesPath := filepath.Join(dir, gitAttributesFile)
+	if err := os.WriteFile(attributesPath, []byte("*.bin binary"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installing twice must not duplicate the attributes.
+	for range 2 {
+		got, err := installTextconv(sub, "age-edit git-textconv")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resolved, err := filepath.EvalSymlinks(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, err := filepath.EvalSymlinks(attributesPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resolved != want {
+			t.Errorf("expected %q, got %q", want, resolved)
+		}
+	}
+
+	data, err := os.ReadFile(attributesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "*.bin binary\n"+gitAttributesLine+"\n" {
+		t.Errorf("unexpected attributes: %q", data)
+	}
+
+	output, err := exec.CommandContext(context.Background(), "git", "-C", dir, "config", "diff.age.textconv").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(output) != "age-edit git-textconv\n" {
+		t.Errorf("unexpected textconv: %q", output)
+	}
+}
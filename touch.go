@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"github.com/anmitsu/go-shlex"
+)
+
+// touchFile creates an encrypted file with the contents of a template or empty.
+// Like touch(1), it leaves an existing file alone; then it returns false.
+func touchFile(
+	encPath string,
+	template []byte,
+	armored bool,
+	encodeCmd string,
+	encodeArgs []string,
+	recipients ...age.Recipient,
+) (bool, error) {
+	if _, err := os.Lstat(encPath); err == nil {
+		return false, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	return true, encryptNewFile(bytes.NewReader(template), encPath, false, armored, encodeCmd, encodeArgs, recipients...)
+}
+
+// touchCommand implements the "touch" subcommand.
+func touchCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultArmorVal, err := defaultArmor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Create new encrypted files without opening the editor. A file is empty or starts from the template, and it is encrypted to the given recipients or, if there are none, to the recipients of the identities. Existing files are left alone.",
+		"  encrypted               encrypted file path\n",
+	)
+
+	armored := flag.BoolP(
+		"armor",
+		"a",
+		defaultArmorVal,
+		fmt.Sprintf("write an armored age file (%v)", armorEnvVar),
+	)
+	encode := flag.String(
+		"encode",
+		defaultEncode(),
+		fmt.Sprintf("filter command before encryption, like a compressor (%v)", encodeEnvVar),
+	)
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	recipientStrings := flag.StringArrayP(
+		"recipient",
+		"r",
+		[]string{},
+		"encrypt to a recipient (repeatable)",
+	)
+	recipientsFiles := flag.StringArrayP(
+		"recipients-file",
+		"R",
+		[]string{},
+		"encrypt to the recipients in a file (repeatable)",
+	)
+	templatePath := flag.StringP(
+		"template",
+		"T",
+		defaultTemplate(),
+		fmt.Sprintf("plaintext file with the initial contents (%v)", templateEnvVar),
+	)
+	templateText := flag.String(
+		"template-text",
+		defaultTemplateText(),
+		fmt.Sprintf("initial contents with ${VAR} expanded from the environment (%v)", templateTextEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Error: need at least one encrypted file")
+
+		return exitBadUsage
+	}
+
+	encodeCmd := ""
+	encodeArgs := []string{}
+
+	if *encode != "" {
+		args, err := shlex.Split(*encode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split encode command")
+
+			return exitBadUsage
+		}
+
+		encodeCmd = args[0]
+		encodeArgs = args[1:]
+	}
+
+	if err := checkDependencies(encodeDependency(encodeCmd)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	template, err := loadTemplate(*templatePath, *templateText)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	var recipients []age.Recipient
+
+	if len(*recipientStrings) > 0 || len(*recipientsFiles) > 0 {
+		recipients, err = loadRecipients(*recipientStrings, *recipientsFiles)
+	} else {
+		_, recipients, err = openIdentities(*idsPath, false)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	code := exitOK
+
+	for _, encPath := range flag.Args() {
+		created, err := touchFile(encPath, []byte(template), *armored, encodeCmd, encodeArgs, recipients...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", encPath, err)
+
+			code = exitError
+
+			continue
+		}
+
+		if created {
+			fmt.Printf("created %s\n", encPath)
+		}
+	}
+
+	return code
+}
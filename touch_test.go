@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestTouchFile(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	emptyPath := filepath.Join(dir, "empty.age")
+	templatePath := filepath.Join(dir, "template.age")
+
+	created, err := touchFile(emptyPath, []byte{}, false, "", []string{}, identity.Recipient())
+	if err != nil || !created {
+		t.Fatalf("expected a new file, got %v, %v", created, err)
+	}
+
+	created, err = touchFile(templatePath, []byte("user:\n"), true, "", []string{}, identity.Recipient())
+	if err != nil || !created {
+		t.Fatalf("expected a new file, got %v, %v", created, err)
+	}
+
+	// An existing file is left alone.
+	created, err = touchFile(templatePath, []byte("other"), true, "", []string{}, identity.Recipient())
+	if err != nil || created {
+		t.Fatalf("expected the existing file to be left alone, got %v, %v", created, err)
+	}
+
+	tests := []struct {
+		path    string
+		armored bool
+		want    string
+	}{
+		{emptyPath, false, ""},
+		{templatePath, true, "user:\n"},
+	}
+
+	for _, test := range tests {
+		armored, err := isArmored(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+
+		if err := decryptToWriter(test.path, &out, "", []string{}, identity); err != nil {
+			t.Fatal(err)
+		}
+
+		if armored != test.armored || out.String() != test.want {
+			t.Errorf("%s: got armored %v, contents %q", test.path, armored, out.String())
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	// trailingExcerptLines is how many lines of the data after the armor age-edit shows.
+	trailingExcerptLines = 10
+	// trailingExcerptWidth is where age-edit cuts the lines it shows.
+	trailingExcerptWidth = 76
+)
+
+// trailingDataError is an armored file with data after the armor footer,
+// like merge conflict markers or another file appended to it.
+type trailingDataError struct {
+	path string
+	// line is the line of the file where the data starts.
+	line int
+	// data is what follows the armor.
+	data []byte
+}
+
+func (e *trailingDataError) Error() string {
+	return fmt.Sprintf(
+		"%q has data after the end of the armor on line %d%s; delete everything after the %q line",
+		e.path,
+		e.line,
+		e.guess(),
+		armor.Footer,
+	)
+}
+
+// guess explains the data after the armor when it looks like something familiar.
+func (e *trailingDataError) guess() string {
+	for _, marker := range []string{"<<<<<<<", "=======", ">>>>>>>", "|||||||"} {
+		if bytes.HasPrefix(e.data, []byte(marker)) || bytes.Contains(e.data, []byte("\n"+marker)) {
+			return " (it looks like merge conflict markers)"
+		}
+	}
+
+	if bytes.Contains(e.data, []byte(armor.Header)) {
+		return " (it looks like another encrypted file)"
+	}
+
+	return ""
+}
+
+// excerpt returns the first lines of the data after the armor with their line numbers.
+// Control characters are replaced, so binary data doesn't garble the terminal.
+func (e *trailingDataError) excerpt() string {
+	lines := strings.Split(strings.TrimRight(string(e.data), "\r\n"), "\n")
+
+	var sb strings.Builder
+
+	for i, line := range lines {
+		if i == trailingExcerptLines {
+			fmt.Fprintf(&sb, "%6s  (%d more lines)\n", "...", len(lines)-i)
+
+			break
+		}
+
+		line = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) && r != '\t' {
+				return '?'
+			}
+
+			return r
+		}, strings.ToValidUTF8(strings.TrimRight(line, "\r"), "?"))
+
+		if runes := []rune(line); len(runes) > trailingExcerptWidth {
+			line = string(runes[:trailingExcerptWidth]) + "..."
+		}
+
+		fmt.Fprintf(&sb, "%6d  %s\n", e.line+i, line)
+	}
+
+	return sb.String()
+}
+
+// findTrailingData returns where non-whitespace data starts after the armor footer of an armored file.
+// It returns -1 when there is no such data or no footer.
+func findTrailingData(data []byte) int {
+	start := armorStart(data)
+	if start < 0 {
+		return -1
+	}
+
+	footer := bytes.Index(data[start:], []byte(armor.Footer))
+	if footer < 0 {
+		return -1
+	}
+
+	end := start + footer + len(armor.Footer)
+	rest := data[end:]
+	trimmed := bytes.TrimLeft(rest, " \t\r\n")
+
+	if len(trimmed) == 0 {
+		return -1
+	}
+
+	return end + len(rest) - len(trimmed)
+}
+
+// explainTrailingData replaces the error of a failed decryption
+// with a trailingDataError when the file has data after the armor.
+// The armor reader of age only reports that there is trailing data,
+// so the file is read again to find it.
+// Identities that don't fit the file are the bigger problem, so their error stays.
+func explainTrailingData(err error, path string) error {
+	var noMatch *age.NoIdentityMatchError
+	if err == nil || errors.As(err, &noMatch) {
+		return err
+	}
+
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return err
+	}
+
+	offset := findTrailingData(data)
+	if offset < 0 {
+		return err
+	}
+
+	return &trailingDataError{
+		path: path,
+		line: bytes.Count(data[:offset], []byte("\n")) + 1,
+		data: data[offset:],
+	}
+}
+
+// offerTrailingData asks whether to show the data after the armor and shows it.
+// Anything but "y" declines.
+func offerTrailingData(r io.Reader, w io.Writer, e *trailingDataError) {
+	fmt.Fprint(w, "Show the data after the armor? [y/N] ")
+
+	line, _ := readLine(r)
+	answer := strings.ToLower(strings.TrimSpace(line))
+
+	if answer != "y" && answer != "yes" {
+		if line == "" {
+			fmt.Fprintln(w)
+		}
+
+		return
+	}
+
+	fmt.Fprint(w, e.excerpt())
+}
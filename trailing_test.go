@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestFindTrailingData(t *testing.T) {
+	t.Parallel()
+
+	armored := "-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n-----END AGE ENCRYPTED FILE-----\n"
+
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{armored, -1},
+		{armored + "\n \r\n\t", -1},
+		{armored + "garbage\n", len(armored)},
+		{armored + "\n  garbage", len(armored) + 3},
+		{"-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n", -1},
+		{"age-encryption.org/v1\ngarbage", -1},
+	}
+
+	for _, test := range tests {
+		if got := findTrailingData([]byte(test.text)); got != test.expected {
+			t.Errorf("%q: expected %d, got %d", test.text, test.expected, got)
+		}
+	}
+}
+
+func TestDecryptToFileTrailingData(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ciphertext bytes.Buffer
+
+	if err := encryptStream(strings.NewReader("secret\n"), &ciphertext, true, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	armored := ciphertext.String()
+	lines := strings.Count(armored, "\n")
+
+	tests := []struct {
+		name    string
+		extra   string
+		guess   string
+		excerpt string
+	}{
+		{
+			"conflict",
+			"=======\nold\n>>>>>>> branch\n",
+			"merge conflict markers",
+			"=======",
+		},
+		{
+			"concatenated",
+			armored,
+			"another encrypted file",
+			"-----BEGIN AGE ENCRYPTED FILE-----",
+		},
+		{
+			"binary",
+			"\x00\x1b[2J\n",
+			"",
+			"??[2J",
+		},
+	}
+
+	for _, test := range tests {
+		encPath := filepath.Join(dir, test.name+".age")
+
+		if err := os.WriteFile(encPath, []byte(armored+test.extra), filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		err := decryptToFile(encPath, filepath.Join(dir, test.name), "", []string{}, identity)
+
+		var trailingErr *trailingDataError
+		if !errors.As(err, &trailingErr) {
+			t.Errorf("%s: expected a trailing data error, got %v", test.name, err)
+
+			continue
+		}
+
+		if trailingErr.line != lines+1 {
+			t.Errorf("%s: expected line %d, got %d", test.name, lines+1, trailingErr.line)
+		}
+
+		if !strings.Contains(err.Error(), test.guess) {
+			t.Errorf("%s: expected %q in %q", test.name, test.guess, err.Error())
+		}
+
+		if !strings.Contains(trailingErr.excerpt(), test.excerpt) {
+			t.Errorf("%s: expected %q in the excerpt:\n%s", test.name, test.excerpt, trailingErr.excerpt())
+		}
+	}
+
+	// The wrong identity is the bigger problem.
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = decryptToFile(filepath.Join(dir, "conflict.age"), filepath.Join(dir, "other"), "", []string{}, other)
+
+	var noMatch *age.NoIdentityMatchError
+	if !errors.As(err, &noMatch) {
+		t.Errorf("expected a no identity match error, got %v", err)
+	}
+}
+
+func TestTrailingDataExcerptLimit(t *testing.T) {
+	t.Parallel()
+
+	e := &trailingDataError{
+		path: "secret.age",
+		line: 5,
+		data: []byte(strings.Repeat("x", trailingExcerptWidth+10) + "\n" + strings.Repeat("line\n", 20)),
+	}
+
+	excerpt := e.excerpt()
+
+	if !strings.HasPrefix(excerpt, "     5  "+strings.Repeat("x", trailingExcerptWidth)+"...\n") {
+		t.Errorf("expected a cut first line, got:\n%s", excerpt)
+	}
+
+	if !strings.HasSuffix(excerpt, "(11 more lines)\n") {
+		t.Errorf("expected the rest to be counted, got:\n%s", excerpt)
+	}
+}
+
+func TestOfferTrailingData(t *testing.T) {
+	t.Parallel()
+
+	e := &trailingDataError{path: "secret.age", line: 3, data: []byte("garbage\n")}
+
+	tests := []struct {
+		input string
+		shown bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"\n", false},
+		{"n\n", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		var w bytes.Buffer
+
+		offerTrailingData(strings.NewReader(test.input), &w, e)
+
+		if shown := strings.Contains(w.String(), "     3  garbage"); shown != test.shown {
+			t.Errorf("%q: expected shown %v, got %q", test.input, test.shown, w.String())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"filippo.io/age"
+)
+
+const (
+	defaultTrashTTL = 7 * 24 * time.Hour
+	trashTimeLayout = "20060102T150405"
+
+	// trashEntryPattern matches the end of the names stashDiscarded gives trash entries:
+	// the time of the stash and a random ID.
+	trashEntryPattern = `\.\d{8}T\d{6}-[0-9a-z]{8}\.age$`
+)
+
+// trashEntryName matches the names of trash entries,
+// so other files in the trash directory are left alone.
+var trashEntryName = regexp.MustCompile(trashEntryPattern)
+
+// stashDiscarded encrypts the contents of a temporary file
+// into the trash directory if they differ from the last saved contents.
+// It is used when changes would otherwise be thrown away.
+// The plaintext is never written to the trash.
+// It returns the path of the new trash entry or an empty string if nothing was stashed.
+func stashDiscarded(cfg config, tempFile string, savedSum []byte, recipients []age.Recipient) (string, error) {
+	if cfg.trashDir == "" {
+		return "", nil
+	}
+
+	currentSum, err := checksumFile(tempFile)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Equal(savedSum, currentSum) {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(cfg.trashDir, tempDirPerm); err != nil {
+		return "", err
+	}
+
+	sourceID, err := trashSourceID(cfg.encPath)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf(
+		"%s.%s.%s-%s.age",
+		filepath.Base(getRoot(cfg.encPath)),
+		sourceID,
+		time.Now().Format(trashTimeLayout),
+		randomID(),
+	)
+	trashPath := filepath.Join(cfg.trashDir, name)
+
+	if err := encryptToFile(tempFile, trashPath, cfg.fsync, cfg.armor, cfg.encodeCmd, cfg.encodeArgs, recipients...); err != nil {
+		_ = os.Remove(trashPath)
+
+		return "", fmt.Errorf("failed to stash discarded changes: %w", err)
+	}
+
+	return trashPath, nil
+}
+
+// trashSourceID identifies the encrypted file a trash entry comes from
+// by the hash of its absolute path,
+// so the entries of files with the same name in other directories can be told apart.
+func trashSourceID(encPath string) (string, error) {
+	absPath, err := filepath.Abs(encPath)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(absPath))
+
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// pruneTrash removes trash entries older than the TTL.
+// A TTL of zero or less keeps entries forever.
+// Only files with the names of trash entries are removed,
+// so a trash directory that also holds other encrypted files keeps them.
+func pruneTrash(dir string, ttl time.Duration) error {
+	if dir == "" || ttl <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-ttl)
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !trashEntryName.MatchString(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// reportStash tells the user where discarded changes went.
+func reportStash(trashPath string, err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+
+		return
+	}
+
+	if trashPath != "" {
+		fmt.Fprintf(os.Stderr, "Discarded changes were encrypted to %q\n", trashPath)
+	}
+}
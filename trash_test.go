@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestStashDiscarded(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	trashDir := filepath.Join(tempDir, "trash")
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempFile := filepath.Join(tempDir, "secret.txt")
+	if err := os.WriteFile(tempFile, []byte("original"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	savedSum, err := checksumFile(tempFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		encPath:  filepath.Join(tempDir, "secret.txt.age"),
+		trashDir: trashDir,
+	}
+
+	// Unchanged contents are not stashed.
+	trashPath, err := stashDiscarded(cfg, tempFile, savedSum, []age.Recipient{identity.Recipient()})
+	if err != nil || trashPath != "" {
+		t.Fatalf("stashDiscarded() = %q, %v; expected nothing stashed", trashPath, err)
+	}
+
+	if err := os.WriteFile(tempFile, []byte("changed"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	trashPath, err = stashDiscarded(cfg, tempFile, savedSum, []age.Recipient{identity.Recipient()})
+	if err != nil || trashPath == "" {
+		t.Fatalf("stashDiscarded() = %q, %v; expected a trash entry", trashPath, err)
+	}
+
+	decPath := filepath.Join(tempDir, "dec")
+	if err := decryptToFile(trashPath, decPath, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(decPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "changed" {
+		t.Errorf("stashed content is %q, expected %q", content, "changed")
+	}
+
+	// Expired entries are pruned; fresh ones are kept, and so are other files.
+	oldPath := filepath.Join(trashDir, "old.txt.20240101T000000-0123abcd.age")
+	otherPath := filepath.Join(trashDir, "other.age")
+
+	oldTime := time.Now().Add(-2 * time.Hour)
+
+	for _, path := range []string{oldPath, otherPath} {
+		if err := os.WriteFile(path, []byte{}, filePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneTrash(trashDir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be pruned", oldPath)
+	}
+
+	for _, path := range []string{trashPath, otherPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %q to be kept: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// saveTriggerName and revertTriggerName are files that a program creates in the temporary directory
+	// to save or revert the session where there are no signals, like on Windows.
+	saveTriggerName   = ".age-edit-save"
+	revertTriggerName = ".age-edit-revert"
+
+	triggerInterval = 500 * time.Millisecond
+)
+
+// watchTriggers checks the temporary directory for trigger files,
+// removes a trigger file it finds, and calls the function for it.
+// A nil function ignores its trigger file.
+// It returns a function that stops watching.
+func watchTriggers(tempDir string, interval time.Duration, save, revert func() error) func() {
+	triggers := []struct {
+		path   string
+		action func() error
+		failed string
+	}{
+		{filepath.Join(tempDir, saveTriggerName), save, "saving"},
+		{filepath.Join(tempDir, revertTriggerName), revert, "reverting"},
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+				for _, trigger := range triggers {
+					// The file is removed first, so a program can trigger again while the action runs.
+					if err := os.Remove(trigger.path); err != nil || trigger.action == nil {
+						continue
+					}
+
+					if err := trigger.action(); err != nil {
+						fmt.Fprintf(os.Stderr, "\r\007age-edit: %s failed: %v\n", trigger.failed, err)
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
+// requestSave asks the session with a temporary directory to save by creating its save trigger file.
+func requestSave(tempDir string) error {
+	return os.WriteFile(filepath.Join(tempDir, saveTriggerName), []byte{}, filePerm)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchTriggers(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	var saves, reverts atomic.Int32
+
+	stop := watchTriggers(tempDir, 10*time.Millisecond, func() error {
+		saves.Add(1)
+
+		return nil
+	}, func() error {
+		reverts.Add(1)
+
+		return nil
+	})
+	defer stop()
+
+	waitRemoved := func(name string) {
+		t.Helper()
+
+		for range 100 {
+			if _, err := os.Stat(filepath.Join(tempDir, name)); os.IsNotExist(err) {
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("%q wasn't picked up", name)
+	}
+
+	for range 2 {
+		if err := requestSave(tempDir); err != nil {
+			t.Fatal(err)
+		}
+
+		waitRemoved(saveTriggerName)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, revertTriggerName), []byte{}, filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	waitRemoved(revertTriggerName)
+
+	// The action runs after the file is removed.
+	time.Sleep(50 * time.Millisecond)
+
+	if n := saves.Load(); n != 2 {
+		t.Errorf("expected 2 saves, got %d", n)
+	}
+
+	if n := reverts.Load(); n != 1 {
+		t.Errorf("expected 1 revert, got %d", n)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const tuiReservedHeight = 6
+
+// renameEncrypted renames an encrypted file together with its backups and its history.
+// A new name without a directory keeps the file in its directory.
+// It refuses to replace an existing file or backup.
+func renameEncrypted(oldPath, newName string, lock bool, locking lockOptions) (string, error) {
+	newPath := newName
+	if !strings.ContainsRune(newName, filepath.Separator) && !strings.ContainsRune(newName, '/') {
+		newPath = filepath.Join(filepath.Dir(oldPath), newName)
+	}
+
+	if _, err := os.Lstat(newPath); err == nil {
+		return "", fmt.Errorf("%q already exists", newPath)
+	}
+
+	// The backups keep their suffixes, so a new file with the old name doesn't rotate them as its own.
+	oldBackups, err := backupFiles(oldPath)
+	if err != nil {
+		return "", err
+	}
+
+	newBackups := make([]string, 0, len(oldBackups))
+
+	for _, backup := range oldBackups {
+		newBackup := newPath + strings.TrimPrefix(backup, oldPath)
+		if _, err := os.Lstat(newBackup); err == nil {
+			return "", fmt.Errorf("%q already exists", newBackup)
+		}
+
+		newBackups = append(newBackups, newBackup)
+	}
+
+	if lock {
+		fileLock := newFileLock(oldPath, locking)
+
+		locked, err := fileLock.TryLock()
+		if err != nil {
+			return "", fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if !locked {
+			return "", errors.New("encrypted file is locked")
+		}
+
+		defer func() {
+			_ = fileLock.Unlock()
+		}()
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return "", err
+	}
+
+	for i, backup := range oldBackups {
+		if err := os.Rename(backup, newBackups[i]); err != nil {
+			return newPath, fmt.Errorf("renamed the file but not its backups: %w", err)
+		}
+	}
+
+	newHistory := historyDirs(newPath)
+
+	for i, oldHistory := range historyDirs(oldPath) {
+		if _, err := os.Stat(oldHistory); err != nil || i >= len(newHistory) {
+			continue
+		}
+
+		if err := os.Rename(oldHistory, newHistory[i]); err != nil {
+			return newPath, fmt.Errorf("renamed the file but not its history: %w", err)
+		}
+	}
+
+	return newPath, nil
+}
+
+// tuiDetails describes an encrypted file for the details pane of the TUI without decrypting it.
+func tuiDetails(path string) string {
+	details := pickerPreview(path)
+
+	entries, err := historyEntries(path)
+	if err == nil && len(entries) > 0 {
+		details += fmt.Sprintf(", %d previous version(s)", len(entries))
+	}
+
+	return details
+}
+
+// tuiSession is the state of the TUI.
+type tuiSession struct {
+	dir      string
+	paths    []string
+	selected int
+	status   string
+
+	// env is the environment of the age-edit commands the TUI runs.
+	env     []string
+	lock    bool
+	locking lockOptions
+
+	inFd  int
+	state *term.State
+}
+
+// reload lists the encrypted files again and keeps the selection in range.
+func (s *tuiSession) reload() error {
+	paths, err := encryptedFilesIn(s.dir)
+	if err != nil {
+		return err
+	}
+
+	s.paths = paths
+	s.selected = max(0, min(s.selected, len(paths)-1))
+
+	return nil
+}
+
+// draw clears the screen and draws the file list, the details of the selected file, and the keys.
+func (s *tuiSession) draw(height int) {
+	var frame strings.Builder
+
+	frame.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&frame, "age-edit: %s\r\n\r\n", s.dir)
+
+	rows := max(1, height-tuiReservedHeight)
+	first := max(0, s.selected-rows+1)
+
+	for i := first; i < min(len(s.paths), first+rows); i++ {
+		name, err := filepath.Rel(s.dir, s.paths[i])
+		if err != nil {
+			name = s.paths[i]
+		}
+
+		marker := "  "
+		if i == s.selected {
+			marker = "> "
+		}
+
+		frame.WriteString(marker + name + "\r\n")
+	}
+
+	fmt.Fprintf(&frame, "\r\n  %s\r\n", tuiDetails(s.paths[s.selected]))
+	frame.WriteString("  <Enter> edit  v view  h history  r rekey  n rename  q quit\r\n")
+
+	if s.status != "" {
+		frame.WriteString("  " + s.status)
+	}
+
+	fmt.Fprint(os.Stderr, frame.String())
+}
+
+// suspend leaves raw mode, so commands and prompts use the terminal normally.
+func (s *tuiSession) suspend() {
+	_ = term.Restore(s.inFd, s.state)
+
+	fmt.Fprint(os.Stderr, "\x1b[H\x1b[2J")
+}
+
+// resume goes back to raw mode after suspend.
+func (s *tuiSession) resume() error {
+	state, err := term.MakeRaw(s.inFd)
+	if err != nil {
+		return err
+	}
+
+	s.state = state
+
+	return nil
+}
+
+// prompt reads a line from the user with the terminal in normal mode.
+func (s *tuiSession) prompt(question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// run runs age-edit itself with arguments.
+// Optionally, it waits for a key press afterward, so the output stays on the screen.
+func (s *tuiSession) run(wait bool, args ...string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(context.Background(), self, args...)
+	cmd.Env = s.env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+
+	if wait {
+		fmt.Fprint(os.Stderr, "\nPress <Enter> to return")
+		_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+
+	return err
+}
+
+// act performs the action for a key on the selected file.
+// It returns false when the user quits.
+func (s *tuiSession) act(input string) (bool, error) {
+	path := s.paths[s.selected]
+
+	switch input {
+	case "q", string(rune(keyCtrlC)), string(rune(keyEscape)):
+		return false, nil
+
+	case "\x1b[A", string(rune(keyCtrlP)):
+		s.selected = max(0, s.selected-1)
+
+		return true, nil
+
+	case "\x1b[B", string(rune(keyCtrlN)):
+		s.selected = min(len(s.paths)-1, s.selected+1)
+
+		return true, nil
+	}
+
+	var action func() (string, error)
+
+	switch input {
+	case "\r", "\n", "e":
+		action = func() (string, error) {
+			return "", s.run(false, path)
+		}
+
+	case "v":
+		action = func() (string, error) {
+			return "", s.run(false, "view", path)
+		}
+
+	case "h":
+		action = func() (string, error) {
+			return "", s.run(true, "history", path)
+		}
+
+	case "r":
+		action = func() (string, error) {
+			answer, err := s.prompt("Recipients file or recipient (empty for the recipients of the identities): ")
+			if err != nil {
+				return "", err
+			}
+
+			args := []string{"rekey"}
+
+			if answer != "" {
+				if _, err := os.Stat(answer); err == nil {
+					args = append(args, "-R", answer)
+				} else {
+					args = append(args, "-r", answer)
+				}
+			}
+
+			return "rekeyed " + path, s.run(false, append(args, path)...)
+		}
+
+	case "n":
+		action = func() (string, error) {
+			answer, err := s.prompt(fmt.Sprintf("Rename %q to: ", path))
+			if err != nil || answer == "" {
+				return "", err
+			}
+
+			newPath, err := renameEncrypted(path, answer, s.lock, s.locking)
+			if err != nil {
+				return "", err
+			}
+
+			return fmt.Sprintf("renamed %s to %s", path, newPath), nil
+		}
+
+	default:
+		return true, nil
+	}
+
+	s.suspend()
+
+	status, err := action()
+	if err != nil {
+		status = "Error: " + err.Error()
+	}
+
+	s.status = status
+
+	if err := s.resume(); err != nil {
+		return false, err
+	}
+
+	return true, s.reload()
+}
+
+// tuiCommand implements the "tui" subcommand.
+func tuiCommand(sub subcommand, args []string) int {
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultLockVal, err := defaultLock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	locking, err := envLockOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Browse the encrypted files in a directory in a terminal UI. The list shows the files found recursively, and the details show the format, size, modification time, recipient types, and number of previous versions of the selected file without decrypting it. Use <Up> and <Down> or Ctrl+P and Ctrl+N to move, <Enter> or \"e\" to edit, \"v\" to view, \"h\" to show the history, \"r\" to rekey, \"n\" to rename the file with its history, and \"q\" to quit. The actions run the age-edit commands with the settings from the environment.",
+		"  dir                     directory to browse (default \".\")\n",
+	)
+
+	idsPath := flag.StringP(
+		"identities",
+		"i",
+		identitiesFileDefault,
+		fmt.Sprintf("identities file path (%v%v)", identitiesFileEnvVar, identitiesFileHelpDefault),
+	)
+	noLock := flag.BoolP(
+		"no-lock",
+		"L",
+		!defaultLockVal,
+		fmt.Sprintf("do not lock encrypted files (negated %v)", lockEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+
+	inFd := int(os.Stdin.Fd())   //nolint:gosec
+	outFd := int(os.Stderr.Fd()) //nolint:gosec
+
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		fmt.Fprintln(os.Stderr, "Error: the TUI needs a terminal")
+
+		return exitError
+	}
+
+	session := &tuiSession{
+		dir:      dir,
+		paths:    []string{},
+		selected: 0,
+		status:   "",
+
+		env:     os.Environ(),
+		lock:    !*noLock,
+		locking: locking,
+
+		inFd:  inFd,
+		state: nil,
+	}
+
+	// The commands the TUI runs take the identities from the environment.
+	if *idsPath != "" {
+		absPath, err := filepath.Abs(*idsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		session.env = append(session.env, identitiesFileEnvVar+"="+absPath)
+	}
+
+	session.env = append(session.env, lockEnvVar+"="+strconv.FormatBool(!*noLock))
+
+	if err := session.reload(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	if err := session.resume(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	buffer := make([]byte, 16) //nolint:mnd
+
+	for {
+		_, height, err := term.GetSize(outFd)
+		if err != nil || height <= tuiReservedHeight {
+			height = pickerDefaultHeight
+		}
+
+		session.draw(height)
+
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			session.suspend()
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		more, err := session.act(string(buffer[:n]))
+		if err != nil {
+			session.suspend()
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			return exitError
+		}
+
+		if !more {
+			session.suspend()
+
+			return exitOK
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRenameEncrypted(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.age")
+
+	if err := os.WriteFile(oldPath, []byte("ciphertext"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := archiveVersion(oldPath, historyOptions{keep: 0, maxAge: 0, store: historyStoreFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if _, err := backupFile(oldPath, 2, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := backupFile(oldPath, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "taken.age"), []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	locking := lockOptions{strategy: lockStrategyFlock, expiry: 0}
+
+	if _, err := renameEncrypted(oldPath, "taken.age", true, locking); err == nil {
+		t.Error("expected an error for an existing file")
+	}
+
+	newPath, err := renameEncrypted(oldPath, "new.age", true, locking)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if newPath != filepath.Join(dir, "new.age") {
+		t.Errorf("unexpected new path %q", newPath)
+	}
+
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("expected %q to be gone", oldPath)
+	}
+
+	entries, err := historyEntries(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected the history to move with the file, got %d entries", len(entries))
+	}
+
+	backups, err := backupFiles(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{newPath + ".bak", newPath + ".~1~", newPath + ".~2~"}
+	if !slices.Equal(backups, expected) {
+		t.Errorf("expected the backups to move with the file, got %q", backups)
+	}
+
+	if backups, err := backupFiles(oldPath); err != nil || len(backups) != 0 {
+		t.Errorf("expected no backups under the old name, got %q: %v", backups, err)
+	}
+
+	// A backup in the way stops the rename before anything moves.
+	if err := os.WriteFile(filepath.Join(dir, "taken.age.bak"), []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "taken.age")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := renameEncrypted(newPath, "taken.age", true, locking); err == nil {
+		t.Error("expected an error for an existing backup")
+	}
+
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("expected %q to stay: %v", newPath, err)
+	}
+}
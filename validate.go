@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// validationError is a validator rejecting the changes to a file.
+type validationError struct {
+	err    error
+	output string
+	// repeated means that the validator has rejected the same plaintext before,
+	// like when the editor exits without a fix.
+	repeated bool
+}
+
+func (e *validationError) Error() string {
+	msg := fmt.Sprintf("the validator rejected the changes (%v), so the encrypted file wasn't changed", e.err)
+	if e.output != "" {
+		msg += ":\n" + e.output
+	}
+
+	return msg
+}
+
+// validatePlaintext runs a validator command with the path of the plaintext as the last argument.
+// The validator gets the environment of the session like the editor.
+// Its output is only shown when it fails.
+func validatePlaintext(command string, args []string, path string, env []string) error {
+	if command == "" {
+		return nil
+	}
+
+	fullArgs := append(slices.Clone(args), path)
+
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(context.Background(), command, fullArgs...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return &validationError{err: err, output: strings.TrimRight(output.String(), "\n"), repeated: false}
+	}
+
+	return nil
+}
+
+// validatorDependency describes a validator.
+func validatorDependency(command string) dependency {
+	return dependency{
+		role:    "validator",
+		command: command,
+		hint:    fmt.Sprintf("install it or change --validate or %s", validateEnvVar),
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestValidate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor and validator are shell scripts")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	encPath := filepath.Join(tempDir, "config.age")
+
+	edit := func(text string) error {
+		editTempDir, err := edit(config{
+			idsPath:       idsPath,
+			encPath:       encPath,
+			tempDirPrefix: t.TempDir(),
+			yes:           true,
+
+			command: "sh",
+			args:    []string{"-c", `printf '%s\n' "$0" > "$1"`, text},
+
+			validateCmd:  "sh",
+			validateArgs: []string{"-c", `grep -q '^valid$' "$1" || { echo "$1: not valid"; exit 1; }`, "sh"},
+		})
+		if editTempDir != "" {
+			defer os.RemoveAll(editTempDir)
+		}
+
+		return err
+	}
+
+	if err := edit("valid"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = edit("broken")
+
+	var validationErr *validationError
+	if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), "config: not valid") {
+		t.Errorf("expected the validator to reject the changes with its output, got %v", err)
+	}
+
+	var plaintext bytes.Buffer
+
+	if err := decryptToWriter(encPath, &plaintext, "", []string{}, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	if plaintext.String() != "valid\n" {
+		t.Errorf("expected the encrypted file to keep the valid text, got %q", plaintext.String())
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// verifyFile checks that the identities can decrypt a file.
+// The whole payload is decrypted and discarded, so damage anywhere in the file is detected.
+func verifyFile(encPath string, identities ...age.Identity) error {
+	return decryptToWriter(encPath, io.Discard, "", []string{}, identities...)
+}
+
+// verifyCommand implements the "verify" subcommand.
+func verifyCommand(sub subcommand, args []string) int {
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultVerboseVal, err := defaultVerbose()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Check that the identities can decrypt a file without writing the plaintext anywhere. The exit status is 0 when the file decrypts, 1 when it doesn't, and 2 on bad usage.",
+		fmt.Sprintf(
+			"  identities              identities file path (%s%s)\n  encrypted               encrypted file path (%s%s)\n",
+			identitiesFileEnvVar,
+			identitiesFileHelpDefault,
+			encryptedFileEnvVar,
+			encryptedFileHelpDefault,
+		),
+	)
+
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	verbose := flag.BoolP(
+		"verbose",
+		"v",
+		defaultVerboseVal,
+		fmt.Sprintf("report which identity decrypted the file (%v)", verboseEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > cliMaxArgs {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	idsPath := identitiesFileDefault
+	encPath := encryptedFileDefault
+
+	//nolint:mnd
+	if flag.NArg() == 1 {
+		encPath = flag.Arg(0)
+	} else if flag.NArg() == 2 {
+		idsPath = flag.Arg(0)
+		encPath = flag.Arg(1)
+	}
+
+	if encPath == "" || (idsPath == "" && !agentAvailable()) {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file and an encrypted file")
+
+		return exitBadUsage
+	}
+
+	lockKeys := false
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			lockKeys = true
+		}
+	}
+
+	identities, _, err := openIdentities(idsPath, lockKeys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	identities = orderIdentities(identities, *prefer)
+
+	if err := verifyFile(encPath, identities...); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	if *verbose {
+		fmt.Fprintf(os.Stderr, "Decrypted with identity %s\n", matchedIdentity(identities))
+	}
+
+	return exitOK
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestVerifyFile(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "plain.age")
+
+	if err := os.WriteFile(plainPath, []byte("backed up\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyFile(encPath, identity); err != nil {
+		t.Errorf("verifyFile() returned %v", err)
+	}
+
+	if err := verifyFile(encPath, other); err == nil {
+		t.Error("verifyFile() accepted the wrong identity")
+	}
+
+	// Damage the authentication tag at the end of the payload.
+	ciphertext, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	if err := os.WriteFile(encPath, ciphertext, filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyFile(encPath, identity); err == nil {
+		t.Error("verifyFile() accepted a damaged file")
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/anmitsu/go-shlex"
+	"golang.org/x/term"
+)
+
+const (
+	pagerPrompt        = "--More--"
+	pagerDefaultHeight = 24
+)
+
+// view implements the view workflow:
+// decrypt the file to a read-only temporary file and show it in a pager.
+// Nothing is ever encrypted or saved, and the encrypted file isn't locked.
+// It returns the temporary directory path and any error encountered.
+// The caller is responsible for cleaning up the temporary directory.
+func view(cfg config) (string, error) {
+	identities, _, err := openIdentities(cfg.idsPath, cfg.lockKeys)
+	if err != nil {
+		return "", err
+	}
+
+	identities = orderIdentities(identities, cfg.prefer)
+
+	tempDir, err := newTempDir(cfg.tempDirPrefix)
+	if err != nil {
+		return tempDir, err
+	}
+
+	tempFile := filepath.Join(tempDir, plaintextName(cfg))
+
+	if err := decryptToFile(cfg.encPath, tempFile, cfg.decodeCmd, cfg.decodeArgs, identities...); err != nil {
+		return tempDir, err
+	}
+
+	if cfg.verbose {
+		fmt.Fprintln(os.Stderr, "Decrypted with identity", matchedIdentity(identities))
+	}
+
+	if err := os.Chmod(tempFile, fileReadOnlyPerm); err != nil {
+		return tempDir, err
+	}
+
+	return tempDir, showFile(cfg, tempFile)
+}
+
+// showFile opens a file in the pager command of the configuration
+// or in the built-in pager if there is no command.
+func showFile(cfg config, path string) error {
+	if cfg.command == "" {
+		return pageFile(path)
+	}
+
+	fullArgs := commandArgs(cfg.args, []string{path})
+
+	cmd := exec.CommandContext(context.Background(), cfg.command, fullArgs...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// pageFile is the built-in pager.
+// It shows a file one screen at a time when stdout is a terminal
+// and copies the file to stdout otherwise.
+// Press <Space> for the next screen, <Enter> for the next line, and "q" to quit.
+func pageFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	outFd := int(os.Stdout.Fd()) //nolint:gosec
+	if !term.IsTerminal(outFd) {
+		_, err := os.Stdout.Write(data)
+
+		return err
+	}
+
+	_, height, err := term.GetSize(outFd)
+	if err != nil || height < 2 {
+		height = pagerDefaultHeight
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	show := height - 1
+
+	for len(lines) > 0 {
+		n := min(show, len(lines))
+		fmt.Print(strings.Join(lines[:n], ""))
+		lines = lines[n:]
+
+		if len(lines) == 0 {
+			break
+		}
+
+		fmt.Print(pagerPrompt)
+
+		key, err := readKey()
+
+		fmt.Print("\r" + strings.Repeat(" ", len(pagerPrompt)) + "\r")
+
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case 'q', 'Q':
+			return nil
+
+		case '\r', '\n':
+			show = 1
+
+		default:
+			show = height - 1
+		}
+	}
+
+	return nil
+}
+
+// readKey reads a single key press from stdin.
+// When stdin is a terminal, it doesn't wait for <Enter>.
+func readKey() (byte, error) {
+	inFd := int(os.Stdin.Fd()) //nolint:gosec
+
+	if term.IsTerminal(inFd) {
+		state, err := term.MakeRaw(inFd)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read key: %w", err)
+		}
+
+		defer func() {
+			_ = term.Restore(inFd, state)
+		}()
+	}
+
+	b := make([]byte, 1)
+	if _, err := os.Stdin.Read(b); err != nil {
+		return 0, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	return b[0], nil
+}
+
+// viewCommand implements the "view" subcommand.
+func viewCommand(sub subcommand, args []string) int {
+	encryptedFileDefault, encryptedFileHelpDefault := defaultArg(encryptedFileEnvVar)
+	identitiesFileDefault, identitiesFileHelpDefault := defaultArg(identitiesFileEnvVar)
+
+	defaultMemlockVal, err := defaultMemlock()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	defaultVerboseVal, err := defaultVerbose()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitBadUsage
+	}
+
+	flag := sub.flagSet(
+		"Decrypt a file to a read-only temporary file and open it in a pager. Nothing is saved, and the encrypted file isn't locked. Without a pager command, a built-in pager is used: press <Space> for the next screen, <Enter> for the next line, and \"q\" to quit.",
+		fmt.Sprintf(
+			"  identities              identities file path (%s%s)\n  encrypted               encrypted file path (%s%s)\n",
+			identitiesFileEnvVar,
+			identitiesFileHelpDefault,
+			encryptedFileEnvVar,
+			encryptedFileHelpDefault,
+		),
+	)
+
+	decode := flag.String(
+		"decode",
+		defaultDecode(),
+		fmt.Sprintf("filter command after decryption, like a decompressor (%v)", decodeEnvVar),
+	)
+	noMemlock := flag.BoolP(
+		"no-memlock",
+		"M",
+		!defaultMemlockVal,
+		fmt.Sprintf("disable mlockall(2) that prevents swapping (negated %v)", memlockEnvVar),
+	)
+	pager := flag.StringP(
+		"pager",
+		"p",
+		defaultPager(),
+		fmt.Sprintf("pager command (default: built-in, %v)", strings.Join(pagerEnvVars, ", ")),
+	)
+	prefer := flag.StringSlice(
+		"prefer",
+		defaultPrefer(),
+		fmt.Sprintf("try identities with these labels or recipients first (%v)", preferEnvVar),
+	)
+	tempDirPrefix := flag.StringP(
+		"temp-dir",
+		"t",
+		defaultTempDirPrefix(),
+		fmt.Sprintf("temporary directory prefix (%v)", tempDirPrefixEnvVar),
+	)
+	verbose := flag.BoolP(
+		"verbose",
+		"v",
+		defaultVerboseVal,
+		fmt.Sprintf("report which identity decrypted the file and how memory is protected (%v)", verboseEnvVar),
+	)
+
+	if code, ok := parseSubcommandFlags(flag, args); !ok {
+		return code
+	}
+
+	if flag.NArg() > cliMaxArgs {
+		fmt.Fprintln(os.Stderr, "Error: too many arguments")
+
+		return exitBadUsage
+	}
+
+	cfg := config{
+		idsPath:       identitiesFileDefault,
+		encPath:       encryptedFileDefault,
+		otherPaths:    []string{},
+		tempDirPrefix: *tempDirPrefix,
+		trashDir:      "",
+		trashTTL:      0,
+		lockStrategy:  lockStrategyFlock,
+		lockExpiry:    0,
+		autosave:      0,
+		idleTimeout:   0,
+		history:       0,
+		historyMaxAge: 0,
+		historyStore:  historyStoreFile,
+		backups:       0,
+		maxShrink:     0,
+		minSize:       0,
+		template:      "",
+		gitMessage:    "",
+		plainName:     defaultPlainName(),
+		wait:          "",
+
+		allowEmpty:    false,
+		allowShrink:   false,
+		armor:         false,
+		autoFilter:    false,
+		chdir:         false,
+		confirmSave:   false,
+		force:         false,
+		fsync:         true,
+		gitCommit:     false,
+		inhibitSleep:  false,
+		keepFormat:    false,
+		keepTemp:      false,
+		lock:          false,
+		lockKeys:      false,
+		notify:        false,
+		openBinary:    false,
+		park:          false,
+		preserveMtime: false,
+		readOnly:      true,
+		stay:          false,
+		supervise:     false,
+		tty:           false,
+		verbose:       *verbose,
+		warnDroppings: false,
+		watch:         false,
+		yes:           false,
+
+		alsoSave: []string{},
+		prefer:   *prefer,
+
+		saveSignals:  []string{},
+		revertSignal: "",
+
+		command: "",
+		args:    []string{},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+
+		validateCmd:  "",
+		validateArgs: []string{},
+
+		compression: compressionOptions{level: 0, threads: 0, window: 0},
+
+		hooks: hookSet{},
+	}
+
+	//nolint:mnd
+	if flag.NArg() == 1 {
+		cfg.encPath = flag.Arg(0)
+	} else if flag.NArg() == 2 {
+		cfg.idsPath = flag.Arg(0)
+		cfg.encPath = flag.Arg(1)
+	}
+
+	if cfg.encPath == "" || (cfg.idsPath == "" && !agentAvailable()) {
+		fmt.Fprintln(os.Stderr, "Error: need an identities file and an encrypted file")
+
+		return exitBadUsage
+	}
+
+	if !*noMemlock {
+		if err := lockMemory(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; only the identities file will be locked in memory\n", err)
+
+			cfg.lockKeys = true
+		}
+	}
+
+	if cfg.verbose {
+		fmt.Fprintln(os.Stderr, "Memory protection:", memoryProtection(!*noMemlock, cfg.lockKeys))
+	}
+
+	if *pager != "" {
+		args, err := shlex.Split(*pager, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split pager command")
+
+			return exitBadUsage
+		}
+
+		cfg.command = args[0]
+		cfg.args = args[1:]
+	}
+
+	if *decode != "" {
+		args, err := shlex.Split(*decode, true)
+		if err != nil || len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split decode command")
+
+			return exitBadUsage
+		}
+
+		cfg.decodeCmd = args[0]
+		cfg.decodeArgs = args[1:]
+	}
+
+	if err := checkDependencies(pagerDependency(cfg.command), decodeDependency(cfg.decodeCmd)); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	tempDir, err := view(cfg)
+	if tempDir != "" {
+		defer removeTempDir(tempDir)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
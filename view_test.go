@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestView(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test pager is a shell script")
+	}
+
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idsPath := filepath.Join(tempDir, "ids")
+	plainPath := filepath.Join(tempDir, "plain")
+	encPath := filepath.Join(tempDir, "secret.txt.age")
+	outPath := filepath.Join(tempDir, "out")
+
+	if err := os.WriteFile(idsPath, []byte(identity.String()), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(plainPath, []byte("hello\n"), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := encryptToFile(plainPath, encPath, true, false, "", []string{}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		idsPath:       idsPath,
+		encPath:       encPath,
+		tempDirPrefix: tempDir,
+		trashDir:      "",
+		trashTTL:      0,
+		lockStrategy:  lockStrategyFlock,
+		lockExpiry:    0,
+		history:       0,
+		historyMaxAge: 0,
+		historyStore:  historyStoreFile,
+		template:      "",
+
+		allowEmpty:  false,
+		allowShrink: false,
+		armor:       false,
+		confirmSave: false,
+		force:       false,
+		lock:        false,
+		lockKeys:    false,
+		readOnly:    true,
+		verbose:     false,
+
+		prefer: []string{},
+
+		// The pager fails if the file isn't read-only or has the wrong name.
+		command: "sh",
+		args:    []string{"-c", `test "$(ls -l "$1" | cut -c 1-10)" = -r-------- && test "$(basename "$1")" = secret.txt && cat "$1" >` + outPath, "sh"},
+
+		decodeCmd:  "",
+		decodeArgs: []string{},
+		encodeCmd:  "",
+		encodeArgs: []string{},
+		diffCmd:    "",
+		diffArgs:   []string{},
+	}
+
+	viewTempDir, err := view(cfg)
+	if viewTempDir != "" {
+		defer os.RemoveAll(viewTempDir)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out) != "hello\n" {
+		t.Errorf("the pager got %q", out)
+	}
+
+	after, err := os.ReadFile(encPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(after) != string(before) {
+		t.Error("view changed the encrypted file")
+	}
+}
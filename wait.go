@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	waitFlags = "flags"
+	waitEnter = "enter"
+	waitOpen  = "open"
+	waitNone  = "none"
+
+	waitOpenInterval = 500 * time.Millisecond
+	// waitOpenGrace is how long to wait for a detached editor to open the files.
+	waitOpenGrace = 10 * time.Second
+
+	// editorExitGrace is how long an editor asked to exit has, like to write its own recovery files, before it is killed.
+	editorExitGrace    = 5 * time.Second
+	editorExitInterval = 50 * time.Millisecond
+)
+
+// editorWaitFlags has the flags that make GUI editors wait until the file is closed instead of returning at once.
+// The first flag is added; all of them are recognized in the arguments.
+var editorWaitFlags = map[string][]string{
+	"atom":          {"--wait", "-w"},
+	"bbedit":        {"--wait", "-w"},
+	"code":          {"--wait", "-w"},
+	"code-insiders": {"--wait", "-w"},
+	"codium":        {"--wait", "-w"},
+	"cursor":        {"--wait", "-w"},
+	"gedit":         {"--wait"},
+	"gvim":          {"--nofork", "-f"},
+	"kate":          {"--block", "-b"},
+	"mate":          {"--wait", "-w"},
+	"mvim":          {"--nofork", "-f"},
+	"open":          {"-W", "--wait-apps"},
+	"subl":          {"--wait", "-w"},
+	"windsurf":      {"--wait", "-w"},
+	"zed":           {"--wait", "-w"},
+}
+
+// editorWaitArgs adds the wait flag of a known GUI editor to its arguments unless they already have it.
+func editorWaitArgs(command string, args []string) []string {
+	name := strings.TrimSuffix(filepath.Base(command), ".exe")
+
+	flags, ok := editorWaitFlags[name]
+	if !ok || slices.ContainsFunc(args, func(arg string) bool { return slices.Contains(flags, arg) }) {
+		return args
+	}
+
+	return append([]string{flags[0]}, args...)
+}
+
+// waitForEditor waits after the editor command has exited for an editor that may still have the files open.
+// With "enter", the user presses <Enter> when done.
+// With "open", it waits for the files to be opened, if the editor hasn't yet, and then closed.
+func waitForEditor(strategy string, stdin *bufio.Reader, w io.Writer, paths []string) error {
+	switch strategy {
+	case waitEnter:
+		fmt.Fprint(w, "Press <Enter> when you have finished editing")
+
+		_, err := stdin.ReadString('\n')
+		fmt.Fprintln(w)
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		return err
+
+	case waitOpen:
+		absPaths := []string{}
+
+		for _, path := range paths {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+
+			absPaths = append(absPaths, absPath)
+		}
+
+		return waitUntilClosed(w, absPaths, time.Now().Add(waitOpenGrace))
+	}
+
+	return nil
+}
+
+// waitUntilClosed polls until no other process has the files open.
+// It gives up waiting for the files to be opened at the deadline.
+func waitUntilClosed(w io.Writer, paths []string, deadline time.Time) error {
+	seen := false
+
+	for {
+		inUse, err := filesInUse(paths)
+		if err != nil {
+			return err
+		}
+
+		if inUse && !seen {
+			fmt.Fprintln(w, "Waiting for the editor to close the file")
+		}
+
+		switch {
+		case inUse:
+			seen = true
+		case seen || time.Now().After(deadline):
+			return nil
+		}
+
+		time.Sleep(waitOpenInterval)
+	}
+}
+
+// closeEditor asks the running editor and its process group to exit and kills the editor if it is still running after the grace period.
+// The editor is running while the pointer isn't nil; whoever waits for it clears the pointer.
+func closeEditor(editor *atomic.Pointer[os.Process], grace time.Duration) {
+	p := editor.Load()
+	if p == nil {
+		return
+	}
+
+	if err := terminateProcessGroup(p); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: failed to close the editor:", err)
+	}
+
+	deadline := time.Now().Add(grace)
+	for editor.Load() == p && time.Now().Before(deadline) {
+		time.Sleep(editorExitInterval)
+	}
+
+	if editor.Load() == p {
+		_ = p.Kill()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditorWaitArgs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		command  string
+		args     []string
+		expected []string
+	}{
+		{"code", []string{}, []string{"--wait"}},
+		{"/usr/bin/subl", []string{"-n"}, []string{"--wait", "-n"}},
+		{"code", []string{"-w"}, []string{"-w"}},
+		{"kate", []string{"--block"}, []string{"--block"}},
+		{"zed.exe", []string{}, []string{"--wait"}},
+		{"vim", []string{"-n"}, []string{"-n"}},
+	}
+
+	for _, tt := range tests {
+		if result := editorWaitArgs(tt.command, tt.args); !slices.Equal(result, tt.expected) {
+			t.Errorf("editorWaitArgs(%q, %q) is %q, expected %q", tt.command, tt.args, result, tt.expected)
+		}
+	}
+}
+
+func TestWaitForEditorEnter(t *testing.T) {
+	t.Parallel()
+
+	stdin := bufio.NewReader(strings.NewReader("\nrest\n"))
+
+	if err := waitForEditor(waitEnter, stdin, io.Discard, []string{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only one line is read.
+	if rest, _ := stdin.ReadString('\n'); rest != "rest\n" {
+		t.Errorf("expected the rest of the input, got %q", rest)
+	}
+}
+
+func TestWaitUntilClosed(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("open files are only listed on Linux")
+	}
+
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte{}, filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file that isn't opened before the deadline isn't waited for.
+	if err := waitUntilClosed(io.Discard, []string{path}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process of age-edit doesn't count, so the file is opened by a child process.
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command("sleep", "1")
+	cmd.Stdin = f
+
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	if err := waitUntilClosed(io.Discard, []string{path}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = cmd.Wait()
+
+	if time.Since(start) < 500*time.Millisecond {
+		t.Error("didn't wait for the file to be closed")
+	}
+}
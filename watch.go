@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// watchDebounce is how long a file must stay unchanged after a write before it is saved.
+// Editors often write a file in several steps.
+const watchDebounce = 200 * time.Millisecond
+
+// saveOnWrite calls the save function shortly after the editor writes a file,
+// so saving in the editor saves the encrypted file.
+// It returns a function that stops watching.
+func saveOnWrite(path string, save func() error) (func(), error) {
+	events := make(chan struct{}, 1)
+
+	stopWatch, err := watchFile(path, events)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		timer := time.NewTimer(watchDebounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-done:
+				timer.Stop()
+
+				return
+
+			case <-events:
+				timer.Reset(watchDebounce)
+
+			case <-timer.C:
+				if err := save(); err != nil {
+					fmt.Fprintf(os.Stderr, "\r\007age-edit: saving failed: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		stopWatch()
+		close(done)
+	}, nil
+}
+
+// notify sends an event without blocking.
+// One pending event is enough to trigger a save.
+func notify(events chan<- struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchPollTimeout = 200 // Milliseconds.
+
+// watchFile sends an event when a file is written and closed or replaced by a rename.
+// It watches the directory of the file with inotify(7),
+// so editors that save by writing a new file and renaming it over the old one are noticed.
+// It returns a function that stops watching.
+func watchFile(path string, events chan<- struct{}) (func(), error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO); err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		buffer := make([]byte, 4096)                               //nolint:mnd
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}} //nolint:gosec
+
+		for {
+			select {
+			case <-done:
+				return
+
+			default:
+			}
+
+			n, err := unix.Poll(fds, watchPollTimeout)
+			if err != nil && !errors.Is(err, unix.EINTR) {
+				return
+			}
+
+			if n <= 0 {
+				continue
+			}
+
+			n, err = unix.Read(fd, buffer)
+			if err != nil {
+				continue
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset])) //nolint:gosec
+				start := offset + unix.SizeofInotifyEvent
+				end := min(n, start+int(event.Len))
+
+				if strings.TrimRight(string(buffer[start:end]), "\x00") == name {
+					notify(events)
+				}
+
+				offset = end
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+
+		_ = unix.Close(fd)
+	}, nil
+}
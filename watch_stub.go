@@ -0,0 +1,53 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+const watchPollInterval = 500 * time.Millisecond
+
+// watchFile sends an event when the modification time or the size of a file changes.
+// It polls the file on platforms without inotify(7).
+// The file doesn't have to exist yet.
+// It returns a function that stops watching.
+func watchFile(path string, events chan<- struct{}) (func(), error) {
+	modTime, size := time.Time{}, int64(-1)
+
+	if info, err := os.Stat(path); err == nil {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	done := make(chan struct{})
+
+	go func() {
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+
+			if !info.ModTime().Equal(modTime) || info.Size() != size {
+				modTime, size = info.ModTime(), info.Size()
+
+				notify(events)
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaveOnWrite(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "plain.txt")
+
+	var saves atomic.Int32
+
+	stop, err := saveOnWrite(path, func() error {
+		saves.Add(1)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// Other files in the directory don't count.
+	if err := os.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Save by writing a new file and renaming it, like some editors do.
+	newPath := filepath.Join(dir, "plain.txt.new")
+	if err := os.WriteFile(newPath, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(newPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for saves.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if saves.Load() == 0 {
+		t.Fatal("expected a save after the file was written")
+	}
+
+	// Wait past the debounce to see that one write means one save.
+	time.Sleep(3 * watchDebounce)
+
+	if n := saves.Load(); n != 1 {
+		t.Errorf("expected 1 save, got %d", n)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+const selfName = "age-edit"
+
+// refersToAgeEdit reports whether an editor setting runs age-edit itself.
+// It is how age-edit avoids calling itself when it is also $EDITOR.
+func refersToAgeEdit(value string) bool {
+	words, err := shlex.Split(value, true)
+	if err != nil || len(words) == 0 {
+		return false
+	}
+
+	if strings.TrimSuffix(filepath.Base(words[0]), ".exe") == selfName {
+		return true
+	}
+
+	path, err := exec.LookPath(words[0])
+	if err != nil {
+		return false
+	}
+
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return false
+	}
+
+	self, err = filepath.EvalSymlinks(self)
+	if err != nil {
+		return false
+	}
+
+	return path == self
+}
+
+// wrapPassthrough reports whether age-edit in wrapper mode should hand the arguments to the editor unchanged.
+// Programs that run $EDITOR pass the file to edit last,
+// so only a last argument with the suffix of an encrypted file is decrypted.
+func wrapPassthrough(args []string) bool {
+	return len(args) == 0 || !hasEncryptedSuffix(args[len(args)-1])
+}
+
+// runWrappedEditor runs the editor on files that aren't encrypted
+// and returns its exit status, as if the program that ran age-edit had run the editor.
+func runWrappedEditor(command, editor string, args []string) int {
+	name := editor
+	editorArgs := []string{}
+
+	if command != "" {
+		words, err := shlex.Split(command, true)
+		if err != nil || len(words) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: failed to split command")
+
+			return exitBadUsage
+		}
+
+		name = words[0]
+		editorArgs = words[1:]
+	}
+
+	if refersToAgeEdit(name) {
+		fmt.Fprintf(
+			os.Stderr,
+			"Error: the editor is age-edit itself; set %s to the real editor\n",
+			editorEnvVars[0],
+		)
+
+		return exitBadUsage
+	}
+
+	cmd := exec.CommandContext(context.Background(), name, append(editorArgs, args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRefersToAgeEdit(t *testing.T) {
+	t.Parallel()
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"age-edit", true},
+		{"age-edit --wrap", true},
+		{"/usr/local/bin/age-edit", true},
+		{"age-edit.exe", true},
+		{self, true},
+		{"vi", false},
+		{"code --wait", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := refersToAgeEdit(test.value); got != test.want {
+			t.Errorf("%q: expected %v, got %v", test.value, test.want, got)
+		}
+	}
+}
+
+func TestWrapPassthrough(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{}, true},
+		{[]string{".git/COMMIT_EDITMSG"}, true},
+		{[]string{"+10", "notes.txt"}, true},
+		{[]string{"secret.txt.age"}, false},
+		{[]string{"ids.txt", "secret.txt.age"}, false},
+	}
+
+	for _, test := range tests {
+		if got := wrapPassthrough(test.args); got != test.want {
+			t.Errorf("%q: expected %v, got %v", test.args, test.want, got)
+		}
+	}
+}
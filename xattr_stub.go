@@ -0,0 +1,8 @@
+//go:build !darwin && !freebsd && !linux && !netbsd
+
+package main
+
+// copyXattrs is a no-op on systems where age-edit doesn't support extended attributes.
+func copyXattrs(src, dst string) error {
+	return nil
+}
@@ -0,0 +1,83 @@
+//go:build darwin || freebsd || linux || netbsd
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrSkippable reports whether an extended attribute can't be read or written
+// for reasons that shouldn't stop a save,
+// like a filesystem without extended attributes or a protected namespace.
+func xattrSkippable(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) ||
+		errors.Is(err, unix.EOPNOTSUPP) ||
+		errors.Is(err, unix.EPERM) ||
+		errors.Is(err, unix.EACCES)
+}
+
+// xattrGet reads an extended attribute, growing the buffer as needed.
+func xattrGet(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, size)
+
+	n, err := unix.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value[:n], nil
+}
+
+// copyXattrs copies the extended attributes of src to dst.
+// On Linux, this includes POSIX ACLs and security labels.
+// Attributes that can't be copied, like a label only root can set, are skipped.
+func copyXattrs(src, dst string) error {
+	size, err := unix.Listxattr(src, nil)
+	if err != nil {
+		if xattrSkippable(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	list := make([]byte, size)
+
+	n, err := unix.Listxattr(src, list)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range strings.Split(string(list[:n]), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		value, err := xattrGet(src, name)
+		if err != nil {
+			if xattrSkippable(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if err := unix.Setxattr(dst, name, value, 0); err != nil && !xattrSkippable(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build darwin || freebsd || linux || netbsd
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWriteFileAtomicXattrs(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "secret.age")
+
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unix.Setxattr(path, "user.age-edit-test", []byte("kept"), 0); err != nil {
+		t.Skipf("the filesystem doesn't support extended attributes: %v", err)
+	}
+
+	err := writeFileAtomic(path, 0o600, false, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := xattrGet(path, "user.age-edit-test")
+	if err != nil {
+		t.Fatalf("the attribute wasn't copied: %v", err)
+	}
+
+	if string(value) != "kept" {
+		t.Errorf("expected %q, got %q", "kept", value)
+	}
+}